@@ -14,8 +14,11 @@ import (
 	"github.com/theruziev/oson_auth/internal/pkg/auth"
 	"github.com/theruziev/oson_auth/internal/pkg/closer"
 	"github.com/theruziev/oson_auth/internal/pkg/dbx"
+	"github.com/theruziev/oson_auth/internal/pkg/fieldcrypt"
 	"github.com/theruziev/oson_auth/internal/pkg/httpx"
+	"github.com/theruziev/oson_auth/internal/pkg/lockout"
 	"github.com/theruziev/oson_auth/internal/pkg/logging"
+	"github.com/theruziev/oson_auth/internal/pkg/passwordpolicy"
 	"github.com/theruziev/oson_auth/internal/pkg/rabbitmqx"
 	"github.com/theruziev/oson_auth/internal/pkg/validatorx"
 	"github.com/theruziev/oson_auth/internal/service"
@@ -39,12 +42,42 @@ type HTTPServer struct {
 
 	userService    *service.UserService
 	contentService *service.ContentService
-
-	userStore    *db.UserStore
-	outboxStore  *db.OutBoxStore
-	contentStore *db.ContentStore
-
-	userHandler *apphttp.UserHandler
+	oidcService    *service.OIDCService
+	tokenRevoker   *service.TokenRevoker
+	apiKeyService  *service.APIKeyService
+	auditService   *service.AuditService
+	adminService   *service.AdminService
+	orgService     *service.OrganizationService
+
+	userStore        *db.UserStore
+	outboxStore      *db.OutBoxStore
+	contentStore     *db.ContentStore
+	sessionStore     *db.SessionStore
+	revokedStore     *db.RevokedTokenStore
+	clientStore      *db.ClientStore
+	authCodeStore    *db.AuthorizationCodeStore
+	webAuthnStore    *db.WebAuthnStore
+	magicLinkStore   *db.MagicLinkStore
+	emailChangeStore *db.EmailChangeStore
+	apiKeyStore      *db.APIKeyStore
+	auditEventStore  *db.AuditEventStore
+	roleStore        *db.RoleStore
+	orgStore         *db.OrganizationStore
+	deviceStore      *db.TrustedDeviceStore
+	recoveryStore    *db.RecoveryCodeStore
+
+	loginAttempts lockout.Counter
+
+	userHandler      *apphttp.UserHandler
+	wellKnownHandler *apphttp.WellKnownHandler
+	oidcHandler      *apphttp.OIDCHandler
+	apiKeyHandler    *apphttp.APIKeyHandler
+	auditHandler     *apphttp.AuditHandler
+	adminHandler     *apphttp.AdminHandler
+	orgHandler       *apphttp.OrganizationHandler
+	contentHandler   *apphttp.ContentHandler
+
+	signer *auth.Signer
 
 	rabbitmqConn *rabbitmq.Conn
 
@@ -73,21 +106,106 @@ func (s *HTTPServer) initPostgres(ctx context.Context) error {
 }
 
 func (s *HTTPServer) InitStore(_ context.Context) error {
-	s.userStore = db.NewUserStore(s.dbxPool)
+	cipher, err := fieldcrypt.New(&s.opt.Auth.Encryption)
+	if err != nil {
+		return fmt.Errorf("failed to init encryption: %w", err)
+	}
+	s.userStore = db.NewUserStore(s.dbxPool, cipher)
 	s.outboxStore = db.NewOutBoxStore(s.dbxPool)
 	s.contentStore = db.NewContentStore(s.dbxPool)
+	s.sessionStore = db.NewSessionStore(s.dbxPool)
+	s.revokedStore = db.NewRevokedTokenStore(s.dbxPool)
+	s.clientStore = db.NewClientStore(s.dbxPool)
+	s.authCodeStore = db.NewAuthorizationCodeStore(s.dbxPool)
+	s.webAuthnStore = db.NewWebAuthnStore(s.dbxPool)
+	s.magicLinkStore = db.NewMagicLinkStore(s.dbxPool)
+	s.emailChangeStore = db.NewEmailChangeStore(s.dbxPool)
+	s.apiKeyStore = db.NewAPIKeyStore(s.dbxPool)
+	s.auditEventStore = db.NewAuditEventStore(s.dbxPool)
+	s.roleStore = db.NewRoleStore(s.dbxPool)
+	s.orgStore = db.NewOrganizationStore(s.dbxPool)
+	s.deviceStore = db.NewTrustedDeviceStore(s.dbxPool)
+	s.recoveryStore = db.NewRecoveryCodeStore(s.dbxPool)
+	if s.opt.Auth.Lockout.Backend == lockout.BackendMemory {
+		s.loginAttempts = lockout.NewMemoryCounter()
+	} else {
+		s.loginAttempts = db.NewLoginAttemptStore(s.dbxPool)
+	}
 	return nil
 }
 
 func (s *HTTPServer) initService(_ context.Context) error {
+	signer, err := auth.NewSigner(&s.opt.Auth)
+	if err != nil {
+		return err
+	}
+	s.signer = signer
 	otp := auth.NewOtpConfig(&s.opt.Auth.Otp)
-	s.userService = service.NewUserStore(&s.opt.Auth, s.outboxStore, s.userStore, otp)
-	s.contentService = service.NewContentService(s.contentStore, s.dbxPool)
+	hasher, err := auth.NewPasswordHasher(&s.opt.Auth.Password)
+	if err != nil {
+		return err
+	}
+	policy, err := passwordpolicy.New(&s.opt.Auth.PasswordPolicy)
+	if err != nil {
+		return err
+	}
+	var webAuthn *auth.WebAuthn
+	if s.opt.Auth.WebAuthn.Enabled {
+		webAuthn, err = auth.NewWebAuthn(&s.opt.Auth.WebAuthn)
+		if err != nil {
+			return err
+		}
+	}
+	s.auditService = service.NewAuditService(s.auditEventStore)
+	s.tokenRevoker = service.NewTokenRevoker(s.userStore, s.sessionStore, s.revokedStore, s.opt.Auth.RevocationCacheTTL)
+	s.userService = service.NewUserStore(
+		&s.opt.Auth,
+		s.outboxStore,
+		s.userStore,
+		s.sessionStore,
+		s.apiKeyStore,
+		s.roleStore,
+		s.tokenRevoker,
+		s.signer,
+		otp,
+		hasher,
+		policy,
+		s.webAuthnStore,
+		webAuthn,
+		s.magicLinkStore,
+		s.emailChangeStore,
+		s.orgStore,
+		s.deviceStore,
+		s.recoveryStore,
+		lockout.NewLimiter(&s.opt.Auth.Lockout, s.loginAttempts),
+		s.auditService,
+		s.dbxPool,
+	)
+	s.adminService = service.NewAdminService(s.userService, s.userStore, s.webAuthnStore, s.roleStore, s.outboxStore, s.auditService)
+	s.orgService = service.NewOrganizationService(
+		&s.opt.Auth,
+		s.orgStore,
+		s.userStore,
+		s.sessionStore,
+		s.outboxStore,
+		s.userService,
+		s.auditService,
+	)
+	s.apiKeyService = service.NewAPIKeyService(s.apiKeyStore, s.userStore)
+	s.contentService = service.NewContentService(s.contentStore, s.userStore, s.auditService, s.dbxPool)
+	s.oidcService = service.NewOIDCService(&s.opt.Auth.OIDC, s.userStore, s.clientStore, s.authCodeStore, s.userService, s.signer)
 	return nil
 }
 
 func (s *HTTPServer) initHandler(_ context.Context) error {
 	s.userHandler = apphttp.NewUserHandler(s.userService)
+	s.wellKnownHandler = apphttp.NewWellKnownHandler(s.signer, &s.opt.Auth.OIDC)
+	s.oidcHandler = apphttp.NewOIDCHandler(s.oidcService)
+	s.apiKeyHandler = apphttp.NewAPIKeyHandler(s.apiKeyService)
+	s.auditHandler = apphttp.NewAuditHandler(s.auditService)
+	s.adminHandler = apphttp.NewAdminHandler(s.adminService)
+	s.orgHandler = apphttp.NewOrganizationHandler(s.orgService)
+	s.contentHandler = apphttp.NewContentHandler(s.contentService)
 	return nil
 }
 
@@ -143,15 +261,18 @@ func (s *HTTPServer) Init(ctx context.Context) error {
 func (s *HTTPServer) initRouter(ctx context.Context) {
 	logger := logging.FromContext(ctx)
 	validator := validatorx.FromContext(ctx)
-	authMiddleware := auth.Middleware(s.opt.Auth.JWTSecret)
+	authMiddleware := auth.Middleware(s.signer, s.tokenRevoker, s.apiKeyService)
 	r := chi.NewRouter()
 	r.Use(httpx.Recoverer(logger))
 	r.Use(httpx.PopulateLogger(logger))
 	r.Use(httpx.PopulateValidator(validator))
+	r.Use(httpx.PopulateClientInfo(s.opt.Server.TrustProxyHeaders))
 
 	r.Get("/", func(w http.ResponseWriter, r *http.Request) {
 		httpx.JSONOKResponse(w)
 	})
+	r.Get("/.well-known/jwks.json", s.wellKnownHandler.JWKS)
+	r.Get("/.well-known/openid-configuration", s.wellKnownHandler.OpenIDConfiguration)
 
 	tfaCheckMiddleware := chi.Middlewares{
 		authMiddleware,
@@ -163,25 +284,129 @@ func (s *HTTPServer) initRouter(ctx context.Context) {
 		auth.CheckScope(auth.UserScope),
 	}
 
+	passwordChangeMiddleware := chi.Middlewares{
+		authMiddleware,
+		auth.CheckScope(auth.UserScope, auth.PasswordChangeScope),
+	}
+
+	// new credentials outlive the token, so they can't be added with a stolen one
+	recentAuthMiddleware := auth.RequireRecentAuth(s.opt.Auth.ReauthMaxAge)
+
+	r.Get("/authorize", s.oidcHandler.StartAuthorize)
+	r.With(userMiddleware...).Post("/authorize", s.oidcHandler.Authorize)
+	r.Post("/token", s.oidcHandler.Token)
+	r.With(authMiddleware, auth.CheckScope(auth.UserScope, auth.UserInfoScope)).Get("/userinfo", s.oidcHandler.UserInfo)
+
+	r.With(authMiddleware, auth.CheckScope(auth.UsersReadScope)).Get("/users/{pid}", s.userHandler.GetUser)
+	r.With(authMiddleware, auth.CheckScope(auth.AuditReadScope)).Get("/audit-events", s.auditHandler.List)
+
+	r.Route("/admin", func(r chi.Router) {
+		r.Use(userMiddleware...)
+		r.Group(func(r chi.Router) {
+			r.Use(auth.RequirePermission(auth.UsersManagePermission))
+			r.Get("/users", s.adminHandler.ListUsers)
+			r.Get("/users/{pid}", s.adminHandler.GetUser)
+			r.Post("/users/{pid}/activate", s.adminHandler.Activate)
+			r.Post("/users/{pid}/reset-password", s.adminHandler.ResetPassword)
+			r.Post("/users/{pid}/disable", s.adminHandler.Disable)
+			r.Post("/users/{pid}/enable", s.adminHandler.Enable)
+			r.Post("/users/{pid}/lock", s.adminHandler.Lock)
+			r.Post("/users/{pid}/reset-2fa", s.adminHandler.ResetTwoFA)
+			r.Post("/users/{pid}/revoke-sessions", s.adminHandler.RevokeSessions)
+		})
+		r.Group(func(r chi.Router) {
+			r.Use(auth.RequirePermission(auth.RolesManagePermission))
+			r.Get("/roles", s.adminHandler.ListRoles)
+			r.Put("/users/{pid}/roles/{role}", s.adminHandler.GrantRole)
+			r.Delete("/users/{pid}/roles/{role}", s.adminHandler.RevokeRole)
+		})
+		r.With(auth.RequirePermission(auth.AuditReadPermission)).Get("/audit-events", s.auditHandler.List)
+	})
+
+	r.Route("/moderation", func(r chi.Router) {
+		r.Use(userMiddleware...)
+		r.Use(auth.RequirePermission(auth.ContentModeratePermission))
+		r.Get("/contents", s.contentHandler.List)
+		r.Put("/contents/{id}/status", s.contentHandler.SetStatus)
+	})
+
+	r.Route("/orgs", func(r chi.Router) {
+		r.Use(userMiddleware...)
+		r.Get("/", s.orgHandler.List)
+		r.Post("/", s.orgHandler.Create)
+		r.Post("/{oid}/switch", s.orgHandler.Switch)
+	})
+
+	// the organization is the active one of the token
+	r.Route("/org", func(r chi.Router) {
+		r.Use(userMiddleware...)
+		r.Use(auth.RequireOrg())
+		r.Get("/", s.orgHandler.Current)
+		r.Get("/members", s.orgHandler.ListMembers)
+		r.Put("/members/{pid}", s.orgHandler.ChangeMemberRole)
+		r.Delete("/members/{pid}", s.orgHandler.RemoveMember)
+		r.Get("/invites", s.orgHandler.ListInvites)
+		r.Post("/invites", s.orgHandler.Invite)
+		r.Delete("/invites/{id}", s.orgHandler.RevokeInvite)
+	})
+
+	r.Route("/invites", func(r chi.Router) {
+		r.Get("/", s.orgHandler.GetInvite)
+		r.With(userMiddleware...).Post("/accept", s.orgHandler.AcceptInvite)
+		r.Post("/register", s.orgHandler.RegisterWithInvite)
+	})
+
 	r.Route("/user", func(r chi.Router) {
 		r.Post("/activate/{aid}", s.userHandler.Activate)
 		r.Post("/auth", s.userHandler.Auth)
 		r.With(tfaCheckMiddleware...).Post("/auth-2fa", s.userHandler.AuthTwoFA)
+		r.With(tfaCheckMiddleware...).Post("/auth-2fa/webauthn/begin", s.userHandler.BeginAuthTwoFAWebAuthn)
+		r.With(tfaCheckMiddleware...).Post("/auth-2fa/webauthn", s.userHandler.AuthTwoFAWebAuthn)
+		r.Post("/passkey/begin", s.userHandler.BeginPasskeyLogin)
+		r.Post("/magic-link", s.userHandler.MagicLinkRequest)
+		r.Post("/magic-link/redeem", s.userHandler.AuthMagicLink)
+		r.Post("/passkey", s.userHandler.AuthPasskey)
 		r.Post("/register", s.userHandler.Register)
+		r.Post("/token/refresh", s.userHandler.RefreshToken)
 
 		r.Get("/reset-password", s.userHandler.GetByResetPassword)
 		r.Post("/reset-password", s.userHandler.ResetPasswordRequest)
 		r.Put("/reset-password", s.userHandler.ResetPassword)
+		r.With(passwordChangeMiddleware...).Post("/change-password", s.userHandler.ChangePassword)
+		r.With(userMiddleware...).Post("/email-change", s.userHandler.RequestEmailChange)
+		r.Post("/email-change/confirm", s.userHandler.ConfirmEmailChange)
+		r.With(authMiddleware, auth.CheckScope(auth.UserScope, auth.ProfileReadScope)).Get("/me", s.userHandler.Me)
 		r.Group(func(r chi.Router) {
 			r.Use(userMiddleware...)
-			r.Get("/me", s.userHandler.Me)
-			r.Post("/change-password", s.userHandler.ChangePassword)
+			r.Delete("/me", s.userHandler.DeleteMe)
+			r.Get("/me/export", s.userHandler.ExportMe)
+			r.Get("/me/activity", s.auditHandler.MyActivity)
+			r.Get("/me/sessions", s.userHandler.ListSessions)
+			r.Delete("/me/sessions/{id}", s.userHandler.RevokeSession)
+			r.Get("/me/trusted-devices", s.userHandler.ListTrustedDevices)
+			r.Delete("/me/trusted-devices/{id}", s.userHandler.RevokeTrustedDevice)
+			r.Post("/logout", s.userHandler.Logout)
+			r.Post("/logout-all", s.userHandler.LogoutAll)
 		})
 		r.Route("/otp", func(r chi.Router) {
 			r.Use(userMiddleware...)
-			r.Post("/step1", s.userHandler.RequestEnableOTPStep1)
-			r.Post("/step2", s.userHandler.RequestEnableOTPStep2)
+			r.With(recentAuthMiddleware).Post("/step1", s.userHandler.RequestEnableOTPStep1)
+			r.With(recentAuthMiddleware).Post("/step2", s.userHandler.RequestEnableOTPStep2)
 			r.Post("/disable", s.userHandler.DisableOTP)
+			r.Post("/recovery-codes/regenerate", s.userHandler.RegenerateRecoveryCodes)
+		})
+		r.Route("/api-keys", func(r chi.Router) {
+			r.Use(userMiddleware...)
+			r.Get("/", s.apiKeyHandler.List)
+			r.With(recentAuthMiddleware).Post("/", s.apiKeyHandler.Create)
+			r.Delete("/{id}", s.apiKeyHandler.Revoke)
+		})
+		r.Route("/webauthn", func(r chi.Router) {
+			r.Use(userMiddleware...)
+			r.With(recentAuthMiddleware).Post("/register/begin", s.userHandler.BeginWebAuthnRegistration)
+			r.With(recentAuthMiddleware).Post("/register", s.userHandler.FinishWebAuthnRegistration)
+			r.Get("/credentials", s.userHandler.ListWebAuthnCredentials)
+			r.Delete("/credentials/{id}", s.userHandler.DeleteWebAuthnCredential)
 		})
 	})
 
@@ -106,6 +106,70 @@ func (a *UserEmailApp) Run(ctx context.Context) error {
 		consumerResetPassword.Close()
 		return nil
 	})
+	consumerMagicLink, err := rabbitmq.NewConsumer(
+		a.rabbitmqConn,
+		a.userEmailConsumer.MagicLinkEmail(ctx),
+		constants.QueueMagicLinkEmail,
+		rabbitmqx.DefaultWithConsumerOptions(ctx,
+			constants.ExchangeUser,
+			constants.TopicUserMagicLink,
+		)...,
+	)
+	if err != nil {
+		return err
+	}
+	a.closer.AddCloser(func(ctx context.Context) error {
+		consumerMagicLink.Close()
+		return nil
+	})
+	consumerEmailChange, err := rabbitmq.NewConsumer(
+		a.rabbitmqConn,
+		a.userEmailConsumer.EmailChangeEmail(ctx),
+		constants.QueueEmailChangeEmail,
+		rabbitmqx.DefaultWithConsumerOptions(ctx,
+			constants.ExchangeUser,
+			constants.TopicUserEmailChange,
+		)...,
+	)
+	if err != nil {
+		return err
+	}
+	a.closer.AddCloser(func(ctx context.Context) error {
+		consumerEmailChange.Close()
+		return nil
+	})
+	consumerEmailChanging, err := rabbitmq.NewConsumer(
+		a.rabbitmqConn,
+		a.userEmailConsumer.EmailChangingEmail(ctx),
+		constants.QueueEmailChangingEmail,
+		rabbitmqx.DefaultWithConsumerOptions(ctx,
+			constants.ExchangeUser,
+			constants.TopicUserEmailChanging,
+		)...,
+	)
+	if err != nil {
+		return err
+	}
+	a.closer.AddCloser(func(ctx context.Context) error {
+		consumerEmailChanging.Close()
+		return nil
+	})
+	consumerOrgInvite, err := rabbitmq.NewConsumer(
+		a.rabbitmqConn,
+		a.userEmailConsumer.OrgInviteEmail(ctx),
+		constants.QueueOrgInviteEmail,
+		rabbitmqx.DefaultWithConsumerOptions(ctx,
+			constants.ExchangeUser,
+			constants.TopicOrganizationInvite,
+		)...,
+	)
+	if err != nil {
+		return err
+	}
+	a.closer.AddCloser(func(ctx context.Context) error {
+		consumerOrgInvite.Close()
+		return nil
+	})
 
 	<-ctx.Done()
 	closeCtx, cancel := context.WithTimeout(context.Background(), closeTimeout)
@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/theruziev/oson_auth/internal/db"
+	"github.com/theruziev/oson_auth/internal/model"
+	"github.com/theruziev/oson_auth/internal/pkg/dbx"
+	"github.com/theruziev/oson_auth/internal/service"
+)
+
+type client struct {
+	Create       clientCreate       `cmd:"" help:"Register an OAuth client"`
+	RotateSecret clientRotateSecret `cmd:"" help:"Issue a new secret for an OAuth client"`
+}
+
+type clientCreate struct {
+	PostgresOpts dbx.PostgresOpt `embed:"" prefix:"postgres." envprefix:"POSTGRES_" validate:"required,dive,required"`
+
+	Name         string   `help:"Human readable client name" required:""`
+	ClientID     string   `help:"Client id, generated when empty"`
+	Public       bool     `help:"Public client without a secret, e.g. a mobile or single page app"`
+	RedirectURIs []string `help:"Allowed redirect uri" name:"redirect-uri"`
+	GrantTypes   []string `help:"Allowed grant type" name:"grant-type" default:"authorization_code,refresh_token"`
+	Scopes       []string `help:"Scope that can be requested with the client credentials grant" name:"scope"`
+}
+
+func (c *clientCreate) Run(_ *Ctx) error {
+	ctx := context.Background()
+	clientService, closeDB, err := newClientService(ctx, c.PostgresOpts)
+	if err != nil {
+		return err
+	}
+	defer closeDB()
+
+	cl, secret, err := clientService.Create(ctx, &model.CreateClientRequest{
+		ClientID:     c.ClientID,
+		Name:         c.Name,
+		IsPublic:     c.Public,
+		RedirectURIs: c.RedirectURIs,
+		GrantTypes:   c.GrantTypes,
+		Scopes:       c.Scopes,
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("client_id: %s\n", cl.ClientID)
+	fmt.Printf("grant_types: %s\n", strings.Join(cl.GrantTypes, " "))
+	if secret != "" {
+		fmt.Printf("client_secret: %s\n", secret)
+		fmt.Println("the secret is shown only once, store it now")
+	}
+	return nil
+}
+
+type clientRotateSecret struct {
+	PostgresOpts dbx.PostgresOpt `embed:"" prefix:"postgres." envprefix:"POSTGRES_" validate:"required,dive,required"`
+
+	ClientID string `arg:"" help:"Client id"`
+}
+
+func (c *clientRotateSecret) Run(_ *Ctx) error {
+	ctx := context.Background()
+	clientService, closeDB, err := newClientService(ctx, c.PostgresOpts)
+	if err != nil {
+		return err
+	}
+	defer closeDB()
+
+	secret, err := clientService.RotateSecret(ctx, c.ClientID)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("client_secret: %s\n", secret)
+	fmt.Println("the secret is shown only once, store it now")
+	return nil
+}
+
+func newClientService(ctx context.Context, opt dbx.PostgresOpt) (*service.ClientService, func(), error) {
+	dbxPool := dbx.NewDbx()
+	if err := dbxPool.Connect(ctx, opt.DSN); err != nil {
+		return nil, nil, err
+	}
+	closeDB := func() {
+		_ = dbxPool.Close(ctx)
+	}
+	return service.NewClientService(db.NewClientStore(dbxPool)), closeDB, nil
+}
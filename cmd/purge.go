@@ -0,0 +1,45 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/theruziev/oson_auth/internal/db"
+	"github.com/theruziev/oson_auth/internal/pkg/dbx"
+	"github.com/theruziev/oson_auth/internal/pkg/fieldcrypt"
+	"github.com/theruziev/oson_auth/internal/pkg/lockout"
+	"github.com/theruziev/oson_auth/internal/service"
+)
+
+// purge is meant to be run periodically, e.g. from cron, it is safe to run it again after a failure.
+type purge struct {
+	PostgresOpts   dbx.PostgresOpt   `embed:"" prefix:"postgres." envprefix:"POSTGRES_" validate:"required,dive,required"`
+	EncryptionOpts fieldcrypt.Option `embed:"" prefix:"encryption." envprefix:"AUTH_ENCRYPTION_"`
+
+	GracePeriod time.Duration `help:"how long a deleted account is kept before it is purged" env:"AUTH_DELETION_GRACE_PERIOD" default:"720h"`
+}
+
+func (c *purge) Run(_ *Ctx) error {
+	cipher, err := fieldcrypt.New(&c.EncryptionOpts)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	dbxPool := dbx.NewDbx()
+	if err := dbxPool.Connect(ctx, c.PostgresOpts.DSN); err != nil {
+		return err
+	}
+	defer func() {
+		_ = dbxPool.Close(ctx)
+	}()
+
+	limiter := lockout.NewLimiter(&lockout.Option{}, db.NewLoginAttemptStore(dbxPool))
+	purged, err := service.PurgeDeletedAccounts(ctx, db.NewUserStore(dbxPool, cipher), limiter, time.Now().Add(-c.GracePeriod))
+	if err != nil {
+		return fmt.Errorf("purged %d accounts before failing: %w", purged, err)
+	}
+
+	fmt.Printf("purged %d accounts\n", purged)
+	return nil
+}
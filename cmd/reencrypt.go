@@ -0,0 +1,44 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/theruziev/oson_auth/internal/db"
+	"github.com/theruziev/oson_auth/internal/pkg/dbx"
+	"github.com/theruziev/oson_auth/internal/pkg/fieldcrypt"
+	"github.com/theruziev/oson_auth/internal/service"
+)
+
+// reencrypt is run after a new primary key is added next to the old one, once it is done the old key
+// can be removed. The servers must know the new key before it starts.
+type reencrypt struct {
+	PostgresOpts   dbx.PostgresOpt   `embed:"" prefix:"postgres." envprefix:"POSTGRES_" validate:"required,dive,required"`
+	EncryptionOpts fieldcrypt.Option `embed:"" prefix:"encryption." envprefix:"AUTH_ENCRYPTION_"`
+}
+
+func (c *reencrypt) Run(_ *Ctx) error {
+	cipher, err := fieldcrypt.New(&c.EncryptionOpts)
+	if err != nil {
+		return err
+	}
+	if _, ok := cipher.(fieldcrypt.Plaintext); ok {
+		return fmt.Errorf("no encryption keys are configured")
+	}
+	ctx := context.Background()
+	dbxPool := dbx.NewDbx()
+	if err := dbxPool.Connect(ctx, c.PostgresOpts.DSN); err != nil {
+		return err
+	}
+	defer func() {
+		_ = dbxPool.Close(ctx)
+	}()
+
+	reencrypted, err := service.ReencryptOtpSecrets(ctx, db.NewUserStore(dbxPool, cipher))
+	if err != nil {
+		return fmt.Errorf("re-encrypted %d otp secrets before failing: %w", reencrypted, err)
+	}
+
+	fmt.Printf("re-encrypted %d otp secrets\n", reencrypted)
+	return nil
+}
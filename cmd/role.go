@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/theruziev/oson_auth/internal/db"
+	"github.com/theruziev/oson_auth/internal/pkg/dbx"
+	"github.com/theruziev/oson_auth/internal/pkg/fieldcrypt"
+)
+
+// role bootstraps the first admin, later roles are managed through the admin api.
+// The change takes effect on the next refresh of the token of the user.
+type role struct {
+	PostgresOpts   dbx.PostgresOpt   `embed:"" prefix:"postgres." envprefix:"POSTGRES_" validate:"required,dive,required"`
+	EncryptionOpts fieldcrypt.Option `embed:"" prefix:"encryption." envprefix:"AUTH_ENCRYPTION_"`
+
+	Email  string `help:"Email of the account" required:""`
+	Role   string `help:"Name of the role" default:"admin"`
+	Revoke bool   `help:"Revoke the role instead of granting it"`
+}
+
+func (c *role) Run(_ *Ctx) error {
+	cipher, err := fieldcrypt.New(&c.EncryptionOpts)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	dbxPool := dbx.NewDbx()
+	if err := dbxPool.Connect(ctx, c.PostgresOpts.DSN); err != nil {
+		return err
+	}
+	defer func() {
+		_ = dbxPool.Close(ctx)
+	}()
+
+	user, err := db.NewUserStore(dbxPool, cipher).GetByEmail(ctx, c.Email)
+	if err != nil {
+		return fmt.Errorf("failed to find the user: %w", err)
+	}
+	roleStore := db.NewRoleStore(dbxPool)
+	r, err := roleStore.GetByName(ctx, c.Role)
+	if err != nil {
+		return fmt.Errorf("failed to find the role: %w", err)
+	}
+
+	if c.Revoke {
+		found, err := roleStore.Unassign(ctx, user.ID, r.ID)
+		if err != nil {
+			return err
+		}
+		if !found {
+			return fmt.Errorf("the user doesn't have the role %s", r.Name)
+		}
+		fmt.Printf("role %s revoked\n", r.Name)
+		return nil
+	}
+	if err := roleStore.Assign(ctx, user.ID, r.ID); err != nil {
+		return err
+	}
+	fmt.Printf("role %s granted\n", r.Name)
+	return nil
+}
@@ -18,6 +18,11 @@ var Root struct {
 
 	Httpserver httpserver `cmd:""`
 	UserEmail  userEmail  `cmd:""`
+	Client     client     `cmd:"" help:"Manage OAuth clients"`
+	Unlock     unlock     `cmd:"" help:"Clear failed login attempts of an account or a client ip"`
+	Purge      purge      `cmd:"" help:"Erase accounts deleted longer than the grace period ago"`
+	Role       role       `cmd:"" help:"Grant or revoke a role of an account"`
+	Reencrypt  reencrypt  `cmd:"" help:"Re-encrypt the stored otp secrets under the primary encryption key"`
 }
 
 func Init() {
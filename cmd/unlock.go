@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/theruziev/oson_auth/internal/db"
+	"github.com/theruziev/oson_auth/internal/pkg/dbx"
+	"github.com/theruziev/oson_auth/internal/pkg/fieldcrypt"
+	"github.com/theruziev/oson_auth/internal/pkg/lockout"
+	"github.com/theruziev/oson_auth/internal/service"
+)
+
+// unlock works with the postgres counters only, the memory ones live in the server process.
+type unlock struct {
+	PostgresOpts   dbx.PostgresOpt   `embed:"" prefix:"postgres." envprefix:"POSTGRES_" validate:"required,dive,required"`
+	EncryptionOpts fieldcrypt.Option `embed:"" prefix:"encryption." envprefix:"AUTH_ENCRYPTION_"`
+
+	Email string `help:"Email of the locked account"`
+	IP    string `help:"Throttled client ip"`
+}
+
+func (c *unlock) Run(_ *Ctx) error {
+	if c.Email == "" && c.IP == "" {
+		return fmt.Errorf("--email or --ip is required")
+	}
+	cipher, err := fieldcrypt.New(&c.EncryptionOpts)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	dbxPool := dbx.NewDbx()
+	if err := dbxPool.Connect(ctx, c.PostgresOpts.DSN); err != nil {
+		return err
+	}
+	defer func() {
+		_ = dbxPool.Close(ctx)
+	}()
+
+	// resetting a counter does not depend on the limits
+	limiter := lockout.NewLimiter(&lockout.Option{}, db.NewLoginAttemptStore(dbxPool))
+	if c.Email != "" {
+		if err := service.UnlockAccount(ctx, db.NewUserStore(dbxPool, cipher), limiter, c.Email); err != nil {
+			return err
+		}
+	}
+	if err := limiter.Reset(ctx, lockout.IP(c.IP)); err != nil {
+		return err
+	}
+
+	fmt.Println("unlocked")
+	return nil
+}
@@ -1,6 +1,9 @@
 package message
 
 import (
+	"strings"
+	"time"
+
 	"github.com/theruziev/oson_auth/internal/model"
 	v0 "github.com/theruziev/oson_auth/pkg/events/v0"
 )
@@ -12,15 +15,23 @@ func ToUserEvent(user *model.User) *v0.UserEvent {
 		userStatus = v0.UserStatusActivate
 	case model.UserStatusRegistered:
 		userStatus = v0.UserStatusRegistered
+	case model.UserStatusDeleted:
+		userStatus = v0.UserStatusDeleted
+	case model.UserStatusSuspended:
+		userStatus = v0.UserStatusSuspended
+	case model.UserStatusLocked:
+		userStatus = v0.UserStatusLocked
 	}
 	return &v0.UserEvent{
-		PublicID:  user.PublicID,
-		Email:     user.Email,
-		FirstName: user.FirstName,
-		LastName:  user.LastName,
-		Status:    userStatus,
-		CreatedAt: user.CreatedAt,
-		UpdatedAt: user.UpdatedAt,
+		PublicID:        user.PublicID,
+		Email:           user.Email,
+		FirstName:       user.FirstName,
+		LastName:        user.LastName,
+		Status:          userStatus,
+		StatusReason:    user.StatusReason,
+		StatusChangedAt: user.StatusChangedAt,
+		CreatedAt:       user.CreatedAt,
+		UpdatedAt:       user.UpdatedAt,
 	}
 }
 
@@ -39,3 +50,82 @@ func ToUserResetPasswordEvent(user *model.User, newResetCode string) *v0.UserRes
 		ResetPasswordCode: newResetCode,
 	}
 }
+
+func ToUserMagicLinkEvent(user *model.User, token string, expiresAt time.Time) *v0.UserMagicLinkEvent {
+	return &v0.UserMagicLinkEvent{
+		PublicID:  user.PublicID,
+		Email:     user.Email,
+		Token:     token,
+		ExpiresAt: expiresAt,
+	}
+}
+
+func ToUserEmailChangeEvent(user *model.User, change *model.EmailChange, token string) *v0.UserEmailChangeEvent {
+	return &v0.UserEmailChangeEvent{
+		PublicID:  user.PublicID,
+		Email:     change.NewEmail,
+		Token:     token,
+		ExpiresAt: change.ExpiresAt,
+	}
+}
+
+func ToUserEmailChangingEvent(user *model.User, change *model.EmailChange) *v0.UserEmailChangingEvent {
+	return &v0.UserEmailChangingEvent{
+		PublicID: user.PublicID,
+		Email:    user.Email,
+		NewEmail: change.NewEmail,
+	}
+}
+
+func ToUserDeletedEvent(user *model.User, purgeAt time.Time) *v0.UserDeletedEvent {
+	return &v0.UserDeletedEvent{
+		PublicID:  user.PublicID,
+		DeletedAt: *user.DeletedAt,
+		PurgeAt:   purgeAt,
+	}
+}
+
+func ToUserAdminActionEvent(user *model.User, action v0.AdminAction, actorPublicID string) *v0.UserAdminActionEvent {
+	return &v0.UserAdminActionEvent{
+		PublicID:      user.PublicID,
+		Action:        action,
+		ActorPublicID: actorPublicID,
+		CreatedAt:     time.Now(),
+	}
+}
+
+func ToOrganizationEvent(org *model.Organization) *v0.OrganizationEvent {
+	return &v0.OrganizationEvent{
+		PublicID:  org.PublicID,
+		Name:      org.Name,
+		CreatedAt: org.CreatedAt,
+		UpdatedAt: org.UpdatedAt,
+	}
+}
+
+func ToMembershipEvent(org *model.Organization, userPublicID string, role model.OrgRole, removed bool) *v0.MembershipEvent {
+	return &v0.MembershipEvent{
+		OrganizationID: org.PublicID,
+		UserPublicID:   userPublicID,
+		Role:           string(role),
+		Removed:        removed,
+		UpdatedAt:      time.Now(),
+	}
+}
+
+func ToOrganizationInviteEvent(
+	org *model.Organization,
+	invite *model.OrganizationInvite,
+	inviter *model.User,
+	token string,
+) *v0.OrganizationInviteEvent {
+	return &v0.OrganizationInviteEvent{
+		OrganizationID:   org.PublicID,
+		OrganizationName: org.Name,
+		Email:            invite.Email,
+		Role:             string(invite.Role),
+		InviterName:      strings.TrimSpace(inviter.FirstName + " " + inviter.LastName),
+		Token:            token,
+		ExpiresAt:        invite.ExpiresAt,
+	}
+}
@@ -0,0 +1,124 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/georgysavva/scany/v2/pgxscan"
+	"github.com/theruziev/oson_auth/internal/model"
+	"github.com/theruziev/oson_auth/internal/pkg/dbx"
+)
+
+const apiKeysTable = "api_keys"
+
+var defaultAPIKeyFields = []string{
+	"id",
+	"public_id",
+	"user_id",
+	"name",
+	"token_hash",
+	"prefix",
+	"scopes",
+	"expires_at",
+	"last_used_at",
+	"revoked_at",
+	"created_at",
+}
+
+type APIKeyStore struct {
+	db dbx.Querier
+}
+
+func NewAPIKeyStore(db dbx.Querier) *APIKeyStore {
+	return &APIKeyStore{
+		db: db,
+	}
+}
+
+func (s *APIKeyStore) Insert(ctx context.Context, key *model.APIKey) error {
+	builder := pgsql.Insert(apiKeysTable).SetMap(map[string]interface{}{
+		"public_id":  key.PublicID,
+		"user_id":    key.UserID,
+		"name":       key.Name,
+		"token_hash": key.TokenHash,
+		"prefix":     key.Prefix,
+		"scopes":     key.Scopes,
+		"expires_at": key.ExpiresAt,
+		"created_at": key.CreatedAt,
+	}).Suffix("returning id")
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return err
+	}
+
+	return pgxscan.Get(ctx, dbx.GetConnOrTx(ctx, s.db), key, query, args...)
+}
+
+func (s *APIKeyStore) GetByHash(ctx context.Context, tokenHash string) (*model.APIKey, error) {
+	builder := pgsql.Select(
+		defaultAPIKeyFields...,
+	).From(apiKeysTable).Where(squirrel.Eq{"token_hash": tokenHash})
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return nil, err
+	}
+	var key model.APIKey
+	if err := pgxscan.Get(ctx, dbx.GetConnOrTx(ctx, s.db), &key, query, args...); err != nil {
+		return nil, err
+	}
+
+	return &key, nil
+}
+
+// ListByUser returns the keys of the user that have not been revoked.
+func (s *APIKeyStore) ListByUser(ctx context.Context, userID uint64) ([]*model.APIKey, error) {
+	builder := pgsql.Select(
+		defaultAPIKeyFields...,
+	).From(apiKeysTable).Where(squirrel.Eq{"user_id": userID, "revoked_at": nil}).OrderBy("id")
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]*model.APIKey, 0)
+	if err := pgxscan.Select(ctx, dbx.GetConnOrTx(ctx, s.db), &keys, query, args...); err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+func (s *APIKeyStore) Touch(ctx context.Context, id uint64, lastUsedAt time.Time) error {
+	builder := pgsql.Update(apiKeysTable).SetMap(map[string]interface{}{
+		"last_used_at": lastUsedAt,
+	}).Where(squirrel.Eq{"id": id})
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return err
+	}
+
+	_, err = dbx.GetConnOrTx(ctx, s.db).Exec(ctx, query, args...)
+	return err
+}
+
+// Revoke revokes the key of the user, it returns false when the user has no such active key.
+func (s *APIKeyStore) Revoke(ctx context.Context, userID uint64, publicID string) (bool, error) {
+	builder := pgsql.Update(apiKeysTable).SetMap(map[string]interface{}{
+		"revoked_at": time.Now(),
+	}).Where(squirrel.Eq{"user_id": userID, "public_id": publicID, "revoked_at": nil})
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return false, err
+	}
+
+	conn, err := dbx.GetConnOrTx(ctx, s.db).Exec(ctx, query, args...)
+	if err != nil {
+		return false, err
+	}
+	return conn.RowsAffected() == 1, nil
+}
@@ -0,0 +1,93 @@
+package db
+
+import (
+	"context"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/georgysavva/scany/v2/pgxscan"
+	"github.com/theruziev/oson_auth/internal/model"
+	"github.com/theruziev/oson_auth/internal/pkg/dbx"
+)
+
+const auditEventsTable = "audit_events"
+
+var defaultAuditEventFields = []string{
+	"audit_events.id",
+	"audit_events.user_id",
+	"coalesce(users.public_id::text, '') as user_public_id",
+	"audit_events.type",
+	"audit_events.ip",
+	"audit_events.user_agent",
+	"audit_events.request_id",
+	"audit_events.metadata",
+	"audit_events.created_at",
+}
+
+// AuditEventStore is append-only, events are only deleted along with their user.
+type AuditEventStore struct {
+	db dbx.Querier
+}
+
+func NewAuditEventStore(db dbx.Querier) *AuditEventStore {
+	return &AuditEventStore{
+		db: db,
+	}
+}
+
+func (s *AuditEventStore) Insert(ctx context.Context, event *model.AuditEvent) error {
+	builder := pgsql.Insert(auditEventsTable).SetMap(map[string]interface{}{
+		"user_id":    event.UserID,
+		"type":       event.Type,
+		"ip":         event.IP,
+		"user_agent": event.UserAgent,
+		"request_id": event.RequestID,
+		"metadata":   event.Metadata,
+		"created_at": event.CreatedAt,
+	}).Suffix("returning id")
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return err
+	}
+
+	return pgxscan.Get(ctx, dbx.GetConnOrTx(ctx, s.db), event, query, args...)
+}
+
+func (s *AuditEventStore) List(ctx context.Context, filter *model.AuditEventFilter) ([]*model.AuditEvent, error) {
+	builder := pgsql.Select(
+		defaultAuditEventFields...,
+	).From(auditEventsTable).
+		LeftJoin(usersTable + " on users.id = audit_events.user_id").
+		OrderBy("audit_events.id desc").
+		Limit(filter.Limit)
+
+	if filter.UserPublicID != "" {
+		builder = builder.Where(squirrel.Eq{"users.public_id": filter.UserPublicID})
+	}
+	if len(filter.Types) > 0 {
+		builder = builder.Where(squirrel.Eq{"audit_events.type": filter.Types})
+	}
+	if filter.IP != "" {
+		builder = builder.Where(squirrel.Eq{"audit_events.ip": filter.IP})
+	}
+	if filter.From != nil {
+		builder = builder.Where(squirrel.GtOrEq{"audit_events.created_at": *filter.From})
+	}
+	if filter.To != nil {
+		builder = builder.Where(squirrel.Lt{"audit_events.created_at": *filter.To})
+	}
+	if filter.BeforeID != 0 {
+		builder = builder.Where(squirrel.Lt{"audit_events.id": filter.BeforeID})
+	}
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return nil, err
+	}
+	events := make([]*model.AuditEvent, 0)
+	if err := pgxscan.Select(ctx, dbx.GetConnOrTx(ctx, s.db), &events, query, args...); err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
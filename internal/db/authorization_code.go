@@ -0,0 +1,113 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/georgysavva/scany/v2/pgxscan"
+	"github.com/theruziev/oson_auth/internal/model"
+	"github.com/theruziev/oson_auth/internal/pkg/dbx"
+)
+
+const authorizationCodesTable = "authorization_codes"
+
+var defaultAuthorizationCodeFields = []string{
+	"id",
+	"code_hash",
+	"client_id",
+	"user_id",
+	"redirect_uri",
+	"scope",
+	"nonce",
+	"code_challenge",
+	"code_challenge_method",
+	"auth_time",
+	"session_id",
+	"expires_at",
+	"used_at",
+	"created_at",
+}
+
+type AuthorizationCodeStore struct {
+	db dbx.Querier
+}
+
+func NewAuthorizationCodeStore(db dbx.Querier) *AuthorizationCodeStore {
+	return &AuthorizationCodeStore{
+		db: db,
+	}
+}
+
+func (s *AuthorizationCodeStore) Insert(ctx context.Context, code *model.AuthorizationCode) error {
+	builder := pgsql.Insert(authorizationCodesTable).SetMap(map[string]interface{}{
+		"code_hash":             code.CodeHash,
+		"client_id":             code.ClientID,
+		"user_id":               code.UserID,
+		"redirect_uri":          code.RedirectURI,
+		"scope":                 code.Scope,
+		"nonce":                 code.Nonce,
+		"code_challenge":        code.CodeChallenge,
+		"code_challenge_method": code.CodeChallengeMethod,
+		"auth_time":             code.AuthTime,
+		"expires_at":            code.ExpiresAt,
+		"created_at":            code.CreatedAt,
+	}).Suffix("returning id")
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return err
+	}
+
+	return pgxscan.Get(ctx, dbx.GetConnOrTx(ctx, s.db), code, query, args...)
+}
+
+func (s *AuthorizationCodeStore) GetByHash(ctx context.Context, codeHash string) (*model.AuthorizationCode, error) {
+	builder := pgsql.Select(
+		defaultAuthorizationCodeFields...,
+	).From(authorizationCodesTable).Where(squirrel.Eq{"code_hash": codeHash})
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return nil, err
+	}
+	var code model.AuthorizationCode
+	if err := pgxscan.Get(ctx, dbx.GetConnOrTx(ctx, s.db), &code, query, args...); err != nil {
+		return nil, err
+	}
+
+	return &code, nil
+}
+
+// Use marks the code as redeemed. It returns false when the code has already been redeemed.
+func (s *AuthorizationCodeStore) Use(ctx context.Context, id uint64) (bool, error) {
+	builder := pgsql.Update(authorizationCodesTable).SetMap(map[string]interface{}{
+		"used_at": time.Now(),
+	}).Where(squirrel.Eq{"id": id, "used_at": nil})
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return false, err
+	}
+
+	conn, err := dbx.GetConnOrTx(ctx, s.db).Exec(ctx, query, args...)
+	if err != nil {
+		return false, err
+	}
+	return conn.RowsAffected() == 1, nil
+}
+
+// SetSession links the code to the session opened with it.
+func (s *AuthorizationCodeStore) SetSession(ctx context.Context, id, sessionID uint64) error {
+	builder := pgsql.Update(authorizationCodesTable).SetMap(map[string]interface{}{
+		"session_id": sessionID,
+	}).Where(squirrel.Eq{"id": id})
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return err
+	}
+
+	_, err = dbx.GetConnOrTx(ctx, s.db).Exec(ctx, query, args...)
+	return err
+}
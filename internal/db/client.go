@@ -0,0 +1,98 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/georgysavva/scany/v2/pgxscan"
+	"github.com/theruziev/oson_auth/internal/model"
+	"github.com/theruziev/oson_auth/internal/pkg/dbx"
+)
+
+const clientsTable = "clients"
+
+var defaultClientFields = []string{
+	"id",
+	"client_id",
+	"concat(secret_hash, '') as secret_hash",
+	"name",
+	"redirect_uris",
+	"is_public",
+	"grant_types",
+	"scopes",
+	"created_at",
+	"updated_at",
+	"secret_rotated_at",
+}
+
+type ClientStore struct {
+	db dbx.Querier
+}
+
+func NewClientStore(db dbx.Querier) *ClientStore {
+	return &ClientStore{
+		db: db,
+	}
+}
+
+func (s *ClientStore) Insert(ctx context.Context, client *model.Client) error {
+	builder := pgsql.Insert(clientsTable).SetMap(map[string]interface{}{
+		"client_id":     client.ClientID,
+		"secret_hash":   client.SecretHash,
+		"name":          client.Name,
+		"redirect_uris": client.RedirectURIs,
+		"is_public":     client.IsPublic,
+		"grant_types":   client.GrantTypes,
+		"scopes":        client.Scopes,
+		"created_at":    client.CreatedAt,
+		"updated_at":    client.UpdatedAt,
+	}).Suffix("returning id")
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return err
+	}
+
+	return pgxscan.Get(ctx, s.db, client, query, args...)
+}
+
+func (s *ClientStore) GetByClientID(ctx context.Context, clientID string) (*model.Client, error) {
+	builder := pgsql.Select(
+		defaultClientFields...,
+	).From(clientsTable).Where(squirrel.Eq{"client_id": clientID})
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return nil, err
+	}
+	var client model.Client
+	if err := pgxscan.Get(ctx, s.db, &client, query, args...); err != nil {
+		return nil, err
+	}
+
+	return &client, nil
+}
+
+func (s *ClientStore) UpdateSecret(ctx context.Context, clientID, secretHash string) error {
+	builder := pgsql.Update(clientsTable).SetMap(map[string]interface{}{
+		"secret_hash":       secretHash,
+		"secret_rotated_at": time.Now(),
+		"updated_at":        time.Now(),
+	}).Where(squirrel.Eq{"client_id": clientID})
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return err
+	}
+
+	conn, err := s.db.Exec(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	if conn.RowsAffected() == 0 {
+		return fmt.Errorf("failed to update")
+	}
+	return nil
+}
@@ -2,6 +2,7 @@ package db
 
 import (
 	"context"
+	"time"
 
 	sq "github.com/Masterminds/squirrel"
 	"github.com/georgysavva/scany/v2/pgxscan"
@@ -13,16 +14,16 @@ const contentTable = "contents"
 
 var defaultContentFields = []string{
 	"id",
-	"public_id",
 	"source",
 	"preview_url",
+	"preview_type",
+	"media_url",
 	"tags",
 	"description",
 	"content_type",
 	"status",
 	"created_at",
 	"updated_at",
-	"views",
 }
 
 type ContentStore struct {
@@ -41,6 +42,7 @@ func (s *ContentStore) Add(ctx context.Context, content *model.Content) error {
 		"preview_url":  content.PreviewURL,
 		"preview_type": content.PreviewType,
 		"description":  content.Description,
+		"media_url":    content.MediaURL,
 		"tags":         content.Tags,
 		"content_type": content.Type,
 		"status":       content.Status,
@@ -103,3 +105,46 @@ func (s *ContentStore) ListNewest(ctx context.Context, lastID, limit uint64) (*m
 		LastID: newLastID,
 	}, nil
 }
+
+// List returns the contents of every status, the newest first.
+func (s *ContentStore) List(ctx context.Context, filter *model.ContentFilter) ([]*model.Content, error) {
+	builder := pgsql.Select(defaultContentFields...).
+		From(contentTable).
+		OrderBy("id desc").
+		Limit(filter.Limit)
+	if filter.Status != "" {
+		builder = builder.Where(sq.Eq{"status": filter.Status})
+	}
+	if filter.BeforeID != 0 {
+		builder = builder.Where(sq.Lt{"id": filter.BeforeID})
+	}
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return nil, err
+	}
+	contents := make([]*model.Content, 0)
+	if err := pgxscan.Select(ctx, s.db, &contents, query, args...); err != nil {
+		return nil, err
+	}
+	return contents, nil
+}
+
+// SetStatus reports false when there is no content with the id.
+func (s *ContentStore) SetStatus(ctx context.Context, id uint64, status model.ContentStatus) (bool, error) {
+	builder := pgsql.Update(contentTable).SetMap(map[string]interface{}{
+		"status":     status,
+		"updated_at": time.Now(),
+	}).Where(sq.Eq{"id": id})
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return false, err
+	}
+
+	conn, err := s.db.Exec(ctx, query, args...)
+	if err != nil {
+		return false, err
+	}
+	return conn.RowsAffected() == 1, nil
+}
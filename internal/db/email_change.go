@@ -0,0 +1,117 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/georgysavva/scany/v2/pgxscan"
+	"github.com/theruziev/oson_auth/internal/model"
+	"github.com/theruziev/oson_auth/internal/pkg/dbx"
+)
+
+const emailChangesTable = "email_changes"
+
+var defaultEmailChangeFields = []string{
+	"id",
+	"token_hash",
+	"user_id",
+	"new_email",
+	"expires_at",
+	"used_at",
+	"created_at",
+}
+
+type EmailChangeStore struct {
+	db dbx.Querier
+}
+
+func NewEmailChangeStore(db dbx.Querier) *EmailChangeStore {
+	return &EmailChangeStore{
+		db: db,
+	}
+}
+
+func (s *EmailChangeStore) Insert(ctx context.Context, change *model.EmailChange) error {
+	builder := pgsql.Insert(emailChangesTable).SetMap(map[string]interface{}{
+		"token_hash": change.TokenHash,
+		"user_id":    change.UserID,
+		"new_email":  change.NewEmail,
+		"expires_at": change.ExpiresAt,
+		"created_at": change.CreatedAt,
+	}).Suffix("returning id")
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return err
+	}
+
+	return pgxscan.Get(ctx, dbx.GetConnOrTx(ctx, s.db), change, query, args...)
+}
+
+func (s *EmailChangeStore) GetByHash(ctx context.Context, tokenHash string) (*model.EmailChange, error) {
+	builder := pgsql.Select(
+		defaultEmailChangeFields...,
+	).From(emailChangesTable).Where(squirrel.Eq{"token_hash": tokenHash})
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return nil, err
+	}
+	var change model.EmailChange
+	if err := pgxscan.Get(ctx, dbx.GetConnOrTx(ctx, s.db), &change, query, args...); err != nil {
+		return nil, err
+	}
+
+	return &change, nil
+}
+
+func (s *EmailChangeStore) ListByUser(ctx context.Context, userID uint64) ([]*model.EmailChange, error) {
+	builder := pgsql.Select(
+		defaultEmailChangeFields...,
+	).From(emailChangesTable).Where(squirrel.Eq{"user_id": userID}).OrderBy("id desc")
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return nil, err
+	}
+	changes := make([]*model.EmailChange, 0)
+	if err := pgxscan.Select(ctx, dbx.GetConnOrTx(ctx, s.db), &changes, query, args...); err != nil {
+		return nil, err
+	}
+
+	return changes, nil
+}
+
+// Use marks the change as confirmed. It returns false when the change has already been confirmed or cancelled.
+func (s *EmailChangeStore) Use(ctx context.Context, id uint64) (bool, error) {
+	builder := pgsql.Update(emailChangesTable).SetMap(map[string]interface{}{
+		"used_at": time.Now(),
+	}).Where(squirrel.Eq{"id": id, "used_at": nil})
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return false, err
+	}
+
+	conn, err := dbx.GetConnOrTx(ctx, s.db).Exec(ctx, query, args...)
+	if err != nil {
+		return false, err
+	}
+	return conn.RowsAffected() == 1, nil
+}
+
+// UseAllByUser cancels the changes of the user that have not been confirmed yet.
+func (s *EmailChangeStore) UseAllByUser(ctx context.Context, userID uint64) error {
+	builder := pgsql.Update(emailChangesTable).SetMap(map[string]interface{}{
+		"used_at": time.Now(),
+	}).Where(squirrel.Eq{"user_id": userID, "used_at": nil})
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return err
+	}
+
+	_, err = dbx.GetConnOrTx(ctx, s.db).Exec(ctx, query, args...)
+	return err
+}
@@ -0,0 +1,90 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/georgysavva/scany/v2/pgxscan"
+	"github.com/theruziev/oson_auth/internal/pkg/dbx"
+	"github.com/theruziev/oson_auth/internal/pkg/lockout"
+)
+
+const loginAttemptsTable = "login_attempts"
+
+type LoginAttemptStore struct {
+	db dbx.Querier
+}
+
+func NewLoginAttemptStore(db dbx.Querier) *LoginAttemptStore {
+	return &LoginAttemptStore{
+		db: db,
+	}
+}
+
+var _ lockout.Counter = (*LoginAttemptStore)(nil)
+
+func (s *LoginAttemptStore) Get(ctx context.Context, key string) (*lockout.Attempts, error) {
+	builder := pgsql.Select(
+		"failures",
+		"coalesce(last_failure_at, 'epoch') as last_failure_at",
+		"coalesce(locked_until, 'epoch') as locked_until",
+	).From(loginAttemptsTable).Where(squirrel.Eq{"subject": key})
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return nil, err
+	}
+	var attempts lockout.Attempts
+	if err := pgxscan.Get(ctx, dbx.GetConnOrTx(ctx, s.db), &attempts, query, args...); err != nil {
+		if dbx.IsErrNoRows(err) {
+			return &lockout.Attempts{}, nil
+		}
+		return nil, err
+	}
+	return &attempts, nil
+}
+
+// Fail counts the failure in a single upsert, so concurrent attempts are not lost.
+func (s *LoginAttemptStore) Fail(ctx context.Context, key string, now time.Time, window time.Duration) (int, error) {
+	builder := pgsql.Insert(loginAttemptsTable).SetMap(map[string]interface{}{
+		"subject":         key,
+		"failures":        1,
+		"last_failure_at": now,
+	}).Suffix(
+		"on conflict (subject) do update set "+
+			"failures = case when login_attempts.last_failure_at < ? then 1 else login_attempts.failures + 1 end, "+
+			"last_failure_at = excluded.last_failure_at returning failures",
+		now.Add(-window),
+	)
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return 0, err
+	}
+	var failures int
+	if err := dbx.GetConnOrTx(ctx, s.db).QueryRow(ctx, query, args...).Scan(&failures); err != nil {
+		return 0, err
+	}
+	return failures, nil
+}
+
+func (s *LoginAttemptStore) Lock(ctx context.Context, key string, until time.Time) error {
+	query, args, err := pgsql.Update(loginAttemptsTable).
+		Set("locked_until", until).
+		Where(squirrel.Eq{"subject": key}).ToSql()
+	if err != nil {
+		return err
+	}
+	_, err = dbx.GetConnOrTx(ctx, s.db).Exec(ctx, query, args...)
+	return err
+}
+
+func (s *LoginAttemptStore) Reset(ctx context.Context, key string) error {
+	query, args, err := pgsql.Delete(loginAttemptsTable).Where(squirrel.Eq{"subject": key}).ToSql()
+	if err != nil {
+		return err
+	}
+	_, err = dbx.GetConnOrTx(ctx, s.db).Exec(ctx, query, args...)
+	return err
+}
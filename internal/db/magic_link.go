@@ -0,0 +1,98 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/georgysavva/scany/v2/pgxscan"
+	"github.com/theruziev/oson_auth/internal/model"
+	"github.com/theruziev/oson_auth/internal/pkg/dbx"
+)
+
+const magicLinksTable = "magic_links"
+
+var defaultMagicLinkFields = []string{
+	"id",
+	"token_hash",
+	"user_id",
+	"expires_at",
+	"used_at",
+	"created_at",
+}
+
+type MagicLinkStore struct {
+	db dbx.Querier
+}
+
+func NewMagicLinkStore(db dbx.Querier) *MagicLinkStore {
+	return &MagicLinkStore{
+		db: db,
+	}
+}
+
+func (s *MagicLinkStore) Insert(ctx context.Context, link *model.MagicLink) error {
+	builder := pgsql.Insert(magicLinksTable).SetMap(map[string]interface{}{
+		"token_hash": link.TokenHash,
+		"user_id":    link.UserID,
+		"expires_at": link.ExpiresAt,
+		"created_at": link.CreatedAt,
+	}).Suffix("returning id")
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return err
+	}
+
+	return pgxscan.Get(ctx, dbx.GetConnOrTx(ctx, s.db), link, query, args...)
+}
+
+func (s *MagicLinkStore) GetByHash(ctx context.Context, tokenHash string) (*model.MagicLink, error) {
+	builder := pgsql.Select(
+		defaultMagicLinkFields...,
+	).From(magicLinksTable).Where(squirrel.Eq{"token_hash": tokenHash})
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return nil, err
+	}
+	var link model.MagicLink
+	if err := pgxscan.Get(ctx, dbx.GetConnOrTx(ctx, s.db), &link, query, args...); err != nil {
+		return nil, err
+	}
+
+	return &link, nil
+}
+
+// Use marks the link as redeemed. It returns false when the link has already been redeemed.
+func (s *MagicLinkStore) Use(ctx context.Context, id uint64) (bool, error) {
+	builder := pgsql.Update(magicLinksTable).SetMap(map[string]interface{}{
+		"used_at": time.Now(),
+	}).Where(squirrel.Eq{"id": id, "used_at": nil})
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return false, err
+	}
+
+	conn, err := dbx.GetConnOrTx(ctx, s.db).Exec(ctx, query, args...)
+	if err != nil {
+		return false, err
+	}
+	return conn.RowsAffected() == 1, nil
+}
+
+// UseAllByUser invalidates the links of the user that have not been redeemed yet.
+func (s *MagicLinkStore) UseAllByUser(ctx context.Context, userID uint64) error {
+	builder := pgsql.Update(magicLinksTable).SetMap(map[string]interface{}{
+		"used_at": time.Now(),
+	}).Where(squirrel.Eq{"user_id": userID, "used_at": nil})
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return err
+	}
+
+	_, err = dbx.GetConnOrTx(ctx, s.db).Exec(ctx, query, args...)
+	return err
+}
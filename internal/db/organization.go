@@ -0,0 +1,358 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/georgysavva/scany/v2/pgxscan"
+	"github.com/theruziev/oson_auth/internal/model"
+	"github.com/theruziev/oson_auth/internal/pkg/dbx"
+)
+
+const (
+	organizationsTable       = "organizations"
+	membershipsTable         = "memberships"
+	organizationInvitesTable = "organization_invites"
+)
+
+var defaultOrganizationFields = []string{
+	"id",
+	"public_id",
+	"name",
+	"created_at",
+	"updated_at",
+}
+
+var defaultMembershipFields = []string{
+	"id",
+	"organization_id",
+	"user_id",
+	"role",
+	"created_at",
+	"updated_at",
+}
+
+var defaultOrganizationInviteFields = []string{
+	"id",
+	"public_id",
+	"organization_id",
+	"email",
+	"role",
+	"token_hash",
+	"invited_by",
+	"expires_at",
+	"accepted_at",
+	"revoked_at",
+	"created_at",
+}
+
+type OrganizationStore struct {
+	db dbx.Querier
+}
+
+func NewOrganizationStore(db dbx.Querier) *OrganizationStore {
+	return &OrganizationStore{
+		db: db,
+	}
+}
+
+func (s *OrganizationStore) Insert(ctx context.Context, org *model.Organization) error {
+	builder := pgsql.Insert(organizationsTable).SetMap(map[string]interface{}{
+		"public_id":  org.PublicID,
+		"name":       org.Name,
+		"created_at": org.CreatedAt,
+		"updated_at": org.UpdatedAt,
+	}).Suffix("returning id")
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return err
+	}
+
+	return pgxscan.Get(ctx, dbx.GetConnOrTx(ctx, s.db), org, query, args...)
+}
+
+func (s *OrganizationStore) Get(ctx context.Context, publicID string) (*model.Organization, error) {
+	return s.getOrganization(ctx, squirrel.Eq{"public_id": publicID})
+}
+
+func (s *OrganizationStore) GetByID(ctx context.Context, id uint64) (*model.Organization, error) {
+	return s.getOrganization(ctx, squirrel.Eq{"id": id})
+}
+
+func (s *OrganizationStore) getOrganization(ctx context.Context, where squirrel.Eq) (*model.Organization, error) {
+	query, args, err := pgsql.Select(defaultOrganizationFields...).From(organizationsTable).Where(where).ToSql()
+	if err != nil {
+		return nil, err
+	}
+	var org model.Organization
+	if err := pgxscan.Get(ctx, dbx.GetConnOrTx(ctx, s.db), &org, query, args...); err != nil {
+		return nil, err
+	}
+
+	return &org, nil
+}
+
+// ListByUser returns the organizations the user is a member of, the oldest membership first.
+func (s *OrganizationStore) ListByUser(ctx context.Context, userID uint64) ([]*model.UserOrganization, error) {
+	builder := pgsql.Select(
+		"o.id",
+		"o.public_id",
+		"o.name",
+		"o.created_at",
+		"o.updated_at",
+		"m.role",
+		"m.created_at as joined_at",
+	).From(organizationsTable+" o").
+		Join(membershipsTable+" m on m.organization_id = o.id").
+		Where(squirrel.Eq{"m.user_id": userID}).
+		OrderBy("m.created_at", "m.id")
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return nil, err
+	}
+	orgs := make([]*model.UserOrganization, 0)
+	if err := pgxscan.Select(ctx, dbx.GetConnOrTx(ctx, s.db), &orgs, query, args...); err != nil {
+		return nil, err
+	}
+
+	return orgs, nil
+}
+
+func (s *OrganizationStore) InsertMembership(ctx context.Context, membership *model.Membership) error {
+	builder := pgsql.Insert(membershipsTable).SetMap(map[string]interface{}{
+		"organization_id": membership.OrganizationID,
+		"user_id":         membership.UserID,
+		"role":            membership.Role,
+		"created_at":      membership.CreatedAt,
+		"updated_at":      membership.UpdatedAt,
+	}).Suffix("returning id")
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return err
+	}
+
+	return pgxscan.Get(ctx, dbx.GetConnOrTx(ctx, s.db), membership, query, args...)
+}
+
+func (s *OrganizationStore) GetMembership(ctx context.Context, orgID, userID uint64) (*model.Membership, error) {
+	builder := pgsql.Select(defaultMembershipFields...).From(membershipsTable).Where(squirrel.Eq{
+		"organization_id": orgID,
+		"user_id":         userID,
+	})
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return nil, err
+	}
+	var membership model.Membership
+	if err := pgxscan.Get(ctx, dbx.GetConnOrTx(ctx, s.db), &membership, query, args...); err != nil {
+		return nil, err
+	}
+
+	return &membership, nil
+}
+
+// ListMembers returns the members of the organization, the oldest first.
+func (s *OrganizationStore) ListMembers(ctx context.Context, orgID uint64) ([]*model.Member, error) {
+	builder := pgsql.Select(
+		"u.public_id",
+		"u.email",
+		"u.first_name",
+		"u.last_name",
+		"m.role",
+		"m.created_at as joined_at",
+	).From(membershipsTable+" m").
+		Join(usersTable+" u on u.id = m.user_id").
+		Where(squirrel.Eq{"m.organization_id": orgID}).
+		OrderBy("m.created_at", "m.id")
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return nil, err
+	}
+	members := make([]*model.Member, 0)
+	if err := pgxscan.Select(ctx, dbx.GetConnOrTx(ctx, s.db), &members, query, args...); err != nil {
+		return nil, err
+	}
+
+	return members, nil
+}
+
+// LockOwners returns the memberships of the owners of the organization and locks them until the transaction ends,
+// so concurrent changes of owners see each other and the last owner can't leave.
+func (s *OrganizationStore) LockOwners(ctx context.Context, orgID uint64) ([]uint64, error) {
+	query, args, err := pgsql.Select("id").From(membershipsTable).Where(squirrel.Eq{
+		"organization_id": orgID,
+		"role":            model.OrgRoleOwner,
+	}).Suffix("for update").ToSql()
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]uint64, 0)
+	if err := pgxscan.Select(ctx, dbx.GetConnOrTx(ctx, s.db), &ids, query, args...); err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
+
+func (s *OrganizationStore) SetMemberRole(ctx context.Context, membershipID uint64, role model.OrgRole) error {
+	builder := pgsql.Update(membershipsTable).SetMap(map[string]interface{}{
+		"role":       role,
+		"updated_at": time.Now(),
+	}).Where(squirrel.Eq{"id": membershipID})
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return err
+	}
+
+	conn, err := dbx.GetConnOrTx(ctx, s.db).Exec(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	if conn.RowsAffected() == 0 {
+		return fmt.Errorf("failed to update")
+	}
+	return nil
+}
+
+func (s *OrganizationStore) DeleteMembership(ctx context.Context, membershipID uint64) error {
+	builder := pgsql.Delete(membershipsTable).Where(squirrel.Eq{"id": membershipID})
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return err
+	}
+
+	conn, err := dbx.GetConnOrTx(ctx, s.db).Exec(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	if conn.RowsAffected() == 0 {
+		return fmt.Errorf("failed to delete")
+	}
+	return nil
+}
+
+func (s *OrganizationStore) InsertInvite(ctx context.Context, invite *model.OrganizationInvite) error {
+	builder := pgsql.Insert(organizationInvitesTable).SetMap(map[string]interface{}{
+		"public_id":       invite.PublicID,
+		"organization_id": invite.OrganizationID,
+		"email":           invite.Email,
+		"role":            invite.Role,
+		"token_hash":      invite.TokenHash,
+		"invited_by":      invite.InvitedBy,
+		"expires_at":      invite.ExpiresAt,
+		"created_at":      invite.CreatedAt,
+	}).Suffix("returning id")
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return err
+	}
+
+	return pgxscan.Get(ctx, dbx.GetConnOrTx(ctx, s.db), invite, query, args...)
+}
+
+func (s *OrganizationStore) GetInviteByHash(ctx context.Context, tokenHash string) (*model.OrganizationInvite, error) {
+	builder := pgsql.Select(
+		defaultOrganizationInviteFields...,
+	).From(organizationInvitesTable).Where(squirrel.Eq{"token_hash": tokenHash})
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return nil, err
+	}
+	var invite model.OrganizationInvite
+	if err := pgxscan.Get(ctx, dbx.GetConnOrTx(ctx, s.db), &invite, query, args...); err != nil {
+		return nil, err
+	}
+
+	return &invite, nil
+}
+
+// ListPendingInvites returns the invites of the organization that can still be accepted, the latest first.
+func (s *OrganizationStore) ListPendingInvites(ctx context.Context, orgID uint64) ([]*model.OrganizationInvite, error) {
+	builder := pgsql.Select(
+		defaultOrganizationInviteFields...,
+	).From(organizationInvitesTable).Where(squirrel.And{
+		squirrel.Eq{"organization_id": orgID, "accepted_at": nil, "revoked_at": nil},
+		squirrel.Gt{"expires_at": time.Now()},
+	}).OrderBy("id desc")
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return nil, err
+	}
+	invites := make([]*model.OrganizationInvite, 0)
+	if err := pgxscan.Select(ctx, dbx.GetConnOrTx(ctx, s.db), &invites, query, args...); err != nil {
+		return nil, err
+	}
+
+	return invites, nil
+}
+
+// AcceptInvite marks the invite accepted, it returns false when the invite was already accepted or revoked.
+func (s *OrganizationStore) AcceptInvite(ctx context.Context, id uint64) (bool, error) {
+	builder := pgsql.Update(organizationInvitesTable).SetMap(map[string]interface{}{
+		"accepted_at": time.Now(),
+	}).Where(squirrel.Eq{"id": id, "accepted_at": nil, "revoked_at": nil})
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return false, err
+	}
+
+	conn, err := dbx.GetConnOrTx(ctx, s.db).Exec(ctx, query, args...)
+	if err != nil {
+		return false, err
+	}
+	return conn.RowsAffected() == 1, nil
+}
+
+// RevokeInvite revokes a pending invite, it returns false when the organization has no such pending invite.
+func (s *OrganizationStore) RevokeInvite(ctx context.Context, orgID uint64, publicID string) (bool, error) {
+	builder := pgsql.Update(organizationInvitesTable).SetMap(map[string]interface{}{
+		"revoked_at": time.Now(),
+	}).Where(squirrel.Eq{
+		"organization_id": orgID,
+		"public_id":       publicID,
+		"accepted_at":     nil,
+		"revoked_at":      nil,
+	})
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return false, err
+	}
+
+	conn, err := dbx.GetConnOrTx(ctx, s.db).Exec(ctx, query, args...)
+	if err != nil {
+		return false, err
+	}
+	return conn.RowsAffected() == 1, nil
+}
+
+// RevokeInvitesByEmail revokes the pending invites of the email to the organization, so only the latest one works.
+func (s *OrganizationStore) RevokeInvitesByEmail(ctx context.Context, orgID uint64, email string) error {
+	builder := pgsql.Update(organizationInvitesTable).SetMap(map[string]interface{}{
+		"revoked_at": time.Now(),
+	}).Where(squirrel.And{
+		squirrel.Eq{"organization_id": orgID, "accepted_at": nil, "revoked_at": nil},
+		squirrel.Expr("lower(email) = lower(?)", email),
+	})
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return err
+	}
+
+	_, err = dbx.GetConnOrTx(ctx, s.db).Exec(ctx, query, args...)
+	return err
+}
@@ -45,7 +45,7 @@ func (o *OutBoxStore) Add(ctx context.Context, messages ...*model.OutBox) error
 		return err
 	}
 
-	if _, err := o.db.Exec(ctx, query, args...); err != nil {
+	if _, err := dbx.GetConnOrTx(ctx, o.db).Exec(ctx, query, args...); err != nil {
 		return err
 	}
 
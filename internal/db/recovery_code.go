@@ -0,0 +1,111 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/georgysavva/scany/v2/pgxscan"
+	"github.com/theruziev/oson_auth/internal/model"
+	"github.com/theruziev/oson_auth/internal/pkg/dbx"
+)
+
+const recoveryCodesTable = "recovery_codes"
+
+var defaultRecoveryCodeFields = []string{
+	"id",
+	"user_id",
+	"code_hash",
+	"used_at",
+	"created_at",
+}
+
+type RecoveryCodeStore struct {
+	db dbx.Querier
+}
+
+func NewRecoveryCodeStore(db dbx.Querier) *RecoveryCodeStore {
+	return &RecoveryCodeStore{
+		db: db,
+	}
+}
+
+// Insert adds the codes of the user, the codes issued before are left as they are.
+func (s *RecoveryCodeStore) Insert(ctx context.Context, userID uint64, codeHashes []string, createdAt time.Time) error {
+	if len(codeHashes) == 0 {
+		return nil
+	}
+	builder := pgsql.Insert(recoveryCodesTable).Columns("user_id", "code_hash", "created_at")
+	for _, codeHash := range codeHashes {
+		builder = builder.Values(userID, codeHash, createdAt)
+	}
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return err
+	}
+
+	_, err = dbx.GetConnOrTx(ctx, s.db).Exec(ctx, query, args...)
+	return err
+}
+
+// ListUnused returns the codes of the user that have not been used yet.
+func (s *RecoveryCodeStore) ListUnused(ctx context.Context, userID uint64) ([]*model.RecoveryCode, error) {
+	builder := pgsql.Select(
+		defaultRecoveryCodeFields...,
+	).From(recoveryCodesTable).Where(squirrel.Eq{"user_id": userID, "used_at": nil}).OrderBy("id")
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return nil, err
+	}
+	codes := make([]*model.RecoveryCode, 0)
+	if err := pgxscan.Select(ctx, dbx.GetConnOrTx(ctx, s.db), &codes, query, args...); err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+func (s *RecoveryCodeStore) CountUnused(ctx context.Context, userID uint64) (uint64, error) {
+	query, args, err := pgsql.Select("count(*)").From(recoveryCodesTable).
+		Where(squirrel.Eq{"user_id": userID, "used_at": nil}).ToSql()
+	if err != nil {
+		return 0, err
+	}
+	var count uint64
+	if err := dbx.GetConnOrTx(ctx, s.db).QueryRow(ctx, query, args...).Scan(&count); err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// Use marks the code used, it reports false when the code was used meanwhile.
+func (s *RecoveryCodeStore) Use(ctx context.Context, id uint64) (bool, error) {
+	builder := pgsql.Update(recoveryCodesTable).SetMap(map[string]interface{}{
+		"used_at": time.Now(),
+	}).Where(squirrel.Eq{"id": id, "used_at": nil})
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return false, err
+	}
+
+	conn, err := dbx.GetConnOrTx(ctx, s.db).Exec(ctx, query, args...)
+	if err != nil {
+		return false, err
+	}
+	return conn.RowsAffected() == 1, nil
+}
+
+// DeleteByUser removes every code of the user, used ones included.
+func (s *RecoveryCodeStore) DeleteByUser(ctx context.Context, userID uint64) error {
+	query, args, err := pgsql.Delete(recoveryCodesTable).Where(squirrel.Eq{"user_id": userID}).ToSql()
+	if err != nil {
+		return err
+	}
+
+	_, err = dbx.GetConnOrTx(ctx, s.db).Exec(ctx, query, args...)
+	return err
+}
@@ -0,0 +1,56 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/georgysavva/scany/v2/pgxscan"
+	"github.com/theruziev/oson_auth/internal/pkg/dbx"
+)
+
+const revokedTokensTable = "revoked_tokens"
+
+type RevokedTokenStore struct {
+	db dbx.Querier
+}
+
+func NewRevokedTokenStore(db dbx.Querier) *RevokedTokenStore {
+	return &RevokedTokenStore{
+		db: db,
+	}
+}
+
+func (s *RevokedTokenStore) Add(ctx context.Context, jti string, expiresAt time.Time) error {
+	builder := pgsql.Insert(revokedTokensTable).SetMap(map[string]interface{}{
+		"jti":        jti,
+		"expires_at": expiresAt,
+		"created_at": time.Now(),
+	}).Suffix("on conflict (jti) do nothing")
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return err
+	}
+
+	if _, err := s.db.Exec(ctx, query, args...); err != nil {
+		return err
+	}
+	return nil
+}
+
+// ListActive returns the jti of every revoked token which hasn't expired yet.
+func (s *RevokedTokenStore) ListActive(ctx context.Context, now time.Time) ([]string, error) {
+	builder := pgsql.Select("jti").From(revokedTokensTable).Where(squirrel.Gt{"expires_at": now})
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	var jtis []string
+	if err := pgxscan.Select(ctx, s.db, &jtis, query, args...); err != nil {
+		return nil, err
+	}
+	return jtis, nil
+}
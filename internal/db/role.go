@@ -0,0 +1,133 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/georgysavva/scany/v2/pgxscan"
+	"github.com/theruziev/oson_auth/internal/model"
+	"github.com/theruziev/oson_auth/internal/pkg/dbx"
+)
+
+const (
+	rolesTable           = "roles"
+	rolePermissionsTable = "role_permissions"
+	userRolesTable       = "user_roles"
+)
+
+var defaultRoleFields = []string{
+	"r.id",
+	"r.name",
+	"concat(r.description, '') as description",
+	"r.created_at",
+	"array(select rp.permission from role_permissions rp where rp.role_id = r.id order by rp.permission) as permissions",
+}
+
+type RoleStore struct {
+	db dbx.Querier
+}
+
+func NewRoleStore(db dbx.Querier) *RoleStore {
+	return &RoleStore{
+		db: db,
+	}
+}
+
+func (s *RoleStore) List(ctx context.Context) ([]*model.Role, error) {
+	builder := pgsql.Select(defaultRoleFields...).From(rolesTable + " r").OrderBy("r.name")
+
+	return s.selectRoles(ctx, builder)
+}
+
+func (s *RoleStore) GetByName(ctx context.Context, name string) (*model.Role, error) {
+	builder := pgsql.Select(defaultRoleFields...).From(rolesTable + " r").Where(squirrel.Eq{"r.name": name})
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return nil, err
+	}
+	var role model.Role
+	if err := pgxscan.Get(ctx, dbx.GetConnOrTx(ctx, s.db), &role, query, args...); err != nil {
+		return nil, err
+	}
+
+	return &role, nil
+}
+
+func (s *RoleStore) ListByUser(ctx context.Context, userID uint64) ([]*model.Role, error) {
+	builder := pgsql.Select(defaultRoleFields...).From(rolesTable + " r").
+		Join(userRolesTable + " ur on ur.role_id = r.id").
+		Where(squirrel.Eq{"ur.user_id": userID}).
+		OrderBy("r.name")
+
+	return s.selectRoles(ctx, builder)
+}
+
+// ListPermissionsByUser returns the permissions of all the roles of the user.
+func (s *RoleStore) ListPermissionsByUser(ctx context.Context, userID uint64) ([]string, error) {
+	builder := pgsql.Select("distinct rp.permission").From(rolePermissionsTable + " rp").
+		Join(userRolesTable + " ur on ur.role_id = rp.role_id").
+		Where(squirrel.Eq{"ur.user_id": userID}).
+		OrderBy("rp.permission")
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return nil, err
+	}
+	permissions := make([]string, 0)
+	if err := pgxscan.Select(ctx, dbx.GetConnOrTx(ctx, s.db), &permissions, query, args...); err != nil {
+		return nil, err
+	}
+
+	return permissions, nil
+}
+
+// Assign grants the role to the user, granting a role the user already has is not an error.
+func (s *RoleStore) Assign(ctx context.Context, userID, roleID uint64) error {
+	builder := pgsql.Insert(userRolesTable).SetMap(map[string]interface{}{
+		"user_id":    userID,
+		"role_id":    roleID,
+		"created_at": time.Now(),
+	}).Suffix("on conflict (user_id, role_id) do nothing")
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return err
+	}
+
+	_, err = dbx.GetConnOrTx(ctx, s.db).Exec(ctx, query, args...)
+	return err
+}
+
+// Unassign takes the role from the user, false means the user didn't have the role.
+func (s *RoleStore) Unassign(ctx context.Context, userID, roleID uint64) (bool, error) {
+	builder := pgsql.Delete(userRolesTable).Where(squirrel.Eq{
+		"user_id": userID,
+		"role_id": roleID,
+	})
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return false, err
+	}
+
+	conn, err := dbx.GetConnOrTx(ctx, s.db).Exec(ctx, query, args...)
+	if err != nil {
+		return false, err
+	}
+	return conn.RowsAffected() == 1, nil
+}
+
+func (s *RoleStore) selectRoles(ctx context.Context, builder squirrel.SelectBuilder) ([]*model.Role, error) {
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return nil, err
+	}
+	roles := make([]*model.Role, 0)
+	if err := pgxscan.Select(ctx, dbx.GetConnOrTx(ctx, s.db), &roles, query, args...); err != nil {
+		return nil, err
+	}
+
+	return roles, nil
+}
@@ -0,0 +1,280 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/georgysavva/scany/v2/pgxscan"
+	"github.com/theruziev/oson_auth/internal/model"
+	"github.com/theruziev/oson_auth/internal/pkg/dbx"
+)
+
+const (
+	sessionsTable      = "sessions"
+	refreshTokensTable = "refresh_tokens"
+)
+
+var defaultSessionFields = []string{
+	"id",
+	"public_id",
+	"user_id",
+	"concat(client_id, '') as client_id",
+	"coalesce(auth_time, created_at) as auth_time",
+	"created_at",
+	"updated_at",
+	"expires_at",
+	"revoked_at",
+	"organization_id",
+	"concat(ip, '') as ip",
+	"concat(user_agent, '') as user_agent",
+	"last_seen_at",
+}
+
+var defaultRefreshTokenFields = []string{
+	"id",
+	"session_id",
+	"token_hash",
+	"created_at",
+	"used_at",
+}
+
+type SessionStore struct {
+	db dbx.Querier
+}
+
+func NewSessionStore(db dbx.Querier) *SessionStore {
+	return &SessionStore{
+		db: db,
+	}
+}
+
+func (s *SessionStore) Insert(ctx context.Context, session *model.Session) error {
+	builder := pgsql.Insert(sessionsTable).SetMap(map[string]interface{}{
+		"public_id":    session.PublicID,
+		"user_id":      session.UserID,
+		"client_id":    session.ClientID,
+		"auth_time":    session.AuthTime,
+		"created_at":   session.CreatedAt,
+		"updated_at":   session.UpdatedAt,
+		"expires_at":   session.ExpiresAt,
+		"ip":           session.IP,
+		"user_agent":   session.UserAgent,
+		"last_seen_at": session.LastSeenAt,
+	}).Suffix("returning id")
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return err
+	}
+
+	return pgxscan.Get(ctx, dbx.GetConnOrTx(ctx, s.db), session, query, args...)
+}
+
+func (s *SessionStore) Get(ctx context.Context, id uint64) (*model.Session, error) {
+	builder := pgsql.Select(
+		defaultSessionFields...,
+	).From(sessionsTable).Where(squirrel.Eq{"id": id})
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return nil, err
+	}
+	var session model.Session
+	if err := pgxscan.Get(ctx, dbx.GetConnOrTx(ctx, s.db), &session, query, args...); err != nil {
+		return nil, err
+	}
+
+	return &session, nil
+}
+
+// Extend prolongs the session on a refresh, the refresh is the last time the session was seen.
+func (s *SessionStore) Extend(ctx context.Context, id uint64, expiresAt time.Time, ip string) error {
+	now := time.Now()
+	builder := pgsql.Update(sessionsTable).SetMap(map[string]interface{}{
+		"expires_at":   expiresAt,
+		"ip":           ip,
+		"last_seen_at": now,
+		"updated_at":   now,
+	}).Where(squirrel.Eq{"id": id})
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return err
+	}
+
+	conn, err := dbx.GetConnOrTx(ctx, s.db).Exec(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	if conn.RowsAffected() == 0 {
+		return fmt.Errorf("failed to update")
+	}
+	return nil
+}
+
+func (s *SessionStore) GetByPublicID(ctx context.Context, publicID string) (*model.Session, error) {
+	builder := pgsql.Select(
+		defaultSessionFields...,
+	).From(sessionsTable).Where(squirrel.Eq{"public_id": publicID})
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return nil, err
+	}
+	var session model.Session
+	if err := pgxscan.Get(ctx, dbx.GetConnOrTx(ctx, s.db), &session, query, args...); err != nil {
+		return nil, err
+	}
+
+	return &session, nil
+}
+
+// SetOrganization switches the active organization of the session, nil leaves the session without one.
+func (s *SessionStore) SetOrganization(ctx context.Context, id uint64, orgID *uint64) error {
+	builder := pgsql.Update(sessionsTable).SetMap(map[string]interface{}{
+		"organization_id": orgID,
+		"updated_at":      time.Now(),
+	}).Where(squirrel.Eq{"id": id})
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return err
+	}
+
+	conn, err := dbx.GetConnOrTx(ctx, s.db).Exec(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	if conn.RowsAffected() == 0 {
+		return fmt.Errorf("failed to update")
+	}
+	return nil
+}
+
+// RevokeByPublicID revokes the session, it reports whether the session was active until now.
+func (s *SessionStore) RevokeByPublicID(ctx context.Context, publicID string) (bool, error) {
+	builder := pgsql.Update(sessionsTable).SetMap(map[string]interface{}{
+		"revoked_at": time.Now(),
+		"updated_at": time.Now(),
+	}).Where(squirrel.Eq{"public_id": publicID, "revoked_at": nil})
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return false, err
+	}
+
+	conn, err := dbx.GetConnOrTx(ctx, s.db).Exec(ctx, query, args...)
+	if err != nil {
+		return false, err
+	}
+	return conn.RowsAffected() > 0, nil
+}
+
+// ListActiveByUser returns the sessions of the user that are neither revoked nor expired, the latest seen first.
+func (s *SessionStore) ListActiveByUser(ctx context.Context, userID uint64, now time.Time) ([]*model.Session, error) {
+	builder := pgsql.Select(
+		defaultSessionFields...,
+	).From(sessionsTable).
+		Where(squirrel.Eq{"user_id": userID, "revoked_at": nil}).
+		Where(squirrel.Gt{"expires_at": now}).
+		OrderBy("last_seen_at desc nulls last", "id desc")
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return nil, err
+	}
+	sessions := make([]*model.Session, 0)
+	if err := pgxscan.Select(ctx, dbx.GetConnOrTx(ctx, s.db), &sessions, query, args...); err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+// ListByUser returns the sessions of the user, revoked and expired ones included, the latest first.
+func (s *SessionStore) ListByUser(ctx context.Context, userID uint64) ([]*model.Session, error) {
+	builder := pgsql.Select(
+		defaultSessionFields...,
+	).From(sessionsTable).Where(squirrel.Eq{"user_id": userID}).OrderBy("id desc")
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return nil, err
+	}
+	sessions := make([]*model.Session, 0)
+	if err := pgxscan.Select(ctx, dbx.GetConnOrTx(ctx, s.db), &sessions, query, args...); err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+func (s *SessionStore) RevokeAllByUser(ctx context.Context, userID uint64) error {
+	builder := pgsql.Update(sessionsTable).SetMap(map[string]interface{}{
+		"revoked_at": time.Now(),
+		"updated_at": time.Now(),
+	}).Where(squirrel.Eq{"user_id": userID, "revoked_at": nil})
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return err
+	}
+
+	if _, err := dbx.GetConnOrTx(ctx, s.db).Exec(ctx, query, args...); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *SessionStore) InsertRefreshToken(ctx context.Context, token *model.RefreshToken) error {
+	builder := pgsql.Insert(refreshTokensTable).SetMap(map[string]interface{}{
+		"session_id": token.SessionID,
+		"token_hash": token.TokenHash,
+		"created_at": token.CreatedAt,
+	}).Suffix("returning id")
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return err
+	}
+
+	return pgxscan.Get(ctx, dbx.GetConnOrTx(ctx, s.db), token, query, args...)
+}
+
+func (s *SessionStore) GetRefreshToken(ctx context.Context, tokenHash string) (*model.RefreshToken, error) {
+	builder := pgsql.Select(
+		defaultRefreshTokenFields...,
+	).From(refreshTokensTable).Where(squirrel.Eq{"token_hash": tokenHash})
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return nil, err
+	}
+	var token model.RefreshToken
+	if err := pgxscan.Get(ctx, dbx.GetConnOrTx(ctx, s.db), &token, query, args...); err != nil {
+		return nil, err
+	}
+
+	return &token, nil
+}
+
+// UseRefreshToken marks the token as used. It returns false when the token has already been used,
+// which means it is being replayed.
+func (s *SessionStore) UseRefreshToken(ctx context.Context, id uint64) (bool, error) {
+	builder := pgsql.Update(refreshTokensTable).SetMap(map[string]interface{}{
+		"used_at": time.Now(),
+	}).Where(squirrel.Eq{"id": id, "used_at": nil})
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return false, err
+	}
+
+	conn, err := dbx.GetConnOrTx(ctx, s.db).Exec(ctx, query, args...)
+	if err != nil {
+		return false, err
+	}
+	return conn.RowsAffected() == 1, nil
+}
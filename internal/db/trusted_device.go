@@ -0,0 +1,139 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/georgysavva/scany/v2/pgxscan"
+	"github.com/theruziev/oson_auth/internal/model"
+	"github.com/theruziev/oson_auth/internal/pkg/dbx"
+)
+
+const trustedDevicesTable = "trusted_devices"
+
+var defaultTrustedDeviceFields = []string{
+	"id",
+	"public_id",
+	"user_id",
+	"token_hash",
+	"concat(ip, '') as ip",
+	"concat(user_agent, '') as user_agent",
+	"expires_at",
+	"last_used_at",
+	"revoked_at",
+	"created_at",
+}
+
+type TrustedDeviceStore struct {
+	db dbx.Querier
+}
+
+func NewTrustedDeviceStore(db dbx.Querier) *TrustedDeviceStore {
+	return &TrustedDeviceStore{
+		db: db,
+	}
+}
+
+func (s *TrustedDeviceStore) Insert(ctx context.Context, device *model.TrustedDevice) error {
+	builder := pgsql.Insert(trustedDevicesTable).SetMap(map[string]interface{}{
+		"public_id":  device.PublicID,
+		"user_id":    device.UserID,
+		"token_hash": device.TokenHash,
+		"ip":         device.IP,
+		"user_agent": device.UserAgent,
+		"expires_at": device.ExpiresAt,
+		"created_at": device.CreatedAt,
+	}).Suffix("returning id")
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return err
+	}
+
+	return pgxscan.Get(ctx, dbx.GetConnOrTx(ctx, s.db), device, query, args...)
+}
+
+func (s *TrustedDeviceStore) GetByHash(ctx context.Context, tokenHash string) (*model.TrustedDevice, error) {
+	builder := pgsql.Select(
+		defaultTrustedDeviceFields...,
+	).From(trustedDevicesTable).Where(squirrel.Eq{"token_hash": tokenHash})
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return nil, err
+	}
+	var device model.TrustedDevice
+	if err := pgxscan.Get(ctx, dbx.GetConnOrTx(ctx, s.db), &device, query, args...); err != nil {
+		return nil, err
+	}
+
+	return &device, nil
+}
+
+// ListByUser returns the devices of the user that are still trusted, the latest first.
+func (s *TrustedDeviceStore) ListByUser(ctx context.Context, userID uint64, now time.Time) ([]*model.TrustedDevice, error) {
+	builder := pgsql.Select(
+		defaultTrustedDeviceFields...,
+	).From(trustedDevicesTable).
+		Where(squirrel.Eq{"user_id": userID, "revoked_at": nil}).
+		Where(squirrel.Gt{"expires_at": now}).
+		OrderBy("id desc")
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return nil, err
+	}
+	devices := make([]*model.TrustedDevice, 0)
+	if err := pgxscan.Select(ctx, dbx.GetConnOrTx(ctx, s.db), &devices, query, args...); err != nil {
+		return nil, err
+	}
+
+	return devices, nil
+}
+
+func (s *TrustedDeviceStore) Touch(ctx context.Context, id uint64, lastUsedAt time.Time) error {
+	builder := pgsql.Update(trustedDevicesTable).SetMap(map[string]interface{}{
+		"last_used_at": lastUsedAt,
+	}).Where(squirrel.Eq{"id": id})
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return err
+	}
+
+	_, err = dbx.GetConnOrTx(ctx, s.db).Exec(ctx, query, args...)
+	return err
+}
+
+// Revoke revokes the device of the user, it returns false when the user has no such trusted device.
+func (s *TrustedDeviceStore) Revoke(ctx context.Context, userID uint64, publicID string) (bool, error) {
+	builder := pgsql.Update(trustedDevicesTable).SetMap(map[string]interface{}{
+		"revoked_at": time.Now(),
+	}).Where(squirrel.Eq{"user_id": userID, "public_id": publicID, "revoked_at": nil})
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return false, err
+	}
+
+	conn, err := dbx.GetConnOrTx(ctx, s.db).Exec(ctx, query, args...)
+	if err != nil {
+		return false, err
+	}
+	return conn.RowsAffected() == 1, nil
+}
+
+func (s *TrustedDeviceStore) RevokeAllByUser(ctx context.Context, userID uint64) error {
+	builder := pgsql.Update(trustedDevicesTable).SetMap(map[string]interface{}{
+		"revoked_at": time.Now(),
+	}).Where(squirrel.Eq{"user_id": userID, "revoked_at": nil})
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return err
+	}
+
+	_, err = dbx.GetConnOrTx(ctx, s.db).Exec(ctx, query, args...)
+	return err
+}
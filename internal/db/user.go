@@ -3,43 +3,65 @@ package db
 import (
 	"context"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/Masterminds/squirrel"
 	"github.com/georgysavva/scany/v2/pgxscan"
+	"github.com/jackc/pgx/v5"
+	"github.com/theruziev/oson_auth/internal/event/constants"
 	"github.com/theruziev/oson_auth/internal/model"
 	"github.com/theruziev/oson_auth/internal/pkg/dbx"
+	"github.com/theruziev/oson_auth/internal/pkg/fieldcrypt"
 )
 
-const usersTable = "users"
+const (
+	usersTable           = "users"
+	passwordHistoryTable = "password_history"
+)
 
 var defaultUserFields = []string{
 	"id",
 	"public_id",
-	"name",
+	"first_name",
+	"last_name",
 	"email",
 	"password",
 	"status",
+	"concat(status_reason, '') as status_reason",
+	"status_changed_at",
 	"created_at",
 	"updated_at",
 	"concat(activation_code, '') as activation_code",
 	"concat(reset_password_code, '') as reset_password_code",
 	"otp_secret",
-	"otp_recovery_codes",
 	"otp_enabled",
+	"concat(otp_algorithm, '') as otp_algorithm",
+	"coalesce(otp_digits, 0) as otp_digits",
+	"coalesce(otp_period, 0) as otp_period",
+	"tokens_valid_after",
+	"password_changed_at",
+	"deleted_at",
 }
 
+// UserStore keeps the otp secrets encrypted, they are decrypted on read and the users it returns hold plain secrets.
 type UserStore struct {
-	db dbx.Querier
+	db     dbx.Querier
+	cipher fieldcrypt.Cipher
 }
 
-func NewUserStore(db dbx.Querier) *UserStore {
+func NewUserStore(db dbx.Querier, cipher fieldcrypt.Cipher) *UserStore {
 	return &UserStore{
-		db: db,
+		db:     db,
+		cipher: cipher,
 	}
 }
 
 func (s *UserStore) Insert(ctx context.Context, user *model.User) error {
+	otpSecret, err := s.cipher.Encrypt(user.OtpSecret, []byte(user.PublicID))
+	if err != nil {
+		return err
+	}
 	builder := pgsql.Insert(usersTable).SetMap(map[string]interface{}{
 		"public_id":           user.PublicID,
 		"first_name":          user.FirstName,
@@ -51,9 +73,9 @@ func (s *UserStore) Insert(ctx context.Context, user *model.User) error {
 		"updated_at":          user.UpdatedAt,
 		"activation_code":     user.ActivationCode,
 		"reset_password_code": user.ResetPasswordCode,
-		"otp_secret":          user.OtpSecret,
-		"otp_recovery_codes":  user.OtpRecoveryCodes,
+		"otp_secret":          otpSecret,
 		"otp_enabled":         user.OtpEnabled,
+		"password_changed_at": user.PasswordChangedAt,
 	}).Suffix("returning id")
 
 	query, args, err := builder.ToSql()
@@ -61,7 +83,7 @@ func (s *UserStore) Insert(ctx context.Context, user *model.User) error {
 		return err
 	}
 
-	err = pgxscan.Get(ctx, s.db, user, query, args...)
+	err = pgxscan.Get(ctx, dbx.GetConnOrTx(ctx, s.db), user, query, args...)
 	if err != nil {
 		return err
 	}
@@ -79,11 +101,28 @@ func (s *UserStore) Get(ctx context.Context, publicID string) (*model.User, erro
 		return nil, err
 	}
 	var user model.User
-	if err := pgxscan.Get(ctx, s.db, &user, query, args...); err != nil {
+	if err := pgxscan.Get(ctx, dbx.GetConnOrTx(ctx, s.db), &user, query, args...); err != nil {
 		return nil, err
 	}
 
-	return &user, nil
+	return s.decryptOtpSecret(&user)
+}
+
+func (s *UserStore) GetByID(ctx context.Context, id uint64) (*model.User, error) {
+	builder := pgsql.Select(
+		defaultUserFields...,
+	).From(usersTable).Where(squirrel.Eq{"id": id})
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return nil, err
+	}
+	var user model.User
+	if err := pgxscan.Get(ctx, dbx.GetConnOrTx(ctx, s.db), &user, query, args...); err != nil {
+		return nil, err
+	}
+
+	return s.decryptOtpSecret(&user)
 }
 
 func (s *UserStore) GetByEmail(ctx context.Context, email string) (*model.User, error) {
@@ -96,11 +135,11 @@ func (s *UserStore) GetByEmail(ctx context.Context, email string) (*model.User,
 		return nil, err
 	}
 	var user model.User
-	if err := pgxscan.Get(ctx, s.db, &user, query, args...); err != nil {
+	if err := pgxscan.Get(ctx, dbx.GetConnOrTx(ctx, s.db), &user, query, args...); err != nil {
 		return nil, err
 	}
 
-	return &user, nil
+	return s.decryptOtpSecret(&user)
 }
 
 func (s *UserStore) GetByActivationCode(ctx context.Context, activationCode string) (*model.User, error) {
@@ -113,17 +152,69 @@ func (s *UserStore) GetByActivationCode(ctx context.Context, activationCode stri
 		return nil, err
 	}
 	var user model.User
-	if err := pgxscan.Get(ctx, s.db, &user, query, args...); err != nil {
+	if err := pgxscan.Get(ctx, dbx.GetConnOrTx(ctx, s.db), &user, query, args...); err != nil {
 		return nil, err
 	}
 
-	return &user, nil
+	return s.decryptOtpSecret(&user)
 }
 
-func (s *UserStore) Activate(ctx context.Context, publicID string) error {
+func (s *UserStore) GetByResetPassword(ctx context.Context, resetCode string) (*model.User, error) {
+	builder := pgsql.Select(
+		defaultUserFields...,
+	).From(usersTable).Where(squirrel.Eq{"reset_password_code": resetCode})
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return nil, err
+	}
+	var user model.User
+	if err := pgxscan.Get(ctx, dbx.GetConnOrTx(ctx, s.db), &user, query, args...); err != nil {
+		return nil, err
+	}
+
+	return s.decryptOtpSecret(&user)
+}
+
+// ChangePassword sets a new password hash and moves the current one to the password history.
+func (s *UserStore) ChangePassword(ctx context.Context, publicID, newPassword string) error {
+	now := time.Now()
+	return pgx.BeginFunc(ctx, dbx.GetConnOrTx(ctx, s.db), func(tx pgx.Tx) error {
+		history := pgsql.Select("id", "password").Column(squirrel.Expr("?::timestamp", now)).
+			From(usersTable).Where(squirrel.Eq{"public_id": publicID})
+		query, args, err := pgsql.Insert(passwordHistoryTable).
+			Columns("user_id", "password", "created_at").
+			Select(history).ToSql()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, query, args...); err != nil {
+			return err
+		}
+
+		query, args, err = pgsql.Update(usersTable).SetMap(map[string]interface{}{
+			"password":            newPassword,
+			"password_changed_at": now,
+		}).Where(squirrel.Eq{"public_id": publicID}).ToSql()
+		if err != nil {
+			return err
+		}
+		conn, err := tx.Exec(ctx, query, args...)
+		if err != nil {
+			return err
+		}
+		if conn.RowsAffected() == 0 {
+			return fmt.Errorf("failed to update")
+		}
+		return nil
+	})
+}
+
+// UpdatePasswordHash replaces the hash of the same password, e.g. with a stronger algorithm,
+// so it is neither recorded in the history nor counted as a password change.
+func (s *UserStore) UpdatePasswordHash(ctx context.Context, publicID, password string) error {
 	builder := pgsql.Update(usersTable).SetMap(map[string]interface{}{
-		"activation_code": nil,
-		"status":          model.UserStatusActivate,
+		"password": password,
 	}).Where(squirrel.Eq{"public_id": publicID})
 
 	query, args, err := builder.ToSql()
@@ -131,7 +222,7 @@ func (s *UserStore) Activate(ctx context.Context, publicID string) error {
 		return err
 	}
 
-	conn, err := s.db.Exec(ctx, query, args...)
+	conn, err := dbx.GetConnOrTx(ctx, s.db).Exec(ctx, query, args...)
 	if err != nil {
 		return err
 	}
@@ -141,26 +232,139 @@ func (s *UserStore) Activate(ctx context.Context, publicID string) error {
 	return nil
 }
 
-func (s *UserStore) GetByResetPassword(ctx context.Context, resetCode string) (*model.User, error) {
+// ChangeEmail replaces the email of the user, it fails with a duplicate error when the email is taken.
+func (s *UserStore) ChangeEmail(ctx context.Context, publicID, email string) error {
+	builder := pgsql.Update(usersTable).SetMap(map[string]interface{}{
+		"email":      email,
+		"updated_at": time.Now(),
+	}).Where(squirrel.Eq{"public_id": publicID})
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return err
+	}
+
+	conn, err := dbx.GetConnOrTx(ctx, s.db).Exec(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	if conn.RowsAffected() == 0 {
+		return fmt.Errorf("failed to update")
+	}
+	return nil
+}
+
+// ListDeletedBefore returns the users soft deleted before the time, the earliest first.
+func (s *UserStore) ListDeletedBefore(ctx context.Context, before time.Time, limit uint64) ([]*model.User, error) {
 	builder := pgsql.Select(
 		defaultUserFields...,
-	).From(usersTable).Where(squirrel.Eq{"reset_code": resetCode})
+	).From(usersTable).Where(squirrel.Lt{"deleted_at": before}).OrderBy("deleted_at", "id").Limit(limit)
 
 	query, args, err := builder.ToSql()
 	if err != nil {
 		return nil, err
 	}
-	var user model.User
-	if err := pgxscan.Get(ctx, s.db, &user, query, args...); err != nil {
+	users := make([]*model.User, 0)
+	if err := pgxscan.Select(ctx, dbx.GetConnOrTx(ctx, s.db), &users, query, args...); err != nil {
 		return nil, err
 	}
 
-	return &user, nil
+	return s.decryptOtpSecrets(users)
 }
 
-func (s *UserStore) ChangePassword(ctx context.Context, publicID, newPassword string) error {
+// Purge deletes the user with everything stored about them, including the outbox messages about them.
+// Only the deleted event is kept while it is not delivered, consumers still have to learn about the
+// deletion and it holds nothing but the public id. An organization the user owned alone gets the
+// earliest admin, or else the earliest member, as its owner, and is deleted when nobody else is left in it.
+func (s *UserStore) Purge(ctx context.Context, user *model.User) error {
+	return pgx.BeginFunc(ctx, dbx.GetConnOrTx(ctx, s.db), func(tx pgx.Tx) error {
+		// the sub queries keep the question placeholders, the outer builder numbers them
+		sessionIDs := squirrel.Select("id").From(sessionsTable).Where(squirrel.Eq{"user_id": user.ID})
+		otherOwners := squirrel.Select("1").From(membershipsTable + " o").
+			Where("o.organization_id = m.organization_id").
+			Where(squirrel.Eq{"o.role": model.OrgRoleOwner}).
+			Where(squirrel.NotEq{"o.user_id": user.ID})
+		ownedAlone := squirrel.Select("m.organization_id").From(membershipsTable + " m").
+			Where(squirrel.Eq{"m.user_id": user.ID, "m.role": model.OrgRoleOwner}).
+			Where(squirrel.Expr("not exists (?)", otherOwners))
+		successors := squirrel.Select("distinct on (organization_id) id").From(membershipsTable).
+			Where(squirrel.Expr("organization_id in (?)", ownedAlone)).
+			Where(squirrel.NotEq{"user_id": user.ID}).
+			OrderByClause("organization_id, role = ? desc, id", model.OrgRoleAdmin)
+		otherMembers := squirrel.Select("1").From(membershipsTable + " o").
+			Where("o.organization_id = m.organization_id").
+			Where(squirrel.NotEq{"o.user_id": user.ID})
+		leftAlone := squirrel.Select("m.organization_id").From(membershipsTable + " m").
+			Where(squirrel.Eq{"m.user_id": user.ID}).
+			Where(squirrel.Expr("not exists (?)", otherMembers))
+
+		// the organizations are settled first, they are found through the memberships of the user
+		builders := []squirrel.Sqlizer{
+			pgsql.Update(membershipsTable).SetMap(map[string]interface{}{
+				"role":       model.OrgRoleOwner,
+				"updated_at": time.Now(),
+			}).Where(squirrel.Expr("id in (?)", successors)),
+			pgsql.Delete(organizationInvitesTable).Where(squirrel.Expr("organization_id in (?)", leftAlone)),
+			pgsql.Delete(organizationsTable).Where(squirrel.Expr("id in (?)", leftAlone)),
+			pgsql.Delete(organizationInvitesTable).Where(squirrel.Expr("lower(email) = lower(?)", user.Email)),
+			pgsql.Update(organizationInvitesTable).Set("invited_by", nil).Where(squirrel.Eq{"invited_by": user.ID}),
+			pgsql.Delete(refreshTokensTable).Where(squirrel.Expr("session_id in (?)", sessionIDs)),
+			pgsql.Delete(sessionsTable).Where(squirrel.Eq{"user_id": user.ID}),
+			pgsql.Delete(authorizationCodesTable).Where(squirrel.Eq{"user_id": user.ID}),
+			pgsql.Delete(apiKeysTable).Where(squirrel.Eq{"user_id": user.ID}),
+			pgsql.Delete(webAuthnCredentialsTable).Where(squirrel.Eq{"user_id": user.ID}),
+			pgsql.Delete(webAuthnSessionsTable).Where(squirrel.Eq{"user_id": user.ID}),
+			pgsql.Delete(magicLinksTable).Where(squirrel.Eq{"user_id": user.ID}),
+			pgsql.Delete(emailChangesTable).Where(squirrel.Eq{"user_id": user.ID}),
+			pgsql.Delete(passwordHistoryTable).Where(squirrel.Eq{"user_id": user.ID}),
+			pgsql.Delete(auditEventsTable).Where(squirrel.Eq{"user_id": user.ID}),
+			pgsql.Delete(userRolesTable).Where(squirrel.Eq{"user_id": user.ID}),
+			pgsql.Delete(membershipsTable).Where(squirrel.Eq{"user_id": user.ID}),
+			pgsql.Delete(trustedDevicesTable).Where(squirrel.Eq{"user_id": user.ID}),
+			pgsql.Delete(recoveryCodesTable).Where(squirrel.Eq{"user_id": user.ID}),
+			pgsql.Delete(outboxTable).Where(squirrel.Or{
+				squirrel.Eq{"msg->>'public_id'": user.PublicID},
+				squirrel.Eq{"msg->>'user_public_id'": user.PublicID},
+				squirrel.Expr("lower(msg->>'email') = lower(?)", user.Email),
+			}).Where(squirrel.Or{
+				squirrel.NotEq{"topic": constants.TopicUserDeleted},
+				squirrel.NotEq{"status": model.CreatedStatus},
+			}),
+			pgsql.Delete(usersTable).Where(squirrel.Eq{"id": user.ID}),
+		}
+		for _, builder := range builders {
+			query, args, err := builder.ToSql()
+			if err != nil {
+				return err
+			}
+			if _, err := tx.Exec(ctx, query, args...); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// ListPasswordHistory returns the hashes of the previous passwords of the user, the latest first.
+func (s *UserStore) ListPasswordHistory(ctx context.Context, userID uint64, limit uint64) ([]string, error) {
+	query, args, err := pgsql.Select("password").From(passwordHistoryTable).
+		Where(squirrel.Eq{"user_id": userID}).
+		OrderBy("created_at desc", "id desc").
+		Limit(limit).ToSql()
+	if err != nil {
+		return nil, err
+	}
+	passwords := make([]string, 0)
+	if err := pgxscan.Select(ctx, dbx.GetConnOrTx(ctx, s.db), &passwords, query, args...); err != nil {
+		return nil, err
+	}
+	return passwords, nil
+}
+
+func (s *UserStore) ResetPasswordRequest(ctx context.Context, publicID, resetCode string) error {
 	builder := pgsql.Update(usersTable).SetMap(map[string]interface{}{
-		"password": newPassword,
+		"reset_password_code": resetCode,
+		"updated_at":          time.Now(),
 	}).Where(squirrel.Eq{"public_id": publicID})
 
 	query, args, err := builder.ToSql()
@@ -168,7 +372,7 @@ func (s *UserStore) ChangePassword(ctx context.Context, publicID, newPassword st
 		return err
 	}
 
-	conn, err := s.db.Exec(ctx, query, args...)
+	conn, err := dbx.GetConnOrTx(ctx, s.db).Exec(ctx, query, args...)
 	if err != nil {
 		return err
 	}
@@ -178,10 +382,40 @@ func (s *UserStore) ChangePassword(ctx context.Context, publicID, newPassword st
 	return nil
 }
 
-func (s *UserStore) ResetPasswordRequest(ctx context.Context, publicID, resetCode string) error {
+// UseResetPasswordCode forgets the code so the link resets the password once, it reports false when the
+// code was used meanwhile.
+func (s *UserStore) UseResetPasswordCode(ctx context.Context, publicID, resetCode string) (bool, error) {
 	builder := pgsql.Update(usersTable).SetMap(map[string]interface{}{
-		"reset_password_code": resetCode,
+		"reset_password_code": nil,
 		"updated_at":          time.Now(),
+	}).Where(squirrel.Eq{"public_id": publicID, "reset_password_code": resetCode})
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return false, err
+	}
+
+	conn, err := dbx.GetConnOrTx(ctx, s.db).Exec(ctx, query, args...)
+	if err != nil {
+		return false, err
+	}
+	return conn.RowsAffected() == 1, nil
+}
+
+// SetOtpSecret stores a new secret with the parameters it was generated for, the steps used with
+// the previous secret are forgotten.
+func (s *UserStore) SetOtpSecret(ctx context.Context, publicID, otpSecret, algorithm string, digits, period int) error {
+	encrypted, err := s.cipher.Encrypt(otpSecret, []byte(publicID))
+	if err != nil {
+		return err
+	}
+	builder := pgsql.Update(usersTable).SetMap(map[string]interface{}{
+		"otp_secret":    encrypted,
+		"otp_algorithm": algorithm,
+		"otp_digits":    digits,
+		"otp_period":    period,
+		"otp_last_step": nil,
+		"updated_at":    time.Now(),
 	}).Where(squirrel.Eq{"public_id": publicID})
 
 	query, args, err := builder.ToSql()
@@ -189,7 +423,7 @@ func (s *UserStore) ResetPasswordRequest(ctx context.Context, publicID, resetCod
 		return err
 	}
 
-	conn, err := s.db.Exec(ctx, query, args...)
+	conn, err := dbx.GetConnOrTx(ctx, s.db).Exec(ctx, query, args...)
 	if err != nil {
 		return err
 	}
@@ -199,10 +433,29 @@ func (s *UserStore) ResetPasswordRequest(ctx context.Context, publicID, resetCod
 	return nil
 }
 
-func (s *UserStore) RemoveCodeFromRecoveryCode(ctx context.Context, publicID, code string) error {
+// EnableOtp turns otp on, it reports false when it was on already, so an enrolment completes once.
+func (s *UserStore) EnableOtp(ctx context.Context, publicID string) (bool, error) {
 	builder := pgsql.Update(usersTable).SetMap(map[string]interface{}{
-		"otp_recovery_codes": squirrel.Expr("array_remove(otp_recovery_codes, ?)", code),
-		"updated_at":         time.Now(),
+		"otp_enabled": true,
+		"updated_at":  time.Now(),
+	}).Where(squirrel.Eq{"public_id": publicID, "otp_enabled": false})
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return false, err
+	}
+
+	conn, err := dbx.GetConnOrTx(ctx, s.db).Exec(ctx, query, args...)
+	if err != nil {
+		return false, err
+	}
+	return conn.RowsAffected() == 1, nil
+}
+
+func (s *UserStore) SetOtpEnabled(ctx context.Context, publicID string, isEnabled bool) error {
+	builder := pgsql.Update(usersTable).SetMap(map[string]interface{}{
+		"otp_enabled": isEnabled,
+		"updated_at":  time.Now(),
 	}).Where(squirrel.Eq{"public_id": publicID})
 
 	query, args, err := builder.ToSql()
@@ -210,7 +463,7 @@ func (s *UserStore) RemoveCodeFromRecoveryCode(ctx context.Context, publicID, co
 		return err
 	}
 
-	conn, err := s.db.Exec(ctx, query, args...)
+	conn, err := dbx.GetConnOrTx(ctx, s.db).Exec(ctx, query, args...)
 	if err != nil {
 		return err
 	}
@@ -220,10 +473,10 @@ func (s *UserStore) RemoveCodeFromRecoveryCode(ctx context.Context, publicID, co
 	return nil
 }
 
-func (s *UserStore) SetOtpSecret(ctx context.Context, publicID, otpSecret string) error {
+func (s *UserStore) SetTokensValidAfter(ctx context.Context, publicID string, validAfter time.Time) error {
 	builder := pgsql.Update(usersTable).SetMap(map[string]interface{}{
-		"otp_secret": otpSecret,
-		"updated_at": time.Now(),
+		"tokens_valid_after": validAfter,
+		"updated_at":         time.Now(),
 	}).Where(squirrel.Eq{"public_id": publicID})
 
 	query, args, err := builder.ToSql()
@@ -231,7 +484,7 @@ func (s *UserStore) SetOtpSecret(ctx context.Context, publicID, otpSecret string
 		return err
 	}
 
-	conn, err := s.db.Exec(ctx, query, args...)
+	conn, err := dbx.GetConnOrTx(ctx, s.db).Exec(ctx, query, args...)
 	if err != nil {
 		return err
 	}
@@ -241,18 +494,111 @@ func (s *UserStore) SetOtpSecret(ctx context.Context, publicID, otpSecret string
 	return nil
 }
 
-func (s *UserStore) SetOtpRecoveryCodes(ctx context.Context, publicID string, codes []string) error {
+// UseOtpStep remembers the time step of an accepted otp code. It reports false when the step or a later
+// one was used already, so a code works once even when it is still valid.
+func (s *UserStore) UseOtpStep(ctx context.Context, publicID string, step uint64) (bool, error) {
 	builder := pgsql.Update(usersTable).SetMap(map[string]interface{}{
-		"otp_recovery_codes": codes,
-		"updated_at":         time.Now(),
-	}).Where(squirrel.Eq{"public_id": publicID})
+		"otp_last_step": step,
+	}).Where(squirrel.Eq{"public_id": publicID}).
+		Where(squirrel.Or{squirrel.Eq{"otp_last_step": nil}, squirrel.Lt{"otp_last_step": step}})
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return false, err
+	}
+
+	conn, err := dbx.GetConnOrTx(ctx, s.db).Exec(ctx, query, args...)
+	if err != nil {
+		return false, err
+	}
+	return conn.RowsAffected() == 1, nil
+}
+
+// List returns a page of users matching the filter, the latest registered first.
+func (s *UserStore) List(ctx context.Context, filter *model.UserFilter) ([]*model.User, error) {
+	builder := userFilter(pgsql.Select(defaultUserFields...).From(usersTable), filter).
+		OrderBy("id desc").
+		Limit(filter.Limit).
+		Offset(filter.Offset)
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return nil, err
+	}
+	users := make([]*model.User, 0)
+	if err := pgxscan.Select(ctx, dbx.GetConnOrTx(ctx, s.db), &users, query, args...); err != nil {
+		return nil, err
+	}
+
+	return s.decryptOtpSecrets(users)
+}
+
+// Count returns the number of users matching the filter, the page is ignored.
+func (s *UserStore) Count(ctx context.Context, filter *model.UserFilter) (uint64, error) {
+	query, args, err := userFilter(pgsql.Select("count(*)").From(usersTable), filter).ToSql()
+	if err != nil {
+		return 0, err
+	}
+	var count uint64
+	if err := dbx.GetConnOrTx(ctx, s.db).QueryRow(ctx, query, args...).Scan(&count); err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+func userFilter(builder squirrel.SelectBuilder, filter *model.UserFilter) squirrel.SelectBuilder {
+	if filter.Query != "" {
+		pattern := "%" + escapeLike(filter.Query) + "%"
+		builder = builder.Where(squirrel.Or{
+			squirrel.ILike{"email": pattern},
+			squirrel.ILike{"first_name": pattern},
+			squirrel.ILike{"last_name": pattern},
+		})
+	}
+	if filter.Status != "" {
+		builder = builder.Where(squirrel.Eq{"status": filter.Status})
+	}
+	return builder
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// escapeLike makes the wildcards of the search query match literally.
+func escapeLike(query string) string {
+	return likeEscaper.Replace(query)
+}
+
+// SetStatus moves the user from one status to another, it fails if the status was changed meanwhile.
+// Activated users have nothing to activate anymore and deleted users are purged after the deleted_at.
+func (s *UserStore) SetStatus(
+	ctx context.Context,
+	publicID string,
+	from, to model.UserStatus,
+	reason string,
+	changedAt time.Time,
+) error {
+	values := map[string]interface{}{
+		"status":            to,
+		"status_reason":     reason,
+		"status_changed_at": changedAt,
+		"updated_at":        changedAt,
+	}
+	switch to {
+	case model.UserStatusActivate:
+		values["activation_code"] = nil
+	case model.UserStatusDeleted:
+		values["deleted_at"] = changedAt
+	}
+	builder := pgsql.Update(usersTable).SetMap(values).
+		Where(squirrel.Eq{"public_id": publicID, "status": from})
 
 	query, args, err := builder.ToSql()
 	if err != nil {
 		return err
 	}
 
-	conn, err := s.db.Exec(ctx, query, args...)
+	conn, err := dbx.GetConnOrTx(ctx, s.db).Exec(ctx, query, args...)
 	if err != nil {
 		return err
 	}
@@ -262,10 +608,16 @@ func (s *UserStore) SetOtpRecoveryCodes(ctx context.Context, publicID string, co
 	return nil
 }
 
-func (s *UserStore) SetOtpEnabled(ctx context.Context, publicID string, isEnabled bool) error {
+// ResetOtp disables otp and forgets the secret, the user has to enroll again.
+func (s *UserStore) ResetOtp(ctx context.Context, publicID string) error {
 	builder := pgsql.Update(usersTable).SetMap(map[string]interface{}{
-		"otp_enabled": isEnabled,
-		"updated_at":  time.Now(),
+		"otp_enabled":   false,
+		"otp_secret":    "",
+		"otp_algorithm": nil,
+		"otp_digits":    nil,
+		"otp_period":    nil,
+		"otp_last_step": nil,
+		"updated_at":    time.Now(),
 	}).Where(squirrel.Eq{"public_id": publicID})
 
 	query, args, err := builder.ToSql()
@@ -273,7 +625,7 @@ func (s *UserStore) SetOtpEnabled(ctx context.Context, publicID string, isEnable
 		return err
 	}
 
-	conn, err := s.db.Exec(ctx, query, args...)
+	conn, err := dbx.GetConnOrTx(ctx, s.db).Exec(ctx, query, args...)
 	if err != nil {
 		return err
 	}
@@ -282,3 +634,71 @@ func (s *UserStore) SetOtpEnabled(ctx context.Context, publicID string, isEnable
 	}
 	return nil
 }
+
+// the public id is the associated data, a secret copied to another user doesn't decrypt.
+func (s *UserStore) decryptOtpSecret(user *model.User) (*model.User, error) {
+	otpSecret, err := s.cipher.Decrypt(user.OtpSecret, []byte(user.PublicID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt otp secret: %w", err)
+	}
+	user.OtpSecret = otpSecret
+	return user, nil
+}
+
+func (s *UserStore) decryptOtpSecrets(users []*model.User) ([]*model.User, error) {
+	for _, user := range users {
+		if _, err := s.decryptOtpSecret(user); err != nil {
+			return nil, err
+		}
+	}
+	return users, nil
+}
+
+// ReencryptOtpSecrets rewrites under the primary key the otp secrets of up to limit users with an id
+// above afterID. It returns the last id it looked at, 0 when no users are left, and the number of
+// rewritten secrets. A secret changed meanwhile is left alone, it is written under the primary key anyway.
+func (s *UserStore) ReencryptOtpSecrets(ctx context.Context, afterID, limit uint64) (uint64, int, error) {
+	builder := pgsql.Select("id", "public_id", "otp_secret").From(usersTable).
+		Where(squirrel.Gt{"id": afterID}).
+		Where(squirrel.NotEq{"otp_secret": ""}).
+		OrderBy("id").
+		Limit(limit)
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return 0, 0, err
+	}
+	users := make([]*model.User, 0)
+	if err := pgxscan.Select(ctx, dbx.GetConnOrTx(ctx, s.db), &users, query, args...); err != nil {
+		return 0, 0, err
+	}
+
+	var lastID uint64
+	reencrypted := 0
+	for _, user := range users {
+		lastID = user.ID
+		if !s.cipher.NeedsReencrypt(user.OtpSecret) {
+			continue
+		}
+		otpSecret, err := s.cipher.Decrypt(user.OtpSecret, []byte(user.PublicID))
+		if err != nil {
+			return lastID, reencrypted, fmt.Errorf("failed to decrypt otp secret of %s: %w", user.PublicID, err)
+		}
+		encrypted, err := s.cipher.Encrypt(otpSecret, []byte(user.PublicID))
+		if err != nil {
+			return lastID, reencrypted, err
+		}
+		query, args, err := pgsql.Update(usersTable).SetMap(map[string]interface{}{
+			"otp_secret": encrypted,
+		}).Where(squirrel.Eq{"id": user.ID, "otp_secret": user.OtpSecret}).ToSql()
+		if err != nil {
+			return lastID, reencrypted, err
+		}
+		conn, err := dbx.GetConnOrTx(ctx, s.db).Exec(ctx, query, args...)
+		if err != nil {
+			return lastID, reencrypted, err
+		}
+		reencrypted += int(conn.RowsAffected())
+	}
+	return lastID, reencrypted, nil
+}
@@ -0,0 +1,213 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/georgysavva/scany/v2/pgxscan"
+	"github.com/theruziev/oson_auth/internal/model"
+	"github.com/theruziev/oson_auth/internal/pkg/dbx"
+)
+
+const (
+	webAuthnCredentialsTable = "webauthn_credentials"
+	webAuthnSessionsTable    = "webauthn_sessions"
+)
+
+var defaultWebAuthnCredentialFields = []string{
+	"id",
+	"user_id",
+	"credential_id",
+	"public_key",
+	"attestation_type",
+	"transports",
+	"aaguid",
+	"sign_count",
+	"backup_eligible",
+	"backup_state",
+	"name",
+	"created_at",
+	"last_used_at",
+}
+
+var defaultWebAuthnSessionFields = []string{
+	"id",
+	"challenge",
+	"ceremony",
+	"coalesce(user_id, 0) as user_id",
+	"data",
+	"expires_at",
+	"created_at",
+}
+
+type WebAuthnStore struct {
+	db dbx.Querier
+}
+
+func NewWebAuthnStore(db dbx.Querier) *WebAuthnStore {
+	return &WebAuthnStore{
+		db: db,
+	}
+}
+
+func (s *WebAuthnStore) InsertCredential(ctx context.Context, credential *model.WebAuthnCredential) error {
+	builder := pgsql.Insert(webAuthnCredentialsTable).SetMap(map[string]interface{}{
+		"user_id":          credential.UserID,
+		"credential_id":    credential.CredentialID,
+		"public_key":       credential.PublicKey,
+		"attestation_type": credential.AttestationType,
+		"transports":       credential.Transports,
+		"aaguid":           credential.AAGUID,
+		"sign_count":       credential.SignCount,
+		"backup_eligible":  credential.BackupEligible,
+		"backup_state":     credential.BackupState,
+		"name":             credential.Name,
+		"created_at":       credential.CreatedAt,
+	}).Suffix("returning id")
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return err
+	}
+
+	return pgxscan.Get(ctx, dbx.GetConnOrTx(ctx, s.db), credential, query, args...)
+}
+
+func (s *WebAuthnStore) ListCredentials(ctx context.Context, userID uint64) ([]*model.WebAuthnCredential, error) {
+	builder := pgsql.Select(
+		defaultWebAuthnCredentialFields...,
+	).From(webAuthnCredentialsTable).Where(squirrel.Eq{"user_id": userID}).OrderBy("id")
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return nil, err
+	}
+	credentials := make([]*model.WebAuthnCredential, 0)
+	if err := pgxscan.Select(ctx, dbx.GetConnOrTx(ctx, s.db), &credentials, query, args...); err != nil {
+		return nil, err
+	}
+
+	return credentials, nil
+}
+
+func (s *WebAuthnStore) HasCredentials(ctx context.Context, userID uint64) (bool, error) {
+	query, args, err := pgsql.Select("1").From(webAuthnCredentialsTable).
+		Where(squirrel.Eq{"user_id": userID}).Prefix("select exists(").Suffix(")").ToSql()
+	if err != nil {
+		return false, err
+	}
+	var exists bool
+	if err := dbx.GetConnOrTx(ctx, s.db).QueryRow(ctx, query, args...).Scan(&exists); err != nil {
+		return false, err
+	}
+	return exists, nil
+}
+
+// UpdateCredentialUsage stores the signature counter and backup state reported by the last assertion.
+func (s *WebAuthnStore) UpdateCredentialUsage(ctx context.Context, credential *model.WebAuthnCredential) error {
+	builder := pgsql.Update(webAuthnCredentialsTable).SetMap(map[string]interface{}{
+		"sign_count":   credential.SignCount,
+		"backup_state": credential.BackupState,
+		"last_used_at": credential.LastUsedAt,
+	}).Where(squirrel.Eq{"id": credential.ID})
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return err
+	}
+
+	conn, err := dbx.GetConnOrTx(ctx, s.db).Exec(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	if conn.RowsAffected() == 0 {
+		return fmt.Errorf("failed to update")
+	}
+	return nil
+}
+
+// DeleteAllCredentials removes every passkey of the user.
+func (s *WebAuthnStore) DeleteAllCredentials(ctx context.Context, userID uint64) error {
+	builder := pgsql.Delete(webAuthnCredentialsTable).Where(squirrel.Eq{"user_id": userID})
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return err
+	}
+
+	_, err = dbx.GetConnOrTx(ctx, s.db).Exec(ctx, query, args...)
+	return err
+}
+
+func (s *WebAuthnStore) DeleteCredential(ctx context.Context, userID, id uint64) error {
+	builder := pgsql.Delete(webAuthnCredentialsTable).Where(squirrel.Eq{
+		"id":      id,
+		"user_id": userID,
+	})
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return err
+	}
+
+	conn, err := dbx.GetConnOrTx(ctx, s.db).Exec(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	if conn.RowsAffected() == 0 {
+		return fmt.Errorf("failed to delete")
+	}
+	return nil
+}
+
+func (s *WebAuthnStore) InsertSession(ctx context.Context, session *model.WebAuthnSession) error {
+	values := map[string]interface{}{
+		"challenge":  session.Challenge,
+		"ceremony":   session.Ceremony,
+		"data":       session.Data,
+		"expires_at": session.ExpiresAt,
+		"created_at": session.CreatedAt,
+	}
+	if session.UserID != 0 {
+		values["user_id"] = session.UserID
+	}
+	builder := pgsql.Insert(webAuthnSessionsTable).SetMap(values).Suffix("returning id")
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return err
+	}
+
+	return pgxscan.Get(ctx, dbx.GetConnOrTx(ctx, s.db), session, query, args...)
+}
+
+// TakeSession removes the ceremony with the challenge and returns it, so every challenge is answered only once.
+func (s *WebAuthnStore) TakeSession(ctx context.Context, challenge string, ceremony model.WebAuthnCeremony) (*model.WebAuthnSession, error) {
+	builder := pgsql.Delete(webAuthnSessionsTable).Where(squirrel.Eq{
+		"challenge": challenge,
+		"ceremony":  ceremony,
+	}).Suffix("returning " + strings.Join(defaultWebAuthnSessionFields, ", "))
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return nil, err
+	}
+	var session model.WebAuthnSession
+	if err := pgxscan.Get(ctx, dbx.GetConnOrTx(ctx, s.db), &session, query, args...); err != nil {
+		return nil, err
+	}
+
+	return &session, nil
+}
+
+func (s *WebAuthnStore) DeleteExpiredSessions(ctx context.Context, now time.Time) error {
+	query, args, err := pgsql.Delete(webAuthnSessionsTable).Where(squirrel.Lt{"expires_at": now}).ToSql()
+	if err != nil {
+		return err
+	}
+	_, err = dbx.GetConnOrTx(ctx, s.db).Exec(ctx, query, args...)
+	return err
+}
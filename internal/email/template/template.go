@@ -12,8 +12,24 @@ var welcomeEmailHTML string
 //go:embed reset-password.html
 var resetPasswordHTML string
 
+//go:embed magic-link.html
+var magicLinkHTML string
+
+//go:embed email-change.html
+var emailChangeHTML string
+
+//go:embed email-changing.html
+var emailChangingHTML string
+
+//go:embed org-invite.html
+var orgInviteHTML string
+
 var welcomeEmailTemplate = template.Must(template.New("welcome").Parse(welcomeEmailHTML))
 var resetPasswordTemplate = template.Must(template.New("reset-password").Parse(resetPasswordHTML))
+var magicLinkTemplate = template.Must(template.New("magic-link").Parse(magicLinkHTML))
+var emailChangeTemplate = template.Must(template.New("email-change").Parse(emailChangeHTML))
+var emailChangingTemplate = template.Must(template.New("email-changing").Parse(emailChangingHTML))
+var orgInviteTemplate = template.Must(template.New("org-invite").Parse(orgInviteHTML))
 
 func WelcomeEmail(name, activationLink string) (string, error) {
 	data := struct {
@@ -49,3 +65,73 @@ func ResetPasswordEmail(name, resetLink string) (string, error) {
 
 	return strBuffer.String(), nil
 }
+
+func MagicLinkEmail(name, loginLink string) (string, error) {
+	data := struct {
+		Name      string
+		LoginLink string
+	}{
+		Name:      name,
+		LoginLink: loginLink,
+	}
+
+	strBuffer := bytes.NewBufferString("")
+	if err := magicLinkTemplate.Execute(strBuffer, data); err != nil {
+		return "", err
+	}
+
+	return strBuffer.String(), nil
+}
+
+func EmailChangeEmail(name, confirmLink string) (string, error) {
+	data := struct {
+		Name        string
+		ConfirmLink string
+	}{
+		Name:        name,
+		ConfirmLink: confirmLink,
+	}
+
+	strBuffer := bytes.NewBufferString("")
+	if err := emailChangeTemplate.Execute(strBuffer, data); err != nil {
+		return "", err
+	}
+
+	return strBuffer.String(), nil
+}
+
+func EmailChangingEmail(name, newEmail string) (string, error) {
+	data := struct {
+		Name     string
+		NewEmail string
+	}{
+		Name:     name,
+		NewEmail: newEmail,
+	}
+
+	strBuffer := bytes.NewBufferString("")
+	if err := emailChangingTemplate.Execute(strBuffer, data); err != nil {
+		return "", err
+	}
+
+	return strBuffer.String(), nil
+}
+
+func OrgInviteEmail(inviterName, organizationName, inviteLink string) (string, error) {
+	data := struct {
+		InviterName      string
+		OrganizationName string
+		InviteLink       string
+	}{
+		InviterName:      inviterName,
+		OrganizationName: organizationName,
+		InviteLink:       inviteLink,
+	}
+
+	strBuffer := bytes.NewBufferString("")
+	if err := orgInviteTemplate.Execute(strBuffer, data); err != nil {
+		return "", err
+	}
+
+	return strBuffer.String(), nil
+}
@@ -3,4 +3,8 @@ package constants
 const (
 	QueueResetPasswordEmail = "reset-password-queue"
 	QueueWelcomeEmail       = "welcome-queue"
+	QueueMagicLinkEmail     = "magic-link-queue"
+	QueueEmailChangeEmail   = "email-change-queue"
+	QueueEmailChangingEmail = "email-changing-queue"
+	QueueOrgInviteEmail     = "org-invite-queue"
 )
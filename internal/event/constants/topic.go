@@ -3,5 +3,14 @@ package constants
 const (
 	TopicRegisteredUser    = "user.be.registered"
 	TopicUserChanged       = "user.cud.changed"
+	TopicUserDeleted       = "user.cud.deleted"
+	TopicUserAdminAction   = "user.be.admin_action"
 	TopicUserResetPassword = "user.be.reset_password" //nolint:gosec
+	TopicUserMagicLink     = "user.be.magic_link"
+	TopicUserEmailChange   = "user.be.email_change"
+	TopicUserEmailChanging = "user.be.email_changing"
+
+	TopicOrganizationChanged    = "organization.cud.changed"
+	TopicOrganizationMembership = "organization.cud.membership"
+	TopicOrganizationInvite     = "organization.be.invite"
 )
@@ -16,15 +16,22 @@ import (
 )
 
 const (
-	repeats        = 3
-	repeatsDelay   = 5 * time.Second
-	resetSubject   = "Reset Password"
-	welcomeSubject = "Welcome"
+	repeats              = 3
+	repeatsDelay         = 5 * time.Second
+	resetSubject         = "Reset Password"
+	welcomeSubject       = "Welcome"
+	magicLinkSubject     = "Sign in to Oson"
+	emailChangeSubject   = "Confirm your new email"
+	emailChangingSubject = "Your email is being changed"
+	orgInviteSubject     = "You are invited to join %s on Oson"
 )
 
 type ConsumerOpt struct {
 	ActivationLinkTemplate string        `help:"kafka address" required:"" env:"ACTIVATION_LINK_FORMAT"`
 	ResetPasswordFormat    string        `help:"kafka address" required:"" env:"RESET_PASSWORD_LINK_FORMAT"`
+	MagicLinkFormat        string        `help:"magic link login url format, %s is replaced with the token" required:"" env:"MAGIC_LINK_FORMAT"`
+	EmailChangeFormat      string        `help:"email change confirmation url format, %s is replaced with the token" required:"" env:"EMAIL_CHANGE_FORMAT"`
+	OrgInviteFormat        string        `help:"organization invite url format, %s is replaced with the token" required:"" env:"ORG_INVITE_FORMAT"`
 	Sender                 string        `help:"kafka address" required:"" env:"SENDER"`
 	Timeout                time.Duration `help:"kafka address" required:"" env:"TIMEOUT"`
 }
@@ -121,3 +128,172 @@ func (c *ConsumerHandler) WelcomeMessageEmail(ctx context.Context) func(message
 		return rabbitmq.Ack
 	}
 }
+
+func (c *ConsumerHandler) MagicLinkEmail(ctx context.Context) func(message rabbitmq.Delivery) rabbitmq.Action {
+	return func(message rabbitmq.Delivery) rabbitmq.Action {
+		logger := logging.FromContext(ctx).With(
+			zap.String("id", message.MessageId),
+			zap.String("response", message.RoutingKey),
+		)
+		logger.Infof("new message")
+		var magicLinkEvent v0.UserMagicLinkEvent
+		if err := json.Unmarshal(message.Body, &magicLinkEvent); err != nil {
+			logger.Error("failed to process json: %s", err)
+			return rabbitmq.NackDiscard
+		}
+
+		// the link is useless once expired, so don't bother the user with it
+		if time.Now().After(magicLinkEvent.ExpiresAt) {
+			logger.Warnf("magic link expired before sending")
+			return rabbitmq.NackDiscard
+		}
+
+		link := fmt.Sprintf(c.opt.MagicLinkFormat, magicLinkEvent.Token)
+		magicLinkBody, err := template.MagicLinkEmail(magicLinkEvent.Email, link)
+		if err != nil {
+			logger.Error("failed to create template: %s", err)
+			return rabbitmq.NackDiscard
+		}
+
+		emailMsg := c.mailgunClient.NewMessage(c.opt.Sender, magicLinkSubject, link, magicLinkEvent.Email)
+		emailMsg.SetHtml(magicLinkBody)
+		ctx, cancel := context.WithTimeout(ctx, c.opt.Timeout)
+		defer cancel()
+		err = c.repeater.Do(ctx, func() error {
+			_, _, err = c.mailgunClient.Send(ctx, emailMsg)
+			return err
+		})
+		if err != nil {
+			logger.Error("failed to send email: %s", err)
+			return rabbitmq.NackDiscard
+		}
+
+		logger.Debugf("email sended")
+		return rabbitmq.Ack
+	}
+}
+
+func (c *ConsumerHandler) EmailChangeEmail(ctx context.Context) func(message rabbitmq.Delivery) rabbitmq.Action {
+	return func(message rabbitmq.Delivery) rabbitmq.Action {
+		logger := logging.FromContext(ctx).With(
+			zap.String("id", message.MessageId),
+			zap.String("response", message.RoutingKey),
+		)
+		logger.Infof("new message")
+		var emailChangeEvent v0.UserEmailChangeEvent
+		if err := json.Unmarshal(message.Body, &emailChangeEvent); err != nil {
+			logger.Error("failed to process json: %s", err)
+			return rabbitmq.NackDiscard
+		}
+
+		if time.Now().After(emailChangeEvent.ExpiresAt) {
+			logger.Warnf("email change expired before sending")
+			return rabbitmq.NackDiscard
+		}
+
+		link := fmt.Sprintf(c.opt.EmailChangeFormat, emailChangeEvent.Token)
+		emailChangeBody, err := template.EmailChangeEmail(emailChangeEvent.Email, link)
+		if err != nil {
+			logger.Error("failed to create template: %s", err)
+			return rabbitmq.NackDiscard
+		}
+
+		emailMsg := c.mailgunClient.NewMessage(c.opt.Sender, emailChangeSubject, link, emailChangeEvent.Email)
+		emailMsg.SetHtml(emailChangeBody)
+		ctx, cancel := context.WithTimeout(ctx, c.opt.Timeout)
+		defer cancel()
+		err = c.repeater.Do(ctx, func() error {
+			_, _, err = c.mailgunClient.Send(ctx, emailMsg)
+			return err
+		})
+		if err != nil {
+			logger.Error("failed to send email: %s", err)
+			return rabbitmq.NackDiscard
+		}
+
+		logger.Debugf("email sended")
+		return rabbitmq.Ack
+	}
+}
+
+func (c *ConsumerHandler) EmailChangingEmail(ctx context.Context) func(message rabbitmq.Delivery) rabbitmq.Action {
+	return func(message rabbitmq.Delivery) rabbitmq.Action {
+		logger := logging.FromContext(ctx).With(
+			zap.String("id", message.MessageId),
+			zap.String("response", message.RoutingKey),
+		)
+		logger.Infof("new message")
+		var emailChangingEvent v0.UserEmailChangingEvent
+		if err := json.Unmarshal(message.Body, &emailChangingEvent); err != nil {
+			logger.Error("failed to process json: %s", err)
+			return rabbitmq.NackDiscard
+		}
+
+		emailChangingBody, err := template.EmailChangingEmail(emailChangingEvent.Email, emailChangingEvent.NewEmail)
+		if err != nil {
+			logger.Error("failed to create template: %s", err)
+			return rabbitmq.NackDiscard
+		}
+
+		text := fmt.Sprintf("A change of your email to %s was requested.", emailChangingEvent.NewEmail)
+		emailMsg := c.mailgunClient.NewMessage(c.opt.Sender, emailChangingSubject, text, emailChangingEvent.Email)
+		emailMsg.SetHtml(emailChangingBody)
+		ctx, cancel := context.WithTimeout(ctx, c.opt.Timeout)
+		defer cancel()
+		err = c.repeater.Do(ctx, func() error {
+			_, _, err = c.mailgunClient.Send(ctx, emailMsg)
+			return err
+		})
+		if err != nil {
+			logger.Error("failed to send email: %s", err)
+			return rabbitmq.NackDiscard
+		}
+
+		logger.Debugf("email sended")
+		return rabbitmq.Ack
+	}
+}
+
+func (c *ConsumerHandler) OrgInviteEmail(ctx context.Context) func(message rabbitmq.Delivery) rabbitmq.Action {
+	return func(message rabbitmq.Delivery) rabbitmq.Action {
+		logger := logging.FromContext(ctx).With(
+			zap.String("id", message.MessageId),
+			zap.String("response", message.RoutingKey),
+		)
+		logger.Infof("new message")
+		var inviteEvent v0.OrganizationInviteEvent
+		if err := json.Unmarshal(message.Body, &inviteEvent); err != nil {
+			logger.Error("failed to process json: %s", err)
+			return rabbitmq.NackDiscard
+		}
+
+		if time.Now().After(inviteEvent.ExpiresAt) {
+			logger.Warnf("invite expired before sending")
+			return rabbitmq.NackDiscard
+		}
+
+		link := fmt.Sprintf(c.opt.OrgInviteFormat, inviteEvent.Token)
+		inviteBody, err := template.OrgInviteEmail(inviteEvent.InviterName, inviteEvent.OrganizationName, link)
+		if err != nil {
+			logger.Error("failed to create template: %s", err)
+			return rabbitmq.NackDiscard
+		}
+
+		subject := fmt.Sprintf(orgInviteSubject, inviteEvent.OrganizationName)
+		emailMsg := c.mailgunClient.NewMessage(c.opt.Sender, subject, link, inviteEvent.Email)
+		emailMsg.SetHtml(inviteBody)
+		ctx, cancel := context.WithTimeout(ctx, c.opt.Timeout)
+		defer cancel()
+		err = c.repeater.Do(ctx, func() error {
+			_, _, err = c.mailgunClient.Send(ctx, emailMsg)
+			return err
+		})
+		if err != nil {
+			logger.Error("failed to send email: %s", err)
+			return rabbitmq.NackDiscard
+		}
+
+		logger.Debugf("email sended")
+		return rabbitmq.Ack
+	}
+}
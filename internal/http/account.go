@@ -0,0 +1,105 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/theruziev/oson_auth/internal/model"
+	"github.com/theruziev/oson_auth/internal/pkg/auth"
+	"github.com/theruziev/oson_auth/internal/pkg/httpx"
+)
+
+func (s *UserHandler) DeleteMe(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claim := auth.FromContext(ctx)
+
+	// the body is optional, a recent login is enough to delete the account
+	req, err := httpx.ParseJSON[ReauthRequest](r)
+	if errors.Is(err, io.EOF) {
+		req, err = &ReauthRequest{}, nil
+	}
+	if err != nil {
+		httpx.JSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	err = s.userService.DeleteAccount(ctx, claim, req.toModel())
+	if err != nil {
+		if reauthError(w, err) {
+			return
+		}
+		httpx.JSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	httpx.JSONOKResponse(w)
+}
+
+func (s *UserHandler) ExportMe(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claim := auth.FromContext(ctx)
+
+	export, err := s.userService.ExportData(ctx, claim.PublicID)
+	if err != nil {
+		httpx.JSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="oson-export-%s.json"`, export.User.PublicID))
+	httpx.JSONResponse(w, http.StatusOK, toUserExportResponse(export))
+}
+
+func toUserExportResponse(export *model.UserExport) UserExportResponse {
+	user := export.User
+	response := UserExportResponse{
+		ExportedAt: export.ExportedAt,
+		Omitted:    export.Omitted,
+		User: UserExportProfileResponse{
+			PublicID:          user.PublicID,
+			FirstName:         user.FirstName,
+			LastName:          user.LastName,
+			Email:             user.Email,
+			Status:            string(user.Status),
+			OtpEnabled:        user.OtpEnabled,
+			PasswordChangedAt: user.PasswordChangedAt,
+			CreatedAt:         user.CreatedAt,
+			UpdatedAt:         user.UpdatedAt,
+		},
+		Sessions:            make([]SessionResponse, 0, len(export.Sessions)),
+		APIKeys:             make([]APIKeyResponse, 0, len(export.APIKeys)),
+		WebAuthnCredentials: make([]WebAuthnCredentialResponse, 0, len(export.WebAuthnCredentials)),
+		EmailChanges:        make([]EmailChangeResponse, 0, len(export.EmailChanges)),
+		AuditEvents:         make([]AuditEventResponse, 0, len(export.AuditEvents)),
+		Organizations:       make([]OrganizationResponse, 0, len(export.Organizations)),
+		TrustedDevices:      make([]TrustedDeviceResponse, 0, len(export.TrustedDevices)),
+	}
+	for _, session := range export.Sessions {
+		response.Sessions = append(response.Sessions, toSessionResponse(session))
+	}
+	for _, apiKey := range export.APIKeys {
+		response.APIKeys = append(response.APIKeys, toAPIKeyResponse(apiKey))
+	}
+	for _, credential := range export.WebAuthnCredentials {
+		response.WebAuthnCredentials = append(response.WebAuthnCredentials, toWebAuthnCredentialResponse(credential))
+	}
+	for _, change := range export.EmailChanges {
+		response.EmailChanges = append(response.EmailChanges, EmailChangeResponse{
+			NewEmail:  change.NewEmail,
+			ExpiresAt: change.ExpiresAt,
+			UsedAt:    change.UsedAt,
+			CreatedAt: change.CreatedAt,
+		})
+	}
+	for _, event := range export.AuditEvents {
+		response.AuditEvents = append(response.AuditEvents, toAuditEventResponse(event))
+	}
+	for _, org := range export.Organizations {
+		response.Organizations = append(response.Organizations, toUserOrganizationResponse(org))
+	}
+	for _, device := range export.TrustedDevices {
+		response.TrustedDevices = append(response.TrustedDevices, toTrustedDeviceResponse(device))
+	}
+	return response
+}
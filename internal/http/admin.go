@@ -0,0 +1,205 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/theruziev/oson_auth/internal/model"
+	"github.com/theruziev/oson_auth/internal/pkg/auth"
+	"github.com/theruziev/oson_auth/internal/pkg/errz"
+	"github.com/theruziev/oson_auth/internal/pkg/httpx"
+	"github.com/theruziev/oson_auth/internal/pkg/validatorx"
+	"github.com/theruziev/oson_auth/internal/service"
+)
+
+type AdminHandler struct {
+	adminService *service.AdminService
+}
+
+func NewAdminHandler(adminService *service.AdminService) *AdminHandler {
+	return &AdminHandler{
+		adminService: adminService,
+	}
+}
+
+// ListUsers searches users by email or name with q, filtered by status and paginated with limit and offset.
+func (h *AdminHandler) ListUsers(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	query := r.URL.Query()
+
+	filter := &model.UserFilter{
+		Query:  query.Get("q"),
+		Status: model.UserStatus(query.Get("status")),
+	}
+	var err error
+	if filter.Limit, err = parseUintQuery(query, "limit"); err != nil {
+		httpx.JSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if filter.Offset, err = parseUintQuery(query, "offset"); err != nil {
+		httpx.JSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	users, total, err := h.adminService.ListUsers(ctx, filter)
+	if err != nil {
+		httpx.JSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	response := AdminUsersResponse{
+		Users: make([]AdminUserResponse, 0, len(users)),
+		Total: total,
+	}
+	for _, user := range users {
+		response.Users = append(response.Users, toAdminUserResponse(user))
+	}
+	httpx.JSONResponse(w, http.StatusOK, response)
+}
+
+func (h *AdminHandler) GetUser(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claim := auth.FromContext(ctx)
+
+	user, roles, err := h.adminService.GetUser(ctx, claim, chi.URLParam(r, "pid"))
+	if err != nil {
+		writeAdminError(w, err)
+		return
+	}
+	response := toAdminUserResponse(user)
+	response.Roles = make([]string, 0, len(roles))
+	for _, role := range roles {
+		response.Roles = append(response.Roles, role.Name)
+	}
+	httpx.JSONResponse(w, http.StatusOK, response)
+}
+
+func (h *AdminHandler) ListRoles(w http.ResponseWriter, r *http.Request) {
+	roles, err := h.adminService.ListRoles(r.Context())
+	if err != nil {
+		httpx.JSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	response := make([]RoleResponse, 0, len(roles))
+	for _, role := range roles {
+		response = append(response, RoleResponse{
+			Name:        role.Name,
+			Description: role.Description,
+			Permissions: role.Permissions,
+			CreatedAt:   role.CreatedAt,
+		})
+	}
+	httpx.JSONResponse(w, http.StatusOK, response)
+}
+
+func (h *AdminHandler) GrantRole(w http.ResponseWriter, r *http.Request) {
+	h.runAction(w, r, func(ctx context.Context, claim *auth.Claim, publicID string) error {
+		return h.adminService.GrantRole(ctx, claim, publicID, chi.URLParam(r, "role"))
+	})
+}
+
+func (h *AdminHandler) RevokeRole(w http.ResponseWriter, r *http.Request) {
+	h.runAction(w, r, func(ctx context.Context, claim *auth.Claim, publicID string) error {
+		return h.adminService.RevokeRole(ctx, claim, publicID, chi.URLParam(r, "role"))
+	})
+}
+
+func (h *AdminHandler) Activate(w http.ResponseWriter, r *http.Request) {
+	h.runAction(w, r, h.adminService.Activate)
+}
+
+func (h *AdminHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	h.runAction(w, r, h.adminService.ResetPassword)
+}
+
+func (h *AdminHandler) Disable(w http.ResponseWriter, r *http.Request) {
+	h.runStatusAction(w, r, h.adminService.Disable)
+}
+
+func (h *AdminHandler) Lock(w http.ResponseWriter, r *http.Request) {
+	h.runStatusAction(w, r, h.adminService.Lock)
+}
+
+func (h *AdminHandler) Enable(w http.ResponseWriter, r *http.Request) {
+	h.runAction(w, r, h.adminService.Enable)
+}
+
+func (h *AdminHandler) ResetTwoFA(w http.ResponseWriter, r *http.Request) {
+	h.runAction(w, r, h.adminService.ResetTwoFA)
+}
+
+func (h *AdminHandler) RevokeSessions(w http.ResponseWriter, r *http.Request) {
+	h.runAction(w, r, h.adminService.RevokeSessions)
+}
+
+// runAction runs an action on the user from the pid url parameter on behalf of the admin.
+func (h *AdminHandler) runAction(
+	w http.ResponseWriter,
+	r *http.Request,
+	action func(ctx context.Context, claim *auth.Claim, publicID string) error,
+) {
+	ctx := r.Context()
+	claim := auth.FromContext(ctx)
+
+	if err := action(ctx, claim, chi.URLParam(r, "pid")); err != nil {
+		writeAdminError(w, err)
+		return
+	}
+	httpx.JSONOKResponse(w)
+}
+
+// runStatusAction runs an action that takes the access away from the user, the body may carry the reason.
+func (h *AdminHandler) runStatusAction(
+	w http.ResponseWriter,
+	r *http.Request,
+	action func(ctx context.Context, claim *auth.Claim, publicID, reason string) error,
+) {
+	validate := validatorx.FromContext(r.Context())
+
+	req, err := httpx.ParseJSON[AdminStatusRequest](r)
+	if errors.Is(err, io.EOF) {
+		req, err = &AdminStatusRequest{}, nil
+	}
+	if err != nil {
+		httpx.JSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := validate.Struct(req); err != nil {
+		httpx.JSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	h.runAction(w, r, func(ctx context.Context, claim *auth.Claim, publicID string) error {
+		return action(ctx, claim, publicID, req.Reason)
+	})
+}
+
+func writeAdminError(w http.ResponseWriter, err error) {
+	switch {
+	case errz.NotFoundErr.Is(err):
+		httpx.JSONError(w, http.StatusNotFound, err.Error())
+	case errz.BadRequestErr.Is(err):
+		httpx.JSONError(w, http.StatusBadRequest, err.Error())
+	default:
+		httpx.JSONError(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+func toAdminUserResponse(user *model.User) AdminUserResponse {
+	return AdminUserResponse{
+		PublicID:          user.PublicID,
+		FirstName:         user.FirstName,
+		LastName:          user.LastName,
+		Email:             user.Email,
+		Status:            string(user.Status),
+		StatusReason:      user.StatusReason,
+		StatusChangedAt:   user.StatusChangedAt,
+		OtpEnabled:        user.OtpEnabled,
+		PasswordChangedAt: user.PasswordChangedAt,
+		DeletedAt:         user.DeletedAt,
+		CreatedAt:         user.CreatedAt,
+		UpdatedAt:         user.UpdatedAt,
+	}
+}
@@ -0,0 +1,115 @@
+package http
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/theruziev/oson_auth/internal/model"
+	"github.com/theruziev/oson_auth/internal/pkg/auth"
+	"github.com/theruziev/oson_auth/internal/pkg/errz"
+	"github.com/theruziev/oson_auth/internal/pkg/httpx"
+	"github.com/theruziev/oson_auth/internal/pkg/validatorx"
+	"github.com/theruziev/oson_auth/internal/service"
+)
+
+type APIKeyHandler struct {
+	apiKeyService *service.APIKeyService
+}
+
+func NewAPIKeyHandler(apiKeyService *service.APIKeyService) *APIKeyHandler {
+	return &APIKeyHandler{
+		apiKeyService: apiKeyService,
+	}
+}
+
+func (h *APIKeyHandler) Create(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	validate := validatorx.FromContext(ctx)
+	claim := auth.FromContext(ctx)
+
+	// an api key must not be able to mint new keys for itself
+	if claim.APIKeyID != "" {
+		httpx.JSONError(w, http.StatusForbidden, "not permitted")
+		return
+	}
+
+	req, err := httpx.ParseJSON[CreateAPIKeyRequest](r)
+	if err != nil {
+		httpx.JSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err = validate.Struct(req); err != nil {
+		httpx.JSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	apiKey, key, err := h.apiKeyService.Create(ctx, claim.PublicID, &model.CreateAPIKeyRequest{
+		Name:      req.Name,
+		Scopes:    req.Scopes,
+		ExpiresAt: req.ExpiresAt,
+	})
+	if err != nil {
+		if errz.BadRequestErr.Is(err) {
+			httpx.JSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		httpx.JSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	httpx.JSONResponse(w, http.StatusCreated, CreateAPIKeyResponse{
+		APIKeyResponse: toAPIKeyResponse(apiKey),
+		Key:            key,
+	})
+}
+
+func (h *APIKeyHandler) List(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claim := auth.FromContext(ctx)
+
+	apiKeys, err := h.apiKeyService.List(ctx, claim.PublicID)
+	if err != nil {
+		httpx.JSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response := make([]APIKeyResponse, 0, len(apiKeys))
+	for _, apiKey := range apiKeys {
+		response = append(response, toAPIKeyResponse(apiKey))
+	}
+	httpx.JSONResponse(w, http.StatusOK, response)
+}
+
+func (h *APIKeyHandler) Revoke(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claim := auth.FromContext(ctx)
+
+	if claim.APIKeyID != "" {
+		httpx.JSONError(w, http.StatusForbidden, "not permitted")
+		return
+	}
+
+	if err := h.apiKeyService.Revoke(ctx, claim.PublicID, chi.URLParam(r, "id")); err != nil {
+		if errz.NotFoundErr.Is(err) {
+			httpx.JSONError(w, http.StatusNotFound, "api key not found")
+			return
+		}
+		httpx.JSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	httpx.JSONOKResponse(w)
+}
+
+func toAPIKeyResponse(apiKey *model.APIKey) APIKeyResponse {
+	return APIKeyResponse{
+		ID:         apiKey.PublicID,
+		Name:       apiKey.Name,
+		Prefix:     apiKey.Prefix,
+		Scopes:     apiKey.Scopes,
+		ExpiresAt:  apiKey.ExpiresAt,
+		LastUsedAt: apiKey.LastUsedAt,
+		CreatedAt:  apiKey.CreatedAt,
+	}
+}
@@ -0,0 +1,142 @@
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/theruziev/oson_auth/internal/model"
+	"github.com/theruziev/oson_auth/internal/pkg/auth"
+	"github.com/theruziev/oson_auth/internal/pkg/httpx"
+	"github.com/theruziev/oson_auth/internal/service"
+)
+
+type AuditHandler struct {
+	auditService *service.AuditService
+}
+
+func NewAuditHandler(auditService *service.AuditService) *AuditHandler {
+	return &AuditHandler{
+		auditService: auditService,
+	}
+}
+
+// MyActivity lists the events of the user, older pages are fetched with before_id.
+func (h *AuditHandler) MyActivity(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claim := auth.FromContext(ctx)
+	query := r.URL.Query()
+
+	beforeID, err := parseUintQuery(query, "before_id")
+	if err != nil {
+		httpx.JSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	limit, err := parseUintQuery(query, "limit")
+	if err != nil {
+		httpx.JSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	events, err := h.auditService.ListByUser(ctx, claim.PublicID, beforeID, limit)
+	if err != nil {
+		httpx.JSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	httpx.JSONResponse(w, http.StatusOK, toAuditEventsResponse(events))
+}
+
+// List lists the events of every user to clients holding the audit:read scope,
+// filtered by user, comma separated types, ip and time range.
+func (h *AuditHandler) List(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	query := r.URL.Query()
+
+	filter := &model.AuditEventFilter{
+		UserPublicID: query.Get("user"),
+		IP:           query.Get("ip"),
+	}
+	if types := query.Get("type"); types != "" {
+		for _, eventType := range strings.Split(types, ",") {
+			filter.Types = append(filter.Types, model.AuditEventType(eventType))
+		}
+	}
+	var err error
+	if filter.From, err = parseTimeQuery(query, "from"); err != nil {
+		httpx.JSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if filter.To, err = parseTimeQuery(query, "to"); err != nil {
+		httpx.JSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if filter.BeforeID, err = parseUintQuery(query, "before_id"); err != nil {
+		httpx.JSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if filter.Limit, err = parseUintQuery(query, "limit"); err != nil {
+		httpx.JSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	events, err := h.auditService.List(ctx, filter)
+	if err != nil {
+		httpx.JSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	httpx.JSONResponse(w, http.StatusOK, toAuditEventsResponse(events))
+}
+
+func toAuditEventsResponse(events []*model.AuditEvent) AuditEventsResponse {
+	response := AuditEventsResponse{
+		Events: make([]AuditEventResponse, 0, len(events)),
+	}
+	for _, event := range events {
+		response.Events = append(response.Events, toAuditEventResponse(event))
+	}
+	if len(events) > 0 {
+		response.NextBeforeID = events[len(events)-1].ID
+	}
+	return response
+}
+
+func toAuditEventResponse(event *model.AuditEvent) AuditEventResponse {
+	return AuditEventResponse{
+		ID:        event.ID,
+		UserID:    event.UserPublicID,
+		Type:      string(event.Type),
+		IP:        event.IP,
+		UserAgent: event.UserAgent,
+		RequestID: event.RequestID,
+		Metadata:  event.Metadata,
+		CreatedAt: event.CreatedAt,
+	}
+}
+
+func parseUintQuery(query url.Values, name string) (uint64, error) {
+	value := query.Get(name)
+	if value == "" {
+		return 0, nil
+	}
+	parsed, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s", name)
+	}
+	return parsed, nil
+}
+
+// parseTimeQuery reads an RFC 3339 time, nil when the parameter is missing.
+func parseTimeQuery(query url.Values, name string) (*time.Time, error) {
+	value := query.Get(name)
+	if value == "" {
+		return nil, nil
+	}
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s, expected an RFC 3339 time", name)
+	}
+	return &parsed, nil
+}
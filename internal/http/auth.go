@@ -2,9 +2,13 @@ package http
 
 import (
 	"net/http"
+	"strconv"
 
+	"github.com/theruziev/oson_auth/internal/model"
 	"github.com/theruziev/oson_auth/internal/pkg/auth"
+	"github.com/theruziev/oson_auth/internal/pkg/errz"
 	"github.com/theruziev/oson_auth/internal/pkg/httpx"
+	"github.com/theruziev/oson_auth/internal/pkg/lockout"
 	"github.com/theruziev/oson_auth/internal/pkg/logging"
 	"github.com/theruziev/oson_auth/internal/pkg/validatorx"
 )
@@ -25,19 +29,17 @@ func (s *UserHandler) Auth(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, err := s.userService.Auth(ctx, req.Email, req.Password)
+	token, err := s.userService.Auth(ctx, req.Email, req.Password, req.DeviceToken)
 	if err != nil {
 		logger.Warnf("failed to auth: %s", err)
+		if lockedError(w, err) {
+			return
+		}
 		httpx.JSONError(w, http.StatusForbidden, "incorrect user and password")
 		return
 	}
 
-	tokenResponse := AuthTokenResponse{
-		AuthToken:     token.AuthToken,
-		ExpireAt:      token.ExpireAt,
-		TwoFARequired: token.TwoFARequired,
-	}
-	httpx.JSONResponse(w, http.StatusOK, tokenResponse)
+	httpx.JSONResponse(w, http.StatusOK, toAuthTokenResponse(token))
 }
 
 func (s *UserHandler) AuthTwoFA(w http.ResponseWriter, r *http.Request) {
@@ -66,16 +68,171 @@ func (s *UserHandler) AuthTwoFA(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, err := s.userService.AuthTwoFA(ctx, claim, req.Code)
+	token, err := s.userService.AuthTwoFA(ctx, claim, req.Code, req.RememberDevice)
 	if err != nil {
 		logger.Warnf("failed to 2fa: %s", err)
+		if lockedError(w, err) {
+			return
+		}
 		httpx.JSONError(w, http.StatusForbidden, "incorrect otp code")
 		return
 	}
 
+	httpx.JSONResponse(w, http.StatusOK, toAuthTokenResponse(token))
+}
+
+// lockedError answers with 423 when the account is locked and 429 when the client ip is throttled.
+func lockedError(w http.ResponseWriter, err error) bool {
+	locked, ok := lockout.IsLocked(err)
+	if !ok {
+		return false
+	}
+	status := http.StatusTooManyRequests
+	if locked.Scope == lockout.ScopeAccount {
+		status = http.StatusLocked
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(locked.RetryAfterSeconds()))
+	httpx.JSONError(w, status, "too many failed attempts, try again later")
+	return true
+}
+
+// reauthError answers with 403 when the user could not prove it is them for a sensitive change.
+func reauthError(w http.ResponseWriter, err error) bool {
+	if lockedError(w, err) {
+		return true
+	}
+	if !errz.ForbiddenErr.Is(err) {
+		return false
+	}
+	httpx.JSONError(w, http.StatusForbidden, err.Error())
+	return true
+}
+
+func (r *ReauthRequest) toModel() *model.ReauthProof {
+	return &model.ReauthProof{
+		CurrentPassword: r.CurrentPassword,
+		OtpCode:         r.Code,
+	}
+}
+
+func (s *UserHandler) MagicLinkRequest(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger := logging.FromContext(ctx)
+	validate := validatorx.FromContext(ctx)
+
+	req, err := httpx.ParseJSON[MagicLinkRequest](r)
+	if err != nil {
+		httpx.JSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err = validate.Struct(req); err != nil {
+		httpx.JSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// the response is the same for unknown emails, so the endpoint can't be used to look up accounts
+	if err := s.userService.MagicLinkRequest(ctx, req.Email); err != nil {
+		logger.Warnf("failed to send magic link: %s", err)
+	}
+
+	httpx.JSONOKResponse(w)
+}
+
+func (s *UserHandler) AuthMagicLink(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger := logging.FromContext(ctx)
+	validate := validatorx.FromContext(ctx)
+
+	req, err := httpx.ParseJSON[MagicLinkRedeemRequest](r)
+	if err != nil {
+		httpx.JSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err = validate.Struct(req); err != nil {
+		httpx.JSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	token, err := s.userService.AuthMagicLink(ctx, req.Token)
+	if err != nil {
+		logger.Warnf("failed to auth with magic link: %s", err)
+		httpx.JSONError(w, http.StatusForbidden, "invalid magic link")
+		return
+	}
+
+	httpx.JSONResponse(w, http.StatusOK, toAuthTokenResponse(token))
+}
+
+func (s *UserHandler) RefreshToken(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger := logging.FromContext(ctx)
+	validate := validatorx.FromContext(ctx)
+
+	req, err := httpx.ParseJSON[RefreshTokenRequest](r)
+	if err != nil {
+		httpx.JSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err = validate.Struct(req); err != nil {
+		httpx.JSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	token, err := s.userService.RefreshToken(ctx, req.RefreshToken, "")
+	if err != nil {
+		logger.Warnf("failed to refresh token: %s", err)
+		httpx.JSONError(w, http.StatusForbidden, "invalid refresh token")
+		return
+	}
+
+	httpx.JSONResponse(w, http.StatusOK, toAuthTokenResponse(token))
+}
+
+func (s *UserHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claim := auth.FromContext(ctx)
+
+	if err := s.userService.Logout(ctx, claim); err != nil {
+		httpx.JSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	httpx.JSONOKResponse(w)
+}
+
+func (s *UserHandler) LogoutAll(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claim := auth.FromContext(ctx)
+
+	if err := s.userService.LogoutAll(ctx, claim); err != nil {
+		httpx.JSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	httpx.JSONOKResponse(w)
+}
+
+func toAuthTokenResponse(token *model.AuthToken) AuthTokenResponse {
 	tokenResponse := AuthTokenResponse{
-		AuthToken: token.AuthToken,
-		ExpireAt:  token.ExpireAt,
+		AuthToken:     token.AuthToken,
+		ExpireAt:      token.ExpireAt,
+		TwoFARequired: token.TwoFARequired,
+		RefreshToken:  token.RefreshToken,
+
+		PasswordChangeRequired: token.PasswordChangeRequired,
+	}
+	for _, method := range token.TwoFAMethods {
+		tokenResponse.TwoFAMethods = append(tokenResponse.TwoFAMethods, string(method))
+	}
+	if token.RefreshToken != "" {
+		tokenResponse.RefreshExpireAt = &token.RefreshExpireAt
+	}
+	if token.DeviceToken != "" {
+		tokenResponse.DeviceToken = token.DeviceToken
+		tokenResponse.DeviceExpireAt = &token.DeviceExpireAt
 	}
-	httpx.JSONResponse(w, http.StatusOK, tokenResponse)
+	return tokenResponse
 }
@@ -0,0 +1,102 @@
+package http
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/theruziev/oson_auth/internal/model"
+	"github.com/theruziev/oson_auth/internal/pkg/auth"
+	"github.com/theruziev/oson_auth/internal/pkg/httpx"
+	"github.com/theruziev/oson_auth/internal/pkg/validatorx"
+	"github.com/theruziev/oson_auth/internal/service"
+)
+
+// ContentHandler serves the moderation of the contents.
+type ContentHandler struct {
+	contentService *service.ContentService
+}
+
+func NewContentHandler(contentService *service.ContentService) *ContentHandler {
+	return &ContentHandler{
+		contentService: contentService,
+	}
+}
+
+// List returns the contents of every status, filtered by status and paginated with before_id and limit.
+func (h *ContentHandler) List(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	query := r.URL.Query()
+
+	filter := &model.ContentFilter{
+		Status: model.ContentStatus(query.Get("status")),
+	}
+	var err error
+	if filter.BeforeID, err = parseUintQuery(query, "before_id"); err != nil {
+		httpx.JSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if filter.Limit, err = parseUintQuery(query, "limit"); err != nil {
+		httpx.JSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	contents, err := h.contentService.List(ctx, filter)
+	if err != nil {
+		httpx.JSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	response := ContentsResponse{
+		Contents: make([]ContentResponse, 0, len(contents)),
+	}
+	for _, content := range contents {
+		response.Contents = append(response.Contents, toContentResponse(content))
+	}
+	if len(contents) > 0 {
+		response.NextBeforeID = contents[len(contents)-1].ID
+	}
+	httpx.JSONResponse(w, http.StatusOK, response)
+}
+
+func (h *ContentHandler) SetStatus(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	validate := validatorx.FromContext(ctx)
+	claim := auth.FromContext(ctx)
+
+	id, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		httpx.JSONError(w, http.StatusNotFound, "content not found")
+		return
+	}
+	req, err := httpx.ParseJSON[SetContentStatusRequest](r)
+	if err != nil {
+		httpx.JSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err = validate.Struct(req); err != nil {
+		httpx.JSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := h.contentService.SetStatus(ctx, claim, id, model.ContentStatus(req.Status)); err != nil {
+		writeAdminError(w, err)
+		return
+	}
+	httpx.JSONOKResponse(w)
+}
+
+func toContentResponse(content *model.Content) ContentResponse {
+	return ContentResponse{
+		ID:          content.ID,
+		Source:      content.Source,
+		PreviewURL:  content.PreviewURL,
+		PreviewType: string(content.PreviewType),
+		MediaURL:    content.MediaURL,
+		Description: content.Description,
+		Tags:        content.Tags,
+		Type:        string(content.Type),
+		Status:      string(content.Status),
+		CreatedAt:   content.CreatedAt,
+		UpdatedAt:   content.UpdatedAt,
+	}
+}
@@ -0,0 +1,82 @@
+package http
+
+import (
+	"net/http"
+
+	"github.com/theruziev/oson_auth/internal/pkg/auth"
+	"github.com/theruziev/oson_auth/internal/pkg/errz"
+	"github.com/theruziev/oson_auth/internal/pkg/httpx"
+	"github.com/theruziev/oson_auth/internal/pkg/validatorx"
+)
+
+func (s *UserHandler) RequestEmailChange(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	validate := validatorx.FromContext(ctx)
+	claim := auth.FromContext(ctx)
+
+	req, err := httpx.ParseJSON[EmailChangeRequest](r)
+	if err != nil {
+		httpx.JSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err = validate.Struct(req); err != nil {
+		httpx.JSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	err = s.userService.RequestEmailChange(ctx, claim, req.Email, req.ReauthRequest.toModel())
+	if err != nil {
+		if reauthError(w, err) {
+			return
+		}
+		if errz.BadRequestErr.Is(err) {
+			httpx.JSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if errz.ConflictErr.Is(err) {
+			httpx.JSONError(w, http.StatusConflict, err.Error())
+			return
+		}
+		httpx.JSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	httpx.JSONOKResponse(w)
+}
+
+func (s *UserHandler) ConfirmEmailChange(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	validate := validatorx.FromContext(ctx)
+
+	req, err := httpx.ParseJSON[EmailChangeConfirmRequest](r)
+	if err != nil {
+		httpx.JSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err = validate.Struct(req); err != nil {
+		httpx.JSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	err = s.userService.ConfirmEmailChange(ctx, req.Token)
+	if err != nil {
+		if errz.NotFoundErr.Is(err) {
+			httpx.JSONError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		if errz.BadRequestErr.Is(err) {
+			httpx.JSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if errz.ConflictErr.Is(err) {
+			httpx.JSONError(w, http.StatusConflict, err.Error())
+			return
+		}
+		httpx.JSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	httpx.JSONOKResponse(w)
+}
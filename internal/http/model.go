@@ -1,23 +1,47 @@
 package http
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
 type RegisterRequest struct {
 	FirstName string `json:"first_name" validate:"required"`
 	LastName  string `json:"last_name" validate:"required"`
 	Email     string `json:"email" validate:"required,email"`
-	Password  string `json:"password" validate:"required,min=6"`
+	Password  string `json:"password" validate:"required"`
 }
 
 type AuthTokenResponse struct {
-	AuthToken     string    `json:"auth_token"`
-	ExpireAt      time.Time `json:"expire_at"`
-	TwoFARequired bool      `json:"twofa_required"`
+	AuthToken       string     `json:"auth_token"`
+	ExpireAt        time.Time  `json:"expire_at"`
+	TwoFARequired   bool       `json:"twofa_required"`
+	TwoFAMethods    []string   `json:"twofa_methods,omitempty"`
+	RefreshToken    string     `json:"refresh_token,omitempty"`
+	RefreshExpireAt *time.Time `json:"refresh_expire_at,omitempty"`
+	DeviceToken     string     `json:"device_token,omitempty"`
+	DeviceExpireAt  *time.Time `json:"device_expire_at,omitempty"`
+
+	PasswordChangeRequired bool `json:"password_change_required,omitempty"`
+}
+
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token" validate:"required"`
 }
 
 type CredentialRequest struct {
 	Email    string `json:"email" validate:"required,email"`
 	Password string `json:"password" validate:"required,min=6"`
+	// DeviceToken is the token of a trusted device, it skips the second factor.
+	DeviceToken string `json:"device_token"`
+}
+
+type MagicLinkRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type MagicLinkRedeemRequest struct {
+	Token string `json:"token" validate:"required"`
 }
 
 type UserResponse struct {
@@ -28,21 +52,219 @@ type UserResponse struct {
 	CreatedAt time.Time `json:"created_at"`
 }
 
+// MeResponse is the profile of the user signed in, RecoveryCodesRemaining is set when otp is enabled.
+type MeResponse struct {
+	UserResponse
+	OtpEnabled             bool    `json:"otp_enabled"`
+	RecoveryCodesRemaining *uint64 `json:"recovery_codes_remaining,omitempty"`
+}
+
+// UserExportResponse is the archive of the data of the user, see service.ExportData for what is left out.
+type UserExportResponse struct {
+	ExportedAt          time.Time                    `json:"exported_at"`
+	User                UserExportProfileResponse    `json:"user"`
+	Sessions            []SessionResponse            `json:"sessions"`
+	APIKeys             []APIKeyResponse             `json:"api_keys"`
+	WebAuthnCredentials []WebAuthnCredentialResponse `json:"webauthn_credentials"`
+	EmailChanges        []EmailChangeResponse        `json:"email_changes"`
+	AuditEvents         []AuditEventResponse         `json:"audit_events"`
+	Organizations       []OrganizationResponse       `json:"organizations"`
+	TrustedDevices      []TrustedDeviceResponse      `json:"trusted_devices"`
+	Omitted             []string                     `json:"omitted"`
+}
+
+type UserExportProfileResponse struct {
+	PublicID          string     `json:"public_id"`
+	FirstName         string     `json:"first_name"`
+	LastName          string     `json:"last_name"`
+	Email             string     `json:"email"`
+	Status            string     `json:"status"`
+	OtpEnabled        bool       `json:"otp_enabled"`
+	PasswordChangedAt *time.Time `json:"password_changed_at,omitempty"`
+	CreatedAt         time.Time  `json:"created_at"`
+	UpdatedAt         time.Time  `json:"updated_at"`
+}
+
+type AdminUserResponse struct {
+	PublicID          string     `json:"public_id"`
+	FirstName         string     `json:"first_name"`
+	LastName          string     `json:"last_name"`
+	Email             string     `json:"email"`
+	Status            string     `json:"status"`
+	StatusReason      string     `json:"status_reason,omitempty"`
+	StatusChangedAt   *time.Time `json:"status_changed_at,omitempty"`
+	OtpEnabled        bool       `json:"otp_enabled"`
+	Roles             []string   `json:"roles,omitempty"`
+	PasswordChangedAt *time.Time `json:"password_changed_at,omitempty"`
+	DeletedAt         *time.Time `json:"deleted_at,omitempty"`
+	CreatedAt         time.Time  `json:"created_at"`
+	UpdatedAt         time.Time  `json:"updated_at"`
+}
+
+type RoleResponse struct {
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Permissions []string  `json:"permissions"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// AdminStatusRequest is the optional body of the actions that suspend or lock the user.
+type AdminStatusRequest struct {
+	Reason string `json:"reason" validate:"max=500"`
+}
+
+type AdminUsersResponse struct {
+	Users []AdminUserResponse `json:"users"`
+	Total uint64              `json:"total"`
+}
+
+type CreateOrganizationRequest struct {
+	Name string `json:"name" validate:"required,max=200"`
+}
+
+type OrganizationResponse struct {
+	ID        string     `json:"id"`
+	Name      string     `json:"name"`
+	Role      string     `json:"role,omitempty"`
+	JoinedAt  *time.Time `json:"joined_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+type MemberResponse struct {
+	PublicID  string    `json:"public_id"`
+	Email     string    `json:"email"`
+	FirstName string    `json:"first_name"`
+	LastName  string    `json:"last_name"`
+	Role      string    `json:"role"`
+	JoinedAt  time.Time `json:"joined_at"`
+}
+
+type ChangeMemberRoleRequest struct {
+	Role string `json:"role" validate:"required"`
+}
+
+type OrganizationInviteRequest struct {
+	Email string `json:"email" validate:"required,email"`
+	Role  string `json:"role" validate:"required"`
+}
+
+type OrganizationInviteResponse struct {
+	ID        string    `json:"id"`
+	Email     string    `json:"email"`
+	Role      string    `json:"role"`
+	ExpiresAt time.Time `json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type InviteInfoResponse struct {
+	Organization  OrganizationResponse `json:"organization"`
+	Email         string               `json:"email"`
+	Role          string               `json:"role"`
+	ExpiresAt     time.Time            `json:"expires_at"`
+	AccountExists bool                 `json:"account_exists"`
+}
+
+type InviteAcceptRequest struct {
+	Token string `json:"token" validate:"required"`
+}
+
+// InviteRegisterRequest creates the account of the invited email, so it has no email of its own.
+type InviteRegisterRequest struct {
+	Token     string `json:"token" validate:"required"`
+	FirstName string `json:"first_name" validate:"required"`
+	LastName  string `json:"last_name" validate:"required"`
+	Password  string `json:"password" validate:"required"`
+}
+
+type SessionResponse struct {
+	ID         string     `json:"id"`
+	ClientID   string     `json:"client_id,omitempty"`
+	Device     string     `json:"device,omitempty"`
+	IP         string     `json:"ip,omitempty"`
+	UserAgent  string     `json:"user_agent,omitempty"`
+	Current    bool       `json:"current,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	LastSeenAt *time.Time `json:"last_seen_at,omitempty"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+type EmailChangeResponse struct {
+	NewEmail  string     `json:"new_email"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+type AuditEventResponse struct {
+	ID        uint64            `json:"id"`
+	UserID    string            `json:"user_id,omitempty"`
+	Type      string            `json:"type"`
+	IP        string            `json:"ip"`
+	UserAgent string            `json:"user_agent"`
+	RequestID string            `json:"request_id"`
+	Metadata  map[string]string `json:"metadata,omitempty"`
+	CreatedAt time.Time         `json:"created_at"`
+}
+
+type AuditEventsResponse struct {
+	Events       []AuditEventResponse `json:"events"`
+	NextBeforeID uint64               `json:"next_before_id,omitempty"`
+}
+
 type UserResetPasswordReqRequest struct {
 	Email string `json:"email" validate:"required,email"`
 }
 
 type UserResetPasswordRequest struct {
 	ResetCode string `json:"reset_code"`
-	Password  string `json:"password"   validate:"required,min=6"`
+	Password  string `json:"password"   validate:"required"`
 }
 
 type UserChangePasswordRequest struct {
-	Password string `json:"password" validate:"required,min=6"`
+	Password string `json:"password" validate:"required"`
+	ReauthRequest
+}
+
+// ReauthRequest confirms a sensitive change, it can be left empty shortly after signing in.
+type ReauthRequest struct {
+	CurrentPassword string `json:"current_password"`
+	Code            string `json:"code"`
+}
+
+type EmailChangeRequest struct {
+	Email string `json:"email" validate:"required,email"`
+	ReauthRequest
+}
+
+type EmailChangeConfirmRequest struct {
+	Token string `json:"token" validate:"required"`
+}
+
+type PasswordViolationResponse struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type PasswordPolicyErrorResponse struct {
+	Error      string                      `json:"error"`
+	Violations []PasswordViolationResponse `json:"violations"`
 }
 
 type UserTwoFACodeRequest struct {
-	Code string `json:"code"`
+	Code           string `json:"code"`
+	RememberDevice bool   `json:"remember_device"`
+}
+
+type TrustedDeviceResponse struct {
+	ID         string     `json:"id"`
+	Device     string     `json:"device,omitempty"`
+	IP         string     `json:"ip"`
+	UserAgent  string     `json:"user_agent"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
 }
 
 type UserOtpResponse struct {
@@ -53,6 +275,115 @@ type UserRecoveryCodeResponse struct {
 	Codes []string `json:"codes"`
 }
 
+// WebAuthnRegisterRequest carries the PublicKeyCredential returned by navigator.credentials.create.
+type WebAuthnRegisterRequest struct {
+	Name       string          `json:"name" validate:"required,max=64"`
+	Credential json.RawMessage `json:"credential" validate:"required"`
+}
+
+type WebAuthnCredentialResponse struct {
+	ID             uint64     `json:"id"`
+	Name           string     `json:"name"`
+	BackupEligible bool       `json:"backup_eligible"`
+	CreatedAt      time.Time  `json:"created_at"`
+	LastUsedAt     *time.Time `json:"last_used_at,omitempty"`
+}
+
+type CreateAPIKeyRequest struct {
+	Name      string     `json:"name" validate:"required,max=64"`
+	Scopes    []string   `json:"scopes" validate:"required,min=1"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+type APIKeyResponse struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// CreateAPIKeyResponse is the only response that contains the key itself.
+type CreateAPIKeyResponse struct {
+	APIKeyResponse
+	Key string `json:"key"`
+}
+
 type ContentResponse struct {
-	ID int64
+	ID          uint64    `json:"id"`
+	Source      string    `json:"source"`
+	PreviewURL  string    `json:"preview_url"`
+	PreviewType string    `json:"preview_type"`
+	MediaURL    string    `json:"media_url"`
+	Description string    `json:"description"`
+	Tags        []string  `json:"tags"`
+	Type        string    `json:"type"`
+	Status      string    `json:"status"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+type ContentsResponse struct {
+	Contents     []ContentResponse `json:"contents"`
+	NextBeforeID uint64            `json:"next_before_id,omitempty"`
+}
+
+type SetContentStatusRequest struct {
+	Status string `json:"status" validate:"required,oneof=active hide"`
+}
+
+type AuthorizeConsentRequest struct {
+	ResponseType        string `json:"response_type" validate:"required"`
+	ClientID            string `json:"client_id" validate:"required"`
+	RedirectURI         string `json:"redirect_uri" validate:"required"`
+	Scope               string `json:"scope" validate:"required"`
+	State               string `json:"state"`
+	Nonce               string `json:"nonce"`
+	CodeChallenge       string `json:"code_challenge"`
+	CodeChallengeMethod string `json:"code_challenge_method"`
+	Approved            bool   `json:"approved"`
+}
+
+type AuthorizeResponse struct {
+	RedirectURI string `json:"redirect_uri"`
+}
+
+type OAuthTokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	IDToken      string `json:"id_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+}
+
+type OAuthErrorResponse struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
+
+type UserInfoResponse struct {
+	Subject       string `json:"sub"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	GivenName     string `json:"given_name"`
+	FamilyName    string `json:"family_name"`
+}
+
+type OpenIDConfigurationResponse struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	UserInfoEndpoint                  string   `json:"userinfo_endpoint"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	ScopesSupported                   []string `json:"scopes_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+	ClaimsSupported                   []string `json:"claims_supported"`
 }
@@ -0,0 +1,166 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/theruziev/oson_auth/internal/model"
+	"github.com/theruziev/oson_auth/internal/pkg/auth"
+	"github.com/theruziev/oson_auth/internal/pkg/httpx"
+	"github.com/theruziev/oson_auth/internal/pkg/logging"
+	"github.com/theruziev/oson_auth/internal/pkg/validatorx"
+	"github.com/theruziev/oson_auth/internal/service"
+)
+
+const tokenTypeBearer = "Bearer"
+
+type OIDCHandler struct {
+	oidcService *service.OIDCService
+}
+
+func NewOIDCHandler(oidcService *service.OIDCService) *OIDCHandler {
+	return &OIDCHandler{
+		oidcService: oidcService,
+	}
+}
+
+// StartAuthorize sends the user agent to the login page that asks for the user's consent.
+func (h *OIDCHandler) StartAuthorize(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	query := r.URL.Query()
+
+	location, err := h.oidcService.StartAuthorize(ctx, &model.AuthorizeRequest{
+		ResponseType:        query.Get("response_type"),
+		ClientID:            query.Get("client_id"),
+		RedirectURI:         query.Get("redirect_uri"),
+		Scope:               query.Get("scope"),
+		State:               query.Get("state"),
+		Nonce:               query.Get("nonce"),
+		CodeChallenge:       query.Get("code_challenge"),
+		CodeChallengeMethod: query.Get("code_challenge_method"),
+	})
+	if err != nil {
+		oauthError(w, r, err)
+		return
+	}
+
+	http.Redirect(w, r, location, http.StatusFound)
+}
+
+// Authorize is called by the login page once the user has signed in and answered the consent prompt.
+func (h *OIDCHandler) Authorize(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	validate := validatorx.FromContext(ctx)
+	claim := auth.FromContext(ctx)
+
+	req, err := httpx.ParseJSON[AuthorizeConsentRequest](r)
+	if err != nil {
+		httpx.JSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err = validate.Struct(req); err != nil {
+		httpx.JSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	location, err := h.oidcService.Authorize(ctx, claim, &model.AuthorizeRequest{
+		ResponseType:        req.ResponseType,
+		ClientID:            req.ClientID,
+		RedirectURI:         req.RedirectURI,
+		Scope:               req.Scope,
+		State:               req.State,
+		Nonce:               req.Nonce,
+		CodeChallenge:       req.CodeChallenge,
+		CodeChallengeMethod: req.CodeChallengeMethod,
+	}, req.Approved)
+	if err != nil {
+		oauthError(w, r, err)
+		return
+	}
+
+	httpx.JSONResponse(w, http.StatusOK, AuthorizeResponse{
+		RedirectURI: location,
+	})
+}
+
+func (h *OIDCHandler) Token(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if err := r.ParseForm(); err != nil {
+		httpx.JSONResponse(w, http.StatusBadRequest, OAuthErrorResponse{
+			Error:            service.OAuthInvalidRequest,
+			ErrorDescription: err.Error(),
+		})
+		return
+	}
+
+	req := &model.TokenRequest{
+		GrantType:    r.PostForm.Get("grant_type"),
+		Code:         r.PostForm.Get("code"),
+		RedirectURI:  r.PostForm.Get("redirect_uri"),
+		CodeVerifier: r.PostForm.Get("code_verifier"),
+		RefreshToken: r.PostForm.Get("refresh_token"),
+		Scope:        r.PostForm.Get("scope"),
+		ClientID:     r.PostForm.Get("client_id"),
+		ClientSecret: r.PostForm.Get("client_secret"),
+	}
+	if clientID, clientSecret, ok := r.BasicAuth(); ok {
+		req.ClientID = clientID
+		req.ClientSecret = clientSecret
+	}
+
+	token, err := h.oidcService.Token(ctx, req)
+	if err != nil {
+		oauthError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	httpx.JSONResponse(w, http.StatusOK, OAuthTokenResponse{
+		AccessToken:  token.AccessToken,
+		TokenType:    tokenTypeBearer,
+		ExpiresIn:    int64(time.Until(token.ExpireAt).Seconds()),
+		RefreshToken: token.RefreshToken,
+		IDToken:      token.IDToken,
+		Scope:        token.Scope,
+	})
+}
+
+func (h *OIDCHandler) UserInfo(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claim := auth.FromContext(ctx)
+
+	userInfo, err := h.oidcService.UserInfo(ctx, claim)
+	if err != nil {
+		httpx.JSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	httpx.JSONResponse(w, http.StatusOK, UserInfoResponse{
+		Subject:       userInfo.Subject,
+		Email:         userInfo.Email,
+		EmailVerified: userInfo.EmailVerified,
+		GivenName:     userInfo.GivenName,
+		FamilyName:    userInfo.FamilyName,
+	})
+}
+
+func oauthError(w http.ResponseWriter, r *http.Request, err error) {
+	var oauthErr *service.OAuthError
+	if !errors.As(err, &oauthErr) {
+		logging.FromContext(r.Context()).Errorf("oauth request failed: %s", err)
+		httpx.JSONError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	code := http.StatusBadRequest
+	if oauthErr.Code == service.OAuthInvalidClient {
+		code = http.StatusUnauthorized
+	}
+	httpx.JSONResponse(w, code, OAuthErrorResponse{
+		Error:            oauthErr.Code,
+		ErrorDescription: oauthErr.Description,
+	})
+}
@@ -0,0 +1,317 @@
+package http
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/theruziev/oson_auth/internal/model"
+	"github.com/theruziev/oson_auth/internal/pkg/auth"
+	"github.com/theruziev/oson_auth/internal/pkg/errz"
+	"github.com/theruziev/oson_auth/internal/pkg/httpx"
+	"github.com/theruziev/oson_auth/internal/pkg/validatorx"
+	"github.com/theruziev/oson_auth/internal/service"
+)
+
+type OrganizationHandler struct {
+	organizationService *service.OrganizationService
+}
+
+func NewOrganizationHandler(organizationService *service.OrganizationService) *OrganizationHandler {
+	return &OrganizationHandler{
+		organizationService: organizationService,
+	}
+}
+
+func (h *OrganizationHandler) Create(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	validate := validatorx.FromContext(ctx)
+	claim := auth.FromContext(ctx)
+
+	req, err := httpx.ParseJSON[CreateOrganizationRequest](r)
+	if err != nil {
+		httpx.JSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err = validate.Struct(req); err != nil {
+		httpx.JSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	org, err := h.organizationService.Create(ctx, claim, req.Name)
+	if err != nil {
+		httpx.JSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	response := toOrganizationResponse(org)
+	response.Role = string(model.OrgRoleOwner)
+	httpx.JSONResponse(w, http.StatusCreated, response)
+}
+
+// List lists the organizations of the user.
+func (h *OrganizationHandler) List(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claim := auth.FromContext(ctx)
+
+	orgs, err := h.organizationService.ListByUser(ctx, claim)
+	if err != nil {
+		httpx.JSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	response := make([]OrganizationResponse, 0, len(orgs))
+	for _, org := range orgs {
+		response = append(response, toUserOrganizationResponse(org))
+	}
+	httpx.JSONResponse(w, http.StatusOK, response)
+}
+
+// Switch returns an access token acting within the organization, the refresh token is kept.
+func (h *OrganizationHandler) Switch(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claim := auth.FromContext(ctx)
+
+	token, err := h.organizationService.Switch(ctx, claim, chi.URLParam(r, "oid"))
+	if err != nil {
+		writeOrganizationError(w, err)
+		return
+	}
+	httpx.JSONResponse(w, http.StatusOK, toAuthTokenResponse(token))
+}
+
+func (h *OrganizationHandler) Current(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claim := auth.FromContext(ctx)
+
+	org, membership, err := h.organizationService.Current(ctx, claim)
+	if err != nil {
+		writeOrganizationError(w, err)
+		return
+	}
+	response := toOrganizationResponse(org)
+	response.Role = string(membership.Role)
+	response.JoinedAt = &membership.CreatedAt
+	httpx.JSONResponse(w, http.StatusOK, response)
+}
+
+func (h *OrganizationHandler) ListMembers(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claim := auth.FromContext(ctx)
+
+	members, err := h.organizationService.ListMembers(ctx, claim)
+	if err != nil {
+		writeOrganizationError(w, err)
+		return
+	}
+	response := make([]MemberResponse, 0, len(members))
+	for _, member := range members {
+		response = append(response, MemberResponse{
+			PublicID:  member.PublicID,
+			Email:     member.Email,
+			FirstName: member.FirstName,
+			LastName:  member.LastName,
+			Role:      string(member.Role),
+			JoinedAt:  member.JoinedAt,
+		})
+	}
+	httpx.JSONResponse(w, http.StatusOK, response)
+}
+
+func (h *OrganizationHandler) ChangeMemberRole(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	validate := validatorx.FromContext(ctx)
+	claim := auth.FromContext(ctx)
+
+	req, err := httpx.ParseJSON[ChangeMemberRoleRequest](r)
+	if err != nil {
+		httpx.JSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err = validate.Struct(req); err != nil {
+		httpx.JSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	err = h.organizationService.ChangeMemberRole(ctx, claim, chi.URLParam(r, "pid"), model.OrgRole(req.Role))
+	if err != nil {
+		writeOrganizationError(w, err)
+		return
+	}
+	httpx.JSONOKResponse(w)
+}
+
+func (h *OrganizationHandler) RemoveMember(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claim := auth.FromContext(ctx)
+
+	if err := h.organizationService.RemoveMember(ctx, claim, chi.URLParam(r, "pid")); err != nil {
+		writeOrganizationError(w, err)
+		return
+	}
+	httpx.JSONOKResponse(w)
+}
+
+func (h *OrganizationHandler) Invite(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	validate := validatorx.FromContext(ctx)
+	claim := auth.FromContext(ctx)
+
+	req, err := httpx.ParseJSON[OrganizationInviteRequest](r)
+	if err != nil {
+		httpx.JSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err = validate.Struct(req); err != nil {
+		httpx.JSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	invite, err := h.organizationService.Invite(ctx, claim, req.Email, model.OrgRole(req.Role))
+	if err != nil {
+		writeOrganizationError(w, err)
+		return
+	}
+	httpx.JSONResponse(w, http.StatusCreated, toOrganizationInviteResponse(invite))
+}
+
+func (h *OrganizationHandler) ListInvites(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claim := auth.FromContext(ctx)
+
+	invites, err := h.organizationService.ListInvites(ctx, claim)
+	if err != nil {
+		writeOrganizationError(w, err)
+		return
+	}
+	response := make([]OrganizationInviteResponse, 0, len(invites))
+	for _, invite := range invites {
+		response = append(response, toOrganizationInviteResponse(invite))
+	}
+	httpx.JSONResponse(w, http.StatusOK, response)
+}
+
+func (h *OrganizationHandler) RevokeInvite(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claim := auth.FromContext(ctx)
+
+	if err := h.organizationService.RevokeInvite(ctx, claim, chi.URLParam(r, "id")); err != nil {
+		writeOrganizationError(w, err)
+		return
+	}
+	httpx.JSONOKResponse(w)
+}
+
+// GetInvite describes the invite of the token query parameter, so the page behind the link
+// knows whether to sign the person in or to register them.
+func (h *OrganizationHandler) GetInvite(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		httpx.JSONError(w, http.StatusBadRequest, "token is required")
+		return
+	}
+
+	info, err := h.organizationService.GetInvite(ctx, token)
+	if err != nil {
+		writeOrganizationError(w, err)
+		return
+	}
+	httpx.JSONResponse(w, http.StatusOK, InviteInfoResponse{
+		Organization:  toOrganizationResponse(info.Organization),
+		Email:         info.Invite.Email,
+		Role:          string(info.Invite.Role),
+		ExpiresAt:     info.Invite.ExpiresAt,
+		AccountExists: info.AccountExists,
+	})
+}
+
+func (h *OrganizationHandler) AcceptInvite(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	validate := validatorx.FromContext(ctx)
+	claim := auth.FromContext(ctx)
+
+	req, err := httpx.ParseJSON[InviteAcceptRequest](r)
+	if err != nil {
+		httpx.JSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err = validate.Struct(req); err != nil {
+		httpx.JSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	org, err := h.organizationService.AcceptInvite(ctx, claim, req.Token)
+	if err != nil {
+		writeOrganizationError(w, err)
+		return
+	}
+	httpx.JSONResponse(w, http.StatusOK, toOrganizationResponse(org))
+}
+
+func (h *OrganizationHandler) RegisterWithInvite(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	validate := validatorx.FromContext(ctx)
+
+	req, err := httpx.ParseJSON[InviteRegisterRequest](r)
+	if err != nil {
+		httpx.JSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err = validate.Struct(req); err != nil {
+		httpx.JSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	_, err = h.organizationService.RegisterWithInvite(ctx, req.Token, &model.RegisterRequest{
+		Password:  req.Password,
+		FirstName: req.FirstName,
+		LastName:  req.LastName,
+	})
+	if err != nil {
+		if passwordPolicyError(w, err) {
+			return
+		}
+		writeOrganizationError(w, err)
+		return
+	}
+	httpx.JSONOKResponse(w)
+}
+
+func writeOrganizationError(w http.ResponseWriter, err error) {
+	switch {
+	case errz.NotFoundErr.Is(err):
+		httpx.JSONError(w, http.StatusNotFound, err.Error())
+	case errz.BadRequestErr.Is(err):
+		httpx.JSONError(w, http.StatusBadRequest, err.Error())
+	case errz.ForbiddenErr.Is(err):
+		httpx.JSONError(w, http.StatusForbidden, err.Error())
+	case errz.ConflictErr.Is(err):
+		httpx.JSONError(w, http.StatusConflict, err.Error())
+	default:
+		httpx.JSONError(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+func toOrganizationResponse(org *model.Organization) OrganizationResponse {
+	return OrganizationResponse{
+		ID:        org.PublicID,
+		Name:      org.Name,
+		CreatedAt: org.CreatedAt,
+	}
+}
+
+func toUserOrganizationResponse(org *model.UserOrganization) OrganizationResponse {
+	response := toOrganizationResponse(&org.Organization)
+	response.Role = string(org.Role)
+	response.JoinedAt = &org.JoinedAt
+	return response
+}
+
+func toOrganizationInviteResponse(invite *model.OrganizationInvite) OrganizationInviteResponse {
+	return OrganizationInviteResponse{
+		ID:        invite.PublicID,
+		Email:     invite.Email,
+		Role:      string(invite.Role),
+		ExpiresAt: invite.ExpiresAt,
+		CreatedAt: invite.CreatedAt,
+	}
+}
@@ -1,12 +1,14 @@
 package http
 
 import (
+	"errors"
 	"net/http"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/theruziev/oson_auth/internal/pkg/auth"
 	"github.com/theruziev/oson_auth/internal/pkg/errz"
 	"github.com/theruziev/oson_auth/internal/pkg/httpx"
+	"github.com/theruziev/oson_auth/internal/pkg/passwordpolicy"
 	"github.com/theruziev/oson_auth/internal/pkg/validatorx"
 )
 
@@ -69,6 +71,13 @@ func (s *UserHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
 
 	err = s.userService.ResetPassword(ctx, req.ResetCode, req.Password)
 	if err != nil {
+		if passwordPolicyError(w, err) {
+			return
+		}
+		if errz.NotFoundErr.Is(err) {
+			httpx.JSONError(w, http.StatusNotFound, err.Error())
+			return
+		}
 		httpx.JSONError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
@@ -81,7 +90,7 @@ func (s *UserHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
 	validate := validatorx.FromContext(ctx)
 	claim := auth.FromContext(ctx)
 
-	req, err := httpx.ParseJSON[UserResetPasswordRequest](r)
+	req, err := httpx.ParseJSON[UserChangePasswordRequest](r)
 	if err != nil {
 		httpx.JSONError(w, http.StatusBadRequest, err.Error())
 		return
@@ -92,11 +101,34 @@ func (s *UserHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = s.userService.ChangePassword(ctx, claim.PublicID, req.Password)
+	err = s.userService.ChangePassword(ctx, claim, req.Password, req.ReauthRequest.toModel())
 	if err != nil {
+		if passwordPolicyError(w, err) || reauthError(w, err) {
+			return
+		}
 		httpx.JSONError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
 	httpx.JSONOKResponse(w)
 }
+
+// passwordPolicyError answers with 400 and the broken rules when the password was rejected by the policy.
+func passwordPolicyError(w http.ResponseWriter, err error) bool {
+	var violationErr *passwordpolicy.ViolationError
+	if !errors.As(err, &violationErr) {
+		return false
+	}
+	violations := make([]PasswordViolationResponse, 0, len(violationErr.Violations))
+	for _, violation := range violationErr.Violations {
+		violations = append(violations, PasswordViolationResponse{
+			Code:    string(violation.Code),
+			Message: violation.Message,
+		})
+	}
+	httpx.JSONResponse(w, http.StatusBadRequest, PasswordPolicyErrorResponse{
+		Error:      "password does not meet the policy",
+		Violations: violations,
+	})
+	return true
+}
@@ -0,0 +1,63 @@
+package http
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/theruziev/oson_auth/internal/model"
+	"github.com/theruziev/oson_auth/internal/pkg/auth"
+	"github.com/theruziev/oson_auth/internal/pkg/clientinfo"
+	"github.com/theruziev/oson_auth/internal/pkg/errz"
+	"github.com/theruziev/oson_auth/internal/pkg/httpx"
+)
+
+// ListSessions lists where the user is signed in, the session of the token is flagged as the current one.
+func (s *UserHandler) ListSessions(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claim := auth.FromContext(ctx)
+
+	sessions, err := s.userService.ListSessions(ctx, claim.PublicID)
+	if err != nil {
+		httpx.JSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response := make([]SessionResponse, 0, len(sessions))
+	for _, session := range sessions {
+		sessionResponse := toSessionResponse(session)
+		sessionResponse.Current = session.PublicID == claim.SessionID
+		response = append(response, sessionResponse)
+	}
+	httpx.JSONResponse(w, http.StatusOK, response)
+}
+
+func (s *UserHandler) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claim := auth.FromContext(ctx)
+
+	if err := s.userService.RevokeSession(ctx, claim.PublicID, chi.URLParam(r, "id")); err != nil {
+		if errz.NotFoundErr.Is(err) {
+			httpx.JSONError(w, http.StatusNotFound, "session not found")
+			return
+		}
+		httpx.JSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	httpx.JSONOKResponse(w)
+}
+
+func toSessionResponse(session *model.Session) SessionResponse {
+	return SessionResponse{
+		ID:         session.PublicID,
+		ClientID:   session.ClientID,
+		Device:     clientinfo.Device(session.UserAgent),
+		IP:         session.IP,
+		UserAgent:  session.UserAgent,
+		CreatedAt:  session.CreatedAt,
+		UpdatedAt:  session.UpdatedAt,
+		LastSeenAt: session.LastSeenAt,
+		ExpiresAt:  session.ExpiresAt,
+		RevokedAt:  session.RevokedAt,
+	}
+}
@@ -0,0 +1,57 @@
+package http
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/theruziev/oson_auth/internal/model"
+	"github.com/theruziev/oson_auth/internal/pkg/auth"
+	"github.com/theruziev/oson_auth/internal/pkg/clientinfo"
+	"github.com/theruziev/oson_auth/internal/pkg/errz"
+	"github.com/theruziev/oson_auth/internal/pkg/httpx"
+)
+
+func (s *UserHandler) ListTrustedDevices(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claim := auth.FromContext(ctx)
+
+	devices, err := s.userService.ListTrustedDevices(ctx, claim.PublicID)
+	if err != nil {
+		httpx.JSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response := make([]TrustedDeviceResponse, 0, len(devices))
+	for _, device := range devices {
+		response = append(response, toTrustedDeviceResponse(device))
+	}
+	httpx.JSONResponse(w, http.StatusOK, response)
+}
+
+func (s *UserHandler) RevokeTrustedDevice(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claim := auth.FromContext(ctx)
+
+	if err := s.userService.RevokeTrustedDevice(ctx, claim.PublicID, chi.URLParam(r, "id")); err != nil {
+		if errz.NotFoundErr.Is(err) {
+			httpx.JSONError(w, http.StatusNotFound, "trusted device not found")
+			return
+		}
+		httpx.JSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	httpx.JSONOKResponse(w)
+}
+
+func toTrustedDeviceResponse(device *model.TrustedDevice) TrustedDeviceResponse {
+	return TrustedDeviceResponse{
+		ID:         device.PublicID,
+		Device:     clientinfo.Device(device.UserAgent),
+		IP:         device.IP,
+		UserAgent:  device.UserAgent,
+		ExpiresAt:  device.ExpiresAt,
+		LastUsedAt: device.LastUsedAt,
+		CreatedAt:  device.CreatedAt,
+	}
+}
@@ -2,6 +2,7 @@ package http
 
 import (
 	"errors"
+	"io"
 	"net/http"
 
 	"github.com/go-chi/chi/v5"
@@ -48,6 +49,9 @@ func (s *UserHandler) Register(w http.ResponseWriter, r *http.Request) {
 		LastName:  req.LastName,
 	})
 	if err != nil {
+		if passwordPolicyError(w, err) {
+			return
+		}
 		if errz.ConflictErr.Is(err) {
 			httpx.JSONError(w, http.StatusConflict, "user already exist")
 			return
@@ -69,6 +73,10 @@ func (s *UserHandler) Activate(w http.ResponseWriter, r *http.Request) {
 			httpx.JSONError(w, http.StatusNotFound, err.Error())
 			return
 		}
+		if errz.BadRequestErr.Is(err) {
+			httpx.JSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
 		httpx.JSONError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
@@ -80,21 +88,56 @@ func (s *UserHandler) Me(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	claim := auth.FromContext(ctx)
 
-	user, err := s.userService.GetByUsername(ctx, claim.Email)
+	user, err := s.userService.GetByID(ctx, claim.PublicID)
+	if err != nil {
+		httpx.JSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	meResponse := MeResponse{
+		UserResponse: UserResponse{
+			PublicID:  user.PublicID,
+			FirstName: user.FirstName,
+			LastName:  user.LastName,
+			Email:     user.Email,
+			CreatedAt: user.CreatedAt,
+		},
+		OtpEnabled: user.OtpEnabled,
+	}
+	if user.OtpEnabled {
+		remaining, err := s.userService.RecoveryCodesRemaining(ctx, user)
+		if err != nil {
+			httpx.JSONError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		meResponse.RecoveryCodesRemaining = &remaining
+	}
+
+	httpx.JSONResponse(w, http.StatusOK, meResponse)
+}
+
+// GetUser returns a user to machine clients holding the users:read scope.
+func (s *UserHandler) GetUser(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	publicID := chi.URLParam(r, "pid")
+
+	user, err := s.userService.GetByID(ctx, publicID)
 	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			httpx.JSONError(w, http.StatusNotFound, "user not found")
+			return
+		}
 		httpx.JSONError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	userResponse := UserResponse{
+	httpx.JSONResponse(w, http.StatusOK, UserResponse{
 		PublicID:  user.PublicID,
 		FirstName: user.FirstName,
 		LastName:  user.LastName,
 		Email:     user.Email,
 		CreatedAt: user.CreatedAt,
-	}
-
-	httpx.JSONResponse(w, http.StatusOK, userResponse)
+	})
 }
 
 func (s *UserHandler) RequestEnableOTPStep1(w http.ResponseWriter, r *http.Request) {
@@ -102,6 +145,10 @@ func (s *UserHandler) RequestEnableOTPStep1(w http.ResponseWriter, r *http.Reque
 	claim := auth.FromContext(ctx)
 	otpToken, err := s.userService.RequestEnableOTPStep1(ctx, claim.PublicID)
 	if err != nil {
+		if errz.ConflictErr.Is(err) {
+			httpx.JSONError(w, http.StatusConflict, err.Error())
+			return
+		}
 		httpx.JSONError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
@@ -123,6 +170,10 @@ func (s *UserHandler) RequestEnableOTPStep2(w http.ResponseWriter, r *http.Reque
 
 	otpRes, err := s.userService.RequestEnableOTPStep2(ctx, claim.PublicID, req.Code)
 	if err != nil {
+		if errz.ConflictErr.Is(err) {
+			httpx.JSONError(w, http.StatusConflict, err.Error())
+			return
+		}
 		httpx.JSONError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
@@ -132,12 +183,57 @@ func (s *UserHandler) RequestEnableOTPStep2(w http.ResponseWriter, r *http.Reque
 	})
 }
 
+func (s *UserHandler) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claim := auth.FromContext(ctx)
+
+	// the body is optional, a recent login is enough to regenerate the codes
+	req, err := httpx.ParseJSON[ReauthRequest](r)
+	if errors.Is(err, io.EOF) {
+		req, err = &ReauthRequest{}, nil
+	}
+	if err != nil {
+		httpx.JSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	codes, err := s.userService.RegenerateRecoveryCodes(ctx, claim, req.toModel())
+	if err != nil {
+		if reauthError(w, err) {
+			return
+		}
+		if errz.BadRequestErr.Is(err) {
+			httpx.JSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		httpx.JSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	httpx.JSONResponse(w, http.StatusOK, UserRecoveryCodeResponse{
+		Codes: codes.Codes,
+	})
+}
+
 func (s *UserHandler) DisableOTP(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	claim := auth.FromContext(ctx)
 
-	err := s.userService.DisableOTP(ctx, claim.PublicID)
+	// the body is optional, a recent login is enough to disable otp
+	req, err := httpx.ParseJSON[ReauthRequest](r)
+	if errors.Is(err, io.EOF) {
+		req, err = &ReauthRequest{}, nil
+	}
 	if err != nil {
+		httpx.JSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	err = s.userService.DisableOTP(ctx, claim, req.toModel())
+	if err != nil {
+		if reauthError(w, err) {
+			return
+		}
 		httpx.JSONError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
@@ -0,0 +1,190 @@
+package http
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/theruziev/oson_auth/internal/model"
+	"github.com/theruziev/oson_auth/internal/pkg/auth"
+	"github.com/theruziev/oson_auth/internal/pkg/errz"
+	"github.com/theruziev/oson_auth/internal/pkg/httpx"
+	"github.com/theruziev/oson_auth/internal/pkg/logging"
+	"github.com/theruziev/oson_auth/internal/pkg/validatorx"
+)
+
+// maxWebAuthnResponseSize limits the PublicKeyCredential read from the request body.
+const maxWebAuthnResponseSize = 64 << 10
+
+func (s *UserHandler) BeginWebAuthnRegistration(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claim := auth.FromContext(ctx)
+
+	options, err := s.userService.BeginWebAuthnRegistration(ctx, claim.PublicID)
+	if err != nil {
+		httpx.JSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	httpx.JSONResponse(w, http.StatusOK, options)
+}
+
+func (s *UserHandler) FinishWebAuthnRegistration(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger := logging.FromContext(ctx)
+	validate := validatorx.FromContext(ctx)
+	claim := auth.FromContext(ctx)
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxWebAuthnResponseSize)
+	req, err := httpx.ParseJSON[WebAuthnRegisterRequest](r)
+	if err != nil {
+		httpx.JSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err = validate.Struct(req); err != nil {
+		httpx.JSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	credential, err := s.userService.FinishWebAuthnRegistration(ctx, claim.PublicID, req.Name, req.Credential)
+	if err != nil {
+		logger.Warnf("failed to register passkey: %s", err)
+		if errz.ConflictErr.Is(err) {
+			httpx.JSONError(w, http.StatusConflict, "passkey already registered")
+			return
+		}
+		if errz.BadRequestErr.Is(err) {
+			httpx.JSONError(w, http.StatusBadRequest, "invalid passkey")
+			return
+		}
+		httpx.JSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	httpx.JSONResponse(w, http.StatusOK, WebAuthnCredentialResponse{
+		ID:             credential.ID,
+		Name:           credential.Name,
+		BackupEligible: credential.BackupEligible,
+		CreatedAt:      credential.CreatedAt,
+		LastUsedAt:     credential.LastUsedAt,
+	})
+}
+
+func (s *UserHandler) ListWebAuthnCredentials(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claim := auth.FromContext(ctx)
+
+	credentials, err := s.userService.ListWebAuthnCredentials(ctx, claim.PublicID)
+	if err != nil {
+		httpx.JSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response := make([]WebAuthnCredentialResponse, 0, len(credentials))
+	for _, credential := range credentials {
+		response = append(response, toWebAuthnCredentialResponse(credential))
+	}
+	httpx.JSONResponse(w, http.StatusOK, response)
+}
+
+func toWebAuthnCredentialResponse(credential *model.WebAuthnCredential) WebAuthnCredentialResponse {
+	return WebAuthnCredentialResponse{
+		ID:             credential.ID,
+		Name:           credential.Name,
+		BackupEligible: credential.BackupEligible,
+		CreatedAt:      credential.CreatedAt,
+		LastUsedAt:     credential.LastUsedAt,
+	}
+}
+
+func (s *UserHandler) DeleteWebAuthnCredential(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claim := auth.FromContext(ctx)
+
+	id, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		httpx.JSONError(w, http.StatusBadRequest, "invalid credential id")
+		return
+	}
+
+	if err := s.userService.DeleteWebAuthnCredential(ctx, claim.PublicID, id); err != nil {
+		if errz.NotFoundErr.Is(err) {
+			httpx.JSONError(w, http.StatusNotFound, "passkey not found")
+			return
+		}
+		httpx.JSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	httpx.JSONOKResponse(w)
+}
+
+func (s *UserHandler) BeginAuthTwoFAWebAuthn(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger := logging.FromContext(ctx)
+	claim := auth.FromContext(ctx)
+
+	options, err := s.userService.BeginAuthTwoFAWebAuthn(ctx, claim)
+	if err != nil {
+		logger.Warnf("failed to begin passkey 2fa: %s", err)
+		httpx.JSONError(w, http.StatusForbidden, "not permitted")
+		return
+	}
+
+	httpx.JSONResponse(w, http.StatusOK, options)
+}
+
+func (s *UserHandler) AuthTwoFAWebAuthn(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger := logging.FromContext(ctx)
+	claim := auth.FromContext(ctx)
+
+	response, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWebAuthnResponseSize))
+	if err != nil {
+		httpx.JSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	token, err := s.userService.AuthTwoFAWebAuthn(ctx, claim, response)
+	if err != nil {
+		logger.Warnf("failed to 2fa with passkey: %s", err)
+		httpx.JSONError(w, http.StatusForbidden, "incorrect passkey")
+		return
+	}
+
+	httpx.JSONResponse(w, http.StatusOK, toAuthTokenResponse(token))
+}
+
+func (s *UserHandler) BeginPasskeyLogin(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	options, err := s.userService.BeginPasskeyLogin(ctx)
+	if err != nil {
+		httpx.JSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	httpx.JSONResponse(w, http.StatusOK, options)
+}
+
+func (s *UserHandler) AuthPasskey(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger := logging.FromContext(ctx)
+
+	response, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWebAuthnResponseSize))
+	if err != nil {
+		httpx.JSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	token, err := s.userService.AuthPasskey(ctx, response)
+	if err != nil {
+		logger.Warnf("failed to auth with passkey: %s", err)
+		httpx.JSONError(w, http.StatusForbidden, "incorrect passkey")
+		return
+	}
+
+	httpx.JSONResponse(w, http.StatusOK, toAuthTokenResponse(token))
+}
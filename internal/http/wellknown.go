@@ -0,0 +1,50 @@
+package http
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/theruziev/oson_auth/internal/model"
+	"github.com/theruziev/oson_auth/internal/pkg/auth"
+	"github.com/theruziev/oson_auth/internal/pkg/httpx"
+	"github.com/theruziev/oson_auth/internal/service"
+)
+
+const jwksCacheControl = "public, max-age=300"
+
+type WellKnownHandler struct {
+	signer  *auth.Signer
+	oidcOpt *auth.OIDCOption
+}
+
+func NewWellKnownHandler(signer *auth.Signer, oidcOpt *auth.OIDCOption) *WellKnownHandler {
+	return &WellKnownHandler{
+		signer:  signer,
+		oidcOpt: oidcOpt,
+	}
+}
+
+func (h *WellKnownHandler) JWKS(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Cache-Control", jwksCacheControl)
+	httpx.JSONResponse(w, http.StatusOK, h.signer.JWKS())
+}
+
+func (h *WellKnownHandler) OpenIDConfiguration(w http.ResponseWriter, _ *http.Request) {
+	issuer := strings.TrimSuffix(h.oidcOpt.Issuer, "/")
+	w.Header().Set("Cache-Control", jwksCacheControl)
+	httpx.JSONResponse(w, http.StatusOK, OpenIDConfigurationResponse{
+		Issuer:                            h.oidcOpt.Issuer,
+		AuthorizationEndpoint:             issuer + "/authorize",
+		TokenEndpoint:                     issuer + "/token",
+		UserInfoEndpoint:                  issuer + "/userinfo",
+		JWKSURI:                           issuer + "/.well-known/jwks.json",
+		ResponseTypesSupported:            []string{"code"},
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  []string{h.signer.Alg()},
+		ScopesSupported:                   []string{auth.ScopeOpenID, "email", "profile"},
+		GrantTypesSupported:               []string{service.GrantTypeAuthorizationCode, service.GrantTypeRefreshToken, service.GrantTypeClientCredentials},
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "none"},
+		CodeChallengeMethodsSupported:     []string{model.CodeChallengeMethodS256},
+		ClaimsSupported:                   []string{"sub", "iss", "aud", "exp", "iat", "auth_time", "nonce", "email", "email_verified", "given_name", "family_name"},
+	})
+}
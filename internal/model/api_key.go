@@ -0,0 +1,32 @@
+package model
+
+import "time"
+
+// APIKey is a long-lived credential a user creates for scripts and CI jobs.
+// Only the hash of the key is stored, Prefix is kept to help the user tell keys apart.
+type APIKey struct {
+	ID         uint64     `db:"id"`
+	PublicID   string     `db:"public_id"`
+	UserID     uint64     `db:"user_id"`
+	Name       string     `db:"name"`
+	TokenHash  string     `db:"token_hash"`
+	Prefix     string     `db:"prefix"`
+	Scopes     []string   `db:"scopes"`
+	ExpiresAt  *time.Time `db:"expires_at"`
+	LastUsedAt *time.Time `db:"last_used_at"`
+	RevokedAt  *time.Time `db:"revoked_at"`
+	CreatedAt  time.Time  `db:"created_at"`
+}
+
+func (k *APIKey) IsActive(now time.Time) bool {
+	if k.RevokedAt != nil {
+		return false
+	}
+	return k.ExpiresAt == nil || now.Before(*k.ExpiresAt)
+}
+
+type CreateAPIKeyRequest struct {
+	Name      string
+	Scopes    []string
+	ExpiresAt *time.Time
+}
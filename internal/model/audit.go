@@ -0,0 +1,57 @@
+package model
+
+import "time"
+
+type AuditEventType string
+
+const (
+	AuditLoginSucceeded       AuditEventType = "login_succeeded"
+	AuditLoginFailed          AuditEventType = "login_failed"
+	AuditTwoFASucceeded       AuditEventType = "2fa_succeeded"
+	AuditTwoFAFailed          AuditEventType = "2fa_failed"
+	AuditRecoveryCodeUsed     AuditEventType = "recovery_code_used"
+	AuditRecoveryCodesIssued  AuditEventType = "recovery_codes_issued"
+	AuditPasswordChanged      AuditEventType = "password_changed"
+	AuditPasswordReset        AuditEventType = "password_reset"
+	AuditOtpEnabled           AuditEventType = "otp_enabled"
+	AuditOtpDisabled          AuditEventType = "otp_disabled"
+	AuditUserActivated        AuditEventType = "user_activated"
+	AuditEmailChangeRequested AuditEventType = "email_change_requested"
+	AuditEmailChanged         AuditEventType = "email_changed"
+	AuditAccountDeleted       AuditEventType = "account_deleted"
+	AuditAdminUserViewed      AuditEventType = "admin_user_viewed"
+	AuditAdminAction          AuditEventType = "admin_action"
+	AuditOrgJoined            AuditEventType = "org_joined"
+	AuditOrgLeft              AuditEventType = "org_left"
+	AuditOrgRoleChanged       AuditEventType = "org_role_changed"
+	AuditDeviceTrusted        AuditEventType = "device_trusted"
+	AuditDeviceRevoked        AuditEventType = "device_revoked"
+	AuditSessionRevoked       AuditEventType = "session_revoked"
+	AuditContentModerated     AuditEventType = "content_moderated"
+)
+
+// AuditEvent records a security relevant action. UserID is nil when the action can't be tied
+// to a user, e.g. a login with an unknown email. Events are never updated.
+type AuditEvent struct {
+	ID           uint64            `db:"id"`
+	UserID       *uint64           `db:"user_id"`
+	UserPublicID string            `db:"user_public_id"`
+	Type         AuditEventType    `db:"type"`
+	IP           string            `db:"ip"`
+	UserAgent    string            `db:"user_agent"`
+	RequestID    string            `db:"request_id"`
+	Metadata     map[string]string `db:"metadata"`
+	CreatedAt    time.Time         `db:"created_at"`
+}
+
+// AuditEventFilter narrows down the listing, zero values match everything.
+// Events come the latest first, BeforeID continues the listing after the last event of the previous page.
+type AuditEventFilter struct {
+	UserPublicID string
+	Types        []AuditEventType
+	IP           string
+	From         *time.Time
+	To           *time.Time
+	BeforeID     uint64
+	Limit        uint64
+}
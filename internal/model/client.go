@@ -0,0 +1,45 @@
+package model
+
+import "time"
+
+type Client struct {
+	ID           uint64    `db:"id"`
+	ClientID     string    `db:"client_id"`
+	SecretHash   string    `db:"secret_hash"`
+	Name         string    `db:"name"`
+	RedirectURIs []string  `db:"redirect_uris"`
+	IsPublic     bool      `db:"is_public"`
+	GrantTypes   []string  `db:"grant_types"`
+	Scopes       []string  `db:"scopes"`
+	CreatedAt    time.Time `db:"created_at"`
+	UpdatedAt    time.Time `db:"updated_at"`
+
+	SecretRotatedAt *time.Time `db:"secret_rotated_at"`
+}
+
+type CreateClientRequest struct {
+	ClientID     string
+	Name         string
+	IsPublic     bool
+	RedirectURIs []string
+	GrantTypes   []string
+	Scopes       []string
+}
+
+func (c *Client) HasRedirectURI(redirectURI string) bool {
+	for _, uri := range c.RedirectURIs {
+		if uri == redirectURI {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Client) HasGrantType(grantType string) bool {
+	for _, gt := range c.GrantTypes {
+		if gt == grantType {
+			return true
+		}
+	}
+	return false
+}
@@ -43,3 +43,11 @@ type ContentListResponse struct {
 	Result []*Content
 	LastID uint64
 }
+
+// ContentFilter narrows down the listing of the moderators, zero values match everything.
+// Contents come the newest first, BeforeID continues the listing after the last content of the previous page.
+type ContentFilter struct {
+	Status   ContentStatus
+	BeforeID uint64
+	Limit    uint64
+}
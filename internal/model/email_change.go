@@ -0,0 +1,19 @@
+package model
+
+import "time"
+
+// EmailChange is a pending change of the email of the user. It is applied once the new address
+// confirms it with the token sent there, only the hash of the token is stored.
+type EmailChange struct {
+	ID        uint64     `db:"id"`
+	TokenHash string     `db:"token_hash"`
+	UserID    uint64     `db:"user_id"`
+	NewEmail  string     `db:"new_email"`
+	ExpiresAt time.Time  `db:"expires_at"`
+	UsedAt    *time.Time `db:"used_at"`
+	CreatedAt time.Time  `db:"created_at"`
+}
+
+func (c *EmailChange) IsExpired(now time.Time) bool {
+	return now.After(c.ExpiresAt)
+}
@@ -0,0 +1,18 @@
+package model
+
+import "time"
+
+// UserExport is everything stored about the user, it answers data subject access requests.
+type UserExport struct {
+	User                *User
+	Sessions            []*Session
+	APIKeys             []*APIKey
+	WebAuthnCredentials []*WebAuthnCredential
+	EmailChanges        []*EmailChange
+	AuditEvents         []*AuditEvent
+	Organizations       []*UserOrganization
+	TrustedDevices      []*TrustedDevice
+	// Omitted names what is stored but can't be attributed to the user, with the reason.
+	Omitted    []string
+	ExportedAt time.Time
+}
@@ -0,0 +1,17 @@
+package model
+
+import "time"
+
+// MagicLink is a single-use login token sent by email. Only the hash of the token is stored.
+type MagicLink struct {
+	ID        uint64     `db:"id"`
+	TokenHash string     `db:"token_hash"`
+	UserID    uint64     `db:"user_id"`
+	ExpiresAt time.Time  `db:"expires_at"`
+	UsedAt    *time.Time `db:"used_at"`
+	CreatedAt time.Time  `db:"created_at"`
+}
+
+func (l *MagicLink) IsExpired(now time.Time) bool {
+	return now.After(l.ExpiresAt)
+}
@@ -0,0 +1,61 @@
+package model
+
+import "time"
+
+const CodeChallengeMethodS256 = "S256"
+
+type AuthorizationCode struct {
+	ID                  uint64    `db:"id"`
+	CodeHash            string    `db:"code_hash"`
+	ClientID            string    `db:"client_id"`
+	UserID              uint64    `db:"user_id"`
+	RedirectURI         string    `db:"redirect_uri"`
+	Scope               string    `db:"scope"`
+	Nonce               string    `db:"nonce"`
+	CodeChallenge       string    `db:"code_challenge"`
+	CodeChallengeMethod string    `db:"code_challenge_method"`
+	AuthTime            time.Time `db:"auth_time"`
+	// SessionID is the session opened with the code, it is revoked when the code is used again.
+	SessionID *uint64    `db:"session_id"`
+	ExpiresAt time.Time  `db:"expires_at"`
+	UsedAt    *time.Time `db:"used_at"`
+	CreatedAt time.Time  `db:"created_at"`
+}
+
+type AuthorizeRequest struct {
+	ResponseType        string
+	ClientID            string
+	RedirectURI         string
+	Scope               string
+	State               string
+	Nonce               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+}
+
+type TokenRequest struct {
+	GrantType    string
+	Code         string
+	RedirectURI  string
+	CodeVerifier string
+	RefreshToken string
+	Scope        string
+	ClientID     string
+	ClientSecret string
+}
+
+type OIDCToken struct {
+	AccessToken  string
+	IDToken      string
+	RefreshToken string
+	ExpireAt     time.Time
+	Scope        string
+}
+
+type UserInfo struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	GivenName     string
+	FamilyName    string
+}
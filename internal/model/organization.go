@@ -0,0 +1,82 @@
+package model
+
+import "time"
+
+// OrgRole is the role of a member within an organization, unlike Role it is not global.
+type OrgRole string
+
+const (
+	OrgRoleOwner  OrgRole = "owner"
+	OrgRoleAdmin  OrgRole = "admin"
+	OrgRoleMember OrgRole = "member"
+)
+
+func (r OrgRole) IsValid() bool {
+	return r == OrgRoleOwner || r == OrgRoleAdmin || r == OrgRoleMember
+}
+
+// CanManage reports whether the role can invite people and manage the members.
+func (r OrgRole) CanManage() bool {
+	return r == OrgRoleOwner || r == OrgRoleAdmin
+}
+
+type Organization struct {
+	ID        uint64    `db:"id"`
+	PublicID  string    `db:"public_id"`
+	Name      string    `db:"name"`
+	CreatedAt time.Time `db:"created_at"`
+	UpdatedAt time.Time `db:"updated_at"`
+}
+
+type Membership struct {
+	ID             uint64    `db:"id"`
+	OrganizationID uint64    `db:"organization_id"`
+	UserID         uint64    `db:"user_id"`
+	Role           OrgRole   `db:"role"`
+	CreatedAt      time.Time `db:"created_at"`
+	UpdatedAt      time.Time `db:"updated_at"`
+}
+
+// UserOrganization is an organization of the user along with the role of the user in it.
+type UserOrganization struct {
+	Organization
+	Role     OrgRole   `db:"role"`
+	JoinedAt time.Time `db:"joined_at"`
+}
+
+// Member is a user of the organization.
+type Member struct {
+	PublicID  string    `db:"public_id"`
+	Email     string    `db:"email"`
+	FirstName string    `db:"first_name"`
+	LastName  string    `db:"last_name"`
+	Role      OrgRole   `db:"role"`
+	JoinedAt  time.Time `db:"joined_at"`
+}
+
+// OrganizationInvite lets whoever owns the email join the organization, only the hash of the token is stored.
+type OrganizationInvite struct {
+	ID             uint64     `db:"id"`
+	PublicID       string     `db:"public_id"`
+	OrganizationID uint64     `db:"organization_id"`
+	Email          string     `db:"email"`
+	Role           OrgRole    `db:"role"`
+	TokenHash      string     `db:"token_hash"`
+	InvitedBy      uint64     `db:"invited_by"`
+	ExpiresAt      time.Time  `db:"expires_at"`
+	AcceptedAt     *time.Time `db:"accepted_at"`
+	RevokedAt      *time.Time `db:"revoked_at"`
+	CreatedAt      time.Time  `db:"created_at"`
+}
+
+func (i *OrganizationInvite) IsActive(now time.Time) bool {
+	return i.AcceptedAt == nil && i.RevokedAt == nil && now.Before(i.ExpiresAt)
+}
+
+// InviteInfo is what the invited person sees before accepting, AccountExists tells whether
+// to sign in or to register to accept it.
+type InviteInfo struct {
+	Organization  *Organization
+	Invite        *OrganizationInvite
+	AccountExists bool
+}
@@ -0,0 +1,12 @@
+package model
+
+import "time"
+
+// RecoveryCode signs the user in once when the authenticator is lost. Only the hash of the code is stored.
+type RecoveryCode struct {
+	ID        uint64     `db:"id"`
+	UserID    uint64     `db:"user_id"`
+	CodeHash  string     `db:"code_hash"`
+	UsedAt    *time.Time `db:"used_at"`
+	CreatedAt time.Time  `db:"created_at"`
+}
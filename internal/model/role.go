@@ -0,0 +1,13 @@
+package model
+
+import "time"
+
+// Role is a named set of permissions granted to users, the sets are kept in the database
+// so they can be changed without a release.
+type Role struct {
+	ID          uint64    `db:"id"`
+	Name        string    `db:"name"`
+	Description string    `db:"description"`
+	Permissions []string  `db:"permissions"`
+	CreatedAt   time.Time `db:"created_at"`
+}
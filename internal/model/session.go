@@ -0,0 +1,34 @@
+package model
+
+import "time"
+
+type Session struct {
+	ID       uint64 `db:"id"`
+	PublicID string `db:"public_id"`
+	UserID   uint64 `db:"user_id"`
+	ClientID string `db:"client_id"`
+	// AuthTime is when the user signed in, the tokens of the session carry it for re-authentication checks.
+	AuthTime  time.Time  `db:"auth_time"`
+	CreatedAt time.Time  `db:"created_at"`
+	UpdatedAt time.Time  `db:"updated_at"`
+	ExpiresAt time.Time  `db:"expires_at"`
+	RevokedAt *time.Time `db:"revoked_at"`
+	// IP is where the session was last seen from, UserAgent is the one it was opened with.
+	IP         string     `db:"ip"`
+	UserAgent  string     `db:"user_agent"`
+	LastSeenAt *time.Time `db:"last_seen_at"`
+	// OrganizationID is the active organization of the session, its tokens act within it.
+	OrganizationID *uint64 `db:"organization_id"`
+}
+
+func (s *Session) IsActive(now time.Time) bool {
+	return s.RevokedAt == nil && now.Before(s.ExpiresAt)
+}
+
+type RefreshToken struct {
+	ID        uint64     `db:"id"`
+	SessionID uint64     `db:"session_id"`
+	TokenHash string     `db:"token_hash"`
+	CreatedAt time.Time  `db:"created_at"`
+	UsedAt    *time.Time `db:"used_at"`
+}
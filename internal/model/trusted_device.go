@@ -0,0 +1,22 @@
+package model
+
+import "time"
+
+// TrustedDevice is a device the user chose to remember after the second factor, logins from it skip
+// the second factor until ExpiresAt. Only the hash of the device token is stored.
+type TrustedDevice struct {
+	ID         uint64     `db:"id"`
+	PublicID   string     `db:"public_id"`
+	UserID     uint64     `db:"user_id"`
+	TokenHash  string     `db:"token_hash"`
+	IP         string     `db:"ip"`
+	UserAgent  string     `db:"user_agent"`
+	ExpiresAt  time.Time  `db:"expires_at"`
+	LastUsedAt *time.Time `db:"last_used_at"`
+	RevokedAt  *time.Time `db:"revoked_at"`
+	CreatedAt  time.Time  `db:"created_at"`
+}
+
+func (d *TrustedDevice) IsActive(now time.Time) bool {
+	return d.RevokedAt == nil && now.Before(d.ExpiresAt)
+}
@@ -1,10 +1,7 @@
 package model
 
 import (
-	"fmt"
 	"time"
-
-	"golang.org/x/crypto/bcrypt"
 )
 
 type UserStatus string
@@ -12,8 +9,30 @@ type UserStatus string
 const (
 	UserStatusActivate   UserStatus = "activated"
 	UserStatusRegistered UserStatus = "registered"
+	UserStatusDeleted    UserStatus = "deleted"
+	UserStatusSuspended  UserStatus = "suspended"
+	UserStatusLocked     UserStatus = "locked"
 )
 
+// userStatusTransitions lists the statuses a user can move to from each status. Deleted is final,
+// the account is only purged afterwards.
+var userStatusTransitions = map[UserStatus][]UserStatus{
+	UserStatusRegistered: {UserStatusActivate, UserStatusSuspended, UserStatusLocked, UserStatusDeleted},
+	UserStatusActivate:   {UserStatusSuspended, UserStatusLocked, UserStatusDeleted},
+	UserStatusSuspended:  {UserStatusActivate, UserStatusRegistered, UserStatusLocked, UserStatusDeleted},
+	UserStatusLocked:     {UserStatusActivate, UserStatusRegistered, UserStatusSuspended, UserStatusDeleted},
+}
+
+// CanTransitionTo reports whether the user can move from the status to next.
+func (s UserStatus) CanTransitionTo(next UserStatus) bool {
+	for _, status := range userStatusTransitions[s] {
+		if status == next {
+			return true
+		}
+	}
+	return false
+}
+
 type User struct {
 	ID                uint64     `db:"id" json:"id"`
 	PublicID          string     `db:"public_id" json:"public_id"`
@@ -22,35 +41,37 @@ type User struct {
 	LastName          string     `db:"last_name" json:"last_name"`
 	Password          string     `db:"password" json:"password"`
 	Status            UserStatus `db:"status" json:"status"`
+	StatusReason      string     `db:"status_reason" json:"status_reason"`
+	StatusChangedAt   *time.Time `db:"status_changed_at" json:"status_changed_at"`
 	CreatedAt         time.Time  `db:"created_at" json:"created_at"`
 	UpdatedAt         time.Time  `db:"updated_at" json:"updated_at"`
 	ActivationCode    string     `db:"activation_code" json:"activation_code"`
 	ResetPasswordCode string     `db:"reset_password_code" json:"reset_password_code"`
 
-	OtpSecret        string   `json:"secret" db:"otp_secret"`
-	OtpRecoveryCodes []string `json:"recovery_codes"  db:"otp_recovery_codes"`
-	OtpEnabled       bool     `db:"otp_enabled"`
+	OtpSecret  string `json:"secret" db:"otp_secret"`
+	OtpEnabled bool   `db:"otp_enabled"`
+	// the parameters the authenticator app was set up with, empty before the user enrolls
+	OtpAlgorithm string `db:"otp_algorithm"`
+	OtpDigits    int    `db:"otp_digits"`
+	OtpPeriod    int    `db:"otp_period"`
+
+	TokensValidAfter  *time.Time `db:"tokens_valid_after" json:"tokens_valid_after"`
+	PasswordChangedAt *time.Time `db:"password_changed_at" json:"password_changed_at"`
+	DeletedAt         *time.Time `db:"deleted_at" json:"deleted_at"`
 }
 
-func (u *User) SetPassword(passwd string) error {
-	hashed, err := bcrypt.GenerateFromPassword([]byte(passwd), bcrypt.DefaultCost)
-	if err != nil {
-		return fmt.Errorf("failed to hash password: %w", err)
+// IsPasswordExpired reports whether the password is older than maxAge, a zero maxAge never expires it.
+func (u *User) IsPasswordExpired(now time.Time, maxAge time.Duration) bool {
+	if maxAge == 0 || u.PasswordChangedAt == nil {
+		return false
 	}
-
-	u.Password = string(hashed)
-	return nil
+	return now.Sub(*u.PasswordChangedAt) > maxAge
 }
 
 func (u *User) Touch() {
 	u.UpdatedAt = time.Now()
 }
 
-func (u *User) ValidatePassword(password string) bool {
-	err := bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(password))
-	return err == nil
-}
-
 type RegisterRequest struct {
 	FirstName string `json:"first_name"`
 	LastName  string `json:"last_name"`
@@ -58,10 +79,31 @@ type RegisterRequest struct {
 	Password  string `json:"password"`
 }
 
+// ReauthProof confirms a sensitive change with the current password or a fresh otp code, either is enough.
+type ReauthProof struct {
+	CurrentPassword string
+	OtpCode         string
+}
+
+type TwoFAMethod string
+
+const (
+	TwoFAMethodOTP      TwoFAMethod = "otp"
+	TwoFAMethodWebAuthn TwoFAMethod = "webauthn"
+)
+
 type AuthToken struct {
-	AuthToken     string    `json:"auth_token"`
-	ExpireAt      time.Time `json:"expire_at"`
-	TwoFARequired bool      `json:"two_fa_required"`
+	AuthToken       string        `json:"auth_token"`
+	ExpireAt        time.Time     `json:"expire_at"`
+	TwoFARequired   bool          `json:"two_fa_required"`
+	TwoFAMethods    []TwoFAMethod `json:"two_fa_methods"`
+	RefreshToken    string        `json:"refresh_token"`
+	RefreshExpireAt time.Time     `json:"refresh_expire_at"`
+	// DeviceToken is set when the user asked to remember the device, it skips the second factor next time.
+	DeviceToken    string    `json:"device_token"`
+	DeviceExpireAt time.Time `json:"device_expire_at"`
+
+	PasswordChangeRequired bool `json:"password_change_required"`
 }
 
 type OtpToken struct {
@@ -71,3 +113,12 @@ type OtpToken struct {
 type OtpRecoveryCode struct {
 	Codes []string
 }
+
+// UserFilter narrows down the user listing of the admin api, zero values match everything.
+// Query is matched against the email and the names.
+type UserFilter struct {
+	Query  string
+	Status UserStatus
+	Limit  uint64
+	Offset uint64
+}
@@ -0,0 +1,40 @@
+package model
+
+import "time"
+
+type WebAuthnCeremony string
+
+const (
+	WebAuthnCeremonyRegistration WebAuthnCeremony = "registration"
+	WebAuthnCeremonyTwoFA        WebAuthnCeremony = "2fa"
+	WebAuthnCeremonyPasswordless WebAuthnCeremony = "passwordless"
+)
+
+// WebAuthnCredential is a passkey registered by a user.
+type WebAuthnCredential struct {
+	ID              uint64     `db:"id"`
+	UserID          uint64     `db:"user_id"`
+	CredentialID    []byte     `db:"credential_id"`
+	PublicKey       []byte     `db:"public_key"`
+	AttestationType string     `db:"attestation_type"`
+	Transports      []string   `db:"transports"`
+	AAGUID          []byte     `db:"aaguid"`
+	SignCount       uint32     `db:"sign_count"`
+	BackupEligible  bool       `db:"backup_eligible"`
+	BackupState     bool       `db:"backup_state"`
+	Name            string     `db:"name"`
+	CreatedAt       time.Time  `db:"created_at"`
+	LastUsedAt      *time.Time `db:"last_used_at"`
+}
+
+// WebAuthnSession keeps the state of a ceremony between its begin and finish requests.
+// UserID is zero for passwordless logins, where the user is only known once the authenticator answers.
+type WebAuthnSession struct {
+	ID        uint64           `db:"id"`
+	Challenge string           `db:"challenge"`
+	Ceremony  WebAuthnCeremony `db:"ceremony"`
+	UserID    uint64           `db:"user_id"`
+	Data      []byte           `db:"data"`
+	ExpiresAt time.Time        `db:"expires_at"`
+	CreatedAt time.Time        `db:"created_at"`
+}
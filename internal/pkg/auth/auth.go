@@ -3,6 +3,10 @@ package auth
 import (
 	"context"
 	"time"
+
+	"github.com/theruziev/oson_auth/internal/pkg/fieldcrypt"
+	"github.com/theruziev/oson_auth/internal/pkg/lockout"
+	"github.com/theruziev/oson_auth/internal/pkg/passwordpolicy"
 )
 
 type contextKey string
@@ -10,9 +14,26 @@ type contextKey string
 const claimKey = contextKey("claim")
 
 type AuthOption struct {
-	JWTSecret string        `help:"listen string" env:"SECRET"`
-	JWTTtl    time.Duration `help:"ttl" env:"TTL"`
-	Otp       OtpConfig     `embed:"" prefix:"otp." envprefix:"OTP_" validate:"required,dive,required"`
+	JWTSecret            string                `help:"listen string" env:"SECRET"`
+	JWTTtl               time.Duration         `help:"ttl" env:"TTL"`
+	RefreshTTL           time.Duration         `help:"refresh token ttl" env:"REFRESH_TTL" default:"720h"`
+	MagicLinkTTL         time.Duration         `help:"how long a magic login link is valid" env:"MAGIC_LINK_TTL" default:"15m"`
+	EmailChangeTTL       time.Duration         `help:"how long the link confirming a new email is valid" env:"EMAIL_CHANGE_TTL" default:"24h"`
+	OrgInviteTTL         time.Duration         `help:"how long an invite to an organization is valid" env:"ORG_INVITE_TTL" default:"168h"`
+	TrustedDeviceTTL     time.Duration         `help:"how long a remembered device skips the second factor, 0 turns remembering off" env:"TRUSTED_DEVICE_TTL" default:"720h"`
+	DeletionGracePeriod  time.Duration         `help:"how long a deleted account is kept before it is purged" env:"DELETION_GRACE_PERIOD" default:"720h"`
+	ReauthMaxAge         time.Duration         `help:"how long after signing in sensitive changes need no re-authentication" env:"REAUTH_MAX_AGE" default:"5m"`
+	RevocationCacheTTL   time.Duration         `help:"how long token revocation state is cached" env:"REVOCATION_CACHE_TTL" default:"30s"`
+	SigningAlg           string                `help:"jwt signing algorithm: HS256, RS256 or EdDSA" env:"SIGNING_ALG" default:"HS256" enum:"HS256,RS256,EdDSA"`
+	SigningKeyFile       string                `help:"PEM private key used to sign tokens with RS256 or EdDSA" env:"SIGNING_KEY_FILE"`
+	VerificationKeyFiles []string              `help:"PEM public keys of retired signing keys that are still accepted" env:"VERIFICATION_KEY_FILES"`
+	Otp                  OtpConfig             `embed:"" prefix:"otp." envprefix:"OTP_" validate:"required,dive,required"`
+	OIDC                 OIDCOption            `embed:"" prefix:"oidc." envprefix:"OIDC_"`
+	WebAuthn             WebAuthnOption        `embed:"" prefix:"webauthn." envprefix:"WEBAUTHN_"`
+	Lockout              lockout.Option        `embed:"" prefix:"lockout." envprefix:"LOCKOUT_"`
+	Password             PasswordOption        `embed:"" prefix:"password." envprefix:"PASSWORD_"`
+	PasswordPolicy       passwordpolicy.Option `embed:"" prefix:"password-policy." envprefix:"PASSWORD_POLICY_"`
+	Encryption           fieldcrypt.Option     `embed:"" prefix:"encryption." envprefix:"ENCRYPTION_"`
 }
 
 func WithClaim(ctx context.Context, claim *Claim) context.Context {
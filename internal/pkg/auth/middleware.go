@@ -1,24 +1,48 @@
 package auth
 
 import (
+	"context"
+	"fmt"
 	"net/http"
 	"strings"
+	"time"
 
-	"github.com/golang-jwt/jwt/v4"
 	"github.com/theruziev/oson_auth/internal/pkg/httpx"
 )
 
-func Middleware(jwtSecret string) func(next http.Handler) http.Handler {
+// RevocationChecker reports whether a token with a valid signature has been revoked before its expiry.
+type RevocationChecker interface {
+	IsRevoked(ctx context.Context, claim *Claim) (bool, error)
+}
+
+// APIKeyVerifier resolves an API key to a claim of the user who owns it.
+type APIKeyVerifier interface {
+	VerifyAPIKey(ctx context.Context, key string) (*Claim, error)
+}
+
+const (
+	schemeBearer = "Bearer"
+	schemeAPIKey = "ApiKey"
+)
+
+func Middleware(signer *Signer, revocationChecker RevocationChecker, apiKeyVerifier APIKeyVerifier) func(next http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			tokenString := getToken(r)
+			scheme, tokenString := getToken(r)
 			if tokenString == "" {
 				httpx.JSONError(w, http.StatusForbidden, "token is empty")
 				return
 			}
-			token, err := jwt.ParseWithClaims(tokenString, &Claim{}, func(token *jwt.Token) (interface{}, error) {
-				return []byte(jwtSecret), nil
-			})
+			if scheme == schemeAPIKey {
+				claim, err := apiKeyVerifier.VerifyAPIKey(r.Context(), tokenString)
+				if err != nil {
+					httpx.JSONError(w, http.StatusForbidden, "invalid api key")
+					return
+				}
+				next.ServeHTTP(w, r.Clone(WithClaim(r.Context(), claim)))
+				return
+			}
+			token, err := signer.Parse(tokenString, &Claim{})
 			if err != nil {
 				httpx.JSONError(w, http.StatusForbidden, "failed to decrypt jwt token")
 				return
@@ -28,6 +52,15 @@ func Middleware(jwtSecret string) func(next http.Handler) http.Handler {
 				httpx.JSONError(w, http.StatusForbidden, "failed to get claim from token")
 				return
 			}
+			isRevoked, err := revocationChecker.IsRevoked(r.Context(), claim)
+			if err != nil {
+				httpx.JSONError(w, http.StatusInternalServerError, "failed to check token")
+				return
+			}
+			if isRevoked {
+				httpx.JSONError(w, http.StatusForbidden, "token is revoked")
+				return
+			}
 
 			ctx := WithClaim(r.Context(), claim)
 			r = r.Clone(ctx)
@@ -61,7 +94,72 @@ func CheckScope(scopes ...Scope) func(next http.Handler) http.Handler {
 	}
 }
 
-func getToken(r *http.Request) string {
+// RequirePermission lets through claims holding all the permissions.
+func RequirePermission(permissions ...Permission) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claim := FromContext(r.Context())
+			if claim == nil {
+				panic("incorrect usage of middleware")
+			}
+			for _, perm := range permissions {
+				if !claim.HasPermission(perm) {
+					httpx.JSONError(w, http.StatusForbidden, "permission denied")
+					return
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireOrg lets through tokens acting within an organization, handlers behind it work on claim.OrgID.
+// The role is only a hint here, services check the membership before changing the organization.
+func RequireOrg() func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claim := FromContext(r.Context())
+			if claim == nil {
+				panic("incorrect usage of middleware")
+			}
+			if claim.OrgID == "" {
+				httpx.JSONError(w, http.StatusForbidden, "no active organization")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireRecentAuth lets through tokens of a user who signed in no longer than maxAge ago.
+// Other requests are answered as in RFC 9470, the client has to sign the user in again.
+func RequireRecentAuth(maxAge time.Duration) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claim := FromContext(r.Context())
+			if claim == nil {
+				panic("incorrect usage of middleware")
+			}
+			if !claim.AuthenticatedWithin(time.Now(), maxAge) {
+				w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer error="insufficient_user_authentication", max_age=%d`, int(maxAge.Seconds())))
+				httpx.JSONError(w, http.StatusUnauthorized, "recent authentication required")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// getToken splits the Authorization header into the scheme and the credentials.
+// A header without a scheme is treated as a bearer token.
+func getToken(r *http.Request) (scheme, token string) {
 	authHeader := r.Header.Get("Authorization")
-	return strings.Replace(authHeader, "Bearer ", "", -1)
+	scheme, token, found := strings.Cut(authHeader, " ")
+	if !found {
+		return schemeBearer, authHeader
+	}
+	if strings.EqualFold(scheme, schemeAPIKey) {
+		return schemeAPIKey, token
+	}
+	return schemeBearer, token
 }
@@ -0,0 +1,49 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequirePermission(t *testing.T) {
+	handler := RequirePermission(UsersManagePermission, AuditReadPermission)(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		}),
+	)
+	serve := func(permissions ...Permission) int {
+		claim := testClaim()
+		claim.Scopes = []Scope{UserScope}
+		claim.Permissions = permissions
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r = r.WithContext(WithClaim(r.Context(), claim))
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	require.Equal(t, http.StatusNoContent, serve(AuditReadPermission, UsersManagePermission, RolesManagePermission))
+	require.Equal(t, http.StatusForbidden, serve(UsersManagePermission))
+	require.Equal(t, http.StatusForbidden, serve())
+}
+
+func TestRequireOrg(t *testing.T) {
+	handler := RequireOrg()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	serve := func(orgID string) int {
+		claim := testClaim()
+		claim.OrgID = orgID
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r = r.WithContext(WithClaim(r.Context(), claim))
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	require.Equal(t, http.StatusNoContent, serve("org"))
+	require.Equal(t, http.StatusForbidden, serve(""))
+}
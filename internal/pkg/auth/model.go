@@ -1,19 +1,95 @@
 package auth
 
-import "github.com/golang-jwt/jwt/v4"
+import (
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
 
 type Scope string
 
 const (
 	TwoFACheckScope Scope = "2fa-check"
 	UserScope       Scope = "user"
+	// PasswordChangeScope is all a user with an expired password gets, it only allows to change the password.
+	PasswordChangeScope Scope = "password-change"
+	// UserInfoScope is given to OIDC clients acting for the user, it only reads the user info.
+	UserInfoScope Scope = "userinfo"
+)
+
+// Scopes granted to machine clients through the client credentials grant.
+const (
+	UsersReadScope    Scope = "users:read"
+	ContentReadScope  Scope = "content:read"
+	ContentWriteScope Scope = "content:write"
+	AuditReadScope    Scope = "audit:read"
+)
+
+var ServiceScopes = []Scope{
+	UsersReadScope,
+	ContentReadScope,
+	ContentWriteScope,
+	AuditReadScope,
+}
+
+func IsServiceScope(s Scope) bool {
+	for _, scp := range ServiceScopes {
+		if s == scp {
+			return true
+		}
+	}
+	return false
+}
+
+// ProfileReadScope lets scripts holding an API key see whose key it is, the account itself is only
+// managed with the tokens of the user.
+const ProfileReadScope Scope = "profile:read"
+
+// APIKeyScopes can be granted to API keys. UserScope is not one of them, a leaked key must not
+// give away the account.
+var APIKeyScopes = []Scope{
+	ProfileReadScope,
+	ContentReadScope,
+	ContentWriteScope,
+}
+
+func IsAPIKeyScope(s Scope) bool {
+	for _, scp := range APIKeyScopes {
+		if s == scp {
+			return true
+		}
+	}
+	return false
+}
+
+// Permission is granted to users through their roles, routes that are not for every user
+// require a permission on top of UserScope.
+type Permission string
+
+const (
+	UsersManagePermission     Permission = "users:manage"
+	RolesManagePermission     Permission = "roles:manage"
+	AuditReadPermission       Permission = "audit:read"
+	ContentModeratePermission Permission = "content:moderate"
 )
 
 type Claim struct {
 	jwt.RegisteredClaims
-	PublicID string  `json:"pid,omitempty"`
-	Email    string  `json:"email,omitempty"`
-	Scopes   []Scope `json:"scp,omitempty"`
+	PublicID  string  `json:"pid,omitempty"`
+	Email     string  `json:"email,omitempty"`
+	SessionID string  `json:"sid,omitempty"`
+	ClientID  string  `json:"cid,omitempty"`
+	Scopes    []Scope `json:"scp,omitempty"`
+	// Permissions of the roles of the user when the token was issued.
+	Permissions []Permission `json:"perm,omitempty"`
+	// OrgID is the public id of the active organization of the session and OrgRole the role of the user in it.
+	OrgID   string `json:"org,omitempty"`
+	OrgRole string `json:"org_role,omitempty"`
+	// AuthTime is when the user signed in, tokens refreshed within the session keep it.
+	AuthTime *jwt.NumericDate `json:"auth_time,omitempty"`
+
+	// APIKeyID is set when the request is authenticated with an API key instead of a token.
+	APIKeyID string `json:"-"`
 }
 
 func (c *Claim) CheckScope(s Scope) bool {
@@ -26,7 +102,26 @@ func (c *Claim) CheckScope(s Scope) bool {
 	return false
 }
 
+func (c *Claim) HasPermission(p Permission) bool {
+	for _, perm := range c.Permissions {
+		if p == perm {
+			return true
+		}
+	}
+
+	return false
+}
+
 type OtpGenerated struct {
 	URL    string
 	Secret string
+	Params OtpParams
+}
+
+// AuthenticatedWithin reports whether the user signed in no longer than maxAge ago.
+func (c *Claim) AuthenticatedWithin(now time.Time, maxAge time.Duration) bool {
+	if c.AuthTime == nil {
+		return false
+	}
+	return now.Sub(c.AuthTime.Time) <= maxAge
 }
@@ -0,0 +1,37 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const ScopeOpenID = "openid"
+
+type OIDCOption struct {
+	Issuer         string        `help:"issuer identifier, the public base url of the service" env:"ISSUER"`
+	LoginURL       string        `help:"login and consent page the authorize endpoint redirects to" env:"LOGIN_URL"`
+	CodeTTL        time.Duration `help:"authorization code ttl" env:"CODE_TTL" default:"1m"`
+	IDTokenTTL     time.Duration `help:"id token ttl" env:"ID_TOKEN_TTL" default:"1h"`
+	ClientTokenTTL time.Duration `help:"ttl of tokens issued with the client credentials grant" env:"CLIENT_TOKEN_TTL" default:"1h"`
+}
+
+type IDTokenClaim struct {
+	jwt.RegisteredClaims
+	Nonce         string           `json:"nonce,omitempty"`
+	AuthTime      *jwt.NumericDate `json:"auth_time,omitempty"`
+	Email         string           `json:"email,omitempty"`
+	EmailVerified bool             `json:"email_verified"`
+	GivenName     string           `json:"given_name,omitempty"`
+	FamilyName    string           `json:"family_name,omitempty"`
+}
+
+// VerifyCodeChallenge checks a PKCE code verifier against an S256 code challenge.
+func VerifyCodeChallenge(verifier, challenge string) bool {
+	sum := sha256.Sum256([]byte(verifier))
+	computed := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(computed), []byte(challenge)) == 1
+}
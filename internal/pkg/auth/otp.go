@@ -2,46 +2,101 @@ package auth
 
 import (
 	"context"
-	"crypto/rand"
+	"crypto/subtle"
 	"fmt"
-	"math/big"
 	"time"
 
 	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/hotp"
 	"github.com/pquerna/otp/totp"
 )
 
-const (
-	max = 999_999
-	min = 100_000
-)
-
 type OtpConfig struct {
-	Enabled           bool   `help:"listen string" env:"ENABLED" default:"false"`
-	Issuer            string `help:"listen string" env:"ISSUER"`
-	RecoveryCodeCount int    `help:"listen string" env:"RECOVERY_CODE_COUNT"`
+	Enabled           bool          `help:"listen string" env:"ENABLED" default:"false"`
+	Issuer            string        `help:"listen string" env:"ISSUER"`
+	RecoveryCodeCount int           `help:"listen string" env:"RECOVERY_CODE_COUNT"`
+	Algorithm         string        `help:"hash of new enrolments, most authenticator apps only support SHA1" env:"ALGORITHM" default:"SHA1" enum:"SHA1,SHA256,SHA512"`
+	Digits            int           `help:"code length of new enrolments" env:"DIGITS" default:"6" enum:"6,8"`
+	Period            time.Duration `help:"how long a code of new enrolments is valid, in whole seconds" env:"PERIOD" default:"30s"`
+	Skew              uint          `help:"time steps before and after the current one that are accepted for clock drift" env:"SKEW" default:"1"`
+}
+
+// OtpParams are what the authenticator app of the user was set up with. They are kept per user, so
+// changing the config only affects new enrolments.
+type OtpParams struct {
+	Algorithm string
+	Digits    int
+	// Period is in seconds.
+	Period uint
 }
 
 type Otp struct {
-	opt       *OtpConfig
-	otpAlgo   otp.Algorithm
-	otpDigits otp.Digits
+	opt    *OtpConfig
+	params OtpParams
 }
 
 func NewOtpConfig(opt *OtpConfig) *Otp {
+	params := OtpParams{
+		Algorithm: opt.Algorithm,
+		Digits:    opt.Digits,
+		Period:    uint(opt.Period / time.Second),
+	}
 	return &Otp{
-		opt:       opt,
-		otpAlgo:   otp.AlgorithmSHA512,
-		otpDigits: otp.DigitsSix,
+		opt:    opt,
+		params: withDefaultParams(params),
+	}
+}
+
+// withDefaultParams fills in what is missing with the parameters of the authenticator apps.
+func withDefaultParams(params OtpParams) OtpParams {
+	if params.Algorithm == "" {
+		params.Algorithm = otp.AlgorithmSHA1.String()
+	}
+	if params.Digits == 0 {
+		params.Digits = otp.DigitsSix.Length()
+	}
+	if params.Period == 0 {
+		params.Period = 30
 	}
+	return params
 }
 
+func parseAlgorithm(name string) (otp.Algorithm, error) {
+	for _, algorithm := range []otp.Algorithm{otp.AlgorithmSHA1, otp.AlgorithmSHA256, otp.AlgorithmSHA512} {
+		if algorithm.String() == name {
+			return algorithm, nil
+		}
+	}
+	return 0, fmt.Errorf("unsupported otp algorithm %s", name)
+}
+
+func parseDigits(digits int) (otp.Digits, error) {
+	switch digits {
+	case 6:
+		return otp.DigitsSix, nil
+	case 8:
+		return otp.DigitsEight, nil
+	default:
+		return 0, fmt.Errorf("unsupported otp digits %d", digits)
+	}
+}
+
+// Generate makes a new secret with the configured parameters, they have to be stored with it.
 func (o *Otp) Generate(_ context.Context, uid string) (*OtpGenerated, error) {
+	algorithm, err := parseAlgorithm(o.params.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+	digits, err := parseDigits(o.params.Digits)
+	if err != nil {
+		return nil, err
+	}
 	key, err := totp.Generate(totp.GenerateOpts{
 		Issuer:      o.opt.Issuer,
 		AccountName: uid,
-		Algorithm:   o.otpAlgo,
-		Digits:      o.otpDigits,
+		Period:      o.params.Period,
+		Algorithm:   algorithm,
+		Digits:      digits,
 	})
 	if err != nil {
 		return nil, err
@@ -50,51 +105,66 @@ func (o *Otp) Generate(_ context.Context, uid string) (*OtpGenerated, error) {
 	return &OtpGenerated{
 		URL:    key.URL(),
 		Secret: key.Secret(),
+		Params: o.params,
 	}, nil
 }
 
-func (o *Otp) ValidateCode(_ context.Context, secret, code string) (bool, error) {
-	nowInUTC := time.Now().UTC()
-	isCorrect, err := totp.ValidateCustom(code, secret, nowInUTC, totp.ValidateOpts{
-		Algorithm: o.otpAlgo,
-		Digits:    o.otpDigits,
-	})
-	if err != nil {
-		return false, err
-	}
-
-	return isCorrect, nil
+// ValidateCode checks the code against the time steps within the skew around now. It returns the
+// step the code belongs to, the caller refuses a code of a step that was already used.
+func (o *Otp) ValidateCode(_ context.Context, params OtpParams, secret, code string) (uint64, bool, error) {
+	return o.validateCodeAt(withDefaultParams(params), secret, code, time.Now())
 }
 
-func getRandom() (int64, error) {
-	bigInt := big.NewInt(max - min)
-	v, err := rand.Int(rand.Reader, bigInt)
+func (o *Otp) validateCodeAt(params OtpParams, secret, code string, now time.Time) (uint64, bool, error) {
+	algorithm, err := parseAlgorithm(params.Algorithm)
+	if err != nil {
+		return 0, false, err
+	}
+	digits, err := parseDigits(params.Digits)
 	if err != nil {
-		return 0, err
+		return 0, false, err
+	}
+	// recovery codes are typed into the same field, a code of another length is just not an otp code
+	if len(code) != digits.Length() {
+		return 0, false, nil
 	}
 
-	return v.Int64() + max, nil
+	current := uint64(now.Unix()) / uint64(params.Period)
+	var step uint64
+	matched := false
+	// every step is checked, so the timing doesn't tell which one matched
+	for i := current - uint64(o.opt.Skew); i <= current+uint64(o.opt.Skew); i++ {
+		expected, err := hotp.GenerateCodeCustom(secret, i, hotp.ValidateOpts{
+			Digits:    digits,
+			Algorithm: algorithm,
+		})
+		if err != nil {
+			return 0, false, err
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			step = i
+			matched = true
+		}
+	}
+
+	return step, matched, nil
 }
 
+// GenerateRecoveryCodes makes the codes that sign the user in when the authenticator is lost.
+// Only their hashes are stored, see HashRecoveryCode.
 func (o *Otp) GenerateRecoveryCodes(_ context.Context) ([]string, error) {
-	codes := make([]string, 0)
+	codes := make([]string, 0, o.opt.RecoveryCodeCount)
 	uniqCodes := make(map[string]struct{})
-	cnt := o.opt.RecoveryCodeCount
-	for cnt > 0 {
-		randomNum, err := getRandom()
+	for len(codes) < o.opt.RecoveryCodeCount {
+		code, err := newRecoveryCode()
 		if err != nil {
 			return nil, err
 		}
-		randInt := fmt.Sprintf("%d", randomNum)
-		if _, ok := uniqCodes[randInt]; ok {
+		if _, ok := uniqCodes[code]; ok {
 			continue
 		}
-		uniqCodes[randInt] = struct{}{}
-		cnt -= 1
-	}
-
-	for k := range uniqCodes {
-		codes = append(codes, k)
+		uniqCodes[code] = struct{}{}
+		codes = append(codes, code)
 	}
 	return codes, nil
 }
@@ -0,0 +1,68 @@
+package auth
+
+import (
+	"context"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOtpGenerate(t *testing.T) {
+	o := NewOtpConfig(&OtpConfig{Issuer: "oson"})
+	generated, err := o.Generate(context.Background(), "user")
+	require.NoError(t, err)
+	// the defaults are the ones every authenticator app supports
+	require.Equal(t, OtpParams{Algorithm: "SHA1", Digits: 6, Period: 30}, generated.Params)
+
+	u, err := url.Parse(generated.URL)
+	require.NoError(t, err)
+	require.Equal(t, "SHA1", u.Query().Get("algorithm"))
+	require.Equal(t, "6", u.Query().Get("digits"))
+	require.Equal(t, "30", u.Query().Get("period"))
+}
+
+func TestOtpValidateCode(t *testing.T) {
+	const secret = "JBSWY3DPEHPK3PXP"
+	o := NewOtpConfig(&OtpConfig{Skew: 1})
+	// an enrolment made before the parameters became configurable
+	params := OtpParams{Algorithm: "SHA512", Digits: 6, Period: 30}
+	now := time.Unix(1700000000, 0)
+	code := func(at time.Time) string {
+		c, err := totp.GenerateCodeCustom(secret, at, totp.ValidateOpts{
+			Period:    30,
+			Digits:    otp.DigitsSix,
+			Algorithm: otp.AlgorithmSHA512,
+		})
+		require.NoError(t, err)
+		return c
+	}
+
+	step, ok, err := o.validateCodeAt(params, secret, code(now), now)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, uint64(now.Unix()/30), step)
+
+	// the previous step is within the skew and reports its own step
+	step, ok, err = o.validateCodeAt(params, secret, code(now.Add(-30*time.Second)), now)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, uint64(now.Unix()/30-1), step)
+
+	_, ok, err = o.validateCodeAt(params, secret, code(now.Add(-90*time.Second)), now)
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	// the code of another algorithm doesn't match
+	_, ok, err = o.validateCodeAt(OtpParams{Algorithm: "SHA1", Digits: 6, Period: 30}, secret, code(now), now)
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	// recovery codes go through the same field
+	_, ok, err = o.validateCodeAt(params, secret, "abcde-fghjk", now)
+	require.NoError(t, err)
+	require.False(t, ok)
+}
@@ -0,0 +1,182 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	PasswordAlgArgon2id = "argon2id"
+	PasswordAlgBcrypt   = "bcrypt"
+
+	argon2SaltLength = 16
+	argon2KeyLength  = 32
+)
+
+type PasswordOption struct {
+	Algorithm         string `help:"algorithm new password hashes are made with: argon2id or bcrypt" env:"ALGORITHM" default:"argon2id" enum:"argon2id,bcrypt"`
+	Argon2Memory      uint32 `help:"argon2id memory in KiB" env:"ARGON2_MEMORY" default:"19456"`
+	Argon2Iterations  uint32 `help:"argon2id number of passes over the memory" env:"ARGON2_ITERATIONS" default:"2"`
+	Argon2Parallelism uint8  `help:"argon2id number of threads" env:"ARGON2_PARALLELISM" default:"1"`
+	BcryptCost        int    `help:"bcrypt cost" env:"BCRYPT_COST" default:"12"`
+}
+
+// PasswordHasher hashes passwords into PHC strings and verifies them.
+// needsRehash reports a hash made with another algorithm or weaker parameters than the configured ones,
+// it should be replaced while the plain password is at hand.
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	Verify(password, encoded string) (ok, needsRehash bool, err error)
+}
+
+// NewPasswordHasher hashes with the configured algorithm and verifies hashes of every supported one,
+// so the algorithm and its parameters can be changed without resetting passwords.
+func NewPasswordHasher(opt *PasswordOption) (PasswordHasher, error) {
+	argon2idHasher := &Argon2idHasher{
+		Memory:      opt.Argon2Memory,
+		Iterations:  opt.Argon2Iterations,
+		Parallelism: opt.Argon2Parallelism,
+	}
+	bcryptHasher := &BcryptHasher{Cost: opt.BcryptCost}
+
+	h := &passwordHasher{
+		argon2id: argon2idHasher,
+		bcrypt:   bcryptHasher,
+	}
+	switch opt.Algorithm {
+	case PasswordAlgArgon2id, "":
+		if argon2idHasher.Memory == 0 || argon2idHasher.Iterations == 0 || argon2idHasher.Parallelism == 0 {
+			return nil, fmt.Errorf("argon2id parameters must be positive")
+		}
+		h.current = argon2idHasher
+	case PasswordAlgBcrypt:
+		if bcryptHasher.Cost < bcrypt.MinCost || bcryptHasher.Cost > bcrypt.MaxCost {
+			return nil, fmt.Errorf("bcrypt cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+		}
+		h.current = bcryptHasher
+	default:
+		return nil, fmt.Errorf("unsupported password algorithm: %s", opt.Algorithm)
+	}
+	return h, nil
+}
+
+type passwordHasher struct {
+	current  PasswordHasher
+	argon2id *Argon2idHasher
+	bcrypt   *BcryptHasher
+}
+
+func (h *passwordHasher) Hash(password string) (string, error) {
+	return h.current.Hash(password)
+}
+
+func (h *passwordHasher) Verify(password, encoded string) (bool, bool, error) {
+	var hasher PasswordHasher
+	switch {
+	case strings.HasPrefix(encoded, "$argon2id$"):
+		hasher = h.argon2id
+	case isBcryptHash(encoded):
+		hasher = h.bcrypt
+	default:
+		return false, false, fmt.Errorf("unknown password hash format")
+	}
+
+	ok, needsRehash, err := hasher.Verify(password, encoded)
+	if err != nil || !ok {
+		return false, false, err
+	}
+	return true, needsRehash || hasher != h.current, nil
+}
+
+// Argon2idHasher encodes hashes as $argon2id$v=19$m=<memory>,t=<iterations>,p=<parallelism>$<salt>$<hash>.
+type Argon2idHasher struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+}
+
+func (h *Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, argon2SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("failed to hash password: %w", err)
+	}
+	key := argon2.IDKey([]byte(password), salt, h.Iterations, h.Memory, h.Parallelism, argon2KeyLength)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, h.Memory, h.Iterations, h.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+func (h *Argon2idHasher) Verify(password, encoded string) (bool, bool, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != PasswordAlgArgon2id {
+		return false, false, fmt.Errorf("invalid argon2id hash")
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return false, false, fmt.Errorf("unsupported argon2id version")
+	}
+	var (
+		memory, iterations uint32
+		parallelism        uint8
+	)
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &iterations, &parallelism); err != nil {
+		return false, false, fmt.Errorf("invalid argon2id parameters: %w", err)
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false, false, fmt.Errorf("invalid argon2id salt: %w", err)
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return false, false, fmt.Errorf("invalid argon2id hash: %w", err)
+	}
+
+	other := argon2.IDKey([]byte(password), salt, iterations, memory, parallelism, uint32(len(key)))
+	if subtle.ConstantTimeCompare(key, other) != 1 {
+		return false, false, nil
+	}
+	needsRehash := memory != h.Memory || iterations != h.Iterations || parallelism != h.Parallelism ||
+		len(salt) != argon2SaltLength || len(key) != argon2KeyLength
+	return true, needsRehash, nil
+}
+
+// BcryptHasher keeps the modular crypt format of bcrypt, $2a$<cost>$<salt and hash>, which predates PHC.
+type BcryptHasher struct {
+	Cost int
+}
+
+func (h *BcryptHasher) Hash(password string) (string, error) {
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), h.Cost)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash password: %w", err)
+	}
+	return string(hashed), nil
+}
+
+func (h *BcryptHasher) Verify(password, encoded string) (bool, bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+	if err == bcrypt.ErrMismatchedHashAndPassword {
+		return false, false, nil
+	}
+	if err != nil {
+		return false, false, err
+	}
+	cost, err := bcrypt.Cost([]byte(encoded))
+	if err != nil {
+		return false, false, err
+	}
+	return true, cost < h.Cost, nil
+}
+
+func isBcryptHash(encoded string) bool {
+	return strings.HasPrefix(encoded, "$2a$") || strings.HasPrefix(encoded, "$2b$") || strings.HasPrefix(encoded, "$2y$")
+}
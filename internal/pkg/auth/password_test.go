@@ -0,0 +1,78 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func newTestPasswordHasher(t *testing.T, opt PasswordOption) PasswordHasher {
+	h, err := NewPasswordHasher(&opt)
+	require.NoError(t, err)
+	return h
+}
+
+func TestPasswordHasherArgon2id(t *testing.T) {
+	h := newTestPasswordHasher(t, PasswordOption{
+		Algorithm:         PasswordAlgArgon2id,
+		Argon2Memory:      1024,
+		Argon2Iterations:  1,
+		Argon2Parallelism: 1,
+		BcryptCost:        bcrypt.MinCost,
+	})
+
+	encoded, err := h.Hash("secret")
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(encoded, "$argon2id$v=19$m=1024,t=1,p=1$"))
+
+	ok, needsRehash, err := h.Verify("secret", encoded)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.False(t, needsRehash)
+
+	ok, _, err = h.Verify("other", encoded)
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	_, _, err = h.Verify("secret", "$argon2id$v=19$m=1024$broken")
+	require.Error(t, err)
+	_, _, err = h.Verify("secret", "plain")
+	require.Error(t, err)
+}
+
+func TestPasswordHasherRehash(t *testing.T) {
+	bcryptHash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	require.NoError(t, err)
+
+	weak := newTestPasswordHasher(t, PasswordOption{
+		Algorithm:         PasswordAlgArgon2id,
+		Argon2Memory:      1024,
+		Argon2Iterations:  1,
+		Argon2Parallelism: 1,
+	})
+	weakHash, err := weak.Hash("secret")
+	require.NoError(t, err)
+
+	h := newTestPasswordHasher(t, PasswordOption{
+		Algorithm:         PasswordAlgArgon2id,
+		Argon2Memory:      2048,
+		Argon2Iterations:  1,
+		Argon2Parallelism: 1,
+		BcryptCost:        bcrypt.MinCost,
+	})
+
+	// hashes of another algorithm and of weaker parameters are still accepted, but have to be upgraded
+	for _, encoded := range []string{string(bcryptHash), weakHash} {
+		ok, needsRehash, err := h.Verify("secret", encoded)
+		require.NoError(t, err)
+		require.True(t, ok)
+		require.True(t, needsRehash)
+	}
+
+	ok, needsRehash, err := h.Verify("other", string(bcryptHash))
+	require.NoError(t, err)
+	require.False(t, ok)
+	require.False(t, needsRehash)
+}
@@ -0,0 +1,54 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+const (
+	// recoveryCodeAlphabet leaves out the characters that are easy to confuse when written down.
+	recoveryCodeAlphabet = "23456789abcdefghjkmnpqrstuvwxyz"
+	// recoveryCodeLength gives about 50 bits, enough for a fast hash since the codes are random.
+	recoveryCodeLength = 10
+)
+
+var recoveryCodeNormalizer = strings.NewReplacer("-", "", " ", "")
+
+// newRecoveryCode returns a random code split in two halves for readability, like 7k3mq-x9f2d.
+func newRecoveryCode() (string, error) {
+	var b strings.Builder
+	alphabetSize := big.NewInt(int64(len(recoveryCodeAlphabet)))
+	for i := 0; i < recoveryCodeLength; i++ {
+		if i == recoveryCodeLength/2 {
+			b.WriteByte('-')
+		}
+		n, err := rand.Int(rand.Reader, alphabetSize)
+		if err != nil {
+			return "", fmt.Errorf("failed to generate recovery code: %w", err)
+		}
+		b.WriteByte(recoveryCodeAlphabet[n.Int64()])
+	}
+	return b.String(), nil
+}
+
+// HashRecoveryCode hashes the code for storage. The code is normalized first, so it matches
+// however the user typed it, with or without the dash and in any case.
+func HashRecoveryCode(code string) string {
+	return HashOpaqueToken(strings.ToLower(recoveryCodeNormalizer.Replace(code)))
+}
+
+// MatchRecoveryCode returns the index of the hash the code matches, or -1. Every hash is compared
+// in constant time and the loop doesn't stop at a match, so the timing tells nothing about the codes.
+func MatchRecoveryCode(code string, hashes []string) int {
+	codeHash := []byte(HashRecoveryCode(code))
+	match := -1
+	for i, hash := range hashes {
+		if subtle.ConstantTimeCompare(codeHash, []byte(hash)) == 1 {
+			match = i
+		}
+	}
+	return match
+}
@@ -0,0 +1,36 @@
+package auth
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateRecoveryCodes(t *testing.T) {
+	o := NewOtpConfig(&OtpConfig{RecoveryCodeCount: 10})
+	codes, err := o.GenerateRecoveryCodes(context.Background())
+	require.NoError(t, err)
+	require.Len(t, codes, 10)
+
+	seen := make(map[string]struct{})
+	for _, code := range codes {
+		require.Len(t, code, recoveryCodeLength+1)
+		require.Equal(t, byte('-'), code[recoveryCodeLength/2])
+		seen[code] = struct{}{}
+	}
+	require.Len(t, seen, len(codes))
+}
+
+func TestMatchRecoveryCode(t *testing.T) {
+	hashes := []string{HashRecoveryCode("abcde-fghjk"), HashRecoveryCode("23456-789ab"), HashRecoveryCode("123456")}
+
+	require.Equal(t, 1, MatchRecoveryCode("23456-789ab", hashes))
+	// the user may leave out the dash or type in upper case
+	require.Equal(t, 0, MatchRecoveryCode(" ABCDEFGHJK", hashes))
+	// numeric codes issued before the codes were hashed still match
+	require.Equal(t, 2, MatchRecoveryCode("123456", hashes))
+	require.Equal(t, -1, MatchRecoveryCode("zzzzz-zzzzz", hashes))
+	require.Equal(t, -1, MatchRecoveryCode(strings.Repeat("a", 10), nil))
+}
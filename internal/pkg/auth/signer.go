@@ -0,0 +1,266 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+	AlgEdDSA = "EdDSA"
+)
+
+type verificationKey struct {
+	method jwt.SigningMethod
+	key    interface{}
+	jwk    *JWK
+}
+
+// Signer signs and verifies every JWT issued by the service.
+// Asymmetric keys are identified by the kid header, which is the RFC 7638 thumbprint of the public key,
+// so retired keys can stay in the verification set until tokens signed by them expire.
+type Signer struct {
+	method     jwt.SigningMethod
+	signingKey interface{}
+	kid        string
+
+	verificationKeys map[string]*verificationKey
+}
+
+func NewSigner(opt *AuthOption) (*Signer, error) {
+	s := &Signer{
+		verificationKeys: make(map[string]*verificationKey),
+	}
+
+	// tokens without kid are signed with the shared secret
+	if opt.JWTSecret != "" {
+		s.verificationKeys[""] = &verificationKey{
+			method: jwt.SigningMethodHS256,
+			key:    []byte(opt.JWTSecret),
+		}
+	}
+
+	switch opt.SigningAlg {
+	case "", AlgHS256:
+		if opt.JWTSecret == "" {
+			return nil, fmt.Errorf("jwt secret is required for %s", AlgHS256)
+		}
+		s.method = jwt.SigningMethodHS256
+		s.signingKey = []byte(opt.JWTSecret)
+	case AlgRS256, AlgEdDSA:
+		privateKey, err := readPrivateKey(opt.SigningKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		signer, ok := privateKey.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("unsupported private key type %T", privateKey)
+		}
+		vk, kid, err := newVerificationKey(signer.Public())
+		if err != nil {
+			return nil, err
+		}
+		if vk.method.Alg() != opt.SigningAlg {
+			return nil, fmt.Errorf("signing key does not match algorithm %s", opt.SigningAlg)
+		}
+		s.method = vk.method
+		s.signingKey = privateKey
+		s.kid = kid
+		s.verificationKeys[kid] = vk
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm %s", opt.SigningAlg)
+	}
+
+	for _, file := range opt.VerificationKeyFiles {
+		publicKey, err := readPublicKey(file)
+		if err != nil {
+			return nil, err
+		}
+		vk, kid, err := newVerificationKey(publicKey)
+		if err != nil {
+			return nil, err
+		}
+		s.verificationKeys[kid] = vk
+	}
+
+	return s, nil
+}
+
+func (s *Signer) Alg() string {
+	return s.method.Alg()
+}
+
+func (s *Signer) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(s.method, claims)
+	if s.kid != "" {
+		token.Header["kid"] = s.kid
+	}
+	tokenString, err := token.SignedString(s.signingKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign token: %w", err)
+	}
+	return tokenString, nil
+}
+
+func (s *Signer) Parse(tokenString string, claims jwt.Claims) (*jwt.Token, error) {
+	return jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		vk, ok := s.verificationKeys[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown key id %q", kid)
+		}
+		// never let the token choose the algorithm for a key
+		if token.Method.Alg() != vk.method.Alg() {
+			return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+		}
+		return vk.key, nil
+	})
+}
+
+// JWKS returns the public verification keys. The shared HS256 secret is never published.
+func (s *Signer) JWKS() *JWKSet {
+	set := &JWKSet{
+		Keys: make([]*JWK, 0, len(s.verificationKeys)),
+	}
+	for _, vk := range s.verificationKeys {
+		if vk.jwk != nil {
+			set.Keys = append(set.Keys, vk.jwk)
+		}
+	}
+	// the current signing key goes first
+	sort.Slice(set.Keys, func(i, j int) bool {
+		if set.Keys[i].Kid == s.kid || set.Keys[j].Kid == s.kid {
+			return set.Keys[i].Kid == s.kid
+		}
+		return set.Keys[i].Kid < set.Keys[j].Kid
+	})
+	return set
+}
+
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+type JWKSet struct {
+	Keys []*JWK `json:"keys"`
+}
+
+func newVerificationKey(publicKey crypto.PublicKey) (*verificationKey, string, error) {
+	var (
+		method     jwt.SigningMethod
+		jwk        *JWK
+		thumbprint []byte
+		err        error
+	)
+	switch key := publicKey.(type) {
+	case *rsa.PublicKey:
+		method = jwt.SigningMethodRS256
+		jwk = &JWK{
+			Kty: "RSA",
+			N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}
+		// members in lexicographic order, as required by RFC 7638
+		thumbprint, err = json.Marshal(struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{jwk.E, jwk.Kty, jwk.N})
+	case ed25519.PublicKey:
+		method = jwt.SigningMethodEdDSA
+		jwk = &JWK{
+			Kty: "OKP",
+			Crv: "Ed25519",
+			X:   base64.RawURLEncoding.EncodeToString(key),
+		}
+		thumbprint, err = json.Marshal(struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{jwk.Crv, jwk.Kty, jwk.X})
+	default:
+		return nil, "", fmt.Errorf("unsupported public key type %T", publicKey)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	sum := sha256.Sum256(thumbprint)
+	kid := base64.RawURLEncoding.EncodeToString(sum[:])
+	jwk.Kid = kid
+	jwk.Use = "sig"
+	jwk.Alg = method.Alg()
+
+	return &verificationKey{
+		method: method,
+		key:    publicKey,
+		jwk:    jwk,
+	}, kid, nil
+}
+
+func readPEM(file string) (*pem.Block, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key file: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data in %s", file)
+	}
+	return block, nil
+}
+
+func readPrivateKey(file string) (interface{}, error) {
+	block, err := readPEM(file)
+	if err != nil {
+		return nil, err
+	}
+	if block.Type == "RSA PRIVATE KEY" {
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	}
+	return x509.ParsePKCS8PrivateKey(block.Bytes)
+}
+
+// readPublicKey accepts a public key or a private key whose public part is used.
+func readPublicKey(file string) (crypto.PublicKey, error) {
+	block, err := readPEM(file)
+	if err != nil {
+		return nil, err
+	}
+	switch block.Type {
+	case "RSA PUBLIC KEY":
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	case "PUBLIC KEY":
+		return x509.ParsePKIXPublicKey(block.Bytes)
+	}
+
+	privateKey, err := readPrivateKey(file)
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := privateKey.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key type %T", privateKey)
+	}
+	return signer.Public(), nil
+}
@@ -0,0 +1,95 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/require"
+)
+
+func writePrivateKey(t *testing.T, key interface{}) string {
+	t.Helper()
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	file := filepath.Join(t.TempDir(), "key.pem")
+	err = os.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600)
+	require.NoError(t, err)
+	return file
+}
+
+func testClaim() *Claim {
+	return &Claim{
+		PublicID: "pid",
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+		},
+	}
+}
+
+func TestSignerRotation(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	rsaFile := writePrivateKey(t, rsaKey)
+	edFile := writePrivateKey(t, edKey)
+
+	oldSigner, err := NewSigner(&AuthOption{SigningAlg: AlgRS256, SigningKeyFile: rsaFile})
+	require.NoError(t, err)
+	oldToken, err := oldSigner.Sign(testClaim())
+	require.NoError(t, err)
+
+	newSigner, err := NewSigner(&AuthOption{
+		SigningAlg:           AlgEdDSA,
+		SigningKeyFile:       edFile,
+		VerificationKeyFiles: []string{rsaFile},
+	})
+	require.NoError(t, err)
+	newToken, err := newSigner.Sign(testClaim())
+	require.NoError(t, err)
+
+	_, err = newSigner.Parse(oldToken, &Claim{})
+	require.NoError(t, err)
+	_, err = newSigner.Parse(newToken, &Claim{})
+	require.NoError(t, err)
+	_, err = oldSigner.Parse(newToken, &Claim{})
+	require.Error(t, err)
+
+	jwks := newSigner.JWKS()
+	require.Len(t, jwks.Keys, 2)
+	require.Equal(t, AlgEdDSA, jwks.Keys[0].Alg)
+	require.Equal(t, AlgRS256, jwks.Keys[1].Alg)
+}
+
+func TestSignerRejectsSecretWithKeyID(t *testing.T) {
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	signer, err := NewSigner(&AuthOption{
+		JWTSecret:      "secret",
+		SigningAlg:     AlgEdDSA,
+		SigningKeyFile: writePrivateKey(t, edKey),
+	})
+	require.NoError(t, err)
+
+	// a HS256 token that claims the kid of the public key must not be verified with it
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, testClaim())
+	token.Header["kid"] = signer.kid
+	tokenString, err := token.SignedString([]byte("secret"))
+	require.NoError(t, err)
+	_, err = signer.Parse(tokenString, &Claim{})
+	require.Error(t, err)
+
+	// legacy tokens without kid are still accepted while the secret is configured
+	legacy, err := jwt.NewWithClaims(jwt.SigningMethodHS256, testClaim()).SignedString([]byte("secret"))
+	require.NoError(t, err)
+	_, err = signer.Parse(legacy, &Claim{})
+	require.NoError(t, err)
+}
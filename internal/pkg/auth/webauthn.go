@@ -0,0 +1,144 @@
+package auth
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+type WebAuthnOption struct {
+	Enabled       bool          `help:"enable passkeys" env:"ENABLED" default:"false"`
+	RPID          string        `help:"relying party id, the domain passkeys are bound to" env:"RP_ID"`
+	RPDisplayName string        `help:"relying party name shown by the authenticator" env:"RP_DISPLAY_NAME" default:"oson"`
+	RPOrigins     []string      `help:"origins allowed to run webauthn ceremonies" env:"RP_ORIGINS"`
+	Timeout       time.Duration `help:"how long a ceremony can take" env:"TIMEOUT" default:"5m"`
+}
+
+// WebAuthnUser is the account a ceremony runs for. ID is the user handle stored by the authenticator.
+type WebAuthnUser struct {
+	ID          []byte
+	Name        string
+	DisplayName string
+	Credentials []webauthn.Credential
+}
+
+var _ webauthn.User = (*WebAuthnUser)(nil)
+
+func (u *WebAuthnUser) WebAuthnID() []byte {
+	return u.ID
+}
+
+func (u *WebAuthnUser) WebAuthnName() string {
+	return u.Name
+}
+
+func (u *WebAuthnUser) WebAuthnDisplayName() string {
+	return u.DisplayName
+}
+
+func (u *WebAuthnUser) WebAuthnIcon() string {
+	return ""
+}
+
+func (u *WebAuthnUser) WebAuthnCredentials() []webauthn.Credential {
+	return u.Credentials
+}
+
+// WebAuthn runs registration and login ceremonies for passkeys.
+// The session data returned by the Begin methods has to be kept on the server until the ceremony is finished.
+type WebAuthn struct {
+	webAuthn *webauthn.WebAuthn
+}
+
+func NewWebAuthn(opt *WebAuthnOption) (*WebAuthn, error) {
+	timeout := webauthn.TimeoutConfig{
+		Enforce:    true,
+		Timeout:    opt.Timeout,
+		TimeoutUVD: opt.Timeout,
+	}
+	w, err := webauthn.New(&webauthn.Config{
+		RPID:          opt.RPID,
+		RPDisplayName: opt.RPDisplayName,
+		RPOrigins:     opt.RPOrigins,
+		Timeouts: webauthn.TimeoutsConfig{
+			Login:        timeout,
+			Registration: timeout,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &WebAuthn{
+		webAuthn: w,
+	}, nil
+}
+
+// BeginRegistration asks for a discoverable credential, so the same passkey works as a second and as a first factor.
+func (w *WebAuthn) BeginRegistration(user *WebAuthnUser) (*protocol.CredentialCreation, *webauthn.SessionData, error) {
+	exclusions := make([]protocol.CredentialDescriptor, 0, len(user.Credentials))
+	for _, credential := range user.Credentials {
+		exclusions = append(exclusions, credential.Descriptor())
+	}
+	return w.webAuthn.BeginRegistration(user,
+		webauthn.WithExclusions(exclusions),
+		webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementPreferred),
+	)
+}
+
+func (w *WebAuthn) FinishRegistration(user *WebAuthnUser, session *webauthn.SessionData, response *protocol.ParsedCredentialCreationData) (*webauthn.Credential, error) {
+	return w.webAuthn.CreateCredential(user, *session, response)
+}
+
+// BeginLogin starts a second factor ceremony limited to the credentials of the user.
+func (w *WebAuthn) BeginLogin(user *WebAuthnUser) (*protocol.CredentialAssertion, *webauthn.SessionData, error) {
+	return w.webAuthn.BeginLogin(user)
+}
+
+func (w *WebAuthn) FinishLogin(user *WebAuthnUser, session *webauthn.SessionData, response *protocol.ParsedCredentialAssertionData) (*webauthn.Credential, error) {
+	credential, err := w.webAuthn.ValidateLogin(user, *session, response)
+	if err != nil {
+		return nil, err
+	}
+	return checkClone(credential)
+}
+
+// BeginPasswordlessLogin starts a ceremony for any discoverable credential.
+// User verification is required because the passkey replaces both the password and the second factor.
+func (w *WebAuthn) BeginPasswordlessLogin() (*protocol.CredentialAssertion, *webauthn.SessionData, error) {
+	return w.webAuthn.BeginDiscoverableLogin(webauthn.WithUserVerification(protocol.VerificationRequired))
+}
+
+// FinishPasswordlessLogin resolves the user from the user handle returned by the authenticator.
+func (w *WebAuthn) FinishPasswordlessLogin(
+	findUser func(userHandle []byte) (*WebAuthnUser, error),
+	session *webauthn.SessionData,
+	response *protocol.ParsedCredentialAssertionData,
+) (*webauthn.Credential, error) {
+	handler := func(_, userHandle []byte) (webauthn.User, error) {
+		return findUser(userHandle)
+	}
+	credential, err := w.webAuthn.ValidateDiscoverableLogin(handler, *session, response)
+	if err != nil {
+		return nil, err
+	}
+	return checkClone(credential)
+}
+
+// checkClone rejects an assertion whose signature counter went backwards, which means the key was copied.
+func checkClone(credential *webauthn.Credential) (*webauthn.Credential, error) {
+	if credential.Authenticator.CloneWarning {
+		return nil, fmt.Errorf("authenticator may be cloned")
+	}
+	return credential, nil
+}
+
+func ParseWebAuthnCreation(body []byte) (*protocol.ParsedCredentialCreationData, error) {
+	return protocol.ParseCredentialCreationResponseBody(bytes.NewReader(body))
+}
+
+func ParseWebAuthnAssertion(body []byte) (*protocol.ParsedCredentialAssertionData, error) {
+	return protocol.ParseCredentialRequestResponseBody(bytes.NewReader(body))
+}
@@ -0,0 +1,216 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+	"github.com/go-webauthn/webauthn/protocol/webauthncose"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testRPID   = "oson.example.com"
+	testOrigin = "https://oson.example.com"
+
+	flagUserPresent  = 0x01
+	flagUserVerified = 0x04
+	flagAttestedData = 0x40
+)
+
+// softAuthenticator is a platform authenticator kept in memory, it makes ES256 passkeys with none attestation.
+type softAuthenticator struct {
+	t          *testing.T
+	key        *ecdsa.PrivateKey
+	id         []byte
+	userHandle []byte
+	counter    uint32
+}
+
+func newSoftAuthenticator(t *testing.T) *softAuthenticator {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	id := make([]byte, 16)
+	_, err = rand.Read(id)
+	require.NoError(t, err)
+	return &softAuthenticator{t: t, key: key, id: id}
+}
+
+func (a *softAuthenticator) authData(flags byte, attestedData []byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(testRPID))
+	data := append(rpIDHash[:], flags)
+	data = binary.BigEndian.AppendUint32(data, a.counter)
+	return append(data, attestedData...)
+}
+
+func (a *softAuthenticator) clientData(ceremony protocol.CeremonyType, challenge protocol.URLEncodedBase64) []byte {
+	data, err := json.Marshal(protocol.CollectedClientData{
+		Type:      ceremony,
+		Challenge: challenge.String(),
+		Origin:    testOrigin,
+	})
+	require.NoError(a.t, err)
+	return data
+}
+
+func (a *softAuthenticator) create(options *protocol.CredentialCreation) *protocol.ParsedCredentialCreationData {
+	a.userHandle = options.Response.User.ID.(protocol.URLEncodedBase64)
+
+	publicKey, err := webauthncbor.Marshal(webauthncose.EC2PublicKeyData{
+		PublicKeyData: webauthncose.PublicKeyData{
+			KeyType:   int64(webauthncose.EllipticKey),
+			Algorithm: int64(webauthncose.AlgES256),
+		},
+		Curve:  1, // P-256
+		XCoord: a.key.X.FillBytes(make([]byte, 32)),
+		YCoord: a.key.Y.FillBytes(make([]byte, 32)),
+	})
+	require.NoError(a.t, err)
+	attestedData := make([]byte, 16) // zero AAGUID
+	attestedData = binary.BigEndian.AppendUint16(attestedData, uint16(len(a.id)))
+	attestedData = append(attestedData, a.id...)
+	attestedData = append(attestedData, publicKey...)
+
+	attestationObject, err := webauthncbor.Marshal(map[string]interface{}{
+		"fmt":      "none",
+		"attStmt":  map[string]interface{}{},
+		"authData": a.authData(flagUserPresent|flagUserVerified|flagAttestedData, attestedData),
+	})
+	require.NoError(a.t, err)
+
+	return a.parseCreation(map[string]interface{}{
+		"clientDataJSON":    encode(a.clientData(protocol.CreateCeremony, options.Response.Challenge)),
+		"attestationObject": encode(attestationObject),
+	})
+}
+
+func (a *softAuthenticator) get(options *protocol.CredentialAssertion) *protocol.ParsedCredentialAssertionData {
+	a.counter++
+	authData := a.authData(flagUserPresent|flagUserVerified, nil)
+	clientData := a.clientData(protocol.AssertCeremony, options.Response.Challenge)
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(authData, clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	require.NoError(a.t, err)
+
+	body, err := json.Marshal(map[string]interface{}{
+		"id":    encode(a.id),
+		"rawId": encode(a.id),
+		"type":  "public-key",
+		"response": map[string]interface{}{
+			"clientDataJSON":    encode(clientData),
+			"authenticatorData": encode(authData),
+			"signature":         encode(signature),
+			"userHandle":        encode(a.userHandle),
+		},
+	})
+	require.NoError(a.t, err)
+	parsed, err := ParseWebAuthnAssertion(body)
+	require.NoError(a.t, err)
+	return parsed
+}
+
+func (a *softAuthenticator) parseCreation(response map[string]interface{}) *protocol.ParsedCredentialCreationData {
+	body, err := json.Marshal(map[string]interface{}{
+		"id":       encode(a.id),
+		"rawId":    encode(a.id),
+		"type":     "public-key",
+		"response": response,
+	})
+	require.NoError(a.t, err)
+	parsed, err := ParseWebAuthnCreation(body)
+	require.NoError(a.t, err)
+	return parsed
+}
+
+func encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func newTestWebAuthn(t *testing.T) *WebAuthn {
+	w, err := NewWebAuthn(&WebAuthnOption{
+		RPID:          testRPID,
+		RPDisplayName: "oson",
+		RPOrigins:     []string{testOrigin},
+		Timeout:       time.Minute,
+	})
+	require.NoError(t, err)
+	return w
+}
+
+func registerPasskey(t *testing.T, w *WebAuthn, authenticator *softAuthenticator, user *WebAuthnUser) {
+	options, session, err := w.BeginRegistration(user)
+	require.NoError(t, err)
+	credential, err := w.FinishRegistration(user, session, authenticator.create(options))
+	require.NoError(t, err)
+	require.Equal(t, authenticator.id, credential.ID)
+	user.Credentials = append(user.Credentials, *credential)
+}
+
+func TestWebAuthnSecondFactor(t *testing.T) {
+	w := newTestWebAuthn(t)
+	authenticator := newSoftAuthenticator(t)
+	user := &WebAuthnUser{ID: []byte("pid"), Name: "user@example.com", DisplayName: "User"}
+	registerPasskey(t, w, authenticator, user)
+
+	options, session, err := w.BeginLogin(user)
+	require.NoError(t, err)
+	credential, err := w.FinishLogin(user, session, authenticator.get(options))
+	require.NoError(t, err)
+	require.Equal(t, uint32(1), credential.Authenticator.SignCount)
+
+	// the assertion is bound to the challenge of its own ceremony
+	_, otherSession, err := w.BeginLogin(user)
+	require.NoError(t, err)
+	_, err = w.FinishLogin(user, otherSession, authenticator.get(options))
+	require.Error(t, err)
+}
+
+func TestWebAuthnPasswordless(t *testing.T) {
+	w := newTestWebAuthn(t)
+	authenticator := newSoftAuthenticator(t)
+	user := &WebAuthnUser{ID: []byte("pid"), Name: "user@example.com", DisplayName: "User"}
+	registerPasskey(t, w, authenticator, user)
+	findUser := func(userHandle []byte) (*WebAuthnUser, error) {
+		require.Equal(t, user.ID, userHandle)
+		return user, nil
+	}
+
+	options, session, err := w.BeginPasswordlessLogin()
+	require.NoError(t, err)
+	require.Equal(t, protocol.VerificationRequired, session.UserVerification)
+	credential, err := w.FinishPasswordlessLogin(findUser, session, authenticator.get(options))
+	require.NoError(t, err)
+	user.Credentials[0] = *credential
+
+	// a signature counter that goes backwards means the key was copied
+	authenticator.counter = 0
+	options, session, err = w.BeginPasswordlessLogin()
+	require.NoError(t, err)
+	_, err = w.FinishPasswordlessLogin(findUser, session, authenticator.get(options))
+	require.Error(t, err)
+}
+
+func TestWebAuthnRejectsOtherOrigin(t *testing.T) {
+	w, err := NewWebAuthn(&WebAuthnOption{
+		RPID:          "other.example.com",
+		RPDisplayName: "oson",
+		RPOrigins:     []string{"https://other.example.com"},
+		Timeout:       time.Minute,
+	})
+	require.NoError(t, err)
+	user := &WebAuthnUser{ID: []byte("pid"), Name: "user@example.com", DisplayName: "User"}
+
+	options, session, err := w.BeginRegistration(user)
+	require.NoError(t, err)
+	_, err = w.FinishRegistration(user, session, newSoftAuthenticator(t).create(options))
+	require.Error(t, err)
+}
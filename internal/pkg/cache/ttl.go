@@ -0,0 +1,67 @@
+package cache
+
+import (
+	"sync"
+	"time"
+)
+
+type item[V any] struct {
+	value    V
+	expireAt time.Time
+}
+
+// TTL is a concurrency safe in-memory map whose entries expire after a fixed duration.
+type TTL[K comparable, V any] struct {
+	ttl       time.Duration
+	items     map[K]item[V]
+	lastEvict time.Time
+	mu        sync.RWMutex
+}
+
+func NewTTL[K comparable, V any](ttl time.Duration) *TTL[K, V] {
+	return &TTL[K, V]{
+		ttl:   ttl,
+		items: make(map[K]item[V]),
+	}
+}
+
+func (c *TTL[K, V]) Get(key K) (V, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	it, ok := c.items[key]
+	if !ok || time.Now().After(it.expireAt) {
+		var zero V
+		return zero, false
+	}
+	return it.value, true
+}
+
+func (c *TTL[K, V]) Set(key K, value V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	c.items[key] = item[V]{
+		value:    value,
+		expireAt: now.Add(c.ttl),
+	}
+	c.evictExpired(now)
+}
+
+func (c *TTL[K, V]) Delete(key K) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.items, key)
+}
+
+// evictExpired drops expired entries, at most once per ttl so that Set stays cheap.
+func (c *TTL[K, V]) evictExpired(now time.Time) {
+	if now.Sub(c.lastEvict) < c.ttl {
+		return
+	}
+	c.lastEvict = now
+	for k, it := range c.items {
+		if now.After(it.expireAt) {
+			delete(c.items, k)
+		}
+	}
+}
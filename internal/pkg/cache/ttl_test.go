@@ -0,0 +1,26 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTTL(t *testing.T) {
+	c := NewTTL[string, int](50 * time.Millisecond)
+	c.Set("a", 1)
+
+	v, ok := c.Get("a")
+	require.True(t, ok)
+	require.Equal(t, 1, v)
+
+	c.Delete("a")
+	_, ok = c.Get("a")
+	require.False(t, ok)
+
+	c.Set("b", 2)
+	time.Sleep(60 * time.Millisecond)
+	_, ok = c.Get("b")
+	require.False(t, ok)
+}
@@ -0,0 +1,29 @@
+package clientinfo
+
+import (
+	"context"
+)
+
+type contextType string
+
+const infoKey = contextType("clientinfo")
+
+// Info describes the client a request came from.
+type Info struct {
+	IP        string
+	UserAgent string
+	RequestID string
+}
+
+func WithInfo(ctx context.Context, info *Info) context.Context {
+	return context.WithValue(ctx, infoKey, info)
+}
+
+// FromContext returns an empty Info outside of a request, e.g. in the cli.
+func FromContext(ctx context.Context) *Info {
+	if info, ok := ctx.Value(infoKey).(*Info); ok {
+		return info
+	}
+
+	return &Info{}
+}
@@ -0,0 +1,54 @@
+package clientinfo
+
+import "strings"
+
+type uaMatch struct {
+	token string
+	name  string
+}
+
+// the order matters, Edge and Opera mention Chrome and Chrome mentions Safari.
+var browsers = []uaMatch{
+	{"Edg/", "Edge"},
+	{"OPR/", "Opera"},
+	{"Firefox/", "Firefox"},
+	{"FxiOS/", "Firefox"},
+	{"CriOS/", "Chrome"},
+	{"Chrome/", "Chrome"},
+	{"Safari/", "Safari"},
+}
+
+// iOS and Android user agents mention the desktop systems as well, so they go first.
+var systems = []uaMatch{
+	{"iPhone", "iOS"},
+	{"iPad", "iPadOS"},
+	{"Android", "Android"},
+	{"Windows", "Windows"},
+	{"Mac OS X", "macOS"},
+	{"CrOS", "ChromeOS"},
+	{"Linux", "Linux"},
+}
+
+// Device names the browser and the system of the user agent for people to recognise their devices,
+// like "Firefox on Windows". It is empty when neither is known.
+func Device(userAgent string) string {
+	browser := match(userAgent, browsers)
+	system := match(userAgent, systems)
+	switch {
+	case browser != "" && system != "":
+		return browser + " on " + system
+	case browser != "":
+		return browser
+	default:
+		return system
+	}
+}
+
+func match(userAgent string, matches []uaMatch) string {
+	for _, m := range matches {
+		if strings.Contains(userAgent, m.token) {
+			return m.name
+		}
+	}
+	return ""
+}
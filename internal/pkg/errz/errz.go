@@ -59,4 +59,5 @@ var (
 	ConflictErr   = NewCustomError("conflict error", 101)
 	NotFoundErr   = NewCustomError("not found", 102)
 	InternalErr   = NewCustomError("internal error", 103)
+	ForbiddenErr  = NewCustomError("forbidden", 104)
 )
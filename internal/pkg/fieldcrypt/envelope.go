@@ -0,0 +1,151 @@
+package fieldcrypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+const (
+	// envelopePrefix marks encrypted values, a TOTP secret or any other legacy plain value never starts with it.
+	envelopePrefix = "enc:v1:"
+	keySize        = 32
+)
+
+var encoding = base64.RawStdEncoding
+
+// Envelope encrypts every value with its own random data key, and the data key with the key
+// encryption key. The stored value is enc:v1:<key id>:<wrapped data key>:<ciphertext>, so values
+// written under a retired key are still read while the rows are re-encrypted.
+type Envelope struct {
+	keys    map[string]cipher.AEAD
+	primary string
+}
+
+func NewEnvelope(keys map[string][]byte, primary string) (*Envelope, error) {
+	e := &Envelope{
+		keys:    make(map[string]cipher.AEAD, len(keys)),
+		primary: primary,
+	}
+	for id, key := range keys {
+		if strings.Contains(id, ":") {
+			return nil, fmt.Errorf("key id %s must not contain a colon", id)
+		}
+		if len(key) != keySize {
+			return nil, fmt.Errorf("key %s must be %d bytes, got %d", id, keySize, len(key))
+		}
+		aead, err := newAEAD(key)
+		if err != nil {
+			return nil, err
+		}
+		e.keys[id] = aead
+	}
+	if _, ok := e.keys[primary]; !ok {
+		return nil, fmt.Errorf("primary key %s is not configured", primary)
+	}
+	return e, nil
+}
+
+// IsEncrypted reports whether the value was written by an Envelope.
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, envelopePrefix)
+}
+
+func (e *Envelope) Encrypt(plaintext string, associatedData []byte) (string, error) {
+	if plaintext == "" {
+		return "", nil
+	}
+	dataKey := make([]byte, keySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return "", fmt.Errorf("failed to generate data key: %w", err)
+	}
+	dataAEAD, err := newAEAD(dataKey)
+	if err != nil {
+		return "", err
+	}
+	ciphertext, err := seal(dataAEAD, []byte(plaintext), associatedData)
+	if err != nil {
+		return "", err
+	}
+	// the key id is authenticated with the data key, moving a value under another key fails
+	wrappedKey, err := seal(e.keys[e.primary], dataKey, []byte(e.primary))
+	if err != nil {
+		return "", err
+	}
+
+	return envelopePrefix + e.primary + ":" + encoding.EncodeToString(wrappedKey) + ":" + encoding.EncodeToString(ciphertext), nil
+}
+
+func (e *Envelope) Decrypt(value string, associatedData []byte) (string, error) {
+	if !IsEncrypted(value) {
+		return value, nil
+	}
+	parts := strings.Split(strings.TrimPrefix(value, envelopePrefix), ":")
+	if len(parts) != 3 {
+		return "", fmt.Errorf("malformed encrypted value")
+	}
+	kek, ok := e.keys[parts[0]]
+	if !ok {
+		return "", fmt.Errorf("unknown encryption key %s", parts[0])
+	}
+	wrappedKey, err := encoding.DecodeString(parts[1])
+	if err != nil {
+		return "", fmt.Errorf("malformed encrypted value: %w", err)
+	}
+	ciphertext, err := encoding.DecodeString(parts[2])
+	if err != nil {
+		return "", fmt.Errorf("malformed encrypted value: %w", err)
+	}
+
+	dataKey, err := open(kek, wrappedKey, []byte(parts[0]))
+	if err != nil {
+		return "", err
+	}
+	dataAEAD, err := newAEAD(dataKey)
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := open(dataAEAD, ciphertext, associatedData)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+func (e *Envelope) NeedsReencrypt(value string) bool {
+	if value == "" {
+		return false
+	}
+	return !strings.HasPrefix(value, envelopePrefix+e.primary+":")
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal prepends the random nonce to the ciphertext.
+func seal(aead cipher.AEAD, plaintext, associatedData []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return aead.Seal(nonce, nonce, plaintext, associatedData), nil
+}
+
+func open(aead cipher.AEAD, ciphertext, associatedData []byte) ([]byte, error) {
+	if len(ciphertext) < aead.NonceSize() {
+		return nil, fmt.Errorf("malformed encrypted value")
+	}
+	plaintext, err := aead.Open(nil, ciphertext[:aead.NonceSize()], ciphertext[aead.NonceSize():], associatedData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt value: %w", err)
+	}
+	return plaintext, nil
+}
@@ -0,0 +1,90 @@
+package fieldcrypt
+
+import (
+	"bytes"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func testKey(b byte) string {
+	return base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{b}, keySize))
+}
+
+func TestEnvelope(t *testing.T) {
+	c, err := New(&Option{Keys: []string{"k1:" + testKey(1)}})
+	require.NoError(t, err)
+	ad := []byte("user-1")
+
+	value, err := c.Encrypt("JBSWY3DPEHPK3PXP", ad)
+	require.NoError(t, err)
+	require.True(t, IsEncrypted(value))
+	require.NotContains(t, value, "JBSWY3DPEHPK3PXP")
+	require.False(t, c.NeedsReencrypt(value))
+
+	plaintext, err := c.Decrypt(value, ad)
+	require.NoError(t, err)
+	require.Equal(t, "JBSWY3DPEHPK3PXP", plaintext)
+
+	// a value copied to another row doesn't decrypt
+	_, err = c.Decrypt(value, []byte("user-2"))
+	require.Error(t, err)
+
+	// values stored before encryption was turned on are read as they are
+	plaintext, err = c.Decrypt("JBSWY3DPEHPK3PXP", ad)
+	require.NoError(t, err)
+	require.Equal(t, "JBSWY3DPEHPK3PXP", plaintext)
+	require.True(t, c.NeedsReencrypt("JBSWY3DPEHPK3PXP"))
+
+	empty, err := c.Encrypt("", ad)
+	require.NoError(t, err)
+	require.Empty(t, empty)
+	require.False(t, c.NeedsReencrypt(empty))
+}
+
+func TestEnvelopeRotation(t *testing.T) {
+	old, err := New(&Option{Keys: []string{"k1:" + testKey(1)}})
+	require.NoError(t, err)
+	value, err := old.Encrypt("secret", nil)
+	require.NoError(t, err)
+
+	keyFile := filepath.Join(t.TempDir(), "keys")
+	require.NoError(t, os.WriteFile(keyFile, []byte("# retired\nk1:"+testKey(1)+"\n\nk2:"+testKey(2)+"\n"), 0o600))
+	rotated, err := New(&Option{KeyFile: keyFile, PrimaryKeyID: "k2"})
+	require.NoError(t, err)
+
+	require.True(t, rotated.NeedsReencrypt(value))
+	plaintext, err := rotated.Decrypt(value, nil)
+	require.NoError(t, err)
+	require.Equal(t, "secret", plaintext)
+
+	value, err = rotated.Encrypt(plaintext, nil)
+	require.NoError(t, err)
+	require.False(t, rotated.NeedsReencrypt(value))
+
+	// the retired key can't read what is written under the new one
+	_, err = old.Decrypt(value, nil)
+	require.Error(t, err)
+}
+
+func TestNew(t *testing.T) {
+	c, err := New(&Option{})
+	require.NoError(t, err)
+	require.Equal(t, Plaintext{}, c)
+	_, err = c.Decrypt(envelopePrefix+"k1:a:b", nil)
+	require.ErrorIs(t, err, ErrNoKeys)
+
+	_, err = New(&Option{Keys: []string{"k1:" + testKey(1), "k2:" + testKey(2)}})
+	require.Error(t, err, "primary key id is required with more than one key")
+	_, err = New(&Option{Keys: []string{"k1:" + testKey(1)}, PrimaryKeyID: "k2"})
+	require.Error(t, err)
+	_, err = New(&Option{Keys: []string{"k1:" + testKey(1), "k1:" + testKey(2)}, PrimaryKeyID: "k1"})
+	require.Error(t, err)
+	_, err = New(&Option{Keys: []string{"k1:" + base64.StdEncoding.EncodeToString([]byte("short"))}})
+	require.Error(t, err)
+	_, err = New(&Option{Keys: []string{testKey(1)}})
+	require.Error(t, err)
+}
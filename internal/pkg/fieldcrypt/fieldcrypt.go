@@ -0,0 +1,114 @@
+package fieldcrypt
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+type Option struct {
+	Keys         []string `help:"key encryption keys as id:base64 of 32 bytes, retired keys are kept to read the old values" env:"KEYS"`
+	KeyFile      string   `help:"file with one id:base64 key per line, read in addition to the keys" env:"KEY_FILE"`
+	PrimaryKeyID string   `help:"id of the key new values are encrypted with, required with more than one key" env:"PRIMARY_KEY_ID"`
+}
+
+// ErrNoKeys is returned when an encrypted value is read without any key configured.
+var ErrNoKeys = errors.New("value is encrypted but no encryption keys are configured")
+
+// Cipher encrypts single column values. The associated data binds a value to its row,
+// a value copied to another row doesn't decrypt. Empty values stay empty.
+type Cipher interface {
+	Encrypt(plaintext string, associatedData []byte) (string, error)
+	// Decrypt returns values written before encryption was turned on as they are.
+	Decrypt(value string, associatedData []byte) (string, error)
+	// NeedsReencrypt reports whether the value is not encrypted under the primary key yet.
+	NeedsReencrypt(value string) bool
+}
+
+// New returns the envelope cipher for the configured keys. Without keys the values are stored
+// in plain text, like before encryption existed.
+func New(opt *Option) (Cipher, error) {
+	keys, err := readKeys(opt)
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return Plaintext{}, nil
+	}
+
+	primary := opt.PrimaryKeyID
+	if primary == "" {
+		if len(keys) > 1 {
+			return nil, fmt.Errorf("primary key id is required with %d keys", len(keys))
+		}
+		for id := range keys {
+			primary = id
+		}
+	}
+	return NewEnvelope(keys, primary)
+}
+
+// readKeys parses the keys of the option and of the key file, the ids must be unique across both.
+func readKeys(opt *Option) (map[string][]byte, error) {
+	entries := append([]string(nil), opt.Keys...)
+	if opt.KeyFile != "" {
+		data, err := os.ReadFile(opt.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read key file: %w", err)
+		}
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			entries = append(entries, line)
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("failed to read key file: %w", err)
+		}
+	}
+
+	keys := make(map[string][]byte, len(entries))
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		id, encoded, ok := strings.Cut(entry, ":")
+		if !ok || id == "" {
+			return nil, fmt.Errorf("key must look like id:base64")
+		}
+		if _, ok := keys[id]; ok {
+			return nil, fmt.Errorf("key %s is given twice", id)
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("key %s is not base64: %w", id, err)
+		}
+		keys[id] = key
+	}
+	return keys, nil
+}
+
+// Plaintext stores the values as they are. Values encrypted earlier can't be read back with it.
+type Plaintext struct{}
+
+func (Plaintext) Encrypt(plaintext string, _ []byte) (string, error) {
+	return plaintext, nil
+}
+
+func (Plaintext) Decrypt(value string, _ []byte) (string, error) {
+	if IsEncrypted(value) {
+		return "", ErrNoKeys
+	}
+	return value, nil
+}
+
+func (Plaintext) NeedsReencrypt(string) bool {
+	return false
+}
@@ -7,4 +7,5 @@ import (
 type ServerOpts struct {
 	Listen            string        `help:"listen string" default:":3000" env:"LISTEN"`
 	ReadHeaderTimeout time.Duration `help:"listen string" default:"10s" env:"READ_HEADER_TIMEOUT"`
+	TrustProxyHeaders bool          `help:"take the client ip from X-Real-IP and X-Forwarded-For set by a reverse proxy" default:"false" env:"TRUST_PROXY_HEADERS"`
 }
@@ -1,14 +1,23 @@
 package httpx
 
 import (
+	"net"
 	"net/http"
+	"strings"
 
 	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	"github.com/theruziev/oson_auth/internal/pkg/clientinfo"
 	"github.com/theruziev/oson_auth/internal/pkg/logging"
 	"github.com/theruziev/oson_auth/internal/pkg/validatorx"
 	"go.uber.org/zap"
 )
 
+const (
+	requestIDHeader    = "X-Request-ID"
+	maxRequestIDLength = 128
+)
+
 // PopulateLogger populates the logger onto the context.
 func PopulateLogger(logger *zap.SugaredLogger) func(next http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
@@ -36,6 +45,44 @@ func PopulateValidator(validate *validator.Validate) func(next http.Handler) htt
 	}
 }
 
+// PopulateClientInfo puts the ip, user agent and request id of the client onto the context.
+// Proxy headers are taken into account only when the server runs behind a trusted reverse proxy,
+// otherwise the client could pick any address.
+func PopulateClientInfo(trustProxyHeaders bool) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+			requestID := requestID(r, trustProxyHeaders)
+			w.Header().Set(requestIDHeader, requestID)
+			ctx = clientinfo.WithInfo(ctx, &clientinfo.Info{
+				IP:        clientIP(r, trustProxyHeaders),
+				UserAgent: r.UserAgent(),
+				RequestID: requestID,
+			})
+			r = r.Clone(ctx)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func clientIP(r *http.Request, trustProxyHeaders bool) string {
+	if trustProxyHeaders {
+		if ip := strings.TrimSpace(r.Header.Get("X-Real-IP")); ip != "" {
+			return ip
+		}
+		// the last address is the one the proxy saw, the ones before it are set by the client
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			addresses := strings.Split(forwarded, ",")
+			return strings.TrimSpace(addresses[len(addresses)-1])
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
 func Recoverer(logger *zap.SugaredLogger) func(next http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -49,3 +96,14 @@ func Recoverer(logger *zap.SugaredLogger) func(next http.Handler) http.Handler {
 		})
 	}
 }
+
+// requestID keeps the id set by the trusted proxy, so the request can be followed across services.
+func requestID(r *http.Request, trustProxyHeaders bool) string {
+	if trustProxyHeaders {
+		id := r.Header.Get(requestIDHeader)
+		if id != "" && len(id) <= maxRequestIDLength {
+			return id
+		}
+	}
+	return uuid.New().String()
+}
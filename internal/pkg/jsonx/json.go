@@ -15,3 +15,10 @@ func Marshal(v any) ([]byte, error) {
 	}
 	return jsonBytes, nil
 }
+
+func Unmarshal(data []byte, v any) error {
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("failed to unmarshal json: %w", err)
+	}
+	return nil
+}
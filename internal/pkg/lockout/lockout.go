@@ -0,0 +1,179 @@
+package lockout
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+const (
+	BackendPostgres = "postgres"
+	BackendMemory   = "memory"
+)
+
+type Option struct {
+	Backend             string        `help:"where failed attempts are counted: postgres or memory" env:"BACKEND" default:"postgres" enum:"postgres,memory"`
+	AccountFreeAttempts int           `help:"failed attempts allowed for an account before it is locked" env:"ACCOUNT_FREE_ATTEMPTS" default:"5"`
+	IPFreeAttempts      int           `help:"failed attempts allowed from an ip before it is throttled" env:"IP_FREE_ATTEMPTS" default:"20"`
+	BaseDelay           time.Duration `help:"lock duration after the first attempt over the limit, doubled with every next one" env:"BASE_DELAY" default:"30s"`
+	MaxDelay            time.Duration `help:"longest lock duration" env:"MAX_DELAY" default:"15m"`
+	Window              time.Duration `help:"failed attempts older than this are forgotten" env:"WINDOW" default:"1h"`
+}
+
+type Scope string
+
+const (
+	// ScopeAccount counts failures against a single account, whatever address they come from.
+	ScopeAccount Scope = "account"
+	// ScopeIP counts failures from a single address, whatever account they target.
+	ScopeIP Scope = "ip"
+)
+
+// Subject is what failed attempts are counted for.
+type Subject struct {
+	Scope Scope
+	ID    string
+}
+
+func Account(id string) Subject {
+	return Subject{Scope: ScopeAccount, ID: id}
+}
+
+func IP(ip string) Subject {
+	return Subject{Scope: ScopeIP, ID: ip}
+}
+
+func (s Subject) key() string {
+	return string(s.Scope) + ":" + s.ID
+}
+
+// Attempts is the state of a counter.
+type Attempts struct {
+	Failures      int
+	LastFailureAt time.Time
+	LockedUntil   time.Time
+}
+
+// Counter keeps failed attempts per key. Implementations must be safe for concurrent use.
+type Counter interface {
+	// Get returns zero Attempts when nothing is counted for the key.
+	Get(ctx context.Context, key string) (*Attempts, error)
+	// Fail counts a failure and returns the number of failures in a row.
+	// The count starts over when the previous failure is older than window.
+	Fail(ctx context.Context, key string, now time.Time, window time.Duration) (int, error)
+	Lock(ctx context.Context, key string, until time.Time) error
+	Reset(ctx context.Context, key string) error
+}
+
+// LockedError is returned while a subject is locked out.
+type LockedError struct {
+	Scope      Scope
+	RetryAfter time.Duration
+}
+
+func (e *LockedError) Error() string {
+	return fmt.Sprintf("too many failed attempts for %s, retry after %s", e.Scope, e.RetryAfter)
+}
+
+// RetryAfterSeconds rounds the wait up to whole seconds, as the Retry-After header wants it.
+func (e *LockedError) RetryAfterSeconds() int {
+	return int(math.Ceil(e.RetryAfter.Seconds()))
+}
+
+func IsLocked(err error) (*LockedError, bool) {
+	var locked *LockedError
+	if errors.As(err, &locked) {
+		return locked, true
+	}
+	return nil, false
+}
+
+// Limiter locks subjects out after too many failed attempts.
+// Every failure over the free attempts locks the subject for twice as long as the previous one.
+type Limiter struct {
+	opt     *Option
+	counter Counter
+	now     func() time.Time
+}
+
+func NewLimiter(opt *Option, counter Counter) *Limiter {
+	return &Limiter{
+		opt:     opt,
+		counter: counter,
+		now:     time.Now,
+	}
+}
+
+// Check returns a LockedError for the first locked subject. Subjects with an empty id are skipped.
+func (l *Limiter) Check(ctx context.Context, subjects ...Subject) error {
+	now := l.now()
+	for _, subject := range subjects {
+		if subject.ID == "" {
+			continue
+		}
+		attempts, err := l.counter.Get(ctx, subject.key())
+		if err != nil {
+			return err
+		}
+		if attempts.LockedUntil.After(now) {
+			return &LockedError{Scope: subject.Scope, RetryAfter: attempts.LockedUntil.Sub(now)}
+		}
+	}
+	return nil
+}
+
+// Fail counts a failed attempt for every subject and locks the ones over their limit.
+func (l *Limiter) Fail(ctx context.Context, subjects ...Subject) error {
+	now := l.now()
+	for _, subject := range subjects {
+		if subject.ID == "" {
+			continue
+		}
+		failures, err := l.counter.Fail(ctx, subject.key(), now, l.opt.Window)
+		if err != nil {
+			return err
+		}
+		delay := l.delay(subject.Scope, failures)
+		if delay == 0 {
+			continue
+		}
+		if err := l.counter.Lock(ctx, subject.key(), now.Add(delay)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Reset forgets the failed attempts of the subjects, it is called on success and to unlock by hand.
+func (l *Limiter) Reset(ctx context.Context, subjects ...Subject) error {
+	for _, subject := range subjects {
+		if subject.ID == "" {
+			continue
+		}
+		if err := l.counter.Reset(ctx, subject.key()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (l *Limiter) delay(scope Scope, failures int) time.Duration {
+	free := l.opt.AccountFreeAttempts
+	if scope == ScopeIP {
+		free = l.opt.IPFreeAttempts
+	}
+	over := failures - free
+	if over <= 0 {
+		return 0
+	}
+	delay := l.opt.BaseDelay
+	for i := 1; i < over && delay < l.opt.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > l.opt.MaxDelay {
+		delay = l.opt.MaxDelay
+	}
+	return delay
+}
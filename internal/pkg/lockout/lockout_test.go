@@ -0,0 +1,84 @@
+package lockout
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newTestLimiter(now *time.Time) *Limiter {
+	l := NewLimiter(&Option{
+		AccountFreeAttempts: 3,
+		IPFreeAttempts:      5,
+		BaseDelay:           time.Minute,
+		MaxDelay:            5 * time.Minute,
+		Window:              time.Hour,
+	}, NewMemoryCounter())
+	l.now = func() time.Time { return *now }
+	return l
+}
+
+func TestLimiterBackoff(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	l := newTestLimiter(&now)
+	account := Account("user@example.com")
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, l.Check(ctx, account))
+		require.NoError(t, l.Fail(ctx, account))
+	}
+	require.NoError(t, l.Check(ctx, account))
+
+	// every failure over the limit doubles the lock, up to the max delay
+	for _, want := range []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute, 5 * time.Minute} {
+		require.NoError(t, l.Fail(ctx, account))
+		err := l.Check(ctx, account)
+		locked, ok := IsLocked(err)
+		require.True(t, ok)
+		require.Equal(t, ScopeAccount, locked.Scope)
+		require.Equal(t, want, locked.RetryAfter)
+		now = now.Add(want)
+	}
+	require.NoError(t, l.Check(ctx, account))
+
+	require.NoError(t, l.Fail(ctx, account))
+	require.Error(t, l.Check(ctx, account))
+	require.NoError(t, l.Reset(ctx, account))
+	require.NoError(t, l.Check(ctx, account))
+}
+
+func TestLimiterScopes(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	l := newTestLimiter(&now)
+	ip := IP("10.0.0.1")
+
+	for i := 0; i < 6; i++ {
+		require.NoError(t, l.Fail(ctx, Account("user"+string(rune('a'+i))), ip))
+	}
+	locked, ok := IsLocked(l.Check(ctx, Account("other"), ip))
+	require.True(t, ok)
+	require.Equal(t, ScopeIP, locked.Scope)
+	require.Equal(t, 60, locked.RetryAfterSeconds())
+
+	// an unknown address is not counted
+	require.NoError(t, l.Fail(ctx, Account("other"), IP("")))
+	require.NoError(t, l.Check(ctx, Account("other"), IP("")))
+}
+
+func TestLimiterWindow(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	l := newTestLimiter(&now)
+	account := Account("user@example.com")
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, l.Fail(ctx, account))
+	}
+	now = now.Add(2 * time.Hour)
+	require.NoError(t, l.Fail(ctx, account))
+	require.NoError(t, l.Check(ctx, account))
+}
@@ -0,0 +1,73 @@
+package lockout
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryCounter keeps the counters in the process. They are lost on restart and not shared between
+// replicas, so it suits a single instance or development.
+type MemoryCounter struct {
+	attempts  map[string]Attempts
+	lastEvict time.Time
+	mu        sync.Mutex
+}
+
+func NewMemoryCounter() *MemoryCounter {
+	return &MemoryCounter{
+		attempts: make(map[string]Attempts),
+	}
+}
+
+var _ Counter = (*MemoryCounter)(nil)
+
+func (c *MemoryCounter) Get(_ context.Context, key string) (*Attempts, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	attempts := c.attempts[key]
+	return &attempts, nil
+}
+
+func (c *MemoryCounter) Fail(_ context.Context, key string, now time.Time, window time.Duration) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.evictExpired(now, window)
+	attempts := c.attempts[key]
+	if now.Sub(attempts.LastFailureAt) > window {
+		attempts.Failures = 0
+	}
+	attempts.Failures++
+	attempts.LastFailureAt = now
+	c.attempts[key] = attempts
+	return attempts.Failures, nil
+}
+
+func (c *MemoryCounter) Lock(_ context.Context, key string, until time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	attempts := c.attempts[key]
+	attempts.LockedUntil = until
+	c.attempts[key] = attempts
+	return nil
+}
+
+func (c *MemoryCounter) Reset(_ context.Context, key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.attempts, key)
+	return nil
+}
+
+// evictExpired drops forgotten and unlocked counters, at most once per window so that Fail stays cheap.
+func (c *MemoryCounter) evictExpired(now time.Time, window time.Duration) {
+	if now.Sub(c.lastEvict) < window {
+		return
+	}
+	c.lastEvict = now
+	for key, attempts := range c.attempts {
+		if now.Sub(attempts.LastFailureAt) > window && now.After(attempts.LockedUntil) {
+			delete(c.attempts, key)
+		}
+	}
+}
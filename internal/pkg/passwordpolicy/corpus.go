@@ -0,0 +1,98 @@
+package passwordpolicy
+
+import (
+	"bufio"
+	"crypto/sha1" //nolint:gosec
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const prefixLength = 5
+
+// BreachCorpus looks passwords up in an offline copy of a breached password corpus, such as the one
+// of Have I Been Pwned. Hashes are grouped by the first five hex characters of their sha-1, the same
+// split as the k-anonymity range api, so a lookup reads only the range of the password.
+//
+// The corpus is either a directory with a <prefix>.txt file per range holding SUFFIX:COUNT lines,
+// as written by the downloader, or a single file with HASH:COUNT lines that is loaded into memory.
+type BreachCorpus struct {
+	dir    string
+	ranges map[string]map[string]struct{}
+}
+
+func LoadBreachCorpus(path string) (*BreachCorpus, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open breach corpus: %w", err)
+	}
+	if info.IsDir() {
+		return &BreachCorpus{dir: path}, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open breach corpus: %w", err)
+	}
+	defer f.Close()
+
+	c := &BreachCorpus{ranges: make(map[string]map[string]struct{})}
+	err = scanHashes(f, func(hash string) {
+		if len(hash) <= prefixLength {
+			return
+		}
+		prefix := hash[:prefixLength]
+		if c.ranges[prefix] == nil {
+			c.ranges[prefix] = make(map[string]struct{})
+		}
+		c.ranges[prefix][hash[prefixLength:]] = struct{}{}
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read breach corpus: %w", err)
+	}
+	return c, nil
+}
+
+func (c *BreachCorpus) Contains(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password)) //nolint:gosec
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:prefixLength], hash[prefixLength:]
+
+	if c.ranges != nil {
+		_, ok := c.ranges[prefix][suffix]
+		return ok, nil
+	}
+
+	f, err := os.Open(filepath.Join(c.dir, prefix+".txt"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return false, nil
+		}
+		return false, err
+	}
+	defer f.Close()
+
+	found := false
+	err = scanHashes(f, func(line string) {
+		if line == suffix {
+			found = true
+		}
+	})
+	return found, err
+}
+
+// scanHashes calls fn with the upper-cased hash of every line, the breach count after the colon is dropped.
+func scanHashes(r io.Reader, fn func(hash string)) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		hash, _, _ := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if hash != "" {
+			fn(strings.ToUpper(hash))
+		}
+	}
+	return scanner.Err()
+}
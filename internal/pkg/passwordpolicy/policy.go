@@ -0,0 +1,174 @@
+package passwordpolicy
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+type Option struct {
+	MinLength     int    `help:"shortest allowed password, in characters" env:"MIN_LENGTH" default:"10"`
+	MaxLength     int    `help:"longest allowed password, in characters" env:"MAX_LENGTH" default:"128"`
+	RequireLower  bool   `help:"require a lowercase letter" env:"REQUIRE_LOWER" default:"false"`
+	RequireUpper  bool   `help:"require an uppercase letter" env:"REQUIRE_UPPER" default:"false"`
+	RequireDigit  bool   `help:"require a digit" env:"REQUIRE_DIGIT" default:"false"`
+	RequireSymbol bool   `help:"require a symbol" env:"REQUIRE_SYMBOL" default:"false"`
+	MinScore      int    `help:"lowest allowed strength score, from 0 to 4" env:"MIN_SCORE" default:"2"`
+	BreachCorpus  string `help:"sha-1 corpus of breached passwords, a file or a directory of range files" env:"BREACH_CORPUS"`
+
+	// History and MaxAge depend on the stored passwords of the user, they are enforced by the user service.
+	History int           `help:"number of recent passwords, the current one included, that can't be reused" env:"HISTORY" default:"5"`
+	MaxAge  time.Duration `help:"age after which the password has to be changed at the next login, 0 disables it" env:"MAX_AGE" default:"0"`
+}
+
+type Code string
+
+const (
+	CodeTooShort      Code = "too_short"
+	CodeTooLong       Code = "too_long"
+	CodeMissingLower  Code = "missing_lower"
+	CodeMissingUpper  Code = "missing_upper"
+	CodeMissingDigit  Code = "missing_digit"
+	CodeMissingSymbol Code = "missing_symbol"
+	CodePersonalInfo  Code = "contains_personal_info"
+	CodeTooWeak       Code = "too_weak"
+	CodeBreached      Code = "breached"
+	CodeReused        Code = "reused"
+)
+
+const minPersonalInfoLen = 3
+
+type Violation struct {
+	Code    Code
+	Message string
+}
+
+// ViolationError is returned when the password breaks the policy, it lists every broken rule.
+type ViolationError struct {
+	Violations []Violation
+}
+
+func (e *ViolationError) Error() string {
+	codes := make([]string, 0, len(e.Violations))
+	for _, violation := range e.Violations {
+		codes = append(codes, string(violation.Code))
+	}
+	return fmt.Sprintf("password does not meet the policy: %s", strings.Join(codes, ", "))
+}
+
+type Policy struct {
+	opt    *Option
+	corpus *BreachCorpus
+}
+
+func New(opt *Option) (*Policy, error) {
+	p := &Policy{opt: opt}
+	if opt.BreachCorpus != "" {
+		corpus, err := LoadBreachCorpus(opt.BreachCorpus)
+		if err != nil {
+			return nil, err
+		}
+		p.corpus = corpus
+	}
+	return p, nil
+}
+
+// Validate checks the password of the user, personalInfo is the email and the names it must not contain.
+// It returns a ViolationError when the password is not accepted.
+func (p *Policy) Validate(password string, personalInfo ...string) error {
+	violations := make([]Violation, 0)
+	add := func(code Code, format string, args ...any) {
+		violations = append(violations, Violation{Code: code, Message: fmt.Sprintf(format, args...)})
+	}
+
+	length := utf8.RuneCountInString(password)
+	if length < p.opt.MinLength {
+		add(CodeTooShort, "password must be at least %d characters long", p.opt.MinLength)
+	}
+	if p.opt.MaxLength > 0 && length > p.opt.MaxLength {
+		add(CodeTooLong, "password must be at most %d characters long", p.opt.MaxLength)
+	}
+
+	classes := characterClasses(password)
+	if p.opt.RequireLower && !classes.lower {
+		add(CodeMissingLower, "password must contain a lowercase letter")
+	}
+	if p.opt.RequireUpper && !classes.upper {
+		add(CodeMissingUpper, "password must contain an uppercase letter")
+	}
+	if p.opt.RequireDigit && !classes.digit {
+		add(CodeMissingDigit, "password must contain a digit")
+	}
+	if p.opt.RequireSymbol && !classes.symbol {
+		add(CodeMissingSymbol, "password must contain a symbol")
+	}
+
+	userInputs := personalInputs(personalInfo)
+	lowered := strings.ToLower(password)
+	for _, input := range userInputs {
+		if strings.Contains(lowered, input) {
+			add(CodePersonalInfo, "password must not contain your email or name")
+			break
+		}
+	}
+
+	if score := Score(password, userInputs...); score < p.opt.MinScore {
+		add(CodeTooWeak, "password is too easy to guess")
+	}
+
+	if p.corpus != nil {
+		breached, err := p.corpus.Contains(password)
+		if err != nil {
+			return err
+		}
+		if breached {
+			add(CodeBreached, "password has appeared in a data breach")
+		}
+	}
+
+	if len(violations) > 0 {
+		return &ViolationError{Violations: violations}
+	}
+	return nil
+}
+
+// personalInputs splits the email into its local part and domain, short parts are too common to reject.
+func personalInputs(personalInfo []string) []string {
+	inputs := make([]string, 0, len(personalInfo)*2)
+	for _, info := range personalInfo {
+		info = strings.ToLower(strings.TrimSpace(info))
+		parts := []string{info}
+		if local, domain, ok := strings.Cut(info, "@"); ok {
+			parts = []string{local, strings.Split(domain, ".")[0]}
+		}
+		for _, part := range parts {
+			if utf8.RuneCountInString(part) >= minPersonalInfoLen {
+				inputs = append(inputs, part)
+			}
+		}
+	}
+	return inputs
+}
+
+type classes struct {
+	lower, upper, digit, symbol bool
+}
+
+func characterClasses(password string) classes {
+	var c classes
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			c.lower = true
+		case unicode.IsUpper(r):
+			c.upper = true
+		case unicode.IsDigit(r):
+			c.digit = true
+		default:
+			c.symbol = true
+		}
+	}
+	return c
+}
@@ -0,0 +1,98 @@
+package passwordpolicy
+
+import (
+	"crypto/sha1" //nolint:gosec
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func violationCodes(t *testing.T, err error) []Code {
+	if err == nil {
+		return nil
+	}
+	violationErr, ok := err.(*ViolationError)
+	require.True(t, ok, err)
+	codes := make([]Code, 0, len(violationErr.Violations))
+	for _, violation := range violationErr.Violations {
+		codes = append(codes, violation.Code)
+	}
+	return codes
+}
+
+func TestPolicyValidate(t *testing.T) {
+	p, err := New(&Option{
+		MinLength:    10,
+		MaxLength:    20,
+		RequireUpper: true,
+		RequireDigit: true,
+		MinScore:     2,
+	})
+	require.NoError(t, err)
+
+	tests := []struct {
+		password string
+		want     []Code
+	}{
+		{"kX9#mQ2$vLw", nil},
+		{"kX9#mQ", []Code{CodeTooShort}},
+		{"kX9#mQ2$vLw-kX9#mQ2$vLw", []Code{CodeTooLong}},
+		{"kx9#mq2$vlw", []Code{CodeMissingUpper}},
+		{"Password2023", []Code{CodeTooWeak}},
+		{"Johnsmith#Q7z", []Code{CodePersonalInfo}},
+		{"Oson#Q7zK4mW", []Code{CodePersonalInfo}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.password, func(t *testing.T) {
+			err := p.Validate(tt.password, "js@oson.uz", "Johnsmith", "Doe")
+			require.Equal(t, tt.want, violationCodes(t, err))
+		})
+	}
+}
+
+func TestScore(t *testing.T) {
+	require.Equal(t, 0, Score("password"))
+	require.Equal(t, 0, Score("qwerty123"))
+	require.Equal(t, 0, Score("p@ssw0rd"))
+	require.Less(t, Score("aaaaaaaaaaaa"), 2)
+	require.Less(t, Score("summer2023!"), 3)
+	require.Equal(t, 4, Score("correct horse battery staple"))
+	require.Equal(t, 4, Score("kX9#mQ2$vL"))
+	require.Less(t, Score("kasimov1990", "kasimov"), Score("kasimov1990"))
+}
+
+func hashOf(password string) string {
+	sum := sha1.Sum([]byte(password)) //nolint:gosec
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+func TestBreachCorpus(t *testing.T) {
+	breached := hashOf("kX9#mQ2$vLw")
+	dir := t.TempDir()
+
+	file := filepath.Join(dir, "corpus.txt")
+	require.NoError(t, os.WriteFile(file, []byte(strings.ToLower(breached)+":42\n"+hashOf("other")+":1\n"), 0o600))
+
+	ranges := filepath.Join(dir, "ranges")
+	require.NoError(t, os.Mkdir(ranges, 0o700))
+	require.NoError(t, os.WriteFile(filepath.Join(ranges, breached[:5]+".txt"), []byte(breached[5:]+":42\r\n"), 0o600))
+
+	for _, path := range []string{file, ranges} {
+		corpus, err := LoadBreachCorpus(path)
+		require.NoError(t, err)
+		found, err := corpus.Contains("kX9#mQ2$vLw")
+		require.NoError(t, err)
+		require.True(t, found)
+		found, err = corpus.Contains("kX9#mQ2$vLx")
+		require.NoError(t, err)
+		require.False(t, found)
+	}
+
+	p, err := New(&Option{MinLength: 10, BreachCorpus: file})
+	require.NoError(t, err)
+	require.Equal(t, []Code{CodeBreached}, violationCodes(t, p.Validate("kX9#mQ2$vLw")))
+}
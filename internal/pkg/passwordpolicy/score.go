@@ -0,0 +1,158 @@
+package passwordpolicy
+
+import (
+	"math"
+	"strings"
+)
+
+// commonPasswords are the most used passwords and words they are built from, ranked by popularity.
+var commonPasswords = []string{
+	"password", "123456", "qwerty", "letmein", "welcome", "admin", "iloveyou", "monkey", "dragon",
+	"football", "baseball", "master", "sunshine", "princess", "shadow", "superman", "batman", "trustno1",
+	"starwars", "michael", "jennifer", "jordan", "hunter", "freedom", "whatever", "qazwsx", "ninja",
+	"mustang", "access", "secret", "login", "hello", "charlie", "donald", "flower", "cookie", "summer",
+	"winter", "spring", "autumn", "soccer", "hockey", "killer", "pepper", "ginger", "cheese", "computer",
+	"internet", "samsung", "apple", "google", "orange", "banana", "chocolate", "purple", "silver",
+	"golden", "diamond", "angel", "lovely", "love", "friend", "family", "forever", "matrix", "oracle",
+	"test", "guest", "root", "user", "default", "changeme", "passw0rd", "abc123", "111111", "000000",
+	"john", "david", "james", "robert", "maria", "anna", "alex", "daniel", "thomas", "andrew", "sarah",
+}
+
+// keyboardRows are walked for keyboard patterns like qwerty or asdf.
+var keyboardRows = []string{
+	"`1234567890-=",
+	"qwertyuiop[]\\",
+	"asdfghjkl;'",
+	"zxcvbnm,./",
+}
+
+var leetReplacer = strings.NewReplacer(
+	"4", "a", "@", "a", "3", "e", "1", "i", "!", "i", "0", "o", "$", "s", "5", "s", "7", "t", "+", "t",
+)
+
+// Score estimates how hard the password is to guess on the scale of zxcvbn, from 0, guessed at once,
+// to 4, out of reach of an offline attack. Dictionary words, the user inputs, repeats, sequences and
+// keyboard walks cost the attacker far less than random characters, so they add little to the estimate.
+func Score(password string, userInputs ...string) int {
+	guesses := math.Pow(10, log10Guesses(password, userInputs))
+	switch {
+	case guesses < 1e3:
+		return 0
+	case guesses < 1e6:
+		return 1
+	case guesses < 1e8:
+		return 2
+	case guesses < 1e10:
+		return 3
+	default:
+		return 4
+	}
+}
+
+func log10Guesses(password string, userInputs []string) float64 {
+	runes := []rune(password)
+	if len(runes) == 0 {
+		return 0
+	}
+	normalized := []rune(leetReplacer.Replace(strings.ToLower(password)))
+	if len(normalized) != len(runes) {
+		normalized = []rune(strings.ToLower(password))
+	}
+
+	covered := make([]bool, len(runes))
+	var total float64
+	// years are guessed out of the last two centuries
+	for start := 0; start+4 <= len(runes); start++ {
+		if isYear(runes[start:start+4]) && !anyCovered(covered[start:start+4]) {
+			for i := start; i < start+4; i++ {
+				covered[i] = true
+			}
+			total += math.Log10(200)
+		}
+	}
+
+	// cover the dictionary matches, every match costs about as much as its rank in the list
+	words := make([]string, 0, len(commonPasswords)+len(userInputs))
+	words = append(words, userInputs...)
+	words = append(words, commonPasswords...)
+	for rank, word := range words {
+		wordRunes := []rune(word)
+		for start := 0; start+len(wordRunes) <= len(normalized); start++ {
+			if string(normalized[start:start+len(wordRunes)]) != word || anyCovered(covered[start:start+len(wordRunes)]) {
+				continue
+			}
+			for i := range wordRunes {
+				covered[start+i] = true
+			}
+			// capitalization and substitutions double the candidates to try
+			total += math.Log10(float64(rank+1)) + math.Log10(2)
+		}
+	}
+
+	pool := math.Log10(float64(poolSize(password)))
+	for i, r := range runes {
+		if covered[i] {
+			continue
+		}
+		if i > 0 && !covered[i-1] && predictable(runes[i-1], r) {
+			total += math.Log10(2)
+			continue
+		}
+		total += pool
+	}
+	return total
+}
+
+func isYear(runes []rune) bool {
+	for _, r := range runes {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	year := string(runes)
+	return strings.HasPrefix(year, "19") || strings.HasPrefix(year, "20")
+}
+
+func anyCovered(covered []bool) bool {
+	for _, c := range covered {
+		if c {
+			return true
+		}
+	}
+	return false
+}
+
+// predictable reports whether the character follows the previous one by repeating it,
+// as the next one in a sequence, or as its neighbour on the keyboard.
+func predictable(prev, r rune) bool {
+	if prev == r || r-prev == 1 || prev-r == 1 {
+		return true
+	}
+	prevLower, rLower := strings.ToLower(string(prev)), strings.ToLower(string(r))
+	for _, row := range keyboardRows {
+		i := strings.Index(row, prevLower)
+		j := strings.Index(row, rLower)
+		if i >= 0 && j >= 0 && (i-j == 1 || j-i == 1) {
+			return true
+		}
+	}
+	return false
+}
+
+func poolSize(password string) int {
+	c := characterClasses(password)
+	size := 0
+	if c.lower {
+		size += 26
+	}
+	if c.upper {
+		size += 26
+	}
+	if c.digit {
+		size += 10
+	}
+	if c.symbol {
+		size += 33
+	}
+	return size
+}
@@ -0,0 +1,80 @@
+package testutil
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/require"
+	"github.com/theruziev/oson_auth/internal/pkg/dbx"
+)
+
+// PostgresDSNEnv names the variable with the dsn of the database the tests run on, e.g. the db of docker-compose.yaml.
+const PostgresDSNEnv = "TEST_POSTGRES_DSN"
+
+// NewPostgres gives the test a schema of its own with every migration applied, the schema is dropped when
+// the test ends. The test is skipped when TEST_POSTGRES_DSN is not set.
+func NewPostgres(t *testing.T) *dbx.Dbx {
+	t.Helper()
+	dsn := os.Getenv(PostgresDSNEnv)
+	if dsn == "" {
+		t.Skipf("%s is not set", PostgresDSNEnv)
+	}
+	ctx := context.Background()
+	schema := "test_" + strings.ReplaceAll(uuid.New().String(), "-", "")
+
+	conn, err := pgx.Connect(ctx, dsn)
+	require.NoError(t, err)
+	_, err = conn.Exec(ctx, "create schema "+schema)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_, err := conn.Exec(ctx, "drop schema "+schema+" cascade")
+		require.NoError(t, err)
+		require.NoError(t, conn.Close(ctx))
+	})
+
+	pool := dbx.NewDbx()
+	require.NoError(t, pool.Connect(ctx, withSearchPath(t, dsn, schema)))
+	t.Cleanup(func() {
+		_ = pool.Close(ctx)
+	})
+	migrate(t, pool)
+	return pool
+}
+
+// withSearchPath points the connections of the dsn to the schema, pgx sends unknown parameters to the server.
+func withSearchPath(t *testing.T, dsn, schema string) string {
+	if !strings.HasPrefix(dsn, "postgres://") && !strings.HasPrefix(dsn, "postgresql://") {
+		return dsn + " search_path=" + schema
+	}
+	u, err := url.Parse(dsn)
+	require.NoError(t, err)
+	query := u.Query()
+	query.Set("search_path", schema)
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+func migrate(t *testing.T, pool *dbx.Dbx) {
+	_, file, _, ok := runtime.Caller(0)
+	require.True(t, ok)
+	files, err := filepath.Glob(filepath.Join(filepath.Dir(file), "..", "..", "..", "migrations", "*.up.sql"))
+	require.NoError(t, err)
+	require.NotEmpty(t, files)
+	sort.Strings(files)
+
+	for _, file := range files {
+		migration, err := os.ReadFile(file)
+		require.NoError(t, err)
+		// without arguments pgx runs the migration on the simple protocol, which allows several statements
+		_, err = pool.Exec(context.Background(), string(migration))
+		require.NoError(t, err, filepath.Base(file))
+	}
+}
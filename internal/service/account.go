@@ -0,0 +1,127 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/theruziev/oson_auth/internal/converter/message"
+	"github.com/theruziev/oson_auth/internal/db"
+	"github.com/theruziev/oson_auth/internal/event/constants"
+	"github.com/theruziev/oson_auth/internal/model"
+	"github.com/theruziev/oson_auth/internal/pkg/auth"
+	"github.com/theruziev/oson_auth/internal/pkg/lockout"
+)
+
+const purgeBatchSize = 100
+
+// exportOmitted is told to the user along with the export, so its gaps are not taken for completeness.
+var exportOmitted = []string{
+	"content: content items have no owner, none of them can be attributed to the account",
+}
+
+// DeleteAccount soft deletes the user and signs them out everywhere. The data is kept for the grace
+// period and purged afterwards by the purge command.
+func (s *UserService) DeleteAccount(ctx context.Context, claim *auth.Claim, proof *model.ReauthProof) error {
+	user, err := s.userStore.Get(ctx, claim.PublicID)
+	if err != nil {
+		return err
+	}
+	if err := s.verifyReauth(ctx, claim, user, proof); err != nil {
+		return err
+	}
+
+	err = s.changeStatus(ctx, user, model.UserStatusDeleted, "", func(ctx context.Context) error {
+		if err := s.emailChangeStore.UseAllByUser(ctx, user.ID); err != nil {
+			return err
+		}
+		if err := s.magicLinkStore.UseAllByUser(ctx, user.ID); err != nil {
+			return err
+		}
+		return s.outboxStore.Add(ctx, &model.OutBox{
+			Topic:     constants.TopicUserDeleted,
+			Data:      message.ToUserDeletedEvent(user, user.DeletedAt.Add(s.authOpt.DeletionGracePeriod)),
+			Status:    model.CreatedStatus,
+			CreatedAt: *user.DeletedAt,
+		})
+	})
+	if err != nil {
+		return err
+	}
+	s.audit.Record(ctx, user, model.AuditAccountDeleted, nil)
+	return nil
+}
+
+// ExportData collects everything stored about the user. Password hashes and otp secrets are left
+// out, they are not personal data the user could use and would only weaken the account if leaked.
+func (s *UserService) ExportData(ctx context.Context, publicID string) (*model.UserExport, error) {
+	user, err := s.userStore.Get(ctx, publicID)
+	if err != nil {
+		return nil, err
+	}
+	sessions, err := s.sessionStore.ListByUser(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	apiKeys, err := s.apiKeyStore.ListByUser(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	credentials, err := s.webAuthnStore.ListCredentials(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	emailChanges, err := s.emailChangeStore.ListByUser(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	auditEvents, err := s.audit.ListAllByUser(ctx, user.PublicID)
+	if err != nil {
+		return nil, err
+	}
+	orgs, err := s.organizationStore.ListByUser(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	devices, err := s.trustedDeviceStore.ListByUser(ctx, user.ID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.UserExport{
+		User:                user,
+		Sessions:            sessions,
+		APIKeys:             apiKeys,
+		WebAuthnCredentials: credentials,
+		EmailChanges:        emailChanges,
+		AuditEvents:         auditEvents,
+		Organizations:       orgs,
+		TrustedDevices:      devices,
+		Omitted:             exportOmitted,
+		ExportedAt:          time.Now(),
+	}, nil
+}
+
+// PurgeDeletedAccounts erases the users deleted before the time along with their failed login
+// attempts. It returns the number of purged users.
+func PurgeDeletedAccounts(ctx context.Context, userStore *db.UserStore, limiter *lockout.Limiter, before time.Time) (int, error) {
+	purged := 0
+	for {
+		users, err := userStore.ListDeletedBefore(ctx, before, purgeBatchSize)
+		if err != nil {
+			return purged, err
+		}
+		if len(users) == 0 {
+			return purged, nil
+		}
+		for _, user := range users {
+			if err := limiter.Reset(ctx, lockout.Account(strings.ToLower(user.Email)), twoFASubject(user)); err != nil {
+				return purged, err
+			}
+			if err := userStore.Purge(ctx, user); err != nil {
+				return purged, err
+			}
+			purged++
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/theruziev/oson_auth/internal/event/constants"
+	"github.com/theruziev/oson_auth/internal/model"
+	"github.com/theruziev/oson_auth/internal/pkg/auth"
+	"github.com/theruziev/oson_auth/internal/pkg/dbx"
+	v0 "github.com/theruziev/oson_auth/pkg/events/v0"
+)
+
+func deleteTestAccount(t *testing.T, s *UserService, user *model.User) {
+	t.Helper()
+	require.NoError(t, s.DeleteAccount(context.Background(), signIn(t, s, user), &model.ReauthProof{}))
+}
+
+// loginAttempts counts the failed login attempts kept for the email of the user.
+func loginAttempts(t *testing.T, s *UserService, user *model.User) int {
+	t.Helper()
+	var count int
+	err := s.pool.QueryRow(context.Background(), "select count(*) from login_attempts where position($1 in subject) > 0", strings.ToLower(user.Email)).Scan(&count)
+	require.NoError(t, err)
+	return count
+}
+
+func TestDeleteAccount(t *testing.T) {
+	s := newTestUserService(t)
+	ctx := context.Background()
+	user := newTestUser(t, s)
+	token := login(t, s, user)
+	changeToken := requestEmailChange(t, s, user, "new-"+user.Email)
+
+	deleteTestAccount(t, s, user)
+	deleted := reloadUser(t, s, user)
+	require.Equal(t, model.UserStatusDeleted, deleted.Status)
+	require.NotNil(t, deleted.DeletedAt)
+	var event v0.UserDeletedEvent
+	lastOutboxMessage(t, s, constants.TopicUserDeleted, &event)
+	require.Equal(t, user.PublicID, event.PublicID)
+	require.Equal(t, deleted.DeletedAt.Add(s.authOpt.DeletionGracePeriod).Unix(), event.PurgeAt.Unix())
+	require.Equal(t, model.AuditAccountDeleted, auditTrail(t, s, user)[0])
+
+	_, err := s.RefreshToken(ctx, token.RefreshToken, "")
+	require.Error(t, err)
+	_, err = s.Auth(ctx, user.Email, testPassword, "")
+	require.Error(t, err)
+	require.Error(t, s.ConfirmEmailChange(ctx, changeToken))
+}
+
+func TestPurgeDeletedAccounts(t *testing.T) {
+	o := newTestOrganization(t, model.OrgRoleOwner, model.OrgRoleMember, model.OrgRoleAdmin)
+	s := o.s
+	ctx := context.Background()
+	owner := o.users[model.OrgRoleOwner]
+	admin := o.users[model.OrgRoleAdmin]
+	alone, err := o.service.Create(ctx, signIn(t, s, owner), "solo")
+	require.NoError(t, err)
+	_, err = s.Auth(ctx, owner.Email, "not the password", "")
+	require.Error(t, err)
+	require.Equal(t, 1, loginAttempts(t, s, owner))
+	deleteTestAccount(t, s, owner)
+	deleteTestAccount(t, s, o.users[""])
+	kept := newTestUser(t, s)
+
+	// accounts deleted after the cut off are kept for now
+	purged, err := PurgeDeletedAccounts(ctx, s.userStore, s.limiter, time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+	require.Zero(t, purged)
+
+	purged, err = PurgeDeletedAccounts(ctx, s.userStore, s.limiter, time.Now())
+	require.NoError(t, err)
+	require.Equal(t, 2, purged)
+	_, err = s.userStore.Get(ctx, owner.PublicID)
+	require.True(t, dbx.IsErrNoRows(err), err)
+	_, err = s.userStore.Get(ctx, o.users[""].PublicID)
+	require.True(t, dbx.IsErrNoRows(err), err)
+	reloadUser(t, s, kept)
+	require.Zero(t, loginAttempts(t, s, owner))
+
+	// only the deleted event of the user is left to deliver
+	var topics []string
+	err = s.pool.QueryRow(ctx, "select array_agg(topic) from outbox where msg->>'public_id' = $1", owner.PublicID).Scan(&topics)
+	require.NoError(t, err)
+	require.Equal(t, []string{constants.TopicUserDeleted}, topics)
+
+	// the admin takes over the organization, the one nobody else was in is gone
+	orgs, err := s.organizationStore.ListByUser(ctx, admin.ID)
+	require.NoError(t, err)
+	require.Len(t, orgs, 1)
+	require.Equal(t, model.OrgRoleOwner, orgs[0].Role)
+	_, err = s.organizationStore.Get(ctx, alone.PublicID)
+	require.True(t, dbx.IsErrNoRows(err), err)
+}
+
+func TestExportData(t *testing.T) {
+	o := newTestOrganization(t, model.OrgRoleOwner)
+	s := o.s
+	ctx := context.Background()
+	user := o.users[model.OrgRoleOwner]
+	requestEmailChange(t, s, user, "new-"+user.Email)
+	_, _, err := newTestAPIKeyService(s).Create(ctx, user.PublicID, &model.CreateAPIKeyRequest{
+		Name:   "ci",
+		Scopes: []string{string(auth.ProfileReadScope)},
+	})
+	require.NoError(t, err)
+	trustTestDevice(t, s, user)
+
+	export, err := s.ExportData(ctx, user.PublicID)
+	require.NoError(t, err)
+	require.Equal(t, user.PublicID, export.User.PublicID)
+	sessions, err := s.ListSessions(ctx, user.PublicID)
+	require.NoError(t, err)
+	require.Len(t, export.Sessions, len(sessions))
+	require.Len(t, export.APIKeys, 1)
+	require.Len(t, export.EmailChanges, 1)
+	require.Len(t, export.Organizations, 1)
+	require.Len(t, export.TrustedDevices, 1)
+	require.Empty(t, export.WebAuthnCredentials)
+	require.NotEmpty(t, export.AuditEvents)
+	require.Equal(t, exportOmitted, export.Omitted)
+
+	// nothing of another user gets in
+	other := newTestUser(t, s)
+	export, err = s.ExportData(ctx, other.PublicID)
+	require.NoError(t, err)
+	require.Empty(t, export.Sessions)
+	require.Empty(t, export.APIKeys)
+	require.Empty(t, export.Organizations)
+}
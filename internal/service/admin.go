@@ -0,0 +1,309 @@
+package service
+
+import (
+	"context"
+
+	"github.com/theruziev/oson_auth/internal/converter/message"
+	"github.com/theruziev/oson_auth/internal/db"
+	"github.com/theruziev/oson_auth/internal/event/constants"
+	"github.com/theruziev/oson_auth/internal/model"
+	"github.com/theruziev/oson_auth/internal/pkg/auth"
+	"github.com/theruziev/oson_auth/internal/pkg/dbx"
+	"github.com/theruziev/oson_auth/internal/pkg/errz"
+	v0 "github.com/theruziev/oson_auth/pkg/events/v0"
+)
+
+const (
+	defaultUserListLimit = 50
+	maxUserListLimit     = 200
+)
+
+// AdminService runs the support actions on the accounts of users. Every action is recorded
+// in the audit log of the user with the admin who made it, and announced through the outbox.
+type AdminService struct {
+	userService   *UserService
+	userStore     *db.UserStore
+	webAuthnStore *db.WebAuthnStore
+	roleStore     *db.RoleStore
+	outboxStore   *db.OutBoxStore
+	audit         *AuditService
+}
+
+func NewAdminService(
+	userService *UserService,
+	userStore *db.UserStore,
+	webAuthnStore *db.WebAuthnStore,
+	roleStore *db.RoleStore,
+	outboxStore *db.OutBoxStore,
+	audit *AuditService,
+) *AdminService {
+	return &AdminService{
+		userService:   userService,
+		userStore:     userStore,
+		webAuthnStore: webAuthnStore,
+		roleStore:     roleStore,
+		outboxStore:   outboxStore,
+		audit:         audit,
+	}
+}
+
+// ListUsers returns a page of the users matching the filter and the number of all matching users.
+func (s *AdminService) ListUsers(ctx context.Context, filter *model.UserFilter) ([]*model.User, uint64, error) {
+	if filter.Limit == 0 {
+		filter.Limit = defaultUserListLimit
+	}
+	if filter.Limit > maxUserListLimit {
+		filter.Limit = maxUserListLimit
+	}
+	users, err := s.userStore.List(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+	total, err := s.userStore.Count(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+	return users, total, nil
+}
+
+// GetUser returns the user with the roles, looking at the personal data of a user is recorded as well.
+func (s *AdminService) GetUser(ctx context.Context, claim *auth.Claim, publicID string) (*model.User, []*model.Role, error) {
+	user, err := s.getUser(ctx, publicID)
+	if err != nil {
+		return nil, nil, err
+	}
+	roles, err := s.roleStore.ListByUser(ctx, user.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	s.audit.Record(ctx, user, model.AuditAdminUserViewed, map[string]string{"actor": claim.PublicID})
+	return user, roles, nil
+}
+
+func (s *AdminService) ListRoles(ctx context.Context) ([]*model.Role, error) {
+	return s.roleStore.List(ctx)
+}
+
+// GrantRole grants the role to the user, the permissions come with the next refresh of the token.
+func (s *AdminService) GrantRole(ctx context.Context, claim *auth.Claim, publicID, roleName string) error {
+	user, role, err := s.getUserAndRole(ctx, claim, publicID, roleName)
+	if err != nil {
+		return err
+	}
+
+	return s.userService.inTx(ctx, func(ctx context.Context) error {
+		if err := s.roleStore.Assign(ctx, user.ID, role.ID); err != nil {
+			return err
+		}
+		event := message.ToUserAdminActionEvent(user, v0.AdminActionGrantRole, claim.PublicID)
+		event.Role = role.Name
+		return s.recordAction(ctx, claim, user, event)
+	})
+}
+
+// RevokeRole takes the role from the user. The access tokens of the user are revoked as they carry the
+// permissions of the role, the next refresh issues a token without them.
+func (s *AdminService) RevokeRole(ctx context.Context, claim *auth.Claim, publicID, roleName string) error {
+	user, role, err := s.getUserAndRole(ctx, claim, publicID, roleName)
+	if err != nil {
+		return err
+	}
+
+	return s.userService.inTx(ctx, func(ctx context.Context) error {
+		found, err := s.roleStore.Unassign(ctx, user.ID, role.ID)
+		if err != nil {
+			return err
+		}
+		if !found {
+			return errz.NotFoundErr.New("user doesn't have the role")
+		}
+		if err := s.userService.tokenRevoker.RevokeAllTokens(ctx, user.PublicID); err != nil {
+			return err
+		}
+		event := message.ToUserAdminActionEvent(user, v0.AdminActionRevokeRole, claim.PublicID)
+		event.Role = role.Name
+		return s.recordAction(ctx, claim, user, event)
+	})
+}
+
+// getUserAndRole loads both sides of a role change, admins can't change their own roles
+// so nobody grants themselves more or locks everybody out by accident.
+func (s *AdminService) getUserAndRole(ctx context.Context, claim *auth.Claim, publicID, roleName string) (*model.User, *model.Role, error) {
+	if publicID == claim.PublicID {
+		return nil, nil, errz.BadRequestErr.New("admins can't change their own roles")
+	}
+	user, err := s.getUser(ctx, publicID)
+	if err != nil {
+		return nil, nil, err
+	}
+	role, err := s.roleStore.GetByName(ctx, roleName)
+	if err != nil {
+		if dbx.IsErrNoRows(err) {
+			return nil, nil, errz.NotFoundErr.New("role not found")
+		}
+		return nil, nil, err
+	}
+	return user, role, nil
+}
+
+// Activate activates the user without the activation link.
+func (s *AdminService) Activate(ctx context.Context, claim *auth.Claim, publicID string) error {
+	user, err := s.getUser(ctx, publicID)
+	if err != nil {
+		return err
+	}
+	if user.Status != model.UserStatusRegistered {
+		return errz.BadRequestErr.New("user is not waiting for activation")
+	}
+
+	event := message.ToUserAdminActionEvent(user, v0.AdminActionActivate, claim.PublicID)
+	return s.userService.changeStatus(ctx, user, model.UserStatusActivate, "", func(ctx context.Context) error {
+		return s.recordAction(ctx, claim, user, event)
+	})
+}
+
+// ResetPassword sends the user a password reset email, the current password keeps working until it is reset.
+func (s *AdminService) ResetPassword(ctx context.Context, claim *auth.Claim, publicID string) error {
+	user, err := s.getUser(ctx, publicID)
+	if err != nil {
+		return err
+	}
+	if user.Status != model.UserStatusActivate {
+		return errz.BadRequestErr.New("user not active")
+	}
+	if err := s.userService.ResetPasswordRequest(ctx, user.Email); err != nil {
+		return err
+	}
+	return s.recordAction(ctx, claim, user, message.ToUserAdminActionEvent(user, v0.AdminActionResetPassword, claim.PublicID))
+}
+
+// Disable suspends the user and signs them out everywhere.
+func (s *AdminService) Disable(ctx context.Context, claim *auth.Claim, publicID, reason string) error {
+	return s.restrict(ctx, claim, publicID, model.UserStatusSuspended, v0.AdminActionDisable, reason)
+}
+
+// Lock locks the user out after a security incident, like a suspension it signs them out everywhere.
+func (s *AdminService) Lock(ctx context.Context, claim *auth.Claim, publicID, reason string) error {
+	return s.restrict(ctx, claim, publicID, model.UserStatusLocked, v0.AdminActionLock, reason)
+}
+
+// Enable lifts the suspension or the lock, a user who never activated the account has to activate it still.
+func (s *AdminService) Enable(ctx context.Context, claim *auth.Claim, publicID string) error {
+	user, err := s.getUser(ctx, publicID)
+	if err != nil {
+		return err
+	}
+	if user.Status != model.UserStatusSuspended && user.Status != model.UserStatusLocked {
+		return errz.BadRequestErr.New("user is not disabled")
+	}
+	status := model.UserStatusActivate
+	if user.ActivationCode != "" {
+		status = model.UserStatusRegistered
+	}
+
+	event := message.ToUserAdminActionEvent(user, v0.AdminActionEnable, claim.PublicID)
+	return s.userService.changeStatus(ctx, user, status, "", func(ctx context.Context) error {
+		return s.recordAction(ctx, claim, user, event)
+	})
+}
+
+// restrict takes the access away from the user, admins can't do it to themselves.
+func (s *AdminService) restrict(
+	ctx context.Context,
+	claim *auth.Claim,
+	publicID string,
+	status model.UserStatus,
+	action v0.AdminAction,
+	reason string,
+) error {
+	if publicID == claim.PublicID {
+		return errz.BadRequestErr.New("admins can't %s themselves", action)
+	}
+	user, err := s.getUser(ctx, publicID)
+	if err != nil {
+		return err
+	}
+
+	event := message.ToUserAdminActionEvent(user, action, claim.PublicID)
+	event.Reason = reason
+	return s.userService.changeStatus(ctx, user, status, reason, func(ctx context.Context) error {
+		return s.recordAction(ctx, claim, user, event)
+	})
+}
+
+// ResetTwoFA removes every second factor of the user, otp and passkeys, for users who lost them.
+// The trusted devices are forgotten too, they skip a second factor the user no longer has.
+// The user signs in with the password alone until a second factor is enrolled again.
+func (s *AdminService) ResetTwoFA(ctx context.Context, claim *auth.Claim, publicID string) error {
+	user, err := s.getUser(ctx, publicID)
+	if err != nil {
+		return err
+	}
+
+	err = s.userService.inTx(ctx, func(ctx context.Context) error {
+		if err := s.userStore.ResetOtp(ctx, user.PublicID); err != nil {
+			return err
+		}
+		if err := s.webAuthnStore.DeleteAllCredentials(ctx, user.ID); err != nil {
+			return err
+		}
+		if err := s.userService.recoveryCodeStore.DeleteByUser(ctx, user.ID); err != nil {
+			return err
+		}
+		if err := s.userService.trustedDeviceStore.RevokeAllByUser(ctx, user.ID); err != nil {
+			return err
+		}
+		return s.recordAction(ctx, claim, user, message.ToUserAdminActionEvent(user, v0.AdminActionResetTwoFA, claim.PublicID))
+	})
+	if err != nil {
+		return err
+	}
+	return s.userService.limiter.Reset(ctx, twoFASubject(user))
+}
+
+// RevokeSessions signs the user out everywhere.
+func (s *AdminService) RevokeSessions(ctx context.Context, claim *auth.Claim, publicID string) error {
+	user, err := s.getUser(ctx, publicID)
+	if err != nil {
+		return err
+	}
+	if err := s.userService.revokeAllSessions(ctx, user); err != nil {
+		return err
+	}
+	return s.recordAction(ctx, claim, user, message.ToUserAdminActionEvent(user, v0.AdminActionRevokeSessions, claim.PublicID))
+}
+
+func (s *AdminService) getUser(ctx context.Context, publicID string) (*model.User, error) {
+	user, err := s.userStore.Get(ctx, publicID)
+	if err != nil {
+		if dbx.IsErrNoRows(err) {
+			return nil, errz.NotFoundErr.New("user not found")
+		}
+		return nil, err
+	}
+	return user, nil
+}
+
+// recordAction announces the action and records it in the audit log of the user. It mostly runs in the
+// transaction of the action, an action that can't be recorded doesn't happen.
+func (s *AdminService) recordAction(ctx context.Context, claim *auth.Claim, user *model.User, event *v0.UserAdminActionEvent) error {
+	if err := s.outboxStore.Add(ctx, &model.OutBox{
+		Topic:     constants.TopicUserAdminAction,
+		Data:      event,
+		Status:    model.CreatedStatus,
+		CreatedAt: event.CreatedAt,
+	}); err != nil {
+		return err
+	}
+	metadata := map[string]string{
+		"action": string(event.Action),
+		"actor":  claim.PublicID,
+	}
+	if event.Role != "" {
+		metadata["role"] = event.Role
+	}
+	if event.Reason != "" {
+		metadata["reason"] = event.Reason
+	}
+	return s.audit.Write(ctx, user, model.AuditAdminAction, metadata)
+}
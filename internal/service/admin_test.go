@@ -0,0 +1,164 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/theruziev/oson_auth/internal/event/constants"
+	"github.com/theruziev/oson_auth/internal/model"
+	"github.com/theruziev/oson_auth/internal/pkg/auth"
+	"github.com/theruziev/oson_auth/internal/pkg/errz"
+	v0 "github.com/theruziev/oson_auth/pkg/events/v0"
+)
+
+func newTestAdminService(s *UserService) *AdminService {
+	return NewAdminService(s, s.userStore, s.webAuthnStore, s.roleStore, s.outboxStore, s.audit)
+}
+
+// adminActions lists the admin actions recorded in the audit log of the user, the latest first.
+func adminActions(t *testing.T, s *UserService, user *model.User) []map[string]string {
+	t.Helper()
+	events, err := s.audit.List(context.Background(), &model.AuditEventFilter{
+		UserPublicID: user.PublicID,
+		Types:        []model.AuditEventType{model.AuditAdminAction},
+	})
+	require.NoError(t, err)
+	actions := make([]map[string]string, 0, len(events))
+	for _, event := range events {
+		actions = append(actions, event.Metadata)
+	}
+	return actions
+}
+
+func TestAdminCantActOnThemselves(t *testing.T) {
+	s := newTestUserService(t)
+	admin := newTestAdminService(s)
+	ctx := context.Background()
+	actor := newTestUser(t, s)
+	claim := signIn(t, s, actor)
+
+	err := admin.GrantRole(ctx, claim, actor.PublicID, "admin")
+	require.True(t, errz.BadRequestErr.Is(err), err)
+	err = admin.RevokeRole(ctx, claim, actor.PublicID, "admin")
+	require.True(t, errz.BadRequestErr.Is(err), err)
+	err = admin.Disable(ctx, claim, actor.PublicID, "testing")
+	require.True(t, errz.BadRequestErr.Is(err), err)
+	err = admin.Lock(ctx, claim, actor.PublicID, "testing")
+	require.True(t, errz.BadRequestErr.Is(err), err)
+	require.Equal(t, model.UserStatusActivate, reloadUser(t, s, actor).Status)
+	require.Empty(t, adminActions(t, s, actor))
+	requireRevoked(t, s.tokenRevoker, claim, false)
+}
+
+func TestAdminDisable(t *testing.T) {
+	s := newTestUserService(t)
+	admin := newTestAdminService(s)
+	ctx := context.Background()
+	actor := newTestUser(t, s)
+	claim := signIn(t, s, actor)
+	user := newTestUser(t, s)
+	userClaim := signIn(t, s, user)
+
+	require.NoError(t, admin.Disable(ctx, claim, user.PublicID, "spam"))
+	require.Equal(t, model.UserStatusSuspended, reloadUser(t, s, user).Status)
+	require.Equal(t, []map[string]string{{
+		"action": "disable",
+		"actor":  actor.PublicID,
+		"reason": "spam",
+	}}, adminActions(t, s, user))
+	var event v0.UserAdminActionEvent
+	lastOutboxMessage(t, s, constants.TopicUserAdminAction, &event)
+	require.Equal(t, user.PublicID, event.PublicID)
+	require.Equal(t, v0.AdminActionDisable, event.Action)
+	require.Equal(t, actor.PublicID, event.ActorPublicID)
+	// the user is signed out everywhere
+	requireRevoked(t, s.tokenRevoker, userClaim, true)
+	sessions, err := s.ListSessions(ctx, user.PublicID)
+	require.NoError(t, err)
+	require.Empty(t, sessions)
+
+	// a disabled user can't be disabled again, but can be enabled
+	err = admin.Disable(ctx, claim, user.PublicID, "spam")
+	require.True(t, errz.BadRequestErr.Is(err), err)
+	require.NoError(t, admin.Enable(ctx, claim, user.PublicID))
+	require.Equal(t, model.UserStatusActivate, reloadUser(t, s, user).Status)
+	err = admin.Enable(ctx, claim, user.PublicID)
+	require.True(t, errz.BadRequestErr.Is(err), err)
+	login(t, s, user)
+}
+
+func TestAdminActionFailsWithoutAudit(t *testing.T) {
+	s := newTestUserService(t)
+	admin := newTestAdminService(s)
+	ctx := context.Background()
+	claim := signIn(t, s, newTestUser(t, s))
+	user := newTestUser(t, s)
+	enrollTestOtp(t, s, user)
+	_, err := s.pool.Exec(ctx, "drop table audit_events")
+	require.NoError(t, err)
+
+	// the action runs in the transaction of its audit event, it can't happen unrecorded
+	require.Error(t, admin.ResetTwoFA(ctx, claim, user.PublicID))
+	require.Error(t, admin.Disable(ctx, claim, user.PublicID, "spam"))
+	unchanged := reloadUser(t, s, user)
+	require.True(t, unchanged.OtpEnabled)
+	require.Equal(t, model.UserStatusActivate, unchanged.Status)
+	pending, err := s.Auth(ctx, user.Email, testPassword, "")
+	require.NoError(t, err)
+	require.True(t, pending.TwoFARequired)
+}
+
+func TestAdminListUsers(t *testing.T) {
+	s := newTestUserService(t)
+	admin := newTestAdminService(s)
+	ctx := context.Background()
+	claim := signIn(t, s, newTestUser(t, s))
+	users := []*model.User{newTestUser(t, s), newTestUser(t, s), newTestUser(t, s)}
+	require.NoError(t, admin.Disable(ctx, claim, users[0].PublicID, "spam"))
+
+	suspended, total, err := admin.ListUsers(ctx, &model.UserFilter{Status: model.UserStatusSuspended})
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), total)
+	require.Equal(t, users[0].PublicID, suspended[0].PublicID)
+
+	// the latest registered come first, the total counts every page
+	page, total, err := admin.ListUsers(ctx, &model.UserFilter{Query: "example.com", Limit: 2, Offset: 1})
+	require.NoError(t, err)
+	require.Equal(t, uint64(4), total)
+	require.Len(t, page, 2)
+	require.Equal(t, users[1].PublicID, page[0].PublicID)
+	require.Equal(t, users[0].PublicID, page[1].PublicID)
+
+	// the wildcards of the query match literally
+	_, total, err = admin.ListUsers(ctx, &model.UserFilter{Query: "%"})
+	require.NoError(t, err)
+	require.Zero(t, total)
+	found, _, err := admin.ListUsers(ctx, &model.UserFilter{Query: strings.ToUpper(users[2].Email)})
+	require.NoError(t, err)
+	require.Len(t, found, 1)
+	require.Equal(t, users[2].PublicID, found[0].PublicID)
+}
+
+func TestAdminRevokeRole(t *testing.T) {
+	s := newTestUserService(t)
+	admin := newTestAdminService(s)
+	ctx := context.Background()
+	claim := signIn(t, s, newTestUser(t, s))
+	user := newTestUser(t, s)
+
+	require.NoError(t, admin.GrantRole(ctx, claim, user.PublicID, "moderator"))
+	moderator := signIn(t, s, user)
+	require.True(t, moderator.HasPermission(auth.ContentModeratePermission))
+
+	// the tokens carry the permissions of the role, they stop working with it
+	require.NoError(t, admin.RevokeRole(ctx, claim, user.PublicID, "moderator"))
+	requireRevoked(t, s.tokenRevoker, moderator, true)
+	require.False(t, signIn(t, s, user).HasPermission(auth.ContentModeratePermission))
+
+	err := admin.RevokeRole(ctx, claim, user.PublicID, "moderator")
+	require.True(t, errz.NotFoundErr.Is(err), err)
+	err = admin.RevokeRole(ctx, claim, user.PublicID, "no such role")
+	require.True(t, errz.NotFoundErr.Is(err), err)
+}
@@ -0,0 +1,150 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/theruziev/oson_auth/internal/db"
+	"github.com/theruziev/oson_auth/internal/model"
+	"github.com/theruziev/oson_auth/internal/pkg/auth"
+	"github.com/theruziev/oson_auth/internal/pkg/dbx"
+	"github.com/theruziev/oson_auth/internal/pkg/errz"
+)
+
+const (
+	// apiKeyPrefix makes leaked keys easy to find by secret scanners.
+	apiKeyPrefix = "oson_"
+	// apiKeyDisplayLength is how much of the key is kept in clear text to tell keys apart.
+	apiKeyDisplayLength = len(apiKeyPrefix) + 6
+	// apiKeyTouchInterval limits how often last_used_at is written for a busy key.
+	apiKeyTouchInterval = time.Minute
+)
+
+type APIKeyService struct {
+	apiKeyStore *db.APIKeyStore
+	userStore   *db.UserStore
+}
+
+func NewAPIKeyService(apiKeyStore *db.APIKeyStore, userStore *db.UserStore) *APIKeyService {
+	return &APIKeyService{
+		apiKeyStore: apiKeyStore,
+		userStore:   userStore,
+	}
+}
+
+// Create stores a new key for the user. The key itself is returned only here and can't be recovered later.
+func (s *APIKeyService) Create(ctx context.Context, publicID string, req *model.CreateAPIKeyRequest) (*model.APIKey, string, error) {
+	if len(req.Scopes) == 0 {
+		return nil, "", errz.BadRequestErr.New("at least one scope is required")
+	}
+	for _, scp := range req.Scopes {
+		if !auth.IsAPIKeyScope(auth.Scope(scp)) {
+			return nil, "", errz.BadRequestErr.New("scope %q can't be granted to api keys", scp)
+		}
+	}
+	now := time.Now()
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(now) {
+		return nil, "", errz.BadRequestErr.New("expiry must be in the future")
+	}
+
+	user, err := s.userStore.Get(ctx, publicID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	token, _, err := auth.NewOpaqueToken()
+	if err != nil {
+		return nil, "", err
+	}
+	key := apiKeyPrefix + token
+	apiKey := &model.APIKey{
+		PublicID:  uuid.New().String(),
+		UserID:    user.ID,
+		Name:      req.Name,
+		TokenHash: auth.HashOpaqueToken(key),
+		Prefix:    key[:apiKeyDisplayLength],
+		Scopes:    req.Scopes,
+		ExpiresAt: req.ExpiresAt,
+		CreatedAt: now,
+	}
+	if err := s.apiKeyStore.Insert(ctx, apiKey); err != nil {
+		return nil, "", fmt.Errorf("failed to create api key: %w", err)
+	}
+
+	return apiKey, key, nil
+}
+
+func (s *APIKeyService) List(ctx context.Context, publicID string) ([]*model.APIKey, error) {
+	user, err := s.userStore.Get(ctx, publicID)
+	if err != nil {
+		return nil, err
+	}
+	return s.apiKeyStore.ListByUser(ctx, user.ID)
+}
+
+func (s *APIKeyService) Revoke(ctx context.Context, publicID, keyID string) error {
+	user, err := s.userStore.Get(ctx, publicID)
+	if err != nil {
+		return err
+	}
+	if _, err := uuid.Parse(keyID); err != nil {
+		return errz.NotFoundErr.New("api key not found")
+	}
+	found, err := s.apiKeyStore.Revoke(ctx, user.ID, keyID)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return errz.NotFoundErr.New("api key not found")
+	}
+	return nil
+}
+
+// VerifyAPIKey implements auth.APIKeyVerifier.
+func (s *APIKeyService) VerifyAPIKey(ctx context.Context, key string) (*auth.Claim, error) {
+	if !strings.HasPrefix(key, apiKeyPrefix) {
+		return nil, fmt.Errorf("malformed api key")
+	}
+	apiKey, err := s.apiKeyStore.GetByHash(ctx, auth.HashOpaqueToken(key))
+	if err != nil {
+		if dbx.IsErrNoRows(err) {
+			return nil, fmt.Errorf("unknown api key")
+		}
+		return nil, err
+	}
+	now := time.Now()
+	if !apiKey.IsActive(now) {
+		return nil, fmt.Errorf("api key is not active")
+	}
+
+	user, err := s.userStore.GetByID(ctx, apiKey.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if user.Status != model.UserStatusActivate {
+		return nil, fmt.Errorf("user not active")
+	}
+
+	if apiKey.LastUsedAt == nil || now.Sub(*apiKey.LastUsedAt) > apiKeyTouchInterval {
+		if err := s.apiKeyStore.Touch(ctx, apiKey.ID, now); err != nil {
+			return nil, err
+		}
+	}
+
+	scopes := make([]auth.Scope, 0, len(apiKey.Scopes))
+	for _, scp := range apiKey.Scopes {
+		// a scope that can't be granted anymore is not honoured either
+		if auth.IsAPIKeyScope(auth.Scope(scp)) {
+			scopes = append(scopes, auth.Scope(scp))
+		}
+	}
+	return &auth.Claim{
+		PublicID: user.PublicID,
+		Email:    user.Email,
+		Scopes:   scopes,
+		APIKeyID: apiKey.PublicID,
+	}, nil
+}
@@ -0,0 +1,124 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"github.com/theruziev/oson_auth/internal/model"
+	"github.com/theruziev/oson_auth/internal/pkg/auth"
+	"github.com/theruziev/oson_auth/internal/pkg/errz"
+)
+
+func newTestAPIKeyService(s *UserService) *APIKeyService {
+	return NewAPIKeyService(s.apiKeyStore, s.userStore)
+}
+
+func TestCreateAPIKey(t *testing.T) {
+	past := time.Now().Add(-time.Minute)
+	tests := []struct {
+		name string
+		req  *model.CreateAPIKeyRequest
+		err  *errz.CustomError
+	}{
+		{name: "no scope", req: &model.CreateAPIKeyRequest{Name: "ci"}, err: errz.BadRequestErr},
+		{name: "user scope", req: &model.CreateAPIKeyRequest{Name: "ci", Scopes: []string{string(auth.UserScope)}}, err: errz.BadRequestErr},
+		{name: "expired", req: &model.CreateAPIKeyRequest{Name: "ci", Scopes: []string{string(auth.ProfileReadScope)}, ExpiresAt: &past}, err: errz.BadRequestErr},
+		{name: "profile scope", req: &model.CreateAPIKeyRequest{Name: "ci", Scopes: []string{string(auth.ProfileReadScope)}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestUserService(t)
+			apiKeys := newTestAPIKeyService(s)
+			ctx := context.Background()
+			user := newTestUser(t, s)
+
+			apiKey, key, err := apiKeys.Create(ctx, user.PublicID, tt.req)
+			if tt.err != nil {
+				require.True(t, tt.err.Is(err), err)
+				keys, err := apiKeys.List(ctx, user.PublicID)
+				require.NoError(t, err)
+				require.Empty(t, keys)
+				return
+			}
+			require.NoError(t, err)
+			require.True(t, len(key) > apiKeyDisplayLength)
+			require.Equal(t, key[:apiKeyDisplayLength], apiKey.Prefix)
+			require.NotContains(t, apiKey.TokenHash, key)
+
+			claim, err := apiKeys.VerifyAPIKey(ctx, key)
+			require.NoError(t, err)
+			require.Equal(t, user.PublicID, claim.PublicID)
+			require.Equal(t, apiKey.PublicID, claim.APIKeyID)
+			require.Equal(t, []auth.Scope{auth.ProfileReadScope}, claim.Scopes)
+		})
+	}
+}
+
+func TestVerifyAPIKey(t *testing.T) {
+	s := newTestUserService(t)
+	apiKeys := newTestAPIKeyService(s)
+	ctx := context.Background()
+	user := newTestUser(t, s)
+
+	_, err := apiKeys.VerifyAPIKey(ctx, "not a key")
+	require.Error(t, err)
+	_, err = apiKeys.VerifyAPIKey(ctx, apiKeyPrefix+"unknown")
+	require.Error(t, err)
+
+	// a key stored with the user scope before it was narrowed keeps only the scopes it may hold
+	token, _, err := auth.NewOpaqueToken()
+	require.NoError(t, err)
+	key := apiKeyPrefix + token
+	require.NoError(t, s.apiKeyStore.Insert(ctx, &model.APIKey{
+		PublicID:  uuid.New().String(),
+		UserID:    user.ID,
+		Name:      "legacy",
+		TokenHash: auth.HashOpaqueToken(key),
+		Prefix:    key[:apiKeyDisplayLength],
+		Scopes:    []string{string(auth.UserScope), string(auth.ProfileReadScope)},
+		CreatedAt: time.Now(),
+	}))
+	claim, err := apiKeys.VerifyAPIKey(ctx, key)
+	require.NoError(t, err)
+	require.Equal(t, []auth.Scope{auth.ProfileReadScope}, claim.Scopes)
+	keys, err := apiKeys.List(ctx, user.PublicID)
+	require.NoError(t, err)
+	require.Len(t, keys, 1)
+	require.NotNil(t, keys[0].LastUsedAt)
+
+	// the keys of a suspended user stop working with the user
+	require.NoError(t, s.changeStatus(ctx, user, model.UserStatusSuspended, "abuse", nil))
+	_, err = apiKeys.VerifyAPIKey(ctx, key)
+	require.Error(t, err)
+}
+
+func TestRevokeAPIKey(t *testing.T) {
+	s := newTestUserService(t)
+	apiKeys := newTestAPIKeyService(s)
+	ctx := context.Background()
+	user := newTestUser(t, s)
+	apiKey, key, err := apiKeys.Create(ctx, user.PublicID, &model.CreateAPIKeyRequest{
+		Name:   "ci",
+		Scopes: []string{string(auth.ProfileReadScope)},
+	})
+	require.NoError(t, err)
+	stranger := newTestUser(t, s)
+
+	err = apiKeys.Revoke(ctx, user.PublicID, "not a uuid")
+	require.True(t, errz.NotFoundErr.Is(err), err)
+	err = apiKeys.Revoke(ctx, user.PublicID, uuid.New().String())
+	require.True(t, errz.NotFoundErr.Is(err), err)
+	err = apiKeys.Revoke(ctx, stranger.PublicID, apiKey.PublicID)
+	require.True(t, errz.NotFoundErr.Is(err), err)
+	_, err = apiKeys.VerifyAPIKey(ctx, key)
+	require.NoError(t, err)
+
+	require.NoError(t, apiKeys.Revoke(ctx, user.PublicID, apiKey.PublicID))
+	_, err = apiKeys.VerifyAPIKey(ctx, key)
+	require.Error(t, err)
+	err = apiKeys.Revoke(ctx, user.PublicID, apiKey.PublicID)
+	require.True(t, errz.NotFoundErr.Is(err), err)
+}
@@ -0,0 +1,97 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/theruziev/oson_auth/internal/db"
+	"github.com/theruziev/oson_auth/internal/model"
+	"github.com/theruziev/oson_auth/internal/pkg/clientinfo"
+	"github.com/theruziev/oson_auth/internal/pkg/logging"
+)
+
+const (
+	defaultAuditListLimit = 50
+	maxAuditListLimit     = 500
+)
+
+type AuditService struct {
+	auditStore *db.AuditEventStore
+}
+
+func NewAuditService(auditStore *db.AuditEventStore) *AuditService {
+	return &AuditService{
+		auditStore: auditStore,
+	}
+}
+
+// Record stores the event along with the client of the request, user is nil when the user is unknown.
+// The action being recorded has already happened, so a failure is logged instead of returned.
+// Events recorded in the transaction of their action go through Write instead.
+func (s *AuditService) Record(ctx context.Context, user *model.User, eventType model.AuditEventType, metadata map[string]string) {
+	if err := s.Write(ctx, user, eventType, metadata); err != nil {
+		logging.FromContext(ctx).Errorf("failed to record audit event %s: %s", eventType, err)
+	}
+}
+
+// Write stores the event like Record but returns the failure. A failed insert aborts the transaction
+// on the context, so the action has to fail with it instead of committing without its event.
+func (s *AuditService) Write(ctx context.Context, user *model.User, eventType model.AuditEventType, metadata map[string]string) error {
+	info := clientinfo.FromContext(ctx)
+	event := &model.AuditEvent{
+		Type:      eventType,
+		IP:        info.IP,
+		UserAgent: info.UserAgent,
+		RequestID: info.RequestID,
+		Metadata:  metadata,
+		CreatedAt: time.Now(),
+	}
+	if user != nil {
+		event.UserID = &user.ID
+	}
+	return s.auditStore.Insert(ctx, event)
+}
+
+// ListByUser returns the events of the user, the latest first.
+func (s *AuditService) ListByUser(ctx context.Context, publicID string, beforeID, limit uint64) ([]*model.AuditEvent, error) {
+	return s.List(ctx, &model.AuditEventFilter{
+		UserPublicID: publicID,
+		BeforeID:     beforeID,
+		Limit:        limit,
+	})
+}
+
+// ListAllByUser returns every event of the user, page by page.
+func (s *AuditService) ListAllByUser(ctx context.Context, publicID string) ([]*model.AuditEvent, error) {
+	events := make([]*model.AuditEvent, 0)
+	var beforeID uint64
+	for {
+		page, err := s.ListByUser(ctx, publicID, beforeID, maxAuditListLimit)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, page...)
+		if len(page) < maxAuditListLimit {
+			return events, nil
+		}
+		beforeID = page[len(page)-1].ID
+	}
+}
+
+func (s *AuditService) List(ctx context.Context, filter *model.AuditEventFilter) ([]*model.AuditEvent, error) {
+	if filter.Limit == 0 {
+		filter.Limit = defaultAuditListLimit
+	}
+	if filter.Limit > maxAuditListLimit {
+		filter.Limit = maxAuditListLimit
+	}
+	return s.auditStore.List(ctx, filter)
+}
+
+func auditReason(reason string) map[string]string {
+	return map[string]string{"reason": reason}
+}
+
+func auditMethod(method string) map[string]string {
+	return map[string]string{"method": method}
+}
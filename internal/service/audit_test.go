@@ -0,0 +1,111 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/theruziev/oson_auth/internal/model"
+	"github.com/theruziev/oson_auth/internal/pkg/clientinfo"
+)
+
+func TestAuditRecordsTheClient(t *testing.T) {
+	s := newTestUserService(t)
+	user := newTestUser(t, s)
+	ctx := clientinfo.WithInfo(context.Background(), &clientinfo.Info{
+		IP:        "203.0.113.7",
+		UserAgent: "curl/8.0",
+		RequestID: "req-1",
+	})
+
+	_, err := s.Auth(ctx, user.Email, "not the password", "")
+	require.Error(t, err)
+	_, err = s.Auth(ctx, "nobody@example.com", testPassword, "")
+	require.Error(t, err)
+	_, err = s.Auth(ctx, user.Email, testPassword, "")
+	require.NoError(t, err)
+
+	events, err := s.audit.List(ctx, &model.AuditEventFilter{IP: "203.0.113.7"})
+	require.NoError(t, err)
+	require.Len(t, events, 3)
+	require.Equal(t, model.AuditLoginSucceeded, events[0].Type)
+	require.Equal(t, user.PublicID, events[0].UserPublicID)
+	// an unknown email can't be tied to a user
+	require.Equal(t, model.AuditLoginFailed, events[1].Type)
+	require.Nil(t, events[1].UserID)
+	require.Equal(t, model.AuditLoginFailed, events[2].Type)
+	require.Equal(t, user.PublicID, events[2].UserPublicID)
+	for _, event := range events {
+		require.Equal(t, "curl/8.0", event.UserAgent)
+		require.Equal(t, "req-1", event.RequestID)
+	}
+}
+
+func TestAuditTrailOfAccount(t *testing.T) {
+	s := newTestUserService(t)
+	ctx := context.Background()
+	user := newTestUser(t, s)
+	require.NoError(t, s.ChangePassword(ctx, signIn(t, s, user), "another passphrase", &model.ReauthProof{}))
+	secret, _ := enrollTestOtp(t, s, user)
+	pending, err := s.Auth(ctx, user.Email, "another passphrase", "")
+	require.NoError(t, err)
+	_, err = s.AuthTwoFA(ctx, parseToken(t, s, pending.AuthToken), otpCode(t, secret), false)
+	require.NoError(t, err)
+
+	require.Equal(t, []model.AuditEventType{
+		model.AuditTwoFASucceeded,
+		model.AuditLoginSucceeded,
+		model.AuditOtpEnabled,
+		model.AuditRecoveryCodesIssued,
+		model.AuditPasswordChanged,
+		model.AuditLoginSucceeded,
+		model.AuditUserActivated,
+	}, auditTrail(t, s, user))
+}
+
+func TestListAuditEvents(t *testing.T) {
+	s := newTestUserService(t)
+	ctx := context.Background()
+	user := newTestUser(t, s)
+	for i := 0; i < 3; i++ {
+		_, err := s.Auth(ctx, user.Email, "not the password", "")
+		require.Error(t, err)
+	}
+	login(t, s, user)
+
+	failed, err := s.audit.List(ctx, &model.AuditEventFilter{
+		UserPublicID: user.PublicID,
+		Types:        []model.AuditEventType{model.AuditLoginFailed},
+	})
+	require.NoError(t, err)
+	require.Len(t, failed, 3)
+
+	// the pages follow each other without a gap or an overlap
+	first, err := s.audit.ListByUser(ctx, user.PublicID, 0, 2)
+	require.NoError(t, err)
+	require.Len(t, first, 2)
+	second, err := s.audit.ListByUser(ctx, user.PublicID, first[1].ID, 2)
+	require.NoError(t, err)
+	require.Len(t, second, 2)
+	require.Less(t, second[0].ID, first[1].ID)
+	all, err := s.audit.ListAllByUser(ctx, user.PublicID)
+	require.NoError(t, err)
+	require.Equal(t, append(first, second...), all[:4])
+
+	// the events of another user are left out
+	events, err := s.audit.ListByUser(ctx, newTestUser(t, s).PublicID, 0, 0)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	require.Equal(t, model.AuditUserActivated, events[0].Type)
+}
+
+func TestAuditFailureDoesNotFailLogin(t *testing.T) {
+	s := newTestUserService(t)
+	ctx := context.Background()
+	user := newTestUser(t, s)
+	_, err := s.pool.Exec(ctx, "drop table audit_events")
+	require.NoError(t, err)
+
+	// the login has happened by the time it is recorded
+	login(t, s, user)
+}
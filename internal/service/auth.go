@@ -3,64 +3,174 @@ package service
 import (
 	"context"
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+	"github.com/theruziev/oson_auth/internal/db"
 	"github.com/theruziev/oson_auth/internal/model"
 	"github.com/theruziev/oson_auth/internal/pkg/auth"
+	"github.com/theruziev/oson_auth/internal/pkg/clientinfo"
+	"github.com/theruziev/oson_auth/internal/pkg/dbx"
+	"github.com/theruziev/oson_auth/internal/pkg/lockout"
+	"github.com/theruziev/oson_auth/internal/pkg/logging"
 )
 
 const (
-	twoFARequiredExpireAt = 5 * time.Minute
+	twoFARequiredExpireAt  = 5 * time.Minute
+	passwordChangeExpireAt = 10 * time.Minute
 )
 
-func (s *UserService) Auth(ctx context.Context, username, password string) (*model.AuthToken, error) {
+// Auth signs the user in with the password. deviceToken is the token of a trusted device, the login
+// from it skips the second factor, it may be empty.
+func (s *UserService) Auth(ctx context.Context, username, password, deviceToken string) (*model.AuthToken, error) {
+	// unknown emails are counted as well, so the lockout does not tell which accounts exist
+	account := lockout.Account(strings.ToLower(username))
+	ip := lockout.IP(clientinfo.FromContext(ctx).IP)
+	if err := s.limiter.Check(ctx, account, ip); err != nil {
+		s.audit.Record(ctx, nil, model.AuditLoginFailed, auditReason("locked"))
+		return nil, err
+	}
+
 	user, err := s.GetByUsername(ctx, username)
 	if err != nil {
+		if dbx.IsErrNoRows(err) {
+			s.audit.Record(ctx, nil, model.AuditLoginFailed, auditReason("unknown_user"))
+			return nil, s.failAttempt(ctx, fmt.Errorf("incorrect password or username"), account, ip)
+		}
 		return nil, err
 	}
 	if user.Status != model.UserStatusActivate {
+		s.audit.Record(ctx, user, model.AuditLoginFailed, auditReason("not_active"))
 		return nil, fmt.Errorf("user not active")
 	}
-	if !user.ValidatePassword(password) {
-		return nil, fmt.Errorf("incorrect password or username")
+	ok, needsRehash, err := s.hasher.Verify(password, user.Password)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		s.audit.Record(ctx, user, model.AuditLoginFailed, auditReason("incorrect_password"))
+		return nil, s.failAttempt(ctx, fmt.Errorf("incorrect password or username"), account, ip)
+	}
+	if needsRehash {
+		// passwords set under an older policy are upgraded as well, the login goes on if the upgrade fails
+		if err := s.rehashPassword(ctx, user, password); err != nil {
+			logging.FromContext(ctx).Warnf("failed to rehash password: %s", err)
+		}
+	}
+	// the ip counter is kept, a valid login of one account must not clear the guesses against others
+	if err := s.limiter.Reset(ctx, account); err != nil {
+		return nil, err
 	}
-	expireAt := time.Now().Add(s.authOpt.JWTTtl)
 
-	twoFARequired := s.authOpt.Otp.Enabled && user.OtpEnabled
-	if twoFARequired {
-		expireAt = time.Now().Add(twoFARequiredExpireAt)
+	return s.completeFirstFactor(ctx, user, "password", deviceToken)
+}
+
+func (s *UserService) rehashPassword(ctx context.Context, user *model.User, password string) error {
+	hashed, err := s.hasher.Hash(password)
+	if err != nil {
+		return err
 	}
+	return s.userStore.UpdatePasswordHash(ctx, user.PublicID, hashed)
+}
 
-	claim := auth.Claim{
-		PublicID: user.PublicID,
-		Email:    user.Email,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(expireAt),
-		},
-		Scopes: []auth.Scope{auth.UserScope},
+// failAttempt counts the failed attempt and returns err.
+func (s *UserService) failAttempt(ctx context.Context, err error, subjects ...lockout.Subject) error {
+	if failErr := s.limiter.Fail(ctx, subjects...); failErr != nil {
+		return failErr
+	}
+	return err
+}
+
+// Unlock forgets the failed login attempts of the account.
+func (s *UserService) Unlock(ctx context.Context, email string) error {
+	return UnlockAccount(ctx, s.userStore, s.limiter, email)
+}
+
+// UnlockAccount forgets the failed login attempts of the account, including the ones on the second factor.
+func UnlockAccount(ctx context.Context, userStore *db.UserStore, limiter *lockout.Limiter, email string) error {
+	subjects := []lockout.Subject{lockout.Account(strings.ToLower(email))}
+	user, err := userStore.GetByEmail(ctx, email)
+	if err != nil && !dbx.IsErrNoRows(err) {
+		return err
+	}
+	if user != nil {
+		subjects = append(subjects, twoFASubject(user))
 	}
+	return limiter.Reset(ctx, subjects...)
+}
+
+// twoFASubject counts the second factor guesses apart from the password ones,
+// the password of the user is already known at that step.
+func twoFASubject(user *model.User) lockout.Subject {
+	return lockout.Account("2fa:" + user.PublicID)
+}
 
-	if twoFARequired {
-		claim.Scopes = []auth.Scope{auth.TwoFACheckScope}
+// completeFirstFactor opens a session for the user, or asks for a second factor when the user has one
+// and signs in from a device that isn't trusted. method is the first factor the user signed in with,
+// it is recorded in the audit log.
+func (s *UserService) completeFirstFactor(ctx context.Context, user *model.User, method, deviceToken string) (*model.AuthToken, error) {
+	twoFAMethods, err := s.twoFAMethods(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	trustedDevice := false
+	if len(twoFAMethods) > 0 {
+		if trustedDevice, err = s.isTrustedDevice(ctx, user, deviceToken); err != nil {
+			return nil, err
+		}
+	}
+	metadata := map[string]string{
+		"method":         method,
+		"twofa_required": strconv.FormatBool(len(twoFAMethods) > 0 && !trustedDevice),
+	}
+	if trustedDevice {
+		metadata["trusted_device"] = "true"
+	}
+	s.audit.Record(ctx, user, model.AuditLoginSucceeded, metadata)
+	if len(twoFAMethods) == 0 || trustedDevice {
+		return s.startSession(ctx, user)
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claim)
-	tokenString, err := token.SignedString([]byte(s.authOpt.JWTSecret))
+	expireAt := time.Now().Add(twoFARequiredExpireAt)
+	tokenString, err := s.signToken(user, "", nil, expireAt, nil, auth.TwoFACheckScope)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create token: %w", err)
+		return nil, err
 	}
 
 	return &model.AuthToken{
 		AuthToken:     tokenString,
-		TwoFARequired: twoFARequired,
+		TwoFARequired: true,
+		TwoFAMethods:  twoFAMethods,
 		ExpireAt:      expireAt,
 	}, nil
 }
 
-func (s *UserService) AuthTwoFA(ctx context.Context, claim *auth.Claim, code string) (*model.AuthToken, error) {
+// twoFAMethods lists the second factors the user can complete the login with.
+func (s *UserService) twoFAMethods(ctx context.Context, user *model.User) ([]model.TwoFAMethod, error) {
+	methods := make([]model.TwoFAMethod, 0)
+	if s.authOpt.Otp.Enabled && user.OtpEnabled {
+		methods = append(methods, model.TwoFAMethodOTP)
+	}
+	if s.webAuthn != nil {
+		hasPasskeys, err := s.webAuthnStore.HasCredentials(ctx, user.ID)
+		if err != nil {
+			return nil, err
+		}
+		if hasPasskeys {
+			methods = append(methods, model.TwoFAMethodWebAuthn)
+		}
+	}
+	return methods, nil
+}
+
+// AuthTwoFA completes the login with the otp or a recovery code, rememberDevice trusts the device
+// so the next logins from it skip the second factor.
+func (s *UserService) AuthTwoFA(ctx context.Context, claim *auth.Claim, code string, rememberDevice bool) (*model.AuthToken, error) {
 	if !s.authOpt.Otp.Enabled {
-		return nil, nil
+		return nil, fmt.Errorf("otp is disabled")
 	}
 	user, err := s.GetByUsername(ctx, claim.Email)
 	if err != nil {
@@ -69,50 +179,121 @@ func (s *UserService) AuthTwoFA(ctx context.Context, claim *auth.Claim, code str
 	if user.Status != model.UserStatusActivate {
 		return nil, fmt.Errorf("user not active")
 	}
-	expireAt := time.Now().Add(s.authOpt.JWTTtl)
+	if !user.OtpEnabled {
+		return nil, fmt.Errorf("otp is not enabled for the user")
+	}
+	account := twoFASubject(user)
+	ip := lockout.IP(clientinfo.FromContext(ctx).IP)
+	if err := s.limiter.Check(ctx, account, ip); err != nil {
+		s.audit.Record(ctx, user, model.AuditTwoFAFailed, auditReason("locked"))
+		return nil, err
+	}
 
-	isValid, err := s.otp.ValidateCode(ctx, user.OtpSecret, code)
+	isValid, err := s.validateOtp(ctx, user, code)
 	if err != nil {
 		return nil, err
 	}
-	var foundInRecovery bool
+	usedRecoveryCode := false
 	if !isValid {
-		// try to use recovery code
-		for _, recoveryCode := range user.OtpRecoveryCodes {
-			if recoveryCode == code {
-				foundInRecovery = true
-				break
-			}
+		if usedRecoveryCode, err = s.useRecoveryCode(ctx, user, code); err != nil {
+			return nil, err
 		}
-		if !foundInRecovery {
-			return nil, fmt.Errorf("incorrect otp code")
+		if !usedRecoveryCode {
+			s.audit.Record(ctx, user, model.AuditTwoFAFailed, auditReason("incorrect_code"))
+			return nil, s.failAttempt(ctx, fmt.Errorf("incorrect otp code"), account, ip)
 		}
 	}
+	if err := s.limiter.Reset(ctx, account); err != nil {
+		return nil, err
+	}
+
+	if usedRecoveryCode {
+		s.audit.Record(ctx, user, model.AuditRecoveryCodeUsed, nil)
+		s.audit.Record(ctx, user, model.AuditTwoFASucceeded, auditMethod("recovery_code"))
+	} else {
+		s.audit.Record(ctx, user, model.AuditTwoFASucceeded, auditMethod("otp"))
+	}
+
+	token, err := s.startSession(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	// a login held back for an expired password is not finished, the device is remembered next time
+	if !rememberDevice || s.authOpt.TrustedDeviceTTL == 0 || token.PasswordChangeRequired {
+		return token, nil
+	}
+	deviceToken, device, err := s.trustDevice(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	token.DeviceToken = deviceToken
+	token.DeviceExpireAt = device.ExpiresAt
+	return token, nil
+}
 
-	newClaim := auth.Claim{
-		PublicID: user.PublicID,
-		Email:    user.Email,
+// signToken signs an access token, authTime is nil for tokens that don't finish a login.
+func (s *UserService) signToken(
+	user *model.User,
+	sessionID string,
+	authTime *time.Time,
+	expireAt time.Time,
+	grants *sessionGrants,
+	scopes ...auth.Scope,
+) (string, error) {
+	claim := auth.Claim{
+		PublicID:  user.PublicID,
+		Email:     user.Email,
+		SessionID: sessionID,
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.New().String(),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			ExpiresAt: jwt.NewNumericDate(expireAt),
 		},
-		Scopes: []auth.Scope{auth.UserScope},
+		Scopes: scopes,
+	}
+	if grants != nil {
+		claim.Permissions = grants.permissions
+		claim.OrgID = grants.orgID
+		claim.OrgRole = string(grants.orgRole)
+	}
+	if authTime != nil {
+		claim.AuthTime = jwt.NewNumericDate(*authTime)
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, newClaim)
-	tokenString, err := token.SignedString([]byte(s.authOpt.JWTSecret))
-	if err != nil {
-		return nil, fmt.Errorf("failed to create token: %w", err)
+	return s.signer.Sign(claim)
+}
+
+// Logout revokes the token of the request and the session it belongs to.
+func (s *UserService) Logout(ctx context.Context, claim *auth.Claim) error {
+	if err := s.tokenRevoker.RevokeToken(ctx, claim); err != nil {
+		return err
 	}
+	if claim.SessionID == "" {
+		return nil
+	}
+	_, err := s.tokenRevoker.RevokeSession(ctx, claim.SessionID)
+	return err
+}
 
-	if foundInRecovery {
-		err = s.userStore.RemoveCodeFromRecoveryCode(ctx, user.PublicID, code)
-		if err != nil {
-			return nil, err
-		}
+// LogoutAll revokes every token and session of the user.
+func (s *UserService) LogoutAll(ctx context.Context, claim *auth.Claim) error {
+	user, err := s.userStore.Get(ctx, claim.PublicID)
+	if err != nil {
+		return err
+	}
+	if err := s.tokenRevoker.RevokeToken(ctx, claim); err != nil {
+		return err
 	}
+	return s.revokeAllSessions(ctx, user)
+}
 
-	return &model.AuthToken{
-		AuthToken: tokenString,
-		ExpireAt:  expireAt,
-	}, nil
+// revokeAllSessions signs the user out everywhere, the trusted devices are forgotten as well.
+func (s *UserService) revokeAllSessions(ctx context.Context, user *model.User) error {
+	if err := s.tokenRevoker.RevokeAllTokens(ctx, user.PublicID); err != nil {
+		return err
+	}
+	if err := s.trustedDeviceStore.RevokeAllByUser(ctx, user.ID); err != nil {
+		return err
+	}
+	return s.sessionStore.RevokeAllByUser(ctx, user.ID)
 }
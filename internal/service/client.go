@@ -0,0 +1,95 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/theruziev/oson_auth/internal/db"
+	"github.com/theruziev/oson_auth/internal/model"
+	"github.com/theruziev/oson_auth/internal/pkg/auth"
+	"github.com/theruziev/oson_auth/internal/pkg/dbx"
+	"github.com/theruziev/oson_auth/internal/pkg/errz"
+)
+
+type ClientService struct {
+	clientStore *db.ClientStore
+}
+
+func NewClientService(clientStore *db.ClientStore) *ClientService {
+	return &ClientService{
+		clientStore: clientStore,
+	}
+}
+
+// Create registers a client. The returned secret is not stored and can't be recovered later.
+func (s *ClientService) Create(ctx context.Context, req *model.CreateClientRequest) (*model.Client, string, error) {
+	for _, scp := range req.Scopes {
+		if !auth.IsServiceScope(auth.Scope(scp)) {
+			return nil, "", errz.BadRequestErr.New("unknown scope %q", scp)
+		}
+	}
+	for _, grantType := range req.GrantTypes {
+		switch grantType {
+		case GrantTypeAuthorizationCode, GrantTypeRefreshToken:
+		case GrantTypeClientCredentials:
+			if req.IsPublic {
+				return nil, "", errz.BadRequestErr.New("public clients can't use the %q grant", grantType)
+			}
+		default:
+			return nil, "", errz.BadRequestErr.New("unknown grant type %q", grantType)
+		}
+	}
+
+	client := &model.Client{
+		ClientID:     req.ClientID,
+		Name:         req.Name,
+		IsPublic:     req.IsPublic,
+		RedirectURIs: req.RedirectURIs,
+		GrantTypes:   req.GrantTypes,
+		Scopes:       req.Scopes,
+		CreatedAt:    time.Now(),
+		UpdatedAt:    time.Now(),
+	}
+	if client.ClientID == "" {
+		client.ClientID = uuid.New().String()
+	}
+
+	var secret string
+	if !client.IsPublic {
+		var err error
+		secret, client.SecretHash, err = auth.NewOpaqueToken()
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	if err := s.clientStore.Insert(ctx, client); err != nil {
+		if dbx.IsDuplicateErr(err) {
+			return nil, "", errz.ConflictErr.Wrap(err)
+		}
+		return nil, "", err
+	}
+	return client, secret, nil
+}
+
+// RotateSecret replaces the client secret. Tokens issued with the old secret stay valid until they expire.
+func (s *ClientService) RotateSecret(ctx context.Context, clientID string) (string, error) {
+	client, err := s.clientStore.GetByClientID(ctx, clientID)
+	if err != nil {
+		return "", err
+	}
+	if client.IsPublic {
+		return "", fmt.Errorf("public clients don't have a secret")
+	}
+
+	secret, secretHash, err := auth.NewOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+	if err := s.clientStore.UpdateSecret(ctx, client.ClientID, secretHash); err != nil {
+		return "", err
+	}
+	return secret, nil
+}
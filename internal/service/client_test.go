@@ -0,0 +1,107 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/theruziev/oson_auth/internal/db"
+	"github.com/theruziev/oson_auth/internal/model"
+	"github.com/theruziev/oson_auth/internal/pkg/auth"
+	"github.com/theruziev/oson_auth/internal/pkg/errz"
+)
+
+// newTestServiceClient registers a confidential client of the client credentials grant and returns its secret.
+func newTestServiceClient(t *testing.T, clients *ClientService, grantTypes ...string) (*model.Client, string) {
+	t.Helper()
+	client, secret, err := clients.Create(context.Background(), &model.CreateClientRequest{
+		Name:       "billing",
+		GrantTypes: grantTypes,
+		Scopes:     []string{string(auth.UsersReadScope), string(auth.ContentReadScope)},
+	})
+	require.NoError(t, err)
+	require.NotEmpty(t, secret)
+	return client, secret
+}
+
+func (o *testOIDC) clientCredentials(client *model.Client, secret, scope string) (*model.OIDCToken, error) {
+	return o.service.Token(context.Background(), &model.TokenRequest{
+		GrantType:    GrantTypeClientCredentials,
+		Scope:        scope,
+		ClientID:     client.ClientID,
+		ClientSecret: secret,
+	})
+}
+
+func TestCreateClient(t *testing.T) {
+	o := newTestOIDC(t)
+	clients := NewClientService(db.NewClientStore(o.s.pool))
+	ctx := context.Background()
+
+	_, _, err := clients.Create(ctx, &model.CreateClientRequest{Name: "spa", IsPublic: true, GrantTypes: []string{GrantTypeClientCredentials}})
+	require.True(t, errz.BadRequestErr.Is(err), err)
+	_, _, err = clients.Create(ctx, &model.CreateClientRequest{Name: "billing", Scopes: []string{string(auth.UserScope)}})
+	require.True(t, errz.BadRequestErr.Is(err), err)
+	_, _, err = clients.Create(ctx, &model.CreateClientRequest{ClientID: o.client.ClientID, Name: "copy"})
+	require.True(t, errz.ConflictErr.Is(err), err)
+
+	// public clients have no secret to show
+	client, secret, err := clients.Create(ctx, &model.CreateClientRequest{Name: "spa", IsPublic: true})
+	require.NoError(t, err)
+	require.Empty(t, secret)
+	_, err = clients.RotateSecret(ctx, client.ClientID)
+	require.Error(t, err)
+}
+
+func TestClientCredentialsGrant(t *testing.T) {
+	o := newTestOIDC(t)
+	clients := NewClientService(db.NewClientStore(o.s.pool))
+	client, secret := newTestServiceClient(t, clients, GrantTypeClientCredentials)
+
+	_, err := o.clientCredentials(client, "", "")
+	requireOAuthError(t, err, OAuthInvalidClient)
+	_, err = o.clientCredentials(client, "not the secret", "")
+	requireOAuthError(t, err, OAuthInvalidClient)
+	_, err = o.clientCredentials(client, secret, string(auth.AuditReadScope))
+	requireOAuthError(t, err, OAuthInvalidScope)
+
+	// without a scope the client gets every scope it was registered with
+	token, err := o.clientCredentials(client, secret, "")
+	require.NoError(t, err)
+	require.Empty(t, token.RefreshToken)
+	require.Equal(t, "users:read content:read", token.Scope)
+	claim := parseToken(t, o.s, token.AccessToken)
+	require.Equal(t, client.ClientID, claim.Subject)
+	require.Equal(t, client.ClientID, claim.ClientID)
+	require.Empty(t, claim.PublicID)
+	require.Equal(t, []auth.Scope{auth.UsersReadScope, auth.ContentReadScope}, claim.Scopes)
+
+	token, err = o.clientCredentials(client, secret, string(auth.ContentReadScope))
+	require.NoError(t, err)
+	require.Equal(t, []auth.Scope{auth.ContentReadScope}, parseToken(t, o.s, token.AccessToken).Scopes)
+}
+
+func TestClientCredentialsGrantNeedsTheGrantType(t *testing.T) {
+	o := newTestOIDC(t)
+	clients := NewClientService(db.NewClientStore(o.s.pool))
+	client, secret := newTestServiceClient(t, clients, GrantTypeAuthorizationCode)
+
+	_, err := o.clientCredentials(client, secret, "")
+	requireOAuthError(t, err, OAuthUnauthorizedClient)
+	// public clients can't prove who they are
+	_, err = o.clientCredentials(o.client, "", "")
+	requireOAuthError(t, err, OAuthUnauthorizedClient)
+}
+
+func TestRotateClientSecret(t *testing.T) {
+	o := newTestOIDC(t)
+	clients := NewClientService(db.NewClientStore(o.s.pool))
+	client, old := newTestServiceClient(t, clients, GrantTypeClientCredentials)
+
+	secret, err := clients.RotateSecret(context.Background(), client.ClientID)
+	require.NoError(t, err)
+	_, err = o.clientCredentials(client, old, "")
+	requireOAuthError(t, err, OAuthInvalidClient)
+	_, err = o.clientCredentials(client, secret, "")
+	require.NoError(t, err)
+}
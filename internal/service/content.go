@@ -2,21 +2,33 @@ package service
 
 import (
 	"context"
+	"strconv"
 
 	"github.com/theruziev/oson_auth/internal/db"
 	"github.com/theruziev/oson_auth/internal/model"
+	"github.com/theruziev/oson_auth/internal/pkg/auth"
 	"github.com/theruziev/oson_auth/internal/pkg/dbx"
+	"github.com/theruziev/oson_auth/internal/pkg/errz"
+)
+
+const (
+	defaultContentListLimit = 50
+	maxContentListLimit     = 500
 )
 
 type ContentService struct {
-	store *db.ContentStore
-	pool  dbx.Querier // for transaction
+	store     *db.ContentStore
+	userStore *db.UserStore
+	audit     *AuditService
+	pool      dbx.Querier // for transaction
 }
 
-func NewContentService(store *db.ContentStore, pool dbx.Querier) *ContentService {
+func NewContentService(store *db.ContentStore, userStore *db.UserStore, audit *AuditService, pool dbx.Querier) *ContentService {
 	return &ContentService{
-		store: store,
-		pool:  pool,
+		store:     store,
+		userStore: userStore,
+		audit:     audit,
+		pool:      pool,
 	}
 }
 
@@ -35,3 +47,37 @@ func (s *ContentService) ListNewest(ctx context.Context, lastID, limit uint64) (
 	}
 	return result, nil
 }
+
+// List is the listing of the moderators, hidden contents are included.
+func (s *ContentService) List(ctx context.Context, filter *model.ContentFilter) ([]*model.Content, error) {
+	if filter.Limit == 0 {
+		filter.Limit = defaultContentListLimit
+	}
+	if filter.Limit > maxContentListLimit {
+		filter.Limit = maxContentListLimit
+	}
+	return s.store.List(ctx, filter)
+}
+
+// SetStatus hides the content or brings it back, the moderator is recorded in the audit log.
+func (s *ContentService) SetStatus(ctx context.Context, claim *auth.Claim, id uint64, status model.ContentStatus) error {
+	if status != model.ContentStatusActive && status != model.ContentStatusHide {
+		return errz.BadRequestErr.New("unknown content status %s", status)
+	}
+	moderator, err := s.userStore.Get(ctx, claim.PublicID)
+	if err != nil {
+		return err
+	}
+	found, err := s.store.SetStatus(ctx, id, status)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return errz.NotFoundErr.New("content not found")
+	}
+	s.audit.Record(ctx, moderator, model.AuditContentModerated, map[string]string{
+		"content": strconv.FormatUint(id, 10),
+		"status":  string(status),
+	})
+	return nil
+}
@@ -0,0 +1,58 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/theruziev/oson_auth/internal/db"
+	"github.com/theruziev/oson_auth/internal/model"
+	"github.com/theruziev/oson_auth/internal/pkg/auth"
+	"github.com/theruziev/oson_auth/internal/pkg/errz"
+)
+
+func TestModeratorRoleGrantsContentModeration(t *testing.T) {
+	s := newTestUserService(t)
+	ctx := context.Background()
+	user := newTestUser(t, s)
+	require.False(t, signIn(t, s, user).HasPermission(auth.ContentModeratePermission))
+
+	role, err := s.roleStore.GetByName(ctx, "moderator")
+	require.NoError(t, err)
+	require.NoError(t, s.roleStore.Assign(ctx, user.ID, role.ID))
+	require.True(t, signIn(t, s, user).HasPermission(auth.ContentModeratePermission))
+}
+
+func TestModerateContent(t *testing.T) {
+	s := newTestUserService(t)
+	ctx := context.Background()
+	contents := NewContentService(db.NewContentStore(s.pool), s.userStore, s.audit, s.pool)
+	moderator := newTestUser(t, s)
+	claim := signIn(t, s, moderator)
+
+	content := &model.Content{
+		Source:      "upload",
+		PreviewURL:  "https://cdn.example.com/preview.jpg",
+		PreviewType: model.PreviewContentTypeImage,
+		MediaURL:    "https://cdn.example.com/media.mp4",
+		Tags:        []string{"cat"},
+		Type:        model.ContentTypeMP4,
+		Status:      model.ContentStatusActive,
+	}
+	require.NoError(t, contents.Add(ctx, content))
+
+	require.NoError(t, contents.SetStatus(ctx, claim, content.ID, model.ContentStatusHide))
+	hidden, err := contents.List(ctx, &model.ContentFilter{Status: model.ContentStatusHide})
+	require.NoError(t, err)
+	require.Len(t, hidden, 1)
+	require.Equal(t, content.ID, hidden[0].ID)
+	active, err := contents.List(ctx, &model.ContentFilter{Status: model.ContentStatusActive})
+	require.NoError(t, err)
+	require.Empty(t, active)
+	require.Contains(t, auditTrail(t, s, moderator), model.AuditContentModerated)
+
+	err = contents.SetStatus(ctx, claim, content.ID+1, model.ContentStatusActive)
+	require.True(t, errz.NotFoundErr.Is(err), err)
+	err = contents.SetStatus(ctx, claim, content.ID, model.ContentStatus("deleted"))
+	require.True(t, errz.BadRequestErr.Is(err), err)
+}
@@ -0,0 +1,141 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/theruziev/oson_auth/internal/converter/message"
+	"github.com/theruziev/oson_auth/internal/event/constants"
+	"github.com/theruziev/oson_auth/internal/model"
+	"github.com/theruziev/oson_auth/internal/pkg/auth"
+	"github.com/theruziev/oson_auth/internal/pkg/dbx"
+	"github.com/theruziev/oson_auth/internal/pkg/errz"
+)
+
+// RequestEmailChange sends a confirmation link to the new email and a notice to the current one.
+// The email is changed only when the link is followed, changes requested earlier stop working.
+func (s *UserService) RequestEmailChange(ctx context.Context, claim *auth.Claim, newEmail string, proof *model.ReauthProof) error {
+	user, err := s.userStore.Get(ctx, claim.PublicID)
+	if err != nil {
+		return err
+	}
+	if err := s.verifyReauth(ctx, claim, user, proof); err != nil {
+		return err
+	}
+	if strings.EqualFold(user.Email, newEmail) {
+		return errz.BadRequestErr.New("new email is the same as the current one")
+	}
+	if err := s.checkEmailAvailable(ctx, newEmail); err != nil {
+		return err
+	}
+
+	token, tokenHash, err := auth.NewOpaqueToken()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	change := &model.EmailChange{
+		TokenHash: tokenHash,
+		UserID:    user.ID,
+		NewEmail:  newEmail,
+		ExpiresAt: now.Add(s.authOpt.EmailChangeTTL),
+		CreatedAt: now,
+	}
+
+	err = s.inTx(ctx, func(ctx context.Context) error {
+		if err := s.emailChangeStore.UseAllByUser(ctx, user.ID); err != nil {
+			return err
+		}
+		if err := s.emailChangeStore.Insert(ctx, change); err != nil {
+			return err
+		}
+		return s.outboxStore.Add(ctx, &model.OutBox{
+			Topic:     constants.TopicUserEmailChange,
+			Data:      message.ToUserEmailChangeEvent(user, change, token),
+			Status:    model.CreatedStatus,
+			CreatedAt: now,
+		}, &model.OutBox{
+			Topic:     constants.TopicUserEmailChanging,
+			Data:      message.ToUserEmailChangingEvent(user, change),
+			Status:    model.CreatedStatus,
+			CreatedAt: now,
+		})
+	})
+	if err != nil {
+		return err
+	}
+	s.audit.Record(ctx, user, model.AuditEmailChangeRequested, map[string]string{"new_email": newEmail})
+	return nil
+}
+
+// ConfirmEmailChange swaps the email of the user for the confirmed one. The user changed event is
+// written in the same transaction, so consumers never miss the change nor see one that was rolled back.
+// Sessions are revoked as their tokens still carry the previous email.
+func (s *UserService) ConfirmEmailChange(ctx context.Context, token string) error {
+	change, err := s.emailChangeStore.GetByHash(ctx, auth.HashOpaqueToken(token))
+	if err != nil {
+		if dbx.IsErrNoRows(err) {
+			return errz.NotFoundErr.New("unknown email change")
+		}
+		return err
+	}
+	if change.IsExpired(time.Now()) {
+		return errz.BadRequestErr.New("email change expired")
+	}
+
+	user, err := s.userStore.GetByID(ctx, change.UserID)
+	if err != nil {
+		return err
+	}
+	if user.Status != model.UserStatusActivate {
+		return errz.BadRequestErr.New("user not active")
+	}
+
+	var previousEmail string
+	err = s.inTx(ctx, func(ctx context.Context) error {
+		isFirstUse, err := s.emailChangeStore.Use(ctx, change.ID)
+		if err != nil {
+			return err
+		}
+		if !isFirstUse {
+			return errz.BadRequestErr.New("email change already used")
+		}
+		if err := s.userStore.ChangeEmail(ctx, user.PublicID, change.NewEmail); err != nil {
+			if dbx.IsDuplicateErr(err) {
+				return errz.ConflictErr.New("email already taken")
+			}
+			return err
+		}
+		// links sent to the previous address must not sign in anymore
+		if err := s.magicLinkStore.UseAllByUser(ctx, user.ID); err != nil {
+			return err
+		}
+
+		previousEmail = user.Email
+		user.Email = change.NewEmail
+		user.Touch()
+		return s.outboxStore.Add(ctx, &model.OutBox{
+			Topic:     constants.TopicUserChanged,
+			Data:      message.ToUserEvent(user),
+			Status:    model.CreatedStatus,
+			CreatedAt: time.Now(),
+		})
+	})
+	if err != nil {
+		return err
+	}
+	s.audit.Record(ctx, user, model.AuditEmailChanged, map[string]string{"previous_email": previousEmail})
+	return s.revokeAllSessions(ctx, user)
+}
+
+func (s *UserService) checkEmailAvailable(ctx context.Context, email string) error {
+	_, err := s.userStore.GetByEmail(ctx, email)
+	if err == nil {
+		return errz.ConflictErr.New("email already taken")
+	}
+	if !dbx.IsErrNoRows(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"github.com/theruziev/oson_auth/internal/event/constants"
+	"github.com/theruziev/oson_auth/internal/model"
+	"github.com/theruziev/oson_auth/internal/pkg/errz"
+	v0 "github.com/theruziev/oson_auth/pkg/events/v0"
+)
+
+// requestEmailChange asks to move the user to the new email and returns the token of the confirmation link.
+func requestEmailChange(t *testing.T, s *UserService, user *model.User, newEmail string) string {
+	t.Helper()
+	require.NoError(t, s.RequestEmailChange(context.Background(), signIn(t, s, user), newEmail, &model.ReauthProof{}))
+	var event v0.UserEmailChangeEvent
+	lastOutboxMessage(t, s, constants.TopicUserEmailChange, &event)
+	require.Equal(t, user.PublicID, event.PublicID)
+	require.Equal(t, newEmail, event.Email)
+	require.NotEmpty(t, event.Token)
+	return event.Token
+}
+
+func TestEmailChangeConfirmed(t *testing.T) {
+	s := newTestUserService(t)
+	ctx := context.Background()
+	user := newTestUser(t, s)
+	token := login(t, s, user)
+	newEmail := uuid.New().String() + "@example.com"
+	changeToken := requestEmailChange(t, s, user, newEmail)
+
+	// the current address is told about the change, which waits for the confirmation
+	var notice v0.UserEmailChangingEvent
+	lastOutboxMessage(t, s, constants.TopicUserEmailChanging, &notice)
+	require.Equal(t, user.Email, notice.Email)
+	require.Equal(t, newEmail, notice.NewEmail)
+	require.Equal(t, user.Email, reloadUser(t, s, user).Email)
+
+	require.NoError(t, s.ConfirmEmailChange(ctx, changeToken))
+	require.Equal(t, newEmail, reloadUser(t, s, user).Email)
+	require.Equal(t, []model.AuditEventType{model.AuditEmailChanged, model.AuditEmailChangeRequested}, auditTrail(t, s, user)[:2])
+	var changed v0.UserEvent
+	lastOutboxMessage(t, s, constants.TopicUserChanged, &changed)
+	require.Equal(t, newEmail, changed.Email)
+
+	// the tokens carry the previous email
+	_, err := s.RefreshToken(ctx, token.RefreshToken, "")
+	require.Error(t, err)
+	_, err = s.Auth(ctx, user.Email, testPassword, "")
+	require.Error(t, err)
+	_, err = s.Auth(ctx, newEmail, testPassword, "")
+	require.NoError(t, err)
+
+	err = s.ConfirmEmailChange(ctx, changeToken)
+	require.True(t, errz.BadRequestErr.Is(err), err)
+	err = s.ConfirmEmailChange(ctx, "unknown")
+	require.True(t, errz.NotFoundErr.Is(err), err)
+}
+
+func TestEmailChangeRequestRevokesEarlierChanges(t *testing.T) {
+	s := newTestUserService(t)
+	ctx := context.Background()
+	user := newTestUser(t, s)
+	earlier := requestEmailChange(t, s, user, uuid.New().String()+"@example.com")
+	latestEmail := uuid.New().String() + "@example.com"
+	latest := requestEmailChange(t, s, user, latestEmail)
+
+	require.Error(t, s.ConfirmEmailChange(ctx, earlier))
+	require.NoError(t, s.ConfirmEmailChange(ctx, latest))
+	require.Equal(t, latestEmail, reloadUser(t, s, user).Email)
+}
+
+func TestEmailChangeToTakenEmail(t *testing.T) {
+	s := newTestUserService(t)
+	ctx := context.Background()
+	user := newTestUser(t, s)
+	other := newTestUser(t, s)
+
+	err := s.RequestEmailChange(ctx, signIn(t, s, user), other.Email, &model.ReauthProof{})
+	require.True(t, errz.ConflictErr.Is(err), err)
+	err = s.RequestEmailChange(ctx, signIn(t, s, user), user.Email, &model.ReauthProof{})
+	require.True(t, errz.BadRequestErr.Is(err), err)
+
+	// the email was free when asked for and got taken before the confirmation
+	newEmail := uuid.New().String() + "@example.com"
+	changeToken := requestEmailChange(t, s, user, newEmail)
+	require.NoError(t, s.ConfirmEmailChange(ctx, requestEmailChange(t, s, other, newEmail)))
+	err = s.ConfirmEmailChange(ctx, changeToken)
+	require.True(t, errz.ConflictErr.Is(err), err)
+	require.Equal(t, user.Email, reloadUser(t, s, user).Email)
+}
+
+func TestEmailChangeExpires(t *testing.T) {
+	s := newTestUserService(t)
+	user := newTestUser(t, s)
+	s.authOpt.EmailChangeTTL = time.Millisecond
+	changeToken := requestEmailChange(t, s, user, uuid.New().String()+"@example.com")
+	time.Sleep(10 * time.Millisecond)
+
+	err := s.ConfirmEmailChange(context.Background(), changeToken)
+	require.True(t, errz.BadRequestErr.Is(err), err)
+	require.Equal(t, user.Email, reloadUser(t, s, user).Email)
+}
@@ -0,0 +1,82 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/theruziev/oson_auth/internal/converter/message"
+	"github.com/theruziev/oson_auth/internal/event/constants"
+	"github.com/theruziev/oson_auth/internal/model"
+	"github.com/theruziev/oson_auth/internal/pkg/auth"
+	"github.com/theruziev/oson_auth/internal/pkg/dbx"
+)
+
+// MagicLinkRequest emails a single-use login link to the user. Links requested earlier stop working.
+func (s *UserService) MagicLinkRequest(ctx context.Context, email string) error {
+	user, err := s.userStore.GetByEmail(ctx, email)
+	if err != nil {
+		return err
+	}
+	if user.Status != model.UserStatusActivate {
+		return fmt.Errorf("user not active")
+	}
+
+	token, tokenHash, err := auth.NewOpaqueToken()
+	if err != nil {
+		return err
+	}
+	if err := s.magicLinkStore.UseAllByUser(ctx, user.ID); err != nil {
+		return err
+	}
+	now := time.Now()
+	link := &model.MagicLink{
+		TokenHash: tokenHash,
+		UserID:    user.ID,
+		ExpiresAt: now.Add(s.authOpt.MagicLinkTTL),
+		CreatedAt: now,
+	}
+	if err := s.magicLinkStore.Insert(ctx, link); err != nil {
+		return fmt.Errorf("failed to create magic link: %w", err)
+	}
+
+	magicLinkEvent := message.ToUserMagicLinkEvent(user, token, link.ExpiresAt)
+	return s.outboxStore.Add(ctx, &model.OutBox{
+		Topic:     constants.TopicUserMagicLink,
+		Data:      magicLinkEvent,
+		Status:    model.CreatedStatus,
+		CreatedAt: now,
+	})
+}
+
+// AuthMagicLink redeems a magic link. It replaces the password only, the second factor is still asked for.
+func (s *UserService) AuthMagicLink(ctx context.Context, token string) (*model.AuthToken, error) {
+	link, err := s.magicLinkStore.GetByHash(ctx, auth.HashOpaqueToken(token))
+	if err != nil {
+		if dbx.IsErrNoRows(err) {
+			return nil, fmt.Errorf("unknown magic link")
+		}
+		return nil, err
+	}
+
+	isFirstUse, err := s.magicLinkStore.Use(ctx, link.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !isFirstUse {
+		return nil, fmt.Errorf("magic link already used")
+	}
+	if link.IsExpired(time.Now()) {
+		return nil, fmt.Errorf("magic link expired")
+	}
+
+	user, err := s.userStore.GetByID(ctx, link.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if user.Status != model.UserStatusActivate {
+		return nil, fmt.Errorf("user not active")
+	}
+
+	return s.completeFirstFactor(ctx, user, "magic_link", "")
+}
@@ -0,0 +1,89 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/theruziev/oson_auth/internal/event/constants"
+	"github.com/theruziev/oson_auth/internal/model"
+	v0 "github.com/theruziev/oson_auth/pkg/events/v0"
+)
+
+// requestMagicLink emails a link to the user and returns its token.
+func requestMagicLink(t *testing.T, s *UserService, user *model.User) string {
+	t.Helper()
+	require.NoError(t, s.MagicLinkRequest(context.Background(), user.Email))
+	var event v0.UserMagicLinkEvent
+	lastOutboxMessage(t, s, constants.TopicUserMagicLink, &event)
+	require.Equal(t, user.PublicID, event.PublicID)
+	require.NotEmpty(t, event.Token)
+	return event.Token
+}
+
+func TestMagicLinkWorksOnce(t *testing.T) {
+	s := newTestUserService(t)
+	ctx := context.Background()
+	user := newTestUser(t, s)
+	token := requestMagicLink(t, s, user)
+
+	authToken, err := s.AuthMagicLink(ctx, token)
+	require.NoError(t, err)
+	require.False(t, authToken.TwoFARequired)
+	require.NotEmpty(t, authToken.RefreshToken)
+	require.Contains(t, auditTrail(t, s, user), model.AuditLoginSucceeded)
+
+	_, err = s.AuthMagicLink(ctx, token)
+	require.Error(t, err)
+	_, err = s.AuthMagicLink(ctx, "unknown")
+	require.Error(t, err)
+}
+
+func TestMagicLinkRequestRevokesEarlierLinks(t *testing.T) {
+	s := newTestUserService(t)
+	ctx := context.Background()
+	user := newTestUser(t, s)
+	earlier := requestMagicLink(t, s, user)
+	latest := requestMagicLink(t, s, user)
+
+	_, err := s.AuthMagicLink(ctx, earlier)
+	require.Error(t, err)
+	_, err = s.AuthMagicLink(ctx, latest)
+	require.NoError(t, err)
+}
+
+func TestMagicLinkExpires(t *testing.T) {
+	s := newTestUserService(t)
+	user := newTestUser(t, s)
+	s.authOpt.MagicLinkTTL = time.Millisecond
+	token := requestMagicLink(t, s, user)
+	time.Sleep(10 * time.Millisecond)
+
+	_, err := s.AuthMagicLink(context.Background(), token)
+	require.Error(t, err)
+}
+
+func TestMagicLinkAsksForSecondFactor(t *testing.T) {
+	s := newTestUserService(t)
+	user := newTestUser(t, s)
+	enrollTestOtp(t, s, user)
+
+	// the link replaces the password, not the authenticator
+	authToken, err := s.AuthMagicLink(context.Background(), requestMagicLink(t, s, user))
+	require.NoError(t, err)
+	require.True(t, authToken.TwoFARequired)
+	require.Empty(t, authToken.RefreshToken)
+}
+
+func TestMagicLinkOfInactiveUser(t *testing.T) {
+	s := newTestUserService(t)
+	ctx := context.Background()
+	user := newTestUser(t, s)
+	token := requestMagicLink(t, s, user)
+	require.NoError(t, s.changeStatus(ctx, user, model.UserStatusSuspended, "abuse", nil))
+
+	_, err := s.AuthMagicLink(ctx, token)
+	require.Error(t, err)
+	require.Error(t, s.MagicLinkRequest(ctx, user.Email))
+}
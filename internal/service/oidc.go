@@ -0,0 +1,460 @@
+package service
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+	"github.com/theruziev/oson_auth/internal/db"
+	"github.com/theruziev/oson_auth/internal/model"
+	"github.com/theruziev/oson_auth/internal/pkg/auth"
+	"github.com/theruziev/oson_auth/internal/pkg/dbx"
+)
+
+const (
+	GrantTypeAuthorizationCode = "authorization_code"
+	GrantTypeRefreshToken      = "refresh_token"
+	GrantTypeClientCredentials = "client_credentials"
+
+	responseTypeCode = "code"
+)
+
+// OAuth error codes from RFC 6749.
+const (
+	OAuthInvalidRequest          = "invalid_request"
+	OAuthInvalidClient           = "invalid_client"
+	OAuthInvalidGrant            = "invalid_grant"
+	OAuthUnauthorizedClient      = "unauthorized_client"
+	OAuthUnsupportedGrantType    = "unsupported_grant_type"
+	OAuthUnsupportedResponseType = "unsupported_response_type"
+	OAuthInvalidScope            = "invalid_scope"
+	OAuthAccessDenied            = "access_denied"
+)
+
+type OAuthError struct {
+	Code        string
+	Description string
+}
+
+func newOAuthError(code, format string, args ...any) *OAuthError {
+	return &OAuthError{
+		Code:        code,
+		Description: fmt.Sprintf(format, args...),
+	}
+}
+
+func (e *OAuthError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.Description)
+}
+
+type OIDCService struct {
+	opt                    *auth.OIDCOption
+	userStore              *db.UserStore
+	clientStore            *db.ClientStore
+	authorizationCodeStore *db.AuthorizationCodeStore
+	userService            *UserService
+	signer                 *auth.Signer
+}
+
+func NewOIDCService(
+	opt *auth.OIDCOption,
+	userStore *db.UserStore,
+	clientStore *db.ClientStore,
+	authorizationCodeStore *db.AuthorizationCodeStore,
+	userService *UserService,
+	signer *auth.Signer,
+) *OIDCService {
+	return &OIDCService{
+		opt:                    opt,
+		userStore:              userStore,
+		clientStore:            clientStore,
+		authorizationCodeStore: authorizationCodeStore,
+		userService:            userService,
+		signer:                 signer,
+	}
+}
+
+// StartAuthorize validates an authorization request and returns where the user agent should go next:
+// the login page when the request is valid, or the client redirect uri with an error otherwise.
+// An error is returned only when the client or redirect uri can't be trusted.
+func (s *OIDCService) StartAuthorize(ctx context.Context, req *model.AuthorizeRequest) (string, error) {
+	if _, err := s.getAuthorizeClient(ctx, req); err != nil {
+		return "", err
+	}
+	if err := validateAuthorizeRequest(req); err != nil {
+		return authorizeErrorRedirect(req, err), nil
+	}
+
+	loginURL, err := url.Parse(s.opt.LoginURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid login url: %w", err)
+	}
+	query := loginURL.Query()
+	for k, v := range authorizeRequestToQuery(req) {
+		query[k] = v
+	}
+	loginURL.RawQuery = query.Encode()
+	return loginURL.String(), nil
+}
+
+// Authorize records the consent of the signed-in user and returns the client redirect uri
+// carrying either the authorization code or an error.
+func (s *OIDCService) Authorize(ctx context.Context, claim *auth.Claim, req *model.AuthorizeRequest, approved bool) (string, error) {
+	client, err := s.getAuthorizeClient(ctx, req)
+	if err != nil {
+		return "", err
+	}
+	if err := validateAuthorizeRequest(req); err != nil {
+		return authorizeErrorRedirect(req, err), nil
+	}
+	if !approved {
+		return authorizeErrorRedirect(req, newOAuthError(OAuthAccessDenied, "the user denied the request")), nil
+	}
+
+	user, err := s.userService.GetByID(ctx, claim.PublicID)
+	if err != nil {
+		return "", err
+	}
+	if user.Status != model.UserStatusActivate {
+		return "", fmt.Errorf("user not active")
+	}
+
+	code, codeHash, err := auth.NewOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+	authTime := time.Now()
+	if claim.AuthTime != nil {
+		authTime = claim.AuthTime.Time
+	} else if claim.IssuedAt != nil {
+		authTime = claim.IssuedAt.Time
+	}
+	now := time.Now()
+	if err := s.authorizationCodeStore.Insert(ctx, &model.AuthorizationCode{
+		CodeHash:            codeHash,
+		ClientID:            client.ClientID,
+		UserID:              user.ID,
+		RedirectURI:         req.RedirectURI,
+		Scope:               req.Scope,
+		Nonce:               req.Nonce,
+		CodeChallenge:       req.CodeChallenge,
+		CodeChallengeMethod: req.CodeChallengeMethod,
+		AuthTime:            authTime,
+		ExpiresAt:           now.Add(s.opt.CodeTTL),
+		CreatedAt:           now,
+	}); err != nil {
+		return "", err
+	}
+
+	return redirectWithQuery(req.RedirectURI, url.Values{
+		"code":  {code},
+		"state": {req.State},
+	}), nil
+}
+
+func (s *OIDCService) Token(ctx context.Context, req *model.TokenRequest) (*model.OIDCToken, error) {
+	client, err := s.authenticateClient(ctx, req.ClientID, req.ClientSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	if !client.HasGrantType(req.GrantType) {
+		return nil, newOAuthError(OAuthUnauthorizedClient, "client is not allowed to use the %q grant", req.GrantType)
+	}
+
+	switch req.GrantType {
+	case GrantTypeClientCredentials:
+		return s.clientCredentials(client, req)
+	case GrantTypeAuthorizationCode:
+		return s.exchangeCode(ctx, client, req)
+	case GrantTypeRefreshToken:
+		token, err := s.userService.RefreshToken(ctx, req.RefreshToken, client.ClientID)
+		if err != nil {
+			return nil, newOAuthError(OAuthInvalidGrant, "invalid refresh token")
+		}
+		return &model.OIDCToken{
+			AccessToken:  token.AuthToken,
+			RefreshToken: token.RefreshToken,
+			ExpireAt:     token.ExpireAt,
+		}, nil
+	default:
+		return nil, newOAuthError(OAuthUnsupportedGrantType, "grant type %q is not supported", req.GrantType)
+	}
+}
+
+// clientCredentials issues a token that identifies the client itself rather than a user.
+func (s *OIDCService) clientCredentials(client *model.Client, req *model.TokenRequest) (*model.OIDCToken, error) {
+	if client.IsPublic {
+		return nil, newOAuthError(OAuthUnauthorizedClient, "public clients can't use the client credentials grant")
+	}
+
+	allowed := make(map[string]struct{}, len(client.Scopes))
+	for _, scp := range client.Scopes {
+		allowed[scp] = struct{}{}
+	}
+	requested := strings.Fields(req.Scope)
+	if len(requested) == 0 {
+		requested = client.Scopes
+	}
+	scopes := make([]auth.Scope, 0, len(requested))
+	for _, scp := range requested {
+		if _, ok := allowed[scp]; !ok {
+			return nil, newOAuthError(OAuthInvalidScope, "scope %q is not allowed for the client", scp)
+		}
+		scopes = append(scopes, auth.Scope(scp))
+	}
+
+	now := time.Now()
+	expireAt := now.Add(s.opt.ClientTokenTTL)
+	accessToken, err := s.signer.Sign(&auth.Claim{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.New().String(),
+			Issuer:    s.opt.Issuer,
+			Subject:   client.ClientID,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expireAt),
+		},
+		ClientID: client.ClientID,
+		Scopes:   scopes,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.OIDCToken{
+		AccessToken: accessToken,
+		ExpireAt:    expireAt,
+		Scope:       strings.Join(requested, " "),
+	}, nil
+}
+
+func (s *OIDCService) UserInfo(ctx context.Context, claim *auth.Claim) (*model.UserInfo, error) {
+	user, err := s.userService.GetByID(ctx, claim.PublicID)
+	if err != nil {
+		return nil, err
+	}
+	return &model.UserInfo{
+		Subject:       user.PublicID,
+		Email:         user.Email,
+		EmailVerified: isEmailVerified(user),
+		GivenName:     user.FirstName,
+		FamilyName:    user.LastName,
+	}, nil
+}
+
+// isEmailVerified tells the clients whether the user proved the email, activation is done through a link sent to it.
+func isEmailVerified(user *model.User) bool {
+	return user.Status == model.UserStatusActivate
+}
+
+// exchangeCode redeems the authorization code. The code is used up in the transaction of the session it opens,
+// a second redemption waits for it and revokes the session, the code may have been stolen (RFC 6749 4.1.2).
+func (s *OIDCService) exchangeCode(ctx context.Context, client *model.Client, req *model.TokenRequest) (*model.OIDCToken, error) {
+	code, err := s.authorizationCodeStore.GetByHash(ctx, auth.HashOpaqueToken(req.Code))
+	if err != nil {
+		if dbx.IsErrNoRows(err) {
+			return nil, newOAuthError(OAuthInvalidGrant, "unknown authorization code")
+		}
+		return nil, err
+	}
+	if code.ClientID != client.ClientID {
+		return nil, newOAuthError(OAuthInvalidGrant, "authorization code was issued to another client")
+	}
+
+	var (
+		user     *model.User
+		token    *model.AuthToken
+		oauthErr *OAuthError
+	)
+	// an invalid exchange spends the code all the same, so oauthErr is returned after the commit
+	err = s.userService.inTx(ctx, func(ctx context.Context) error {
+		isFirstUse, err := s.authorizationCodeStore.Use(ctx, code.ID)
+		if err != nil {
+			return err
+		}
+		if !isFirstUse {
+			oauthErr = newOAuthError(OAuthInvalidGrant, "authorization code has already been used")
+			return s.revokeCodeSession(ctx, code)
+		}
+		if oauthErr = validateCodeExchange(code, req); oauthErr != nil {
+			return nil
+		}
+
+		user, err = s.userStore.GetByID(ctx, code.UserID)
+		if err != nil {
+			return err
+		}
+		if user.Status != model.UserStatusActivate {
+			oauthErr = newOAuthError(OAuthInvalidGrant, "user not active")
+			return nil
+		}
+		var session *model.Session
+		token, session, err = s.userService.startClientSession(ctx, user, client.ClientID, code.AuthTime)
+		if err != nil {
+			return err
+		}
+		return s.authorizationCodeStore.SetSession(ctx, code.ID, session.ID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if oauthErr != nil {
+		return nil, oauthErr
+	}
+
+	now := time.Now()
+	idToken, err := s.signer.Sign(&auth.IDTokenClaim{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    s.opt.Issuer,
+			Subject:   user.PublicID,
+			Audience:  jwt.ClaimStrings{client.ClientID},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(s.opt.IDTokenTTL)),
+		},
+		Nonce:         code.Nonce,
+		AuthTime:      jwt.NewNumericDate(code.AuthTime),
+		Email:         user.Email,
+		EmailVerified: isEmailVerified(user),
+		GivenName:     user.FirstName,
+		FamilyName:    user.LastName,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.OIDCToken{
+		AccessToken:  token.AuthToken,
+		IDToken:      idToken,
+		RefreshToken: token.RefreshToken,
+		ExpireAt:     token.ExpireAt,
+		Scope:        code.Scope,
+	}, nil
+}
+
+func validateCodeExchange(code *model.AuthorizationCode, req *model.TokenRequest) *OAuthError {
+	if time.Now().After(code.ExpiresAt) {
+		return newOAuthError(OAuthInvalidGrant, "authorization code expired")
+	}
+	if code.RedirectURI != req.RedirectURI {
+		return newOAuthError(OAuthInvalidGrant, "redirect_uri does not match")
+	}
+	if !auth.VerifyCodeChallenge(req.CodeVerifier, code.CodeChallenge) {
+		return newOAuthError(OAuthInvalidGrant, "invalid code_verifier")
+	}
+	return nil
+}
+
+// revokeCodeSession revokes the session opened with the code. The code is read again, the exchange
+// that used it has committed by now.
+func (s *OIDCService) revokeCodeSession(ctx context.Context, code *model.AuthorizationCode) error {
+	used, err := s.authorizationCodeStore.GetByHash(ctx, code.CodeHash)
+	if err != nil {
+		return err
+	}
+	if used.SessionID == nil {
+		return nil
+	}
+	session, err := s.userService.sessionStore.Get(ctx, *used.SessionID)
+	if err != nil {
+		return err
+	}
+	_, err = s.userService.tokenRevoker.RevokeSession(ctx, session.PublicID)
+	return err
+}
+
+func (s *OIDCService) authenticateClient(ctx context.Context, clientID, clientSecret string) (*model.Client, error) {
+	client, err := s.clientStore.GetByClientID(ctx, clientID)
+	if err != nil {
+		if dbx.IsErrNoRows(err) {
+			return nil, newOAuthError(OAuthInvalidClient, "unknown client")
+		}
+		return nil, err
+	}
+	if client.IsPublic {
+		return client, nil
+	}
+	secretHash := auth.HashOpaqueToken(clientSecret)
+	if clientSecret == "" || subtle.ConstantTimeCompare([]byte(secretHash), []byte(client.SecretHash)) != 1 {
+		return nil, newOAuthError(OAuthInvalidClient, "invalid client credentials")
+	}
+	return client, nil
+}
+
+func (s *OIDCService) getAuthorizeClient(ctx context.Context, req *model.AuthorizeRequest) (*model.Client, error) {
+	client, err := s.clientStore.GetByClientID(ctx, req.ClientID)
+	if err != nil {
+		if dbx.IsErrNoRows(err) {
+			return nil, newOAuthError(OAuthInvalidClient, "unknown client")
+		}
+		return nil, err
+	}
+	if !client.HasRedirectURI(req.RedirectURI) {
+		return nil, newOAuthError(OAuthInvalidRequest, "redirect_uri is not registered for the client")
+	}
+	if !client.HasGrantType(GrantTypeAuthorizationCode) {
+		return nil, newOAuthError(OAuthUnauthorizedClient, "client is not allowed to use the authorization code grant")
+	}
+	return client, nil
+}
+
+func validateAuthorizeRequest(req *model.AuthorizeRequest) *OAuthError {
+	if req.ResponseType != responseTypeCode {
+		return newOAuthError(OAuthUnsupportedResponseType, "only the code response type is supported")
+	}
+	if !hasScope(req.Scope, auth.ScopeOpenID) {
+		return newOAuthError(OAuthInvalidScope, "openid scope is required")
+	}
+	if req.CodeChallenge == "" || req.CodeChallengeMethod != model.CodeChallengeMethodS256 {
+		return newOAuthError(OAuthInvalidRequest, "PKCE with the S256 method is required")
+	}
+	return nil
+}
+
+func hasScope(scope, expected string) bool {
+	for _, scp := range strings.Fields(scope) {
+		if scp == expected {
+			return true
+		}
+	}
+	return false
+}
+
+func authorizeErrorRedirect(req *model.AuthorizeRequest, oauthErr *OAuthError) string {
+	return redirectWithQuery(req.RedirectURI, url.Values{
+		"error":             {oauthErr.Code},
+		"error_description": {oauthErr.Description},
+		"state":             {req.State},
+	})
+}
+
+func redirectWithQuery(redirectURI string, values url.Values) string {
+	// redirect uri has already been matched against the registered ones
+	u, _ := url.Parse(redirectURI)
+	query := u.Query()
+	for k, v := range values {
+		if len(v) == 1 && v[0] == "" {
+			continue
+		}
+		query[k] = v
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+func authorizeRequestToQuery(req *model.AuthorizeRequest) url.Values {
+	return url.Values{
+		"response_type":         {req.ResponseType},
+		"client_id":             {req.ClientID},
+		"redirect_uri":          {req.RedirectURI},
+		"scope":                 {req.Scope},
+		"state":                 {req.State},
+		"nonce":                 {req.Nonce},
+		"code_challenge":        {req.CodeChallenge},
+		"code_challenge_method": {req.CodeChallengeMethod},
+	}
+}
@@ -0,0 +1,224 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"github.com/theruziev/oson_auth/internal/db"
+	"github.com/theruziev/oson_auth/internal/model"
+	"github.com/theruziev/oson_auth/internal/pkg/auth"
+)
+
+const (
+	testRedirectURI  = "https://app.example.com/callback"
+	testCodeVerifier = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+)
+
+// testOIDC is the provider with two public clients, the second one stands for any other client.
+type testOIDC struct {
+	s       *UserService
+	service *OIDCService
+	client  *model.Client
+	other   *model.Client
+}
+
+func newTestOIDC(t *testing.T) *testOIDC {
+	t.Helper()
+	s := newTestUserService(t)
+	clientStore := db.NewClientStore(s.pool)
+	o := &testOIDC{
+		s: s,
+		service: NewOIDCService(&auth.OIDCOption{
+			Issuer:         "https://auth.example.com",
+			LoginURL:       "https://auth.example.com/login",
+			CodeTTL:        time.Minute,
+			IDTokenTTL:     time.Hour,
+			ClientTokenTTL: time.Hour,
+		}, s.userStore, clientStore, db.NewAuthorizationCodeStore(s.pool), s, s.signer),
+	}
+	for _, client := range []**model.Client{&o.client, &o.other} {
+		*client = &model.Client{
+			ClientID:     uuid.New().String(),
+			Name:         "app",
+			RedirectURIs: []string{testRedirectURI},
+			IsPublic:     true,
+			GrantTypes:   []string{GrantTypeAuthorizationCode, GrantTypeRefreshToken},
+			CreatedAt:    time.Now(),
+			UpdatedAt:    time.Now(),
+		}
+		require.NoError(t, clientStore.Insert(context.Background(), *client))
+	}
+	return o
+}
+
+func codeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// authorize has the user consent to the client and returns the redirect to the client.
+func (o *testOIDC) authorize(t *testing.T, user *model.User, method string) *url.URL {
+	t.Helper()
+	redirect, err := o.service.Authorize(context.Background(), signIn(t, o.s, user), &model.AuthorizeRequest{
+		ResponseType:        "code",
+		ClientID:            o.client.ClientID,
+		RedirectURI:         testRedirectURI,
+		Scope:               auth.ScopeOpenID,
+		State:               "xyz",
+		CodeChallenge:       codeChallenge(testCodeVerifier),
+		CodeChallengeMethod: method,
+	}, true)
+	require.NoError(t, err)
+	u, err := url.Parse(redirect)
+	require.NoError(t, err)
+	return u
+}
+
+func (o *testOIDC) code(t *testing.T, user *model.User) string {
+	t.Helper()
+	code := o.authorize(t, user, model.CodeChallengeMethodS256).Query().Get("code")
+	require.NotEmpty(t, code)
+	return code
+}
+
+func (o *testOIDC) exchange(client *model.Client, code, verifier string) (*model.OIDCToken, error) {
+	return o.service.Token(context.Background(), &model.TokenRequest{
+		GrantType:    GrantTypeAuthorizationCode,
+		Code:         code,
+		RedirectURI:  testRedirectURI,
+		CodeVerifier: verifier,
+		ClientID:     client.ClientID,
+	})
+}
+
+func (o *testOIDC) refresh(client *model.Client, refreshToken string) (*model.OIDCToken, error) {
+	return o.service.Token(context.Background(), &model.TokenRequest{
+		GrantType:    GrantTypeRefreshToken,
+		RefreshToken: refreshToken,
+		ClientID:     client.ClientID,
+	})
+}
+
+func requireOAuthError(t *testing.T, err error, code string) {
+	t.Helper()
+	var oauthErr *OAuthError
+	require.True(t, errors.As(err, &oauthErr), err)
+	require.Equal(t, code, oauthErr.Code)
+}
+
+func TestAuthorizeRequiresPKCEWithS256(t *testing.T) {
+	o := newTestOIDC(t)
+	user := newTestUser(t, o.s)
+
+	redirect := o.authorize(t, user, "plain")
+	require.Empty(t, redirect.Query().Get("code"))
+	require.Equal(t, OAuthInvalidRequest, redirect.Query().Get("error"))
+	require.Equal(t, "xyz", redirect.Query().Get("state"))
+}
+
+func TestExchangeCodeVerifiesCodeVerifier(t *testing.T) {
+	o := newTestOIDC(t)
+	user := newTestUser(t, o.s)
+	code := o.code(t, user)
+
+	_, err := o.exchange(o.client, code, "another verifier of the same kind, but not the one")
+	requireOAuthError(t, err, OAuthInvalidGrant)
+	// a wrong guess spends the code
+	_, err = o.exchange(o.client, code, testCodeVerifier)
+	requireOAuthError(t, err, OAuthInvalidGrant)
+
+	token, err := o.exchange(o.client, o.code(t, user), testCodeVerifier)
+	require.NoError(t, err)
+	require.NotEmpty(t, token.AccessToken)
+	require.NotEmpty(t, token.IDToken)
+	require.NotEmpty(t, token.RefreshToken)
+}
+
+func TestAuthorizationCodeIsBoundToClient(t *testing.T) {
+	o := newTestOIDC(t)
+	user := newTestUser(t, o.s)
+	code := o.code(t, user)
+
+	_, err := o.exchange(o.other, code, testCodeVerifier)
+	requireOAuthError(t, err, OAuthInvalidGrant)
+	// the code is not spent by another client
+	_, err = o.exchange(o.client, code, testCodeVerifier)
+	require.NoError(t, err)
+}
+
+func TestReusedAuthorizationCodeRevokesItsTokens(t *testing.T) {
+	o := newTestOIDC(t)
+	user := newTestUser(t, o.s)
+	code := o.code(t, user)
+	token, err := o.exchange(o.client, code, testCodeVerifier)
+	require.NoError(t, err)
+	claim := parseToken(t, o.s, token.AccessToken)
+	requireRevoked(t, o.s.tokenRevoker, claim, false)
+
+	_, err = o.exchange(o.client, code, testCodeVerifier)
+	requireOAuthError(t, err, OAuthInvalidGrant)
+	requireRevoked(t, o.s.tokenRevoker, claim, true)
+	_, err = o.refresh(o.client, token.RefreshToken)
+	requireOAuthError(t, err, OAuthInvalidGrant)
+}
+
+func TestAuthorizationCodeRedeemedConcurrently(t *testing.T) {
+	o := newTestOIDC(t)
+	user := newTestUser(t, o.s)
+	code := o.code(t, user)
+
+	// the second redemption waits for the first one and revokes what it issued
+	tokens := make([]*model.OIDCToken, 2)
+	errs := make([]error, len(tokens))
+	var wg sync.WaitGroup
+	for i := range tokens {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			tokens[i], errs[i] = o.exchange(o.client, code, testCodeVerifier)
+		}(i)
+	}
+	wg.Wait()
+
+	var issued *model.OIDCToken
+	for i, err := range errs {
+		if err != nil {
+			requireOAuthError(t, err, OAuthInvalidGrant)
+			continue
+		}
+		require.Nil(t, issued)
+		issued = tokens[i]
+	}
+	require.NotNil(t, issued)
+	requireRevoked(t, o.s.tokenRevoker, parseToken(t, o.s, issued.AccessToken), true)
+}
+
+func TestRefreshGrant(t *testing.T) {
+	o := newTestOIDC(t)
+	user := newTestUser(t, o.s)
+	token, err := o.exchange(o.client, o.code(t, user), testCodeVerifier)
+	require.NoError(t, err)
+
+	// the refresh token only works for the client it was issued to
+	_, err = o.refresh(o.other, token.RefreshToken)
+	requireOAuthError(t, err, OAuthInvalidGrant)
+
+	refreshed, err := o.refresh(o.client, token.RefreshToken)
+	require.NoError(t, err)
+	require.NotEmpty(t, refreshed.AccessToken)
+	require.NotEqual(t, token.RefreshToken, refreshed.RefreshToken)
+	claim := parseToken(t, o.s, refreshed.AccessToken)
+	require.Equal(t, user.PublicID, claim.PublicID)
+
+	// the rotated refresh token is spent
+	_, err = o.refresh(o.client, token.RefreshToken)
+	requireOAuthError(t, err, OAuthInvalidGrant)
+}
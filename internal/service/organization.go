@@ -0,0 +1,542 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/theruziev/oson_auth/internal/converter/message"
+	"github.com/theruziev/oson_auth/internal/db"
+	"github.com/theruziev/oson_auth/internal/event/constants"
+	"github.com/theruziev/oson_auth/internal/model"
+	"github.com/theruziev/oson_auth/internal/pkg/auth"
+	"github.com/theruziev/oson_auth/internal/pkg/dbx"
+	"github.com/theruziev/oson_auth/internal/pkg/errz"
+)
+
+// OrganizationService manages the team accounts. The role in the organization carried by the token
+// only routes the request, every change checks the membership as it is stored.
+type OrganizationService struct {
+	authOpt           *auth.AuthOption
+	organizationStore *db.OrganizationStore
+	userStore         *db.UserStore
+	sessionStore      *db.SessionStore
+	outboxStore       *db.OutBoxStore
+	userService       *UserService
+	audit             *AuditService
+}
+
+func NewOrganizationService(
+	authOpt *auth.AuthOption,
+	organizationStore *db.OrganizationStore,
+	userStore *db.UserStore,
+	sessionStore *db.SessionStore,
+	outboxStore *db.OutBoxStore,
+	userService *UserService,
+	audit *AuditService,
+) *OrganizationService {
+	return &OrganizationService{
+		authOpt:           authOpt,
+		organizationStore: organizationStore,
+		userStore:         userStore,
+		sessionStore:      sessionStore,
+		outboxStore:       outboxStore,
+		userService:       userService,
+		audit:             audit,
+	}
+}
+
+// Create creates an organization owned by the user.
+func (s *OrganizationService) Create(ctx context.Context, claim *auth.Claim, name string) (*model.Organization, error) {
+	user, err := s.userStore.Get(ctx, claim.PublicID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	org := &model.Organization{
+		PublicID:  uuid.New().String(),
+		Name:      name,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	err = s.userService.inTx(ctx, func(ctx context.Context) error {
+		if err := s.organizationStore.Insert(ctx, org); err != nil {
+			return err
+		}
+		if err := s.addMember(ctx, org, user, model.OrgRoleOwner); err != nil {
+			return err
+		}
+		return s.outboxStore.Add(ctx, &model.OutBox{
+			Topic:     constants.TopicOrganizationChanged,
+			Data:      message.ToOrganizationEvent(org),
+			Status:    model.CreatedStatus,
+			CreatedAt: now,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.audit.Record(ctx, user, model.AuditOrgJoined, map[string]string{"organization": org.PublicID})
+	return org, nil
+}
+
+func (s *OrganizationService) ListByUser(ctx context.Context, claim *auth.Claim) ([]*model.UserOrganization, error) {
+	user, err := s.userStore.Get(ctx, claim.PublicID)
+	if err != nil {
+		return nil, err
+	}
+	return s.organizationStore.ListByUser(ctx, user.ID)
+}
+
+// Switch makes the organization the active one of the session and returns an access token acting within it.
+// The refresh token of the session is kept, refreshed tokens act within the organization as well.
+func (s *OrganizationService) Switch(ctx context.Context, claim *auth.Claim, orgPublicID string) (*model.AuthToken, error) {
+	if claim.SessionID == "" {
+		return nil, errz.BadRequestErr.New("only tokens of a session can switch the organization")
+	}
+	user, err := s.userStore.Get(ctx, claim.PublicID)
+	if err != nil {
+		return nil, err
+	}
+	org, err := s.organizationStore.Get(ctx, orgPublicID)
+	if err != nil {
+		if dbx.IsErrNoRows(err) {
+			return nil, errz.NotFoundErr.New("organization not found")
+		}
+		return nil, err
+	}
+	if _, err := s.organizationStore.GetMembership(ctx, org.ID, user.ID); err != nil {
+		// organizations of others are not revealed
+		if dbx.IsErrNoRows(err) {
+			return nil, errz.NotFoundErr.New("organization not found")
+		}
+		return nil, err
+	}
+
+	session, err := s.sessionStore.GetByPublicID(ctx, claim.SessionID)
+	if err != nil {
+		return nil, err
+	}
+	if session.UserID != user.ID || !session.IsActive(time.Now()) {
+		return nil, errz.BadRequestErr.New("session is not active")
+	}
+	if err := s.sessionStore.SetOrganization(ctx, session.ID, &org.ID); err != nil {
+		return nil, err
+	}
+	session.OrganizationID = &org.ID
+
+	return s.userService.issueAccessToken(ctx, user, session)
+}
+
+// Current returns the active organization of the token with the membership of the user in it.
+func (s *OrganizationService) Current(ctx context.Context, claim *auth.Claim) (*model.Organization, *model.Membership, error) {
+	_, org, membership, err := s.currentMembership(ctx, claim)
+	if err != nil {
+		return nil, nil, err
+	}
+	return org, membership, nil
+}
+
+func (s *OrganizationService) ListMembers(ctx context.Context, claim *auth.Claim) ([]*model.Member, error) {
+	_, org, _, err := s.currentMembership(ctx, claim)
+	if err != nil {
+		return nil, err
+	}
+	return s.organizationStore.ListMembers(ctx, org.ID)
+}
+
+// ChangeMemberRole changes the role of a member. Admins manage members and admins,
+// owners are made and unmade by owners only, and the last owner stays an owner.
+func (s *OrganizationService) ChangeMemberRole(ctx context.Context, claim *auth.Claim, userPublicID string, role model.OrgRole) error {
+	if !role.IsValid() {
+		return errz.BadRequestErr.New("unknown role %s", role)
+	}
+	_, org, actor, err := s.currentMembership(ctx, claim)
+	if err != nil {
+		return err
+	}
+	if !actor.Role.CanManage() {
+		return errz.ForbiddenErr.New("only owners and admins can change roles")
+	}
+	user, membership, err := s.member(ctx, org, userPublicID)
+	if err != nil {
+		return err
+	}
+	if membership.Role == role {
+		return nil
+	}
+	if (membership.Role == model.OrgRoleOwner || role == model.OrgRoleOwner) && actor.Role != model.OrgRoleOwner {
+		return errz.ForbiddenErr.New("only owners can change owners")
+	}
+
+	err = s.userService.inTx(ctx, func(ctx context.Context) error {
+		if role != model.OrgRoleOwner {
+			if err := s.checkNotLastOwner(ctx, org, membership); err != nil {
+				return err
+			}
+		}
+		if err := s.organizationStore.SetMemberRole(ctx, membership.ID, role); err != nil {
+			return err
+		}
+		return s.outboxStore.Add(ctx, &model.OutBox{
+			Topic:     constants.TopicOrganizationMembership,
+			Data:      message.ToMembershipEvent(org, user.PublicID, role, false),
+			Status:    model.CreatedStatus,
+			CreatedAt: time.Now(),
+		})
+	})
+	if err != nil {
+		return err
+	}
+	s.audit.Record(ctx, user, model.AuditOrgRoleChanged, map[string]string{
+		"organization": org.PublicID,
+		"actor":        claim.PublicID,
+		"from":         string(membership.Role),
+		"to":           string(role),
+	})
+	return nil
+}
+
+// RemoveMember removes a member, members can remove themselves to leave the organization.
+// The removed user keeps acting within the organization until the token expires, but can't change it anymore.
+func (s *OrganizationService) RemoveMember(ctx context.Context, claim *auth.Claim, userPublicID string) error {
+	_, org, actor, err := s.currentMembership(ctx, claim)
+	if err != nil {
+		return err
+	}
+	user, membership, err := s.member(ctx, org, userPublicID)
+	if err != nil {
+		return err
+	}
+	if membership.ID != actor.ID {
+		if !actor.Role.CanManage() {
+			return errz.ForbiddenErr.New("only owners and admins can remove members")
+		}
+		if membership.Role == model.OrgRoleOwner && actor.Role != model.OrgRoleOwner {
+			return errz.ForbiddenErr.New("only owners can remove owners")
+		}
+	}
+
+	err = s.userService.inTx(ctx, func(ctx context.Context) error {
+		if err := s.checkNotLastOwner(ctx, org, membership); err != nil {
+			return err
+		}
+		if err := s.organizationStore.DeleteMembership(ctx, membership.ID); err != nil {
+			return err
+		}
+		return s.outboxStore.Add(ctx, &model.OutBox{
+			Topic:     constants.TopicOrganizationMembership,
+			Data:      message.ToMembershipEvent(org, user.PublicID, membership.Role, true),
+			Status:    model.CreatedStatus,
+			CreatedAt: time.Now(),
+		})
+	})
+	if err != nil {
+		return err
+	}
+	s.audit.Record(ctx, user, model.AuditOrgLeft, map[string]string{
+		"organization": org.PublicID,
+		"actor":        claim.PublicID,
+	})
+	return nil
+}
+
+// Invite sends an invite to the email, an earlier invite of the email stops working.
+func (s *OrganizationService) Invite(ctx context.Context, claim *auth.Claim, email string, role model.OrgRole) (*model.OrganizationInvite, error) {
+	if !role.IsValid() {
+		return nil, errz.BadRequestErr.New("unknown role %s", role)
+	}
+	inviter, org, actor, err := s.currentMembership(ctx, claim)
+	if err != nil {
+		return nil, err
+	}
+	if !actor.Role.CanManage() {
+		return nil, errz.ForbiddenErr.New("only owners and admins can invite")
+	}
+	if role == model.OrgRoleOwner && actor.Role != model.OrgRoleOwner {
+		return nil, errz.ForbiddenErr.New("only owners can invite owners")
+	}
+	if existing, err := s.userStore.GetByEmail(ctx, email); err == nil {
+		if _, err := s.organizationStore.GetMembership(ctx, org.ID, existing.ID); err == nil {
+			return nil, errz.ConflictErr.New("user is already a member")
+		} else if !dbx.IsErrNoRows(err) {
+			return nil, err
+		}
+	} else if !dbx.IsErrNoRows(err) {
+		return nil, err
+	}
+
+	token, tokenHash, err := auth.NewOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	invite := &model.OrganizationInvite{
+		PublicID:       uuid.New().String(),
+		OrganizationID: org.ID,
+		Email:          email,
+		Role:           role,
+		TokenHash:      tokenHash,
+		InvitedBy:      inviter.ID,
+		ExpiresAt:      now.Add(s.authOpt.OrgInviteTTL),
+		CreatedAt:      now,
+	}
+	err = s.userService.inTx(ctx, func(ctx context.Context) error {
+		if err := s.organizationStore.RevokeInvitesByEmail(ctx, org.ID, email); err != nil {
+			return err
+		}
+		if err := s.organizationStore.InsertInvite(ctx, invite); err != nil {
+			return err
+		}
+		return s.outboxStore.Add(ctx, &model.OutBox{
+			Topic:     constants.TopicOrganizationInvite,
+			Data:      message.ToOrganizationInviteEvent(org, invite, inviter, token),
+			Status:    model.CreatedStatus,
+			CreatedAt: now,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return invite, nil
+}
+
+func (s *OrganizationService) ListInvites(ctx context.Context, claim *auth.Claim) ([]*model.OrganizationInvite, error) {
+	_, org, actor, err := s.currentMembership(ctx, claim)
+	if err != nil {
+		return nil, err
+	}
+	if !actor.Role.CanManage() {
+		return nil, errz.ForbiddenErr.New("only owners and admins can see invites")
+	}
+	return s.organizationStore.ListPendingInvites(ctx, org.ID)
+}
+
+func (s *OrganizationService) RevokeInvite(ctx context.Context, claim *auth.Claim, invitePublicID string) error {
+	_, org, actor, err := s.currentMembership(ctx, claim)
+	if err != nil {
+		return err
+	}
+	if !actor.Role.CanManage() {
+		return errz.ForbiddenErr.New("only owners and admins can revoke invites")
+	}
+	found, err := s.organizationStore.RevokeInvite(ctx, org.ID, invitePublicID)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return errz.NotFoundErr.New("invite not found")
+	}
+	return nil
+}
+
+// GetInvite describes the invite behind the link.
+func (s *OrganizationService) GetInvite(ctx context.Context, token string) (*model.InviteInfo, error) {
+	invite, org, err := s.activeInvite(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	_, err = s.userStore.GetByEmail(ctx, invite.Email)
+	if err != nil && !dbx.IsErrNoRows(err) {
+		return nil, err
+	}
+	return &model.InviteInfo{
+		Organization:  org,
+		Invite:        invite,
+		AccountExists: err == nil,
+	}, nil
+}
+
+// AcceptInvite adds the signed in user to the organization, the invite has to be sent to the email of the user.
+func (s *OrganizationService) AcceptInvite(ctx context.Context, claim *auth.Claim, token string) (*model.Organization, error) {
+	invite, org, err := s.activeInvite(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	user, err := s.userStore.Get(ctx, claim.PublicID)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.EqualFold(user.Email, invite.Email) {
+		return nil, errz.ForbiddenErr.New("invite was sent to another email")
+	}
+
+	if err := s.acceptInvite(ctx, invite, org, user, nil); err != nil {
+		return nil, err
+	}
+	return org, nil
+}
+
+// RegisterWithInvite creates the account of the invited email and adds it to the organization.
+// Following the link proves the email, so the account is active right away.
+func (s *OrganizationService) RegisterWithInvite(ctx context.Context, token string, req *model.RegisterRequest) (*model.User, error) {
+	invite, org, err := s.activeInvite(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	req.Email = invite.Email
+	if err := s.userService.checkEmailAvailable(ctx, req.Email); err != nil {
+		return nil, err
+	}
+	user, err := s.userService.newUser(req)
+	if err != nil {
+		return nil, err
+	}
+	user.Status = model.UserStatusActivate
+
+	err = s.acceptInvite(ctx, invite, org, user, func(ctx context.Context) error {
+		if err := s.userService.insertUser(ctx, user); err != nil {
+			return err
+		}
+		return s.outboxStore.Add(ctx, &model.OutBox{
+			Topic:     constants.TopicUserChanged,
+			Data:      message.ToUserEvent(user),
+			Status:    model.CreatedStatus,
+			CreatedAt: time.Now(),
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// acceptInvite uses the invite and adds the user, before runs first in the same transaction.
+func (s *OrganizationService) acceptInvite(
+	ctx context.Context,
+	invite *model.OrganizationInvite,
+	org *model.Organization,
+	user *model.User,
+	before func(ctx context.Context) error,
+) error {
+	err := s.userService.inTx(ctx, func(ctx context.Context) error {
+		if before != nil {
+			if err := before(ctx); err != nil {
+				return err
+			}
+		}
+		isFirstUse, err := s.organizationStore.AcceptInvite(ctx, invite.ID)
+		if err != nil {
+			return err
+		}
+		if !isFirstUse {
+			return errz.BadRequestErr.New("invite already used")
+		}
+		if err := s.addMember(ctx, org, user, invite.Role); err != nil {
+			if dbx.IsDuplicateErr(err) {
+				return errz.ConflictErr.New("user is already a member")
+			}
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	s.audit.Record(ctx, user, model.AuditOrgJoined, map[string]string{"organization": org.PublicID})
+	return nil
+}
+
+func (s *OrganizationService) addMember(ctx context.Context, org *model.Organization, user *model.User, role model.OrgRole) error {
+	now := time.Now()
+	if err := s.organizationStore.InsertMembership(ctx, &model.Membership{
+		OrganizationID: org.ID,
+		UserID:         user.ID,
+		Role:           role,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}); err != nil {
+		return err
+	}
+	return s.outboxStore.Add(ctx, &model.OutBox{
+		Topic:     constants.TopicOrganizationMembership,
+		Data:      message.ToMembershipEvent(org, user.PublicID, role, false),
+		Status:    model.CreatedStatus,
+		CreatedAt: now,
+	})
+}
+
+func (s *OrganizationService) activeInvite(ctx context.Context, token string) (*model.OrganizationInvite, *model.Organization, error) {
+	invite, err := s.organizationStore.GetInviteByHash(ctx, auth.HashOpaqueToken(token))
+	if err != nil {
+		if dbx.IsErrNoRows(err) {
+			return nil, nil, errz.NotFoundErr.New("unknown invite")
+		}
+		return nil, nil, err
+	}
+	if !invite.IsActive(time.Now()) {
+		return nil, nil, errz.BadRequestErr.New("invite is no longer valid")
+	}
+	org, err := s.organizationStore.GetByID(ctx, invite.OrganizationID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return invite, org, nil
+}
+
+// currentMembership loads the active organization of the token and the membership of the user in it.
+func (s *OrganizationService) currentMembership(
+	ctx context.Context,
+	claim *auth.Claim,
+) (*model.User, *model.Organization, *model.Membership, error) {
+	user, err := s.userStore.Get(ctx, claim.PublicID)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	org, err := s.organizationStore.Get(ctx, claim.OrgID)
+	if err != nil {
+		if dbx.IsErrNoRows(err) {
+			return nil, nil, nil, errz.NotFoundErr.New("organization not found")
+		}
+		return nil, nil, nil, err
+	}
+	membership, err := s.organizationStore.GetMembership(ctx, org.ID, user.ID)
+	if err != nil {
+		if dbx.IsErrNoRows(err) {
+			return nil, nil, nil, errz.ForbiddenErr.New("not a member of the organization")
+		}
+		return nil, nil, nil, err
+	}
+	return user, org, membership, nil
+}
+
+func (s *OrganizationService) member(ctx context.Context, org *model.Organization, userPublicID string) (*model.User, *model.Membership, error) {
+	user, err := s.userStore.Get(ctx, userPublicID)
+	if err != nil {
+		if dbx.IsErrNoRows(err) {
+			return nil, nil, errz.NotFoundErr.New("member not found")
+		}
+		return nil, nil, err
+	}
+	membership, err := s.organizationStore.GetMembership(ctx, org.ID, user.ID)
+	if err != nil {
+		if dbx.IsErrNoRows(err) {
+			return nil, nil, errz.NotFoundErr.New("member not found")
+		}
+		return nil, nil, err
+	}
+	return user, membership, nil
+}
+
+// checkNotLastOwner makes sure another owner stays once the membership stops being one. It runs in the transaction
+// of the change and locks the owners, two owners leaving at once can't both pass it.
+func (s *OrganizationService) checkNotLastOwner(ctx context.Context, org *model.Organization, membership *model.Membership) error {
+	owners, err := s.organizationStore.LockOwners(ctx, org.ID)
+	if err != nil {
+		return err
+	}
+	isOwner, others := false, 0
+	for _, id := range owners {
+		if id == membership.ID {
+			isOwner = true
+		} else {
+			others++
+		}
+	}
+	if isOwner && others == 0 {
+		return errz.BadRequestErr.New("the organization needs another owner first")
+	}
+	return nil
+}
@@ -0,0 +1,237 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"github.com/theruziev/oson_auth/internal/model"
+	"github.com/theruziev/oson_auth/internal/pkg/auth"
+	"github.com/theruziev/oson_auth/internal/pkg/dbx"
+	"github.com/theruziev/oson_auth/internal/pkg/errz"
+)
+
+// testOrganization is an organization with a user of every role of the test.
+type testOrganization struct {
+	s       *UserService
+	org     *model.Organization
+	service *OrganizationService
+	users   map[model.OrgRole]*model.User
+	owners  []*model.User
+}
+
+// newTestOrganization creates users with the roles, the first one has to be the owner creating the organization.
+// A role given twice makes a second user with it.
+func newTestOrganization(t *testing.T, roles ...model.OrgRole) *testOrganization {
+	t.Helper()
+	s := newTestUserService(t)
+	ctx := context.Background()
+	o := &testOrganization{
+		s:       s,
+		service: NewOrganizationService(s.authOpt, s.organizationStore, s.userStore, s.sessionStore, s.outboxStore, s, s.audit),
+		users:   make(map[model.OrgRole]*model.User),
+	}
+	for i, role := range roles {
+		user := newTestUser(t, s)
+		if i == 0 {
+			require.Equal(t, model.OrgRoleOwner, role)
+			org, err := o.service.Create(ctx, signIn(t, s, user), "acme")
+			require.NoError(t, err)
+			o.org = org
+		} else {
+			require.NoError(t, s.organizationStore.InsertMembership(ctx, &model.Membership{
+				OrganizationID: o.org.ID,
+				UserID:         user.ID,
+				Role:           role,
+				CreatedAt:      time.Now(),
+				UpdatedAt:      time.Now(),
+			}))
+		}
+		if _, ok := o.users[role]; !ok {
+			o.users[role] = user
+		}
+		if role == model.OrgRoleOwner {
+			o.owners = append(o.owners, user)
+		}
+	}
+	// an outsider is a user of the service without a membership
+	o.users[""] = newTestUser(t, s)
+	return o
+}
+
+// claim is the claim of the user acting within the organization.
+func (o *testOrganization) claim(t *testing.T, user *model.User) *auth.Claim {
+	claim := signIn(t, o.s, user)
+	claim.OrgID = o.org.PublicID
+	claim.OrgRole = string(o.role(t, user))
+	return claim
+}
+
+// role is the stored role of the user in the organization, empty when the user is not a member.
+func (o *testOrganization) role(t *testing.T, user *model.User) model.OrgRole {
+	membership, err := o.s.organizationStore.GetMembership(context.Background(), o.org.ID, user.ID)
+	if dbx.IsErrNoRows(err) {
+		return ""
+	}
+	require.NoError(t, err)
+	return membership.Role
+}
+
+func TestChangeMemberRole(t *testing.T) {
+	owner, admin, member := model.OrgRoleOwner, model.OrgRoleAdmin, model.OrgRoleMember
+	tests := []struct {
+		name   string
+		actor  model.OrgRole
+		target model.OrgRole
+		role   model.OrgRole
+		err    *errz.CustomError
+	}{
+		{name: "member can't change roles", actor: member, target: admin, role: member, err: errz.ForbiddenErr},
+		{name: "outsider can't change roles", actor: "", target: member, role: admin, err: errz.ForbiddenErr},
+		{name: "admin promotes member", actor: admin, target: member, role: admin},
+		{name: "admin can't make owners", actor: admin, target: member, role: owner, err: errz.ForbiddenErr},
+		{name: "admin can't demote owners", actor: admin, target: owner, role: member, err: errz.ForbiddenErr},
+		{name: "owner makes owners", actor: owner, target: admin, role: owner},
+		{name: "last owner stays owner", actor: owner, target: owner, role: admin, err: errz.BadRequestErr},
+		{name: "unknown role", actor: owner, target: member, role: "root", err: errz.BadRequestErr},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := newTestOrganization(t, owner, admin, member)
+			target := o.users[tt.target]
+
+			err := o.service.ChangeMemberRole(context.Background(), o.claim(t, o.users[tt.actor]), target.PublicID, tt.role)
+			if tt.err != nil {
+				require.True(t, tt.err.Is(err), err)
+				require.Equal(t, tt.target, o.role(t, target))
+				require.NotContains(t, auditTrail(t, o.s, target), model.AuditOrgRoleChanged)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.role, o.role(t, target))
+			require.Contains(t, auditTrail(t, o.s, target), model.AuditOrgRoleChanged)
+		})
+	}
+}
+
+func TestChangeMemberRoleOfAnotherOwner(t *testing.T) {
+	o := newTestOrganization(t, model.OrgRoleOwner, model.OrgRoleOwner)
+	first, second := o.owners[0], o.owners[1]
+
+	// with another owner left the first one can step down, the second one has to stay
+	require.NoError(t, o.service.ChangeMemberRole(context.Background(), o.claim(t, second), first.PublicID, model.OrgRoleAdmin))
+	require.Equal(t, model.OrgRoleAdmin, o.role(t, first))
+	err := o.service.ChangeMemberRole(context.Background(), o.claim(t, second), second.PublicID, model.OrgRoleAdmin)
+	require.True(t, errz.BadRequestErr.Is(err), err)
+}
+
+func TestOwnersLeaveConcurrently(t *testing.T) {
+	o := newTestOrganization(t, model.OrgRoleOwner, model.OrgRoleOwner)
+	claims := []*auth.Claim{o.claim(t, o.owners[0]), o.claim(t, o.owners[1])}
+
+	// both owners see another owner before they leave, only one of them may go
+	errs := make([]error, len(claims))
+	var wg sync.WaitGroup
+	for i, claim := range claims {
+		wg.Add(1)
+		go func(i int, claim *auth.Claim) {
+			defer wg.Done()
+			errs[i] = o.service.RemoveMember(context.Background(), claim, claim.PublicID)
+		}(i, claim)
+	}
+	wg.Wait()
+
+	left := 0
+	for _, err := range errs {
+		if err == nil {
+			left++
+			continue
+		}
+		require.True(t, errz.BadRequestErr.Is(err), err)
+	}
+	require.Equal(t, 1, left)
+	members, err := o.s.organizationStore.ListMembers(context.Background(), o.org.ID)
+	require.NoError(t, err)
+	require.Len(t, members, 1)
+	require.Equal(t, model.OrgRoleOwner, members[0].Role)
+}
+
+func TestRemoveMember(t *testing.T) {
+	owner, admin, member := model.OrgRoleOwner, model.OrgRoleAdmin, model.OrgRoleMember
+	tests := []struct {
+		name   string
+		actor  model.OrgRole
+		target model.OrgRole
+		err    *errz.CustomError
+	}{
+		{name: "member can't remove others", actor: member, target: admin, err: errz.ForbiddenErr},
+		{name: "member leaves", actor: member, target: member},
+		{name: "admin removes member", actor: admin, target: member},
+		{name: "admin can't remove owners", actor: admin, target: owner, err: errz.ForbiddenErr},
+		{name: "last owner can't leave", actor: owner, target: owner, err: errz.BadRequestErr},
+		{name: "outsider is not a member", actor: owner, target: "", err: errz.NotFoundErr},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := newTestOrganization(t, owner, admin, member)
+			target := o.users[tt.target]
+
+			err := o.service.RemoveMember(context.Background(), o.claim(t, o.users[tt.actor]), target.PublicID)
+			if tt.err != nil {
+				require.True(t, tt.err.Is(err), err)
+				require.Equal(t, tt.target, o.role(t, target))
+				return
+			}
+			require.NoError(t, err)
+			require.Empty(t, o.role(t, target))
+			require.Contains(t, auditTrail(t, o.s, target), model.AuditOrgLeft)
+		})
+	}
+}
+
+func TestInviteRoles(t *testing.T) {
+	o := newTestOrganization(t, model.OrgRoleOwner, model.OrgRoleAdmin, model.OrgRoleMember)
+	ctx := context.Background()
+	owner := o.claim(t, o.users[model.OrgRoleOwner])
+	admin := o.claim(t, o.users[model.OrgRoleAdmin])
+
+	_, err := o.service.Invite(ctx, o.claim(t, o.users[model.OrgRoleMember]), "new@example.com", model.OrgRoleMember)
+	require.True(t, errz.ForbiddenErr.Is(err), err)
+	_, err = o.service.Invite(ctx, admin, "new@example.com", model.OrgRoleOwner)
+	require.True(t, errz.ForbiddenErr.Is(err), err)
+	_, err = o.service.Invite(ctx, admin, o.users[model.OrgRoleMember].Email, model.OrgRoleMember)
+	require.True(t, errz.ConflictErr.Is(err), err)
+	invites, err := o.service.ListInvites(ctx, owner)
+	require.NoError(t, err)
+	require.Empty(t, invites)
+
+	invite, err := o.service.Invite(ctx, owner, "new@example.com", model.OrgRoleOwner)
+	require.NoError(t, err)
+	require.Equal(t, model.OrgRoleOwner, invite.Role)
+	invites, err = o.service.ListInvites(ctx, owner)
+	require.NoError(t, err)
+	require.Len(t, invites, 1)
+}
+
+func TestRevokeInvite(t *testing.T) {
+	o := newTestOrganization(t, model.OrgRoleOwner, model.OrgRoleMember)
+	ctx := context.Background()
+	owner := o.claim(t, o.users[model.OrgRoleOwner])
+	invite, err := o.service.Invite(ctx, owner, "new@example.com", model.OrgRoleMember)
+	require.NoError(t, err)
+
+	err = o.service.RevokeInvite(ctx, o.claim(t, o.users[model.OrgRoleMember]), invite.PublicID)
+	require.True(t, errz.ForbiddenErr.Is(err), err)
+	err = o.service.RevokeInvite(ctx, owner, uuid.New().String())
+	require.True(t, errz.NotFoundErr.Is(err), err)
+
+	require.NoError(t, o.service.RevokeInvite(ctx, owner, invite.PublicID))
+	invites, err := o.service.ListInvites(ctx, owner)
+	require.NoError(t, err)
+	require.Empty(t, invites)
+	err = o.service.RevokeInvite(ctx, owner, invite.PublicID)
+	require.True(t, errz.NotFoundErr.Is(err), err)
+}
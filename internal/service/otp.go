@@ -4,20 +4,33 @@ import (
 	"context"
 	"fmt"
 
+	"github.com/theruziev/oson_auth/internal/db"
 	"github.com/theruziev/oson_auth/internal/model"
+	"github.com/theruziev/oson_auth/internal/pkg/auth"
+	"github.com/theruziev/oson_auth/internal/pkg/errz"
 )
 
+// reencryptBatchSize is how many users ReencryptOtpSecrets loads at a time.
+const reencryptBatchSize = 100
+
+// RequestEnableOTPStep1 starts the enrolment of an authenticator. The enrolled one can't be replaced
+// here, otherwise a stolen token would be enough to take over the second factor, it has to be disabled
+// with a re-authentication first.
 func (s *UserService) RequestEnableOTPStep1(ctx context.Context, publicID string) (*model.OtpToken, error) {
 	user, err := s.userStore.Get(ctx, publicID)
 	if err != nil {
 		return nil, err
 	}
+	if user.OtpEnabled {
+		return nil, errz.ConflictErr.New("otp is already enabled")
+	}
 	otpRes, err := s.otp.Generate(ctx, user.PublicID)
 	if err != nil {
 		return nil, err
 	}
 
-	err = s.userStore.SetOtpSecret(ctx, user.PublicID, otpRes.Secret)
+	params := otpRes.Params
+	err = s.userStore.SetOtpSecret(ctx, user.PublicID, otpRes.Secret, params.Algorithm, params.Digits, int(params.Period))
 	if err != nil {
 		return nil, err
 	}
@@ -27,42 +40,104 @@ func (s *UserService) RequestEnableOTPStep1(ctx context.Context, publicID string
 	}, nil
 }
 
+// validateOtp checks the code with the parameters the user enrolled with. An accepted code is not
+// accepted again, neither is a code of an earlier time step.
+func (s *UserService) validateOtp(ctx context.Context, user *model.User, code string) (bool, error) {
+	step, ok, err := s.otp.ValidateCode(ctx, otpParams(user), user.OtpSecret, code)
+	if err != nil || !ok {
+		return false, err
+	}
+	return s.userStore.UseOtpStep(ctx, user.PublicID, step)
+}
+
+func otpParams(user *model.User) auth.OtpParams {
+	return auth.OtpParams{
+		Algorithm: user.OtpAlgorithm,
+		Digits:    user.OtpDigits,
+		Period:    uint(user.OtpPeriod),
+	}
+}
+
 func (s *UserService) RequestEnableOTPStep2(ctx context.Context, publicID, code string) (*model.OtpRecoveryCode, error) {
 	user, err := s.userStore.Get(ctx, publicID)
 	if err != nil {
 		return nil, err
 	}
-	isValid, err := s.otp.ValidateCode(ctx, user.OtpSecret, code)
+	if user.OtpEnabled {
+		return nil, errz.ConflictErr.New("otp is already enabled")
+	}
+	isValid, err := s.validateOtp(ctx, user, code)
 	if err != nil {
 		return nil, err
 	}
 	if !isValid {
 		return nil, fmt.Errorf("invalid otp code")
 	}
-	codes, err := s.otp.GenerateRecoveryCodes(ctx)
+	// the codes come with the first enrolment only, new ones need a re-authentication, see RegenerateRecoveryCodes
+	var codes []string
+	err = s.inTx(ctx, func(ctx context.Context) error {
+		enabled, err := s.userStore.EnableOtp(ctx, user.PublicID)
+		if err != nil {
+			return err
+		}
+		if !enabled {
+			return errz.ConflictErr.New("otp is already enabled")
+		}
+		codes, err = s.issueRecoveryCodes(ctx, user)
+		return err
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate recovery code: %w", err)
-	}
-
-	if err := s.userStore.SetOtpRecoveryCodes(ctx, user.PublicID, codes); err != nil {
-		return nil, err
-	}
-	if err := s.userStore.SetOtpEnabled(ctx, user.PublicID, true); err != nil {
 		return nil, err
 	}
+	s.audit.Record(ctx, user, model.AuditOtpEnabled, nil)
 	return &model.OtpRecoveryCode{
 		Codes: codes,
 	}, nil
 }
 
-func (s *UserService) DisableOTP(ctx context.Context, publicID string) error {
-	user, err := s.userStore.Get(ctx, publicID)
+// DisableOTP turns the otp off. The trusted devices are forgotten as well, they skip a second factor
+// the user no longer has and would skip the one enrolled next.
+func (s *UserService) DisableOTP(ctx context.Context, claim *auth.Claim, proof *model.ReauthProof) error {
+	user, err := s.userStore.Get(ctx, claim.PublicID)
 	if err != nil {
 		return err
 	}
+	if err := s.verifyReauth(ctx, claim, user, proof); err != nil {
+		return err
+	}
 
-	if err := s.userStore.SetOtpEnabled(ctx, user.PublicID, false); err != nil {
+	err = s.inTx(ctx, func(ctx context.Context) error {
+		if err := s.userStore.SetOtpEnabled(ctx, user.PublicID, false); err != nil {
+			return err
+		}
+		// enrolling again issues new codes, the old ones must not come back to life with it
+		if err := s.recoveryCodeStore.DeleteByUser(ctx, user.ID); err != nil {
+			return err
+		}
+		return s.trustedDeviceStore.RevokeAllByUser(ctx, user.ID)
+	})
+	if err != nil {
 		return err
 	}
+	s.audit.Record(ctx, user, model.AuditOtpDisabled, nil)
 	return nil
 }
+
+// ReencryptOtpSecrets rewrites the otp secrets that are stored in plain text or under a retired key
+// with the primary key, so the retired key can be dropped afterwards. It returns the number of
+// rewritten secrets and is safe to run again after a failure.
+func ReencryptOtpSecrets(ctx context.Context, userStore *db.UserStore) (int, error) {
+	total := 0
+	var afterID uint64
+	for {
+		lastID, reencrypted, err := userStore.ReencryptOtpSecrets(ctx, afterID, reencryptBatchSize)
+		total += reencrypted
+		if err != nil {
+			return total, err
+		}
+		if lastID == 0 {
+			return total, nil
+		}
+		afterID = lastID
+	}
+}
@@ -0,0 +1,79 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/theruziev/oson_auth/internal/model"
+	"github.com/theruziev/oson_auth/internal/pkg/auth"
+	"github.com/theruziev/oson_auth/internal/pkg/passwordpolicy"
+)
+
+func requireReused(t *testing.T, err error) {
+	t.Helper()
+	var violation *passwordpolicy.ViolationError
+	require.True(t, errors.As(err, &violation), err)
+	require.Equal(t, passwordpolicy.CodeReused, violation.Violations[0].Code)
+}
+
+func TestPasswordHistory(t *testing.T) {
+	s := newTestUserService(t)
+	s.authOpt.PasswordPolicy.History = 3
+	ctx := context.Background()
+	user := newTestUser(t, s)
+	// the login is recent enough for every change of the test
+	claim := signIn(t, s, user)
+	proof := &model.ReauthProof{}
+
+	requireReused(t, s.ChangePassword(ctx, claim, testPassword, proof))
+	require.NoError(t, s.ChangePassword(ctx, claim, "second passphrase", proof))
+	require.NoError(t, s.ChangePassword(ctx, claim, "third passphrase", proof))
+
+	// the current password and the two before it are kept
+	requireReused(t, s.ChangePassword(ctx, claim, "third passphrase", proof))
+	requireReused(t, s.ChangePassword(ctx, claim, "second passphrase", proof))
+	requireReused(t, s.ChangePassword(ctx, claim, testPassword, proof))
+	ok, _, err := s.hasher.Verify("third passphrase", reloadUser(t, s, user).Password)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	require.NoError(t, s.ChangePassword(ctx, claim, "fourth passphrase", proof))
+	require.NoError(t, s.ChangePassword(ctx, claim, testPassword, proof))
+}
+
+func TestPasswordHistoryTurnedOff(t *testing.T) {
+	s := newTestUserService(t)
+	s.authOpt.PasswordPolicy.History = 0
+	user := newTestUser(t, s)
+
+	require.NoError(t, s.ChangePassword(context.Background(), signIn(t, s, user), testPassword, &model.ReauthProof{}))
+}
+
+func TestExpiredPasswordMustBeChanged(t *testing.T) {
+	s := newTestUserService(t)
+	s.authOpt.PasswordPolicy.MaxAge = time.Hour
+	ctx := context.Background()
+	user := newTestUser(t, s)
+	_, err := s.pool.Exec(ctx, "update users set password_changed_at = $1 where id = $2", time.Now().Add(-2*time.Hour), user.ID)
+	require.NoError(t, err)
+
+	// the login is held back, the token only allows the change
+	authToken, err := s.Auth(ctx, user.Email, testPassword, "")
+	require.NoError(t, err)
+	require.True(t, authToken.PasswordChangeRequired)
+	require.Empty(t, authToken.RefreshToken)
+	claim := parseToken(t, s, authToken.AuthToken)
+	require.Equal(t, []auth.Scope{auth.PasswordChangeScope}, claim.Scopes)
+	sessions, err := s.ListSessions(ctx, user.PublicID)
+	require.NoError(t, err)
+	require.Empty(t, sessions)
+
+	require.NoError(t, s.ChangePassword(ctx, claim, "a fresh passphrase", &model.ReauthProof{}))
+	authToken, err = s.Auth(ctx, user.Email, "a fresh passphrase", "")
+	require.NoError(t, err)
+	require.False(t, authToken.PasswordChangeRequired)
+	require.NotEmpty(t, authToken.RefreshToken)
+}
@@ -0,0 +1,56 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/theruziev/oson_auth/internal/model"
+	"github.com/theruziev/oson_auth/internal/pkg/auth"
+	"github.com/theruziev/oson_auth/internal/pkg/clientinfo"
+	"github.com/theruziev/oson_auth/internal/pkg/errz"
+	"github.com/theruziev/oson_auth/internal/pkg/lockout"
+)
+
+// verifyReauth makes sure the request comes from the user and not only with a token of the user.
+// A token of a recent login is enough, otherwise the user has to present the password or an otp code.
+// Failed proofs are counted like failed logins, so they can't be used to guess the password.
+func (s *UserService) verifyReauth(ctx context.Context, claim *auth.Claim, user *model.User, proof *model.ReauthProof) error {
+	ip := lockout.IP(clientinfo.FromContext(ctx).IP)
+	switch {
+	case proof.CurrentPassword != "":
+		account := lockout.Account(strings.ToLower(user.Email))
+		if err := s.limiter.Check(ctx, account, ip); err != nil {
+			return err
+		}
+		ok, _, err := s.hasher.Verify(proof.CurrentPassword, user.Password)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return s.failAttempt(ctx, errz.ForbiddenErr.New("incorrect current password"), account, ip)
+		}
+		return nil
+	case proof.OtpCode != "":
+		if !s.authOpt.Otp.Enabled || !user.OtpEnabled {
+			return errz.ForbiddenErr.New("otp is not enabled for the user")
+		}
+		account := twoFASubject(user)
+		if err := s.limiter.Check(ctx, account, ip); err != nil {
+			return err
+		}
+		// recovery codes are not accepted, they are meant to sign in when the authenticator is lost
+		ok, err := s.validateOtp(ctx, user, proof.OtpCode)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return s.failAttempt(ctx, errz.ForbiddenErr.New("incorrect otp code"), account, ip)
+		}
+		return nil
+	case claim.AuthenticatedWithin(time.Now(), s.authOpt.ReauthMaxAge):
+		return nil
+	default:
+		return errz.ForbiddenErr.New("re-authentication required")
+	}
+}
@@ -0,0 +1,106 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/theruziev/oson_auth/internal/model"
+	"github.com/theruziev/oson_auth/internal/pkg/errz"
+	"github.com/theruziev/oson_auth/internal/pkg/lockout"
+)
+
+func TestVerifyReauth(t *testing.T) {
+	s := newTestUserService(t)
+	ctx := context.Background()
+	user := newTestUser(t, s)
+	claim := signIn(t, s, user)
+	stale := staleClaim(claim)
+
+	// a token of a recent login is enough
+	require.NoError(t, s.verifyReauth(ctx, claim, user, &model.ReauthProof{}))
+
+	err := s.verifyReauth(ctx, stale, user, &model.ReauthProof{})
+	require.True(t, errz.ForbiddenErr.Is(err), err)
+	// a token without auth_time is as good as a stale one
+	withoutAuthTime := *claim
+	withoutAuthTime.AuthTime = nil
+	err = s.verifyReauth(ctx, &withoutAuthTime, user, &model.ReauthProof{})
+	require.True(t, errz.ForbiddenErr.Is(err), err)
+
+	err = s.verifyReauth(ctx, stale, user, &model.ReauthProof{CurrentPassword: "not the password"})
+	require.True(t, errz.ForbiddenErr.Is(err), err)
+	require.NoError(t, s.verifyReauth(ctx, stale, user, &model.ReauthProof{CurrentPassword: testPassword}))
+
+	// the otp is no proof until the user has enrolled
+	err = s.verifyReauth(ctx, stale, user, &model.ReauthProof{OtpCode: "123456"})
+	require.True(t, errz.ForbiddenErr.Is(err), err)
+
+	secret, _ := enrollTestOtp(t, s, user)
+	user = reloadUser(t, s, user)
+	code := otpCode(t, secret)
+	require.NoError(t, s.verifyReauth(ctx, stale, user, &model.ReauthProof{OtpCode: code}))
+	// a code proves the user once
+	err = s.verifyReauth(ctx, stale, user, &model.ReauthProof{OtpCode: code})
+	require.True(t, errz.ForbiddenErr.Is(err), err)
+}
+
+func TestVerifyReauthLockout(t *testing.T) {
+	s := newTestUserService(t)
+	ctx := context.Background()
+	user := newTestUser(t, s)
+	stale := staleClaim(signIn(t, s, user))
+
+	// the proofs are counted like logins, a stolen token can't be used to guess the password
+	for i := 0; i <= s.authOpt.Lockout.AccountFreeAttempts; i++ {
+		err := s.verifyReauth(ctx, stale, user, &model.ReauthProof{CurrentPassword: "not the password"})
+		require.True(t, errz.ForbiddenErr.Is(err), err)
+	}
+	err := s.verifyReauth(ctx, stale, user, &model.ReauthProof{CurrentPassword: testPassword})
+	_, locked := lockout.IsLocked(err)
+	require.True(t, locked, err)
+}
+
+func TestSensitiveChangesRequireReauth(t *testing.T) {
+	s := newTestUserService(t)
+	ctx := context.Background()
+	user := newTestUser(t, s)
+	claim := signIn(t, s, user)
+	_, codes := enrollTestOtp(t, s, user)
+	stale := staleClaim(claim)
+
+	err := s.ChangePassword(ctx, stale, "a brand new passphrase", &model.ReauthProof{})
+	require.True(t, errz.ForbiddenErr.Is(err), err)
+	err = s.DisableOTP(ctx, stale, &model.ReauthProof{})
+	require.True(t, errz.ForbiddenErr.Is(err), err)
+	_, err = s.RegenerateRecoveryCodes(ctx, stale, &model.ReauthProof{})
+	require.True(t, errz.ForbiddenErr.Is(err), err)
+
+	user = reloadUser(t, s, user)
+	ok, _, err := s.hasher.Verify(testPassword, user.Password)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.True(t, user.OtpEnabled)
+	remaining, err := s.RecoveryCodesRemaining(ctx, user)
+	require.NoError(t, err)
+	require.Equal(t, uint64(len(codes)), remaining)
+}
+
+func TestEnableOtpRefusesEnrolledUser(t *testing.T) {
+	s := newTestUserService(t)
+	ctx := context.Background()
+	user := newTestUser(t, s)
+	secret, codes := enrollTestOtp(t, s, user)
+
+	// a token alone must not replace the authenticator of the user
+	_, err := s.RequestEnableOTPStep1(ctx, user.PublicID)
+	require.True(t, errz.ConflictErr.Is(err), err)
+	user = reloadUser(t, s, user)
+	require.Equal(t, secret, user.OtpSecret)
+
+	_, err = s.RequestEnableOTPStep2(ctx, user.PublicID, otpCode(t, secret))
+	require.True(t, errz.ConflictErr.Is(err), err)
+	ok, err := s.useRecoveryCode(ctx, user, codes[0])
+	require.NoError(t, err)
+	require.True(t, ok)
+}
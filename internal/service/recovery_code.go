@@ -0,0 +1,83 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/theruziev/oson_auth/internal/model"
+	"github.com/theruziev/oson_auth/internal/pkg/auth"
+	"github.com/theruziev/oson_auth/internal/pkg/errz"
+)
+
+// issueRecoveryCodes replaces the recovery codes of the user with new ones. The codes are returned
+// only here, the store keeps their hashes.
+func (s *UserService) issueRecoveryCodes(ctx context.Context, user *model.User) ([]string, error) {
+	codes, err := s.otp.GenerateRecoveryCodes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	codeHashes := make([]string, 0, len(codes))
+	for _, code := range codes {
+		codeHashes = append(codeHashes, auth.HashRecoveryCode(code))
+	}
+
+	err = s.inTx(ctx, func(ctx context.Context) error {
+		if err := s.recoveryCodeStore.DeleteByUser(ctx, user.ID); err != nil {
+			return err
+		}
+		if err := s.recoveryCodeStore.Insert(ctx, user.ID, codeHashes, time.Now()); err != nil {
+			return err
+		}
+		// the enrolment issues the codes in its own transaction
+		return s.audit.Write(ctx, user, model.AuditRecoveryCodesIssued, nil)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// useRecoveryCode redeems the code, it reports false when the code is unknown or already used.
+func (s *UserService) useRecoveryCode(ctx context.Context, user *model.User, code string) (bool, error) {
+	codes, err := s.recoveryCodeStore.ListUnused(ctx, user.ID)
+	if err != nil {
+		return false, err
+	}
+	codeHashes := make([]string, 0, len(codes))
+	for _, recoveryCode := range codes {
+		codeHashes = append(codeHashes, recoveryCode.CodeHash)
+	}
+	i := auth.MatchRecoveryCode(code, codeHashes)
+	if i < 0 {
+		return false, nil
+	}
+	// a code redeemed twice at the same time is only accepted once
+	return s.recoveryCodeStore.Use(ctx, codes[i].ID)
+}
+
+// RegenerateRecoveryCodes issues new recovery codes, the ones issued before stop working.
+func (s *UserService) RegenerateRecoveryCodes(ctx context.Context, claim *auth.Claim, proof *model.ReauthProof) (*model.OtpRecoveryCode, error) {
+	user, err := s.userStore.Get(ctx, claim.PublicID)
+	if err != nil {
+		return nil, err
+	}
+	if !s.authOpt.Otp.Enabled || !user.OtpEnabled {
+		return nil, errz.BadRequestErr.New("otp is not enabled for the user")
+	}
+	if err := s.verifyReauth(ctx, claim, user, proof); err != nil {
+		return nil, err
+	}
+
+	codes, err := s.issueRecoveryCodes(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	return &model.OtpRecoveryCode{
+		Codes: codes,
+	}, nil
+}
+
+// RecoveryCodesRemaining counts the recovery codes the user has not used yet.
+func (s *UserService) RecoveryCodesRemaining(ctx context.Context, user *model.User) (uint64, error) {
+	return s.recoveryCodeStore.CountUnused(ctx, user.ID)
+}
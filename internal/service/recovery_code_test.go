@@ -0,0 +1,154 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+	"github.com/stretchr/testify/require"
+	"github.com/theruziev/oson_auth/internal/model"
+)
+
+func TestRecoveryCodeWorksOnce(t *testing.T) {
+	s := newTestUserService(t)
+	ctx := context.Background()
+	user := newTestUser(t, s)
+	_, codes := enrollTestOtp(t, s, user)
+	require.Len(t, codes, s.authOpt.Otp.RecoveryCodeCount)
+	stored, err := s.recoveryCodeStore.ListUnused(ctx, user.ID)
+	require.NoError(t, err)
+	require.Len(t, stored, len(codes))
+	for _, code := range stored {
+		require.NotContains(t, codes, code.CodeHash)
+	}
+
+	authToken, err := s.AuthTwoFA(ctx, signIn(t, s, user), codes[0], false)
+	require.NoError(t, err)
+	require.NotEmpty(t, authToken.RefreshToken)
+	require.Contains(t, auditTrail(t, s, user), model.AuditRecoveryCodeUsed)
+	remaining, err := s.RecoveryCodesRemaining(ctx, user)
+	require.NoError(t, err)
+	require.Equal(t, uint64(len(codes)-1), remaining)
+
+	_, err = s.AuthTwoFA(ctx, signIn(t, s, user), codes[0], false)
+	require.Error(t, err)
+	_, err = s.AuthTwoFA(ctx, signIn(t, s, user), codes[1], false)
+	require.NoError(t, err)
+}
+
+func TestRecoveryCodeRedeemedConcurrently(t *testing.T) {
+	s := newTestUserService(t)
+	user := newTestUser(t, s)
+	_, codes := enrollTestOtp(t, s, user)
+
+	// every request lists the code as unused, only one of them may redeem it
+	used := make([]bool, 5)
+	errs := make([]error, len(used))
+	var wg sync.WaitGroup
+	for i := range used {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			used[i], errs[i] = s.useRecoveryCode(context.Background(), user, codes[0])
+		}(i)
+	}
+	wg.Wait()
+
+	redeemed := 0
+	for i, ok := range used {
+		require.NoError(t, errs[i])
+		if ok {
+			redeemed++
+		}
+	}
+	require.Equal(t, 1, redeemed)
+	remaining, err := s.RecoveryCodesRemaining(context.Background(), user)
+	require.NoError(t, err)
+	require.Equal(t, uint64(len(codes)-1), remaining)
+}
+
+func TestRegenerateRecoveryCodes(t *testing.T) {
+	s := newTestUserService(t)
+	ctx := context.Background()
+	user := newTestUser(t, s)
+	_, old := enrollTestOtp(t, s, user)
+
+	stale := staleClaim(signIn(t, s, user))
+	recoveryCodes, err := s.RegenerateRecoveryCodes(ctx, stale, &model.ReauthProof{CurrentPassword: testPassword})
+	require.NoError(t, err)
+	require.Contains(t, auditTrail(t, s, user), model.AuditRecoveryCodesIssued)
+
+	// the codes issued before stop working
+	ok, err := s.useRecoveryCode(ctx, user, old[0])
+	require.NoError(t, err)
+	require.False(t, ok)
+	ok, err = s.useRecoveryCode(ctx, user, recoveryCodes.Codes[0])
+	require.NoError(t, err)
+	require.True(t, ok)
+}
+
+func TestEnrolmentIssuesRecoveryCodesOnce(t *testing.T) {
+	s := newTestUserService(t)
+	ctx := context.Background()
+	user := newTestUser(t, s)
+	token, err := s.RequestEnableOTPStep1(ctx, user.PublicID)
+	require.NoError(t, err)
+	key, err := otp.NewKeyFromURL(token.OtpURL)
+	require.NoError(t, err)
+
+	// two enrolments are finished at once, with the codes of both time steps within the skew
+	now := time.Now()
+	steps := []time.Time{now, now.Add(30 * time.Second)}
+	issued := make([]*model.OtpRecoveryCode, len(steps))
+	errs := make([]error, len(steps))
+	var wg sync.WaitGroup
+	for i, at := range steps {
+		code, err := totp.GenerateCode(key.Secret(), at)
+		require.NoError(t, err)
+		wg.Add(1)
+		go func(i int, code string) {
+			defer wg.Done()
+			issued[i], errs[i] = s.RequestEnableOTPStep2(context.Background(), user.PublicID, code)
+		}(i, code)
+	}
+	wg.Wait()
+
+	// one of them enables the otp, the codes of the other one are never stored
+	var codes []string
+	for i, err := range errs {
+		if err == nil {
+			require.Nil(t, codes)
+			codes = issued[i].Codes
+		}
+	}
+	require.NotNil(t, codes)
+	remaining, err := s.RecoveryCodesRemaining(ctx, user)
+	require.NoError(t, err)
+	require.Equal(t, uint64(len(codes)), remaining)
+	ok, err := s.useRecoveryCode(ctx, user, codes[0])
+	require.NoError(t, err)
+	require.True(t, ok)
+}
+
+func TestDisableOtpDropsRecoveryCodes(t *testing.T) {
+	s := newTestUserService(t)
+	ctx := context.Background()
+	user := newTestUser(t, s)
+	_, old := enrollTestOtp(t, s, user)
+
+	claim := staleClaim(signIn(t, s, user))
+	require.NoError(t, s.DisableOTP(ctx, claim, &model.ReauthProof{CurrentPassword: testPassword}))
+	require.False(t, reloadUser(t, s, user).OtpEnabled)
+	remaining, err := s.RecoveryCodesRemaining(ctx, user)
+	require.NoError(t, err)
+	require.Zero(t, remaining)
+	require.Contains(t, auditTrail(t, s, user), model.AuditOtpDisabled)
+
+	// the codes stop working, a later enrolment issues new ones
+	ok, err := s.useRecoveryCode(ctx, user, old[0])
+	require.NoError(t, err)
+	require.False(t, ok)
+}
@@ -0,0 +1,200 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/theruziev/oson_auth/internal/db"
+	"github.com/theruziev/oson_auth/internal/model"
+	"github.com/theruziev/oson_auth/internal/pkg/auth"
+	"github.com/theruziev/oson_auth/internal/pkg/cache"
+	"github.com/theruziev/oson_auth/internal/pkg/dbx"
+)
+
+// TokenRevoker keeps track of revoked access tokens. A token is revoked either by its jti, by its
+// session being revoked, by being issued before the user's tokens_valid_after timestamp or by the user
+// not being active. Every lookup is cached, a revocation made by another instance is visible after at
+// most cacheTTL, the instance that made it sees it immediately.
+type TokenRevoker struct {
+	userStore         *db.UserStore
+	sessionStore      *db.SessionStore
+	revokedTokenStore *db.RevokedTokenStore
+	cacheTTL          time.Duration
+
+	users           *cache.TTL[string, tokenOwner]
+	revokedSessions *cache.TTL[string, bool]
+
+	// the denylist of jti is loaded as a whole, every token has its own jti and looking each of them up
+	// would hit the database on the first request of every token
+	mu              sync.Mutex
+	revokedTokens   map[string]struct{}
+	revokedTokensAt time.Time
+}
+
+// tokenOwner is what the revoker needs to know about the user the tokens were issued to.
+type tokenOwner struct {
+	active     bool
+	validAfter time.Time
+}
+
+func NewTokenRevoker(
+	userStore *db.UserStore,
+	sessionStore *db.SessionStore,
+	revokedTokenStore *db.RevokedTokenStore,
+	cacheTTL time.Duration,
+) *TokenRevoker {
+	return &TokenRevoker{
+		userStore:         userStore,
+		sessionStore:      sessionStore,
+		revokedTokenStore: revokedTokenStore,
+		cacheTTL:          cacheTTL,
+		users:             cache.NewTTL[string, tokenOwner](cacheTTL),
+		revokedSessions:   cache.NewTTL[string, bool](cacheTTL),
+	}
+}
+
+func (r *TokenRevoker) IsRevoked(ctx context.Context, claim *auth.Claim) (bool, error) {
+	if claim.ID != "" {
+		isRevoked, err := r.isTokenRevoked(ctx, claim.ID)
+		if err != nil {
+			return false, err
+		}
+		if isRevoked {
+			return true, nil
+		}
+	}
+
+	if claim.SessionID != "" {
+		isRevoked, err := r.isSessionRevoked(ctx, claim.SessionID)
+		if err != nil {
+			return false, err
+		}
+		if isRevoked {
+			return true, nil
+		}
+	}
+
+	if claim.PublicID == "" {
+		return false, nil
+	}
+	owner, err := r.tokenOwner(ctx, claim.PublicID)
+	if err != nil {
+		return false, err
+	}
+	if !owner.active {
+		return true, nil
+	}
+	if owner.validAfter.IsZero() {
+		return false, nil
+	}
+	if claim.IssuedAt == nil {
+		return true, nil
+	}
+	// iat has second precision, a token of the same second as validAfter may have been issued before it,
+	// so it is revoked too. At worst a login right after the revocation has to be repeated a second later.
+	return !claim.IssuedAt.Time.After(owner.validAfter), nil
+}
+
+// RevokeToken puts a single token on the denylist until it expires.
+func (r *TokenRevoker) RevokeToken(ctx context.Context, claim *auth.Claim) error {
+	if claim.ID == "" {
+		return nil
+	}
+	expiresAt := time.Now()
+	if claim.ExpiresAt != nil {
+		expiresAt = claim.ExpiresAt.Time
+	}
+	if err := r.revokedTokenStore.Add(ctx, claim.ID, expiresAt); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	if r.revokedTokens != nil {
+		r.revokedTokens[claim.ID] = struct{}{}
+	}
+	r.mu.Unlock()
+	return nil
+}
+
+// RevokeSession revokes the session and with it every token issued for the session.
+// It reports whether the session was active until now.
+func (r *TokenRevoker) RevokeSession(ctx context.Context, sessionID string) (bool, error) {
+	isRevoked, err := r.sessionStore.RevokeByPublicID(ctx, sessionID)
+	if err != nil {
+		return false, err
+	}
+	r.revokedSessions.Set(sessionID, true)
+	return isRevoked, nil
+}
+
+// RevokeAllTokens invalidates every token of the user issued before now.
+func (r *TokenRevoker) RevokeAllTokens(ctx context.Context, publicID string) error {
+	now := time.Now()
+	if err := r.userStore.SetTokensValidAfter(ctx, publicID, now); err != nil {
+		return err
+	}
+	r.users.Delete(publicID)
+	return nil
+}
+
+// Forget drops what is cached about the user, the next lookup sees the current status of the user.
+func (r *TokenRevoker) Forget(publicID string) {
+	r.users.Delete(publicID)
+}
+
+func (r *TokenRevoker) isTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	if r.revokedTokens == nil || now.Sub(r.revokedTokensAt) >= r.cacheTTL {
+		jtis, err := r.revokedTokenStore.ListActive(ctx, now)
+		if err != nil {
+			return false, err
+		}
+		r.revokedTokens = make(map[string]struct{}, len(jtis))
+		for _, jti := range jtis {
+			r.revokedTokens[jti] = struct{}{}
+		}
+		r.revokedTokensAt = now
+	}
+	_, isRevoked := r.revokedTokens[jti]
+	return isRevoked, nil
+}
+
+func (r *TokenRevoker) isSessionRevoked(ctx context.Context, sessionID string) (bool, error) {
+	if isRevoked, ok := r.revokedSessions.Get(sessionID); ok {
+		return isRevoked, nil
+	}
+	session, err := r.sessionStore.GetByPublicID(ctx, sessionID)
+	if err != nil {
+		if dbx.IsErrNoRows(err) {
+			// the session is gone with its user, so are its tokens
+			r.revokedSessions.Set(sessionID, true)
+			return true, nil
+		}
+		return false, err
+	}
+	isRevoked := session.RevokedAt != nil
+	r.revokedSessions.Set(sessionID, isRevoked)
+	return isRevoked, nil
+}
+
+func (r *TokenRevoker) tokenOwner(ctx context.Context, publicID string) (tokenOwner, error) {
+	if owner, ok := r.users.Get(publicID); ok {
+		return owner, nil
+	}
+	user, err := r.userStore.Get(ctx, publicID)
+	if err != nil {
+		if dbx.IsErrNoRows(err) {
+			// the user is gone, so none of its tokens are valid anymore
+			return tokenOwner{}, nil
+		}
+		return tokenOwner{}, err
+	}
+	owner := tokenOwner{active: user.Status == model.UserStatusActivate}
+	if user.TokensValidAfter != nil {
+		owner.validAfter = *user.TokensValidAfter
+	}
+	r.users.Set(publicID, owner)
+	return owner, nil
+}
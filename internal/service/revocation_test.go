@@ -0,0 +1,151 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/require"
+	"github.com/theruziev/oson_auth/internal/model"
+	"github.com/theruziev/oson_auth/internal/pkg/auth"
+	"github.com/theruziev/oson_auth/internal/pkg/errz"
+)
+
+// otherInstance is the revoker of another instance of the server on the same database.
+func otherInstance(s *UserService, cacheTTL time.Duration) *TokenRevoker {
+	return NewTokenRevoker(s.userStore, s.sessionStore, s.tokenRevoker.revokedTokenStore, cacheTTL)
+}
+
+func requireRevoked(t *testing.T, revoker *TokenRevoker, claim *auth.Claim, revoked bool) {
+	t.Helper()
+	isRevoked, err := revoker.IsRevoked(context.Background(), claim)
+	require.NoError(t, err)
+	require.Equal(t, revoked, isRevoked)
+}
+
+func TestSessionRevokedByAnotherInstance(t *testing.T) {
+	s := newTestUserService(t)
+	user := newTestUser(t, s)
+	claim := signIn(t, s, user)
+	other := otherInstance(s, 200*time.Millisecond)
+	requireRevoked(t, s.tokenRevoker, claim, false)
+	requireRevoked(t, other, claim, false)
+
+	// the active session is cached, the revocation reaches the other instance after its cache ttl
+	wasActive, err := s.tokenRevoker.RevokeSession(context.Background(), claim.SessionID)
+	require.NoError(t, err)
+	require.True(t, wasActive)
+	requireRevoked(t, s.tokenRevoker, claim, true)
+	requireRevoked(t, other, claim, false)
+	time.Sleep(250 * time.Millisecond)
+	requireRevoked(t, other, claim, true)
+}
+
+func TestRevokeSession(t *testing.T) {
+	s := newTestUserService(t)
+	ctx := context.Background()
+	user := newTestUser(t, s)
+	claim := signIn(t, s, user)
+	stranger := newTestUser(t, s)
+
+	err := s.RevokeSession(ctx, stranger.PublicID, claim.SessionID)
+	require.True(t, errz.NotFoundErr.Is(err), err)
+	requireRevoked(t, s.tokenRevoker, claim, false)
+
+	require.NoError(t, s.RevokeSession(ctx, user.PublicID, claim.SessionID))
+	requireRevoked(t, s.tokenRevoker, claim, true)
+	require.Contains(t, auditTrail(t, s, user), model.AuditSessionRevoked)
+	sessions, err := s.ListSessions(ctx, user.PublicID)
+	require.NoError(t, err)
+	require.Empty(t, sessions)
+
+	err = s.RevokeSession(ctx, user.PublicID, claim.SessionID)
+	require.True(t, errz.NotFoundErr.Is(err), err)
+}
+
+func TestRevokeToken(t *testing.T) {
+	s := newTestUserService(t)
+	user := newTestUser(t, s)
+	claim := signIn(t, s, user)
+	// the denylist of the other instance is loaded before the revocation
+	other := otherInstance(s, 200*time.Millisecond)
+	requireRevoked(t, other, claim, false)
+
+	require.NoError(t, s.tokenRevoker.RevokeToken(context.Background(), claim))
+	requireRevoked(t, s.tokenRevoker, claim, true)
+	requireRevoked(t, otherInstance(s, time.Minute), claim, true)
+	requireRevoked(t, other, claim, false)
+	time.Sleep(250 * time.Millisecond)
+	requireRevoked(t, other, claim, true)
+
+	// a token of the same session is revoked on its own
+	requireRevoked(t, s.tokenRevoker, parseToken(t, s, refreshAccessToken(t, s, claim)), false)
+}
+
+// refreshAccessToken issues another access token of the session of the claim.
+func refreshAccessToken(t *testing.T, s *UserService, claim *auth.Claim) string {
+	t.Helper()
+	ctx := context.Background()
+	session, err := s.sessionStore.GetByPublicID(ctx, claim.SessionID)
+	require.NoError(t, err)
+	user, err := s.userStore.Get(ctx, claim.PublicID)
+	require.NoError(t, err)
+	token, err := s.issueAccessToken(ctx, user, session)
+	require.NoError(t, err)
+	return token.AuthToken
+}
+
+func TestTokensIssuedBeforeValidAfter(t *testing.T) {
+	validAfter := time.Unix(1700000000, 400_000_000)
+	tests := []struct {
+		name     string
+		issuedAt *jwt.NumericDate
+		suspend  bool
+		revoked  bool
+	}{
+		{name: "issued before", issuedAt: jwt.NewNumericDate(validAfter.Add(-time.Minute)), revoked: true},
+		// iat has second precision, the token may have been issued just before the revocation
+		{name: "issued in the same second", issuedAt: jwt.NewNumericDate(validAfter), revoked: true},
+		{name: "issued after", issuedAt: jwt.NewNumericDate(validAfter.Add(time.Second))},
+		{name: "issued at is missing", revoked: true},
+		{name: "user not active", issuedAt: jwt.NewNumericDate(validAfter.Add(time.Minute)), suspend: true, revoked: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestUserService(t)
+			ctx := context.Background()
+			user := newTestUser(t, s)
+			require.NoError(t, s.userStore.SetTokensValidAfter(ctx, user.PublicID, validAfter))
+			if tt.suspend {
+				require.NoError(t, s.changeStatus(ctx, user, model.UserStatusSuspended, "abuse", nil))
+			}
+			claim := &auth.Claim{PublicID: user.PublicID}
+			claim.IssuedAt = tt.issuedAt
+
+			requireRevoked(t, s.tokenRevoker, claim, tt.revoked)
+		})
+	}
+}
+
+func TestLogoutAll(t *testing.T) {
+	s := newTestUserService(t)
+	ctx := context.Background()
+	user := newTestUser(t, s)
+	claim := signIn(t, s, user)
+	// a token of another device of the user
+	other := signIn(t, s, user)
+	requireRevoked(t, s.tokenRevoker, other, false)
+
+	// the cached state of the user is dropped right away on the instance that signs the user out
+	require.NoError(t, s.LogoutAll(ctx, claim))
+	requireRevoked(t, s.tokenRevoker, claim, true)
+	requireRevoked(t, s.tokenRevoker, other, true)
+	sessions, err := s.ListSessions(ctx, user.PublicID)
+	require.NoError(t, err)
+	require.Empty(t, sessions)
+
+	// a login after the sign-out works, its token is of a later second
+	time.Sleep(time.Until(time.Now().Truncate(time.Second).Add(time.Second)))
+	requireRevoked(t, s.tokenRevoker, signIn(t, s, user), false)
+}
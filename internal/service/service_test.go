@@ -0,0 +1,188 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+	"github.com/stretchr/testify/require"
+	"github.com/theruziev/oson_auth/internal/db"
+	"github.com/theruziev/oson_auth/internal/model"
+	"github.com/theruziev/oson_auth/internal/pkg/auth"
+	"github.com/theruziev/oson_auth/internal/pkg/fieldcrypt"
+	"github.com/theruziev/oson_auth/internal/pkg/lockout"
+	"github.com/theruziev/oson_auth/internal/pkg/passwordpolicy"
+	"github.com/theruziev/oson_auth/internal/pkg/testutil"
+)
+
+const testPassword = "correct horse battery staple"
+
+func testAuthOption() *auth.AuthOption {
+	return &auth.AuthOption{
+		JWTSecret:          "secret",
+		JWTTtl:             time.Minute,
+		RefreshTTL:         time.Hour,
+		OrgInviteTTL:       time.Hour,
+		TrustedDeviceTTL:   time.Hour,
+		MagicLinkTTL:       15 * time.Minute,
+		EmailChangeTTL:     time.Hour,
+		ReauthMaxAge:       5 * time.Minute,
+		RevocationCacheTTL: time.Minute,
+		Otp: auth.OtpConfig{
+			Enabled:           true,
+			Issuer:            "oson",
+			RecoveryCodeCount: 10,
+			Skew:              1,
+		},
+		Lockout: lockout.Option{
+			AccountFreeAttempts: 5,
+			IPFreeAttempts:      20,
+			BaseDelay:           30 * time.Second,
+			MaxDelay:            15 * time.Minute,
+			Window:              time.Hour,
+		},
+		Password: auth.PasswordOption{
+			Algorithm:  auth.PasswordAlgBcrypt,
+			BcryptCost: 4,
+		},
+		PasswordPolicy: passwordpolicy.Option{
+			MinLength: 10,
+			MaxLength: 128,
+		},
+	}
+}
+
+// newTestUserService builds the user service the way the server does, on a database of the test. Passkeys are off.
+func newTestUserService(t *testing.T) *UserService {
+	t.Helper()
+	pool := testutil.NewPostgres(t)
+	authOpt := testAuthOption()
+	signer, err := auth.NewSigner(authOpt)
+	require.NoError(t, err)
+	hasher, err := auth.NewPasswordHasher(&authOpt.Password)
+	require.NoError(t, err)
+	policy, err := passwordpolicy.New(&authOpt.PasswordPolicy)
+	require.NoError(t, err)
+
+	userStore := db.NewUserStore(pool, fieldcrypt.Plaintext{})
+	sessionStore := db.NewSessionStore(pool)
+	tokenRevoker := NewTokenRevoker(userStore, sessionStore, db.NewRevokedTokenStore(pool), authOpt.RevocationCacheTTL)
+	return NewUserStore(
+		authOpt,
+		db.NewOutBoxStore(pool),
+		userStore,
+		sessionStore,
+		db.NewAPIKeyStore(pool),
+		db.NewRoleStore(pool),
+		tokenRevoker,
+		signer,
+		auth.NewOtpConfig(&authOpt.Otp),
+		hasher,
+		policy,
+		db.NewWebAuthnStore(pool),
+		nil,
+		db.NewMagicLinkStore(pool),
+		db.NewEmailChangeStore(pool),
+		db.NewOrganizationStore(pool),
+		db.NewTrustedDeviceStore(pool),
+		db.NewRecoveryCodeStore(pool),
+		lockout.NewLimiter(&authOpt.Lockout, db.NewLoginAttemptStore(pool)),
+		NewAuditService(db.NewAuditEventStore(pool)),
+		pool,
+	)
+}
+
+// newTestUser registers and activates a user with testPassword.
+func newTestUser(t *testing.T, s *UserService) *model.User {
+	t.Helper()
+	ctx := context.Background()
+	registered, err := s.Register(ctx, &model.RegisterRequest{
+		FirstName: "Jane",
+		LastName:  "Doe",
+		Email:     uuid.New().String() + "@example.com",
+		Password:  testPassword,
+	})
+	require.NoError(t, err)
+	require.NoError(t, s.Activate(ctx, registered.ActivationCode))
+	return reloadUser(t, s, registered)
+}
+
+func reloadUser(t *testing.T, s *UserService, user *model.User) *model.User {
+	t.Helper()
+	user, err := s.userStore.Get(context.Background(), user.PublicID)
+	require.NoError(t, err)
+	return user
+}
+
+// signIn logs the user in with the password and returns the claim of the access token.
+func signIn(t *testing.T, s *UserService, user *model.User) *auth.Claim {
+	t.Helper()
+	token, err := s.Auth(context.Background(), user.Email, testPassword, "")
+	require.NoError(t, err)
+	return parseToken(t, s, token.AuthToken)
+}
+
+func parseToken(t *testing.T, s *UserService, token string) *auth.Claim {
+	t.Helper()
+	claim := &auth.Claim{}
+	_, err := s.signer.Parse(token, claim)
+	require.NoError(t, err)
+	return claim
+}
+
+// staleClaim is the claim of a login older than the re-authentication window.
+func staleClaim(claim *auth.Claim) *auth.Claim {
+	stale := *claim
+	stale.AuthTime = jwt.NewNumericDate(time.Now().Add(-time.Hour))
+	return &stale
+}
+
+// enrollTestOtp enrols an authenticator for the user and returns its secret along with the recovery codes.
+// The code of the enrolment is used up, otpCode gives one of the next time step.
+func enrollTestOtp(t *testing.T, s *UserService, user *model.User) (string, []string) {
+	t.Helper()
+	ctx := context.Background()
+	token, err := s.RequestEnableOTPStep1(ctx, user.PublicID)
+	require.NoError(t, err)
+	key, err := otp.NewKeyFromURL(token.OtpURL)
+	require.NoError(t, err)
+	code, err := totp.GenerateCode(key.Secret(), time.Now())
+	require.NoError(t, err)
+	recoveryCodes, err := s.RequestEnableOTPStep2(ctx, user.PublicID, code)
+	require.NoError(t, err)
+	return key.Secret(), recoveryCodes.Codes
+}
+
+// otpCode is the code of the time step after the current one, it is accepted within the skew of the test config.
+func otpCode(t *testing.T, secret string) string {
+	t.Helper()
+	code, err := totp.GenerateCode(secret, time.Now().Add(30*time.Second))
+	require.NoError(t, err)
+	return code
+}
+
+// auditTrail lists the types of the events recorded for the user, the latest first.
+func auditTrail(t *testing.T, s *UserService, user *model.User) []model.AuditEventType {
+	t.Helper()
+	events, err := s.audit.ListAllByUser(context.Background(), user.PublicID)
+	require.NoError(t, err)
+	types := make([]model.AuditEventType, 0, len(events))
+	for _, event := range events {
+		types = append(types, event.Type)
+	}
+	return types
+}
+
+// lastOutboxMessage decodes the latest message of the topic, links and codes are only sent out through it.
+func lastOutboxMessage(t *testing.T, s *UserService, topic string, dest any) {
+	t.Helper()
+	var msg []byte
+	err := s.pool.QueryRow(context.Background(), "select msg from outbox where topic = $1 order by id desc limit 1", topic).Scan(&msg)
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(msg, dest))
+}
@@ -0,0 +1,292 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+	"github.com/theruziev/oson_auth/internal/model"
+	"github.com/theruziev/oson_auth/internal/pkg/auth"
+	"github.com/theruziev/oson_auth/internal/pkg/clientinfo"
+	"github.com/theruziev/oson_auth/internal/pkg/dbx"
+	"github.com/theruziev/oson_auth/internal/pkg/errz"
+	"github.com/theruziev/oson_auth/internal/pkg/logging"
+)
+
+// startSession opens a new session for the user who has just signed in.
+func (s *UserService) startSession(ctx context.Context, user *model.User) (*model.AuthToken, error) {
+	now := time.Now()
+	if user.IsPasswordExpired(now, s.authOpt.PasswordPolicy.MaxAge) {
+		return s.requirePasswordChange(user)
+	}
+	token, _, err := s.openSession(ctx, user, "", now)
+	return token, err
+}
+
+// startClientSession opens the session of an OIDC client acting for the user, authTime is when the
+// user signed in before consenting, not when the client exchanged the code.
+func (s *UserService) startClientSession(
+	ctx context.Context,
+	user *model.User,
+	clientID string,
+	authTime time.Time,
+) (*model.AuthToken, *model.Session, error) {
+	return s.openSession(ctx, user, clientID, authTime)
+}
+
+func (s *UserService) openSession(
+	ctx context.Context,
+	user *model.User,
+	clientID string,
+	authTime time.Time,
+) (*model.AuthToken, *model.Session, error) {
+	now := time.Now()
+	info := clientinfo.FromContext(ctx)
+	session := &model.Session{
+		PublicID:   uuid.New().String(),
+		UserID:     user.ID,
+		ClientID:   clientID,
+		AuthTime:   authTime,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+		ExpiresAt:  now.Add(s.authOpt.RefreshTTL),
+		IP:         info.IP,
+		UserAgent:  info.UserAgent,
+		LastSeenAt: &now,
+	}
+	if err := s.sessionStore.Insert(ctx, session); err != nil {
+		return nil, nil, fmt.Errorf("failed to create session: %w", err)
+	}
+
+	token, err := s.issueSessionTokens(ctx, user, session)
+	if err != nil {
+		return nil, nil, err
+	}
+	return token, session, nil
+}
+
+// requirePasswordChange holds the login back until the expired password is changed, no session is opened
+// and the token allows nothing but the change. The user signs in again with the new password.
+func (s *UserService) requirePasswordChange(user *model.User) (*model.AuthToken, error) {
+	now := time.Now()
+	expireAt := now.Add(passwordChangeExpireAt)
+	tokenString, err := s.signToken(user, "", &now, expireAt, nil, auth.PasswordChangeScope)
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.AuthToken{
+		AuthToken:              tokenString,
+		ExpireAt:               expireAt,
+		PasswordChangeRequired: true,
+	}, nil
+}
+
+// issueSessionTokens creates an access token bound to the session and the next refresh token of its family.
+func (s *UserService) issueSessionTokens(ctx context.Context, user *model.User, session *model.Session) (*model.AuthToken, error) {
+	refreshToken, refreshTokenHash, err := auth.NewOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.sessionStore.InsertRefreshToken(ctx, &model.RefreshToken{
+		SessionID: session.ID,
+		TokenHash: refreshTokenHash,
+		CreatedAt: time.Now(),
+	}); err != nil {
+		return nil, fmt.Errorf("failed to store refresh token: %w", err)
+	}
+
+	token, err := s.issueAccessToken(ctx, user, session)
+	if err != nil {
+		return nil, err
+	}
+	token.RefreshToken = refreshToken
+	token.RefreshExpireAt = session.ExpiresAt
+	return token, nil
+}
+
+// issueAccessToken signs an access token for the session with what the user is granted right now,
+// the refresh token of the session stays as it is.
+func (s *UserService) issueAccessToken(ctx context.Context, user *model.User, session *model.Session) (*model.AuthToken, error) {
+	if session.ClientID != "" {
+		return s.issueClientAccessToken(user, session)
+	}
+	grants, err := s.loadSessionGrants(ctx, user, session)
+	if err != nil {
+		return nil, err
+	}
+	expireAt := time.Now().Add(s.authOpt.JWTTtl)
+	tokenString, err := s.signToken(user, session.PublicID, &session.AuthTime, expireAt, grants, auth.UserScope)
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.AuthToken{
+		AuthToken: tokenString,
+		ExpireAt:  expireAt,
+	}, nil
+}
+
+// issueClientAccessToken signs the access token of an OIDC client. It is meant for the client alone and
+// only reads the user info, the account itself is managed with the tokens of the user.
+func (s *UserService) issueClientAccessToken(user *model.User, session *model.Session) (*model.AuthToken, error) {
+	now := time.Now()
+	expireAt := now.Add(s.authOpt.JWTTtl)
+	tokenString, err := s.signer.Sign(auth.Claim{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.New().String(),
+			Issuer:    s.authOpt.OIDC.Issuer,
+			Audience:  jwt.ClaimStrings{session.ClientID},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expireAt),
+		},
+		PublicID:  user.PublicID,
+		SessionID: session.PublicID,
+		ClientID:  session.ClientID,
+		Scopes:    []auth.Scope{auth.UserInfoScope},
+		AuthTime:  jwt.NewNumericDate(session.AuthTime),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.AuthToken{
+		AuthToken: tokenString,
+		ExpireAt:  expireAt,
+	}, nil
+}
+
+// RefreshToken rotates the refresh token. Presenting a refresh token that has already been rotated
+// is treated as token theft, and the whole session is revoked.
+// Sessions of OIDC clients can only be refreshed by the client they were issued to.
+func (s *UserService) RefreshToken(ctx context.Context, refreshToken, clientID string) (*model.AuthToken, error) {
+	logger := logging.FromContext(ctx)
+	token, err := s.sessionStore.GetRefreshToken(ctx, auth.HashOpaqueToken(refreshToken))
+	if err != nil {
+		if dbx.IsErrNoRows(err) {
+			return nil, fmt.Errorf("unknown refresh token")
+		}
+		return nil, err
+	}
+
+	session, err := s.sessionStore.Get(ctx, token.SessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	if session.ClientID != clientID {
+		return nil, fmt.Errorf("refresh token was issued to another client")
+	}
+
+	isFirstUse, err := s.sessionStore.UseRefreshToken(ctx, token.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !isFirstUse {
+		logger.Warnf("refresh token reuse detected, revoking session %s", session.PublicID)
+		if _, err := s.tokenRevoker.RevokeSession(ctx, session.PublicID); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("refresh token reused")
+	}
+
+	if !session.IsActive(time.Now()) {
+		return nil, fmt.Errorf("session is not active")
+	}
+
+	user, err := s.userStore.GetByID(ctx, session.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if user.Status != model.UserStatusActivate {
+		return nil, fmt.Errorf("user not active")
+	}
+
+	session.ExpiresAt = time.Now().Add(s.authOpt.RefreshTTL)
+	if err := s.sessionStore.Extend(ctx, session.ID, session.ExpiresAt, clientinfo.FromContext(ctx).IP); err != nil {
+		return nil, err
+	}
+
+	return s.issueSessionTokens(ctx, user, session)
+}
+
+// ListSessions returns the sessions the user is signed in with.
+func (s *UserService) ListSessions(ctx context.Context, publicID string) ([]*model.Session, error) {
+	user, err := s.userStore.Get(ctx, publicID)
+	if err != nil {
+		return nil, err
+	}
+	return s.sessionStore.ListActiveByUser(ctx, user.ID, time.Now())
+}
+
+// RevokeSession signs the user out of one session, the tokens of the session stop working right away.
+func (s *UserService) RevokeSession(ctx context.Context, publicID, sessionID string) error {
+	user, err := s.userStore.Get(ctx, publicID)
+	if err != nil {
+		return err
+	}
+	if _, err := uuid.Parse(sessionID); err != nil {
+		return errz.NotFoundErr.Wrap(err)
+	}
+	session, err := s.sessionStore.GetByPublicID(ctx, sessionID)
+	if err != nil {
+		if dbx.IsErrNoRows(err) {
+			return errz.NotFoundErr.New("session not found")
+		}
+		return err
+	}
+	if session.UserID != user.ID {
+		return errz.NotFoundErr.New("session not found")
+	}
+	isRevoked, err := s.tokenRevoker.RevokeSession(ctx, session.PublicID)
+	if err != nil {
+		return err
+	}
+	if !isRevoked {
+		return errz.NotFoundErr.New("session not found")
+	}
+	s.audit.Record(ctx, user, model.AuditSessionRevoked, map[string]string{"session": session.PublicID})
+	return nil
+}
+
+// sessionGrants is what the token of a session carries on top of the identity of the user.
+type sessionGrants struct {
+	permissions []auth.Permission
+	orgID       string
+	orgRole     model.OrgRole
+}
+
+// loadSessionGrants loads the permissions of the roles of the user and the role in the active organization
+// of the session. A change of them reaches the user with the next refresh of the token.
+func (s *UserService) loadSessionGrants(ctx context.Context, user *model.User, session *model.Session) (*sessionGrants, error) {
+	grants := &sessionGrants{}
+
+	names, err := s.roleStore.ListPermissionsByUser(ctx, user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load permissions: %w", err)
+	}
+	for _, name := range names {
+		grants.permissions = append(grants.permissions, auth.Permission(name))
+	}
+
+	if session.OrganizationID == nil {
+		return grants, nil
+	}
+	membership, err := s.organizationStore.GetMembership(ctx, *session.OrganizationID, user.ID)
+	if err != nil {
+		// the user has left the organization, the session goes on without one
+		if dbx.IsErrNoRows(err) {
+			return grants, nil
+		}
+		return nil, fmt.Errorf("failed to load membership: %w", err)
+	}
+	org, err := s.organizationStore.GetByID(ctx, membership.OrganizationID)
+	if err != nil {
+		return nil, err
+	}
+	grants.orgID = org.PublicID
+	grants.orgRole = membership.Role
+	return grants, nil
+}
@@ -0,0 +1,107 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/theruziev/oson_auth/internal/model"
+)
+
+// login signs the user in with the password and returns the tokens of the new session.
+func login(t *testing.T, s *UserService, user *model.User) *model.AuthToken {
+	t.Helper()
+	token, err := s.Auth(context.Background(), user.Email, testPassword, "")
+	require.NoError(t, err)
+	require.NotEmpty(t, token.RefreshToken)
+	return token
+}
+
+func TestRefreshTokenRotation(t *testing.T) {
+	s := newTestUserService(t)
+	ctx := context.Background()
+	user := newTestUser(t, s)
+	first := login(t, s, user)
+
+	second, err := s.RefreshToken(ctx, first.RefreshToken, "")
+	require.NoError(t, err)
+	require.NotEqual(t, first.RefreshToken, second.RefreshToken)
+	third, err := s.RefreshToken(ctx, second.RefreshToken, "")
+	require.NoError(t, err)
+	claim := parseToken(t, s, third.AuthToken)
+	require.Equal(t, parseToken(t, s, first.AuthToken).SessionID, claim.SessionID)
+	requireRevoked(t, s.tokenRevoker, claim, false)
+
+	// a rotated token came back, whoever holds the latest one may be the thief, the whole family goes
+	_, err = s.RefreshToken(ctx, first.RefreshToken, "")
+	require.Error(t, err)
+	_, err = s.RefreshToken(ctx, third.RefreshToken, "")
+	require.Error(t, err)
+	requireRevoked(t, s.tokenRevoker, claim, true)
+	sessions, err := s.ListSessions(ctx, user.PublicID)
+	require.NoError(t, err)
+	require.Empty(t, sessions)
+}
+
+func TestRefreshTokenReuseKeepsOtherSessions(t *testing.T) {
+	s := newTestUserService(t)
+	ctx := context.Background()
+	user := newTestUser(t, s)
+	stolen := login(t, s, user)
+	other := login(t, s, user)
+
+	_, err := s.RefreshToken(ctx, stolen.RefreshToken, "")
+	require.NoError(t, err)
+	_, err = s.RefreshToken(ctx, stolen.RefreshToken, "")
+	require.Error(t, err)
+
+	_, err = s.RefreshToken(ctx, other.RefreshToken, "")
+	require.NoError(t, err)
+	sessions, err := s.ListSessions(ctx, user.PublicID)
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+}
+
+func TestRefreshTokenRotatedConcurrently(t *testing.T) {
+	s := newTestUserService(t)
+	user := newTestUser(t, s)
+	token := login(t, s, user)
+
+	// both requests present the same token, only one of them rotates it and the other one is a reuse
+	refreshed := make([]*model.AuthToken, 2)
+	errs := make([]error, len(refreshed))
+	var wg sync.WaitGroup
+	for i := range refreshed {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			refreshed[i], errs[i] = s.RefreshToken(context.Background(), token.RefreshToken, "")
+		}(i)
+	}
+	wg.Wait()
+
+	rotated := 0
+	for _, err := range errs {
+		if err == nil {
+			rotated++
+		}
+	}
+	require.Equal(t, 1, rotated)
+	sessions, err := s.ListSessions(context.Background(), user.PublicID)
+	require.NoError(t, err)
+	require.Empty(t, sessions)
+}
+
+func TestRefreshTokenOfEndedSession(t *testing.T) {
+	s := newTestUserService(t)
+	ctx := context.Background()
+	user := newTestUser(t, s)
+	token := login(t, s, user)
+
+	require.NoError(t, s.Logout(ctx, parseToken(t, s, token.AuthToken)))
+	_, err := s.RefreshToken(ctx, token.RefreshToken, "")
+	require.Error(t, err)
+	_, err = s.RefreshToken(ctx, "unknown", "")
+	require.Error(t, err)
+}
@@ -0,0 +1,65 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/theruziev/oson_auth/internal/converter/message"
+	"github.com/theruziev/oson_auth/internal/event/constants"
+	"github.com/theruziev/oson_auth/internal/model"
+	"github.com/theruziev/oson_auth/internal/pkg/errz"
+)
+
+// changeStatus moves the user to the status. Every change of the status goes through here, so only
+// the transitions allowed by model.UserStatus happen and other services learn about them from the user
+// changed event. also runs in the same transaction, a user who is not active anymore is signed out everywhere.
+func (s *UserService) changeStatus(
+	ctx context.Context,
+	user *model.User,
+	status model.UserStatus,
+	reason string,
+	also func(ctx context.Context) error,
+) error {
+	if !user.Status.CanTransitionTo(status) {
+		return errz.BadRequestErr.New("user can't go from %s to %s", user.Status, status)
+	}
+
+	now := time.Now()
+	err := s.inTx(ctx, func(ctx context.Context) error {
+		if err := s.userStore.SetStatus(ctx, user.PublicID, user.Status, status, reason, now); err != nil {
+			return err
+		}
+		user.Status = status
+		user.StatusReason = reason
+		user.StatusChangedAt = &now
+		user.UpdatedAt = now
+		switch status {
+		case model.UserStatusActivate:
+			user.ActivationCode = ""
+		case model.UserStatusDeleted:
+			user.DeletedAt = &now
+		}
+
+		if err := s.outboxStore.Add(ctx, &model.OutBox{
+			Topic:     constants.TopicUserChanged,
+			Data:      message.ToUserEvent(user),
+			Status:    model.CreatedStatus,
+			CreatedAt: now,
+		}); err != nil {
+			return err
+		}
+		if also == nil {
+			return nil
+		}
+		return also(ctx)
+	})
+	if err != nil {
+		return err
+	}
+
+	if status == model.UserStatusActivate {
+		s.tokenRevoker.Forget(user.PublicID)
+		return nil
+	}
+	return s.revokeAllSessions(ctx, user)
+}
@@ -0,0 +1,111 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/theruziev/oson_auth/internal/event/constants"
+	"github.com/theruziev/oson_auth/internal/model"
+	"github.com/theruziev/oson_auth/internal/pkg/errz"
+	v0 "github.com/theruziev/oson_auth/pkg/events/v0"
+)
+
+func TestUserStatusTransitions(t *testing.T) {
+	tests := []struct {
+		from, to model.UserStatus
+		allowed  bool
+	}{
+		{from: model.UserStatusRegistered, to: model.UserStatusActivate, allowed: true},
+		{from: model.UserStatusActivate, to: model.UserStatusSuspended, allowed: true},
+		{from: model.UserStatusSuspended, to: model.UserStatusActivate, allowed: true},
+		{from: model.UserStatusLocked, to: model.UserStatusRegistered, allowed: true},
+		{from: model.UserStatusActivate, to: model.UserStatusDeleted, allowed: true},
+		{from: model.UserStatusActivate, to: model.UserStatusRegistered},
+		{from: model.UserStatusActivate, to: model.UserStatusActivate},
+		{from: model.UserStatusDeleted, to: model.UserStatusActivate},
+		{from: model.UserStatusDeleted, to: model.UserStatusSuspended},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.from)+" to "+string(tt.to), func(t *testing.T) {
+			require.Equal(t, tt.allowed, tt.from.CanTransitionTo(tt.to))
+		})
+	}
+}
+
+func TestSuspendedUserIsShutOut(t *testing.T) {
+	s := newTestUserService(t)
+	ctx := context.Background()
+	user := newTestUser(t, s)
+	token := login(t, s, user)
+	claim := parseToken(t, s, token.AuthToken)
+	require.NoError(t, s.ResetPasswordRequest(ctx, user.Email))
+	var reset v0.UserResetPasswordEvent
+	lastOutboxMessage(t, s, constants.TopicUserResetPassword, &reset)
+
+	require.NoError(t, s.changeStatus(ctx, user, model.UserStatusSuspended, "abuse", nil))
+	suspended := reloadUser(t, s, user)
+	require.Equal(t, model.UserStatusSuspended, suspended.Status)
+	require.Equal(t, "abuse", suspended.StatusReason)
+	require.NotNil(t, suspended.StatusChangedAt)
+	var changed v0.UserEvent
+	lastOutboxMessage(t, s, constants.TopicUserChanged, &changed)
+	require.Equal(t, v0.UserStatusSuspended, changed.Status)
+	require.Equal(t, "abuse", changed.StatusReason)
+
+	// the tokens issued before stop working, no new ones are issued
+	requireRevoked(t, s.tokenRevoker, claim, true)
+	_, err := s.RefreshToken(ctx, token.RefreshToken, "")
+	require.Error(t, err)
+	_, err = s.Auth(ctx, user.Email, testPassword, "")
+	require.Error(t, err)
+	require.Error(t, s.ResetPasswordRequest(ctx, user.Email))
+	require.Error(t, s.ResetPassword(ctx, reset.ResetPasswordCode, "another passphrase"))
+
+	// lifting the suspension lets the user sign in again, the old tokens stay revoked
+	require.NoError(t, s.changeStatus(ctx, suspended, model.UserStatusActivate, "", nil))
+	login(t, s, user)
+	requireRevoked(t, s.tokenRevoker, claim, true)
+	lastOutboxMessage(t, s, constants.TopicUserChanged, &changed)
+	require.Equal(t, v0.UserStatusActivate, changed.Status)
+	require.Empty(t, changed.StatusReason)
+}
+
+func TestSuspendedUserCantFinishTwoFA(t *testing.T) {
+	s := newTestUserService(t)
+	ctx := context.Background()
+	user := newTestUser(t, s)
+	secret, _ := enrollTestOtp(t, s, user)
+	pending := signIn(t, s, user)
+
+	require.NoError(t, s.changeStatus(ctx, reloadUser(t, s, user), model.UserStatusLocked, "stolen", nil))
+	_, err := s.AuthTwoFA(ctx, pending, otpCode(t, secret), false)
+	require.Error(t, err)
+}
+
+func TestChangeStatusRefusesTransitions(t *testing.T) {
+	s := newTestUserService(t)
+	ctx := context.Background()
+	user := newTestUser(t, s)
+
+	err := s.changeStatus(ctx, user, model.UserStatusRegistered, "", nil)
+	require.True(t, errz.BadRequestErr.Is(err), err)
+	deleteTestAccount(t, s, user)
+	err = s.changeStatus(ctx, reloadUser(t, s, user), model.UserStatusActivate, "", nil)
+	require.True(t, errz.BadRequestErr.Is(err), err)
+	require.Equal(t, model.UserStatusDeleted, reloadUser(t, s, user).Status)
+}
+
+func TestChangeStatusOfStaleUser(t *testing.T) {
+	s := newTestUserService(t)
+	ctx := context.Background()
+	user := newTestUser(t, s)
+	stale := reloadUser(t, s, user)
+
+	// the change only applies to the status it was decided on
+	require.NoError(t, s.changeStatus(ctx, user, model.UserStatusLocked, "stolen", nil))
+	require.Error(t, s.changeStatus(ctx, stale, model.UserStatusSuspended, "abuse", nil))
+	locked := reloadUser(t, s, user)
+	require.Equal(t, model.UserStatusLocked, locked.Status)
+	require.Equal(t, "stolen", locked.StatusReason)
+}
@@ -0,0 +1,90 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/theruziev/oson_auth/internal/model"
+	"github.com/theruziev/oson_auth/internal/pkg/auth"
+	"github.com/theruziev/oson_auth/internal/pkg/clientinfo"
+	"github.com/theruziev/oson_auth/internal/pkg/dbx"
+	"github.com/theruziev/oson_auth/internal/pkg/errz"
+)
+
+// trustDevice remembers the device the user has just completed the second factor on. The returned
+// token is given back on the next login and is only shown here, the store keeps its hash.
+func (s *UserService) trustDevice(ctx context.Context, user *model.User) (string, *model.TrustedDevice, error) {
+	token, tokenHash, err := auth.NewOpaqueToken()
+	if err != nil {
+		return "", nil, err
+	}
+	info := clientinfo.FromContext(ctx)
+	now := time.Now()
+	device := &model.TrustedDevice{
+		PublicID:  uuid.New().String(),
+		UserID:    user.ID,
+		TokenHash: tokenHash,
+		IP:        info.IP,
+		UserAgent: info.UserAgent,
+		ExpiresAt: now.Add(s.authOpt.TrustedDeviceTTL),
+		CreatedAt: now,
+	}
+	if err := s.trustedDeviceStore.Insert(ctx, device); err != nil {
+		return "", nil, fmt.Errorf("failed to trust device: %w", err)
+	}
+	s.audit.Record(ctx, user, model.AuditDeviceTrusted, map[string]string{"device": device.PublicID})
+	return token, device, nil
+}
+
+// isTrustedDevice reports whether the token belongs to a device the user still trusts.
+// Unknown, foreign and expired tokens are not an error, the user just goes through the second factor.
+func (s *UserService) isTrustedDevice(ctx context.Context, user *model.User, token string) (bool, error) {
+	if token == "" || s.authOpt.TrustedDeviceTTL == 0 {
+		return false, nil
+	}
+	device, err := s.trustedDeviceStore.GetByHash(ctx, auth.HashOpaqueToken(token))
+	if err != nil {
+		if dbx.IsErrNoRows(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	now := time.Now()
+	if device.UserID != user.ID || !device.IsActive(now) {
+		return false, nil
+	}
+	if err := s.trustedDeviceStore.Touch(ctx, device.ID, now); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (s *UserService) ListTrustedDevices(ctx context.Context, publicID string) ([]*model.TrustedDevice, error) {
+	user, err := s.userStore.Get(ctx, publicID)
+	if err != nil {
+		return nil, err
+	}
+	return s.trustedDeviceStore.ListByUser(ctx, user.ID, time.Now())
+}
+
+// RevokeTrustedDevice forgets the device, the next login from it asks for the second factor again.
+func (s *UserService) RevokeTrustedDevice(ctx context.Context, publicID, deviceID string) error {
+	user, err := s.userStore.Get(ctx, publicID)
+	if err != nil {
+		return err
+	}
+	if _, err := uuid.Parse(deviceID); err != nil {
+		return errz.NotFoundErr.New("device not found")
+	}
+	found, err := s.trustedDeviceStore.Revoke(ctx, user.ID, deviceID)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return errz.NotFoundErr.New("device not found")
+	}
+	s.audit.Record(ctx, user, model.AuditDeviceRevoked, map[string]string{"device": deviceID})
+	return nil
+}
@@ -0,0 +1,180 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"github.com/theruziev/oson_auth/internal/model"
+	"github.com/theruziev/oson_auth/internal/pkg/auth"
+	"github.com/theruziev/oson_auth/internal/pkg/errz"
+)
+
+func TestAuthSkipsSecondFactorOnTrustedDevice(t *testing.T) {
+	tests := []struct {
+		name     string
+		token    func(t *testing.T, s *UserService, user *model.User) string
+		required bool
+	}{
+		{
+			name:     "no device token",
+			token:    func(t *testing.T, s *UserService, user *model.User) string { return "" },
+			required: true,
+		},
+		{
+			name: "trusted device",
+			token: func(t *testing.T, s *UserService, user *model.User) string {
+				return trustTestDevice(t, s, user)
+			},
+		},
+		{
+			name:     "unknown device",
+			token:    func(t *testing.T, s *UserService, user *model.User) string { return "unknown" },
+			required: true,
+		},
+		{
+			name: "device of another user",
+			token: func(t *testing.T, s *UserService, user *model.User) string {
+				return trustTestDevice(t, s, newTestUser(t, s))
+			},
+			required: true,
+		},
+		{
+			name: "expired device",
+			token: func(t *testing.T, s *UserService, user *model.User) string {
+				token, tokenHash, err := auth.NewOpaqueToken()
+				require.NoError(t, err)
+				require.NoError(t, s.trustedDeviceStore.Insert(context.Background(), &model.TrustedDevice{
+					PublicID:  uuid.New().String(),
+					UserID:    user.ID,
+					TokenHash: tokenHash,
+					ExpiresAt: time.Now().Add(-time.Second),
+					CreatedAt: time.Now().Add(-time.Hour),
+				}))
+				return token
+			},
+			required: true,
+		},
+		{
+			name: "revoked device",
+			token: func(t *testing.T, s *UserService, user *model.User) string {
+				token := trustTestDevice(t, s, user)
+				require.NoError(t, s.trustedDeviceStore.RevokeAllByUser(context.Background(), user.ID))
+				return token
+			},
+			required: true,
+		},
+		{
+			name: "remembering turned off",
+			token: func(t *testing.T, s *UserService, user *model.User) string {
+				token := trustTestDevice(t, s, user)
+				s.authOpt.TrustedDeviceTTL = 0
+				return token
+			},
+			required: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestUserService(t)
+			ctx := context.Background()
+			user := newTestUser(t, s)
+			enrollTestOtp(t, s, user)
+			token := tt.token(t, s, user)
+
+			authToken, err := s.Auth(ctx, user.Email, testPassword, token)
+			require.NoError(t, err)
+			require.Equal(t, tt.required, authToken.TwoFARequired)
+			sessions, err := s.ListSessions(ctx, user.PublicID)
+			require.NoError(t, err)
+			if tt.required {
+				require.Equal(t, []model.TwoFAMethod{model.TwoFAMethodOTP}, authToken.TwoFAMethods)
+				require.Empty(t, authToken.RefreshToken)
+				require.Empty(t, sessions)
+				require.Equal(t, []auth.Scope{auth.TwoFACheckScope}, parseToken(t, s, authToken.AuthToken).Scopes)
+				return
+			}
+			require.NotEmpty(t, authToken.RefreshToken)
+			require.Len(t, sessions, 1)
+			devices, err := s.ListTrustedDevices(ctx, user.PublicID)
+			require.NoError(t, err)
+			require.Len(t, devices, 1)
+			require.NotNil(t, devices[0].LastUsedAt)
+		})
+	}
+}
+
+// trustTestDevice remembers a device of the user and returns its token.
+func trustTestDevice(t *testing.T, s *UserService, user *model.User) string {
+	t.Helper()
+	token, _, err := s.trustDevice(context.Background(), user)
+	require.NoError(t, err)
+	return token
+}
+
+func TestAuthTwoFARemembersDevice(t *testing.T) {
+	s := newTestUserService(t)
+	ctx := context.Background()
+	user := newTestUser(t, s)
+	secret, _ := enrollTestOtp(t, s, user)
+
+	pending, err := s.Auth(ctx, user.Email, testPassword, "")
+	require.NoError(t, err)
+	require.True(t, pending.TwoFARequired)
+	authToken, err := s.AuthTwoFA(ctx, parseToken(t, s, pending.AuthToken), otpCode(t, secret), true)
+	require.NoError(t, err)
+	require.NotEmpty(t, authToken.DeviceToken)
+	require.Contains(t, auditTrail(t, s, user), model.AuditDeviceTrusted)
+
+	// the next login from the device goes without the otp
+	authToken, err = s.Auth(ctx, user.Email, testPassword, authToken.DeviceToken)
+	require.NoError(t, err)
+	require.False(t, authToken.TwoFARequired)
+	require.NotEmpty(t, authToken.RefreshToken)
+}
+
+func TestRevokeTrustedDevice(t *testing.T) {
+	s := newTestUserService(t)
+	ctx := context.Background()
+	user := newTestUser(t, s)
+	enrollTestOtp(t, s, user)
+	token, device, err := s.trustDevice(ctx, user)
+	require.NoError(t, err)
+	stranger := newTestUser(t, s)
+
+	err = s.RevokeTrustedDevice(ctx, user.PublicID, "not a uuid")
+	require.True(t, errz.NotFoundErr.Is(err), err)
+	err = s.RevokeTrustedDevice(ctx, user.PublicID, uuid.New().String())
+	require.True(t, errz.NotFoundErr.Is(err), err)
+	err = s.RevokeTrustedDevice(ctx, stranger.PublicID, device.PublicID)
+	require.True(t, errz.NotFoundErr.Is(err), err)
+
+	require.NoError(t, s.RevokeTrustedDevice(ctx, user.PublicID, device.PublicID))
+	require.Contains(t, auditTrail(t, s, user), model.AuditDeviceRevoked)
+	trusted, err := s.isTrustedDevice(ctx, user, token)
+	require.NoError(t, err)
+	require.False(t, trusted)
+	err = s.RevokeTrustedDevice(ctx, user.PublicID, device.PublicID)
+	require.True(t, errz.NotFoundErr.Is(err), err)
+}
+
+func TestDisableOtpForgetsTrustedDevices(t *testing.T) {
+	s := newTestUserService(t)
+	ctx := context.Background()
+	user := newTestUser(t, s)
+	enrollTestOtp(t, s, user)
+	token := trustTestDevice(t, s, user)
+
+	claim := staleClaim(signIn(t, s, user))
+	require.NoError(t, s.DisableOTP(ctx, claim, &model.ReauthProof{CurrentPassword: testPassword}))
+
+	// the device must not skip the authenticator enrolled next
+	devices, err := s.ListTrustedDevices(ctx, user.PublicID)
+	require.NoError(t, err)
+	require.Empty(t, devices)
+	trusted, err := s.isTrustedDevice(ctx, user, token)
+	require.NoError(t, err)
+	require.False(t, trusted)
+}
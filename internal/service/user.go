@@ -2,9 +2,11 @@ package service
 
 import (
 	"context"
+	"fmt"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"github.com/theruziev/oson_auth/internal/converter/message"
 	"github.com/theruziev/oson_auth/internal/db"
 	"github.com/theruziev/oson_auth/internal/event/constants"
@@ -12,53 +14,149 @@ import (
 	"github.com/theruziev/oson_auth/internal/pkg/auth"
 	"github.com/theruziev/oson_auth/internal/pkg/dbx"
 	"github.com/theruziev/oson_auth/internal/pkg/errz"
+	"github.com/theruziev/oson_auth/internal/pkg/lockout"
+	"github.com/theruziev/oson_auth/internal/pkg/passwordpolicy"
 )
 
 type UserService struct {
-	userStore   *db.UserStore
-	authOpt     *auth.AuthOption
-	outboxStore *db.OutBoxStore
-	otp         *auth.Otp
+	userStore    *db.UserStore
+	authOpt      *auth.AuthOption
+	outboxStore  *db.OutBoxStore
+	sessionStore *db.SessionStore
+	apiKeyStore  *db.APIKeyStore
+	roleStore    *db.RoleStore
+	tokenRevoker *TokenRevoker
+	signer       *auth.Signer
+	otp          *auth.Otp
+	hasher       auth.PasswordHasher
+	policy       *passwordpolicy.Policy
+
+	webAuthnStore *db.WebAuthnStore
+	// webAuthn is nil when passkeys are disabled
+	webAuthn *auth.WebAuthn
+
+	magicLinkStore   *db.MagicLinkStore
+	emailChangeStore *db.EmailChangeStore
+	// organizationStore resolves the active organization of sessions
+	organizationStore  *db.OrganizationStore
+	trustedDeviceStore *db.TrustedDeviceStore
+	recoveryCodeStore  *db.RecoveryCodeStore
+
+	limiter *lockout.Limiter
+	audit   *AuditService
+	pool    dbx.Querier // for transaction
 }
 
-func NewUserStore(authOpt *auth.AuthOption, outboxStore *db.OutBoxStore, userStore *db.UserStore, otp *auth.Otp) *UserService {
+func NewUserStore(
+	authOpt *auth.AuthOption,
+	outboxStore *db.OutBoxStore,
+	userStore *db.UserStore,
+	sessionStore *db.SessionStore,
+	apiKeyStore *db.APIKeyStore,
+	roleStore *db.RoleStore,
+	tokenRevoker *TokenRevoker,
+	signer *auth.Signer,
+	otp *auth.Otp,
+	hasher auth.PasswordHasher,
+	policy *passwordpolicy.Policy,
+	webAuthnStore *db.WebAuthnStore,
+	webAuthn *auth.WebAuthn,
+	magicLinkStore *db.MagicLinkStore,
+	emailChangeStore *db.EmailChangeStore,
+	organizationStore *db.OrganizationStore,
+	trustedDeviceStore *db.TrustedDeviceStore,
+	recoveryCodeStore *db.RecoveryCodeStore,
+	limiter *lockout.Limiter,
+	audit *AuditService,
+	pool dbx.Querier,
+) *UserService {
 	return &UserService{
-		authOpt:     authOpt,
-		userStore:   userStore,
-		outboxStore: outboxStore,
-		otp:         otp,
+		authOpt:      authOpt,
+		userStore:    userStore,
+		outboxStore:  outboxStore,
+		sessionStore: sessionStore,
+		apiKeyStore:  apiKeyStore,
+		roleStore:    roleStore,
+		tokenRevoker: tokenRevoker,
+		signer:       signer,
+		otp:          otp,
+		hasher:       hasher,
+		policy:       policy,
+
+		webAuthnStore: webAuthnStore,
+		webAuthn:      webAuthn,
+
+		magicLinkStore:   magicLinkStore,
+		emailChangeStore: emailChangeStore,
+
+		organizationStore:  organizationStore,
+		trustedDeviceStore: trustedDeviceStore,
+		recoveryCodeStore:  recoveryCodeStore,
+
+		limiter: limiter,
+		audit:   audit,
+		pool:    pool,
 	}
 }
 
+// inTx runs fn in a transaction, the stores pick it up from the context.
+func (s *UserService) inTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return pgx.BeginFunc(ctx, dbx.GetConnOrTx(ctx, s.pool), func(tx pgx.Tx) error {
+		return fn(dbx.WithContext(ctx, tx))
+	})
+}
+
 func (s *UserService) Register(ctx context.Context, req *model.RegisterRequest) (*model.User, error) {
-	user := &model.User{
-		PublicID:       uuid.New().String(),
-		ActivationCode: uuid.New().String(),
-		Email:          req.Email,
-		FirstName:      req.FirstName,
-		LastName:       req.LastName,
-		Status:         model.UserStatusRegistered,
-		CreatedAt:      time.Now(),
-		UpdatedAt:      time.Now(),
+	user, err := s.newUser(req)
+	if err != nil {
+		return nil, err
 	}
+	user.ActivationCode = uuid.New().String()
+	user.Status = model.UserStatusRegistered
 
-	if err := user.SetPassword(req.Password); err != nil {
+	if err := s.insertUser(ctx, user); err != nil {
 		return nil, err
 	}
 
-	if err := s.userStore.Insert(ctx, user); err != nil {
-		if dbx.IsDuplicateErr(err) {
-			return nil, errz.ConflictErr.Wrap(err)
-		}
+	if err := s.sendEventNewUser(ctx, user); err != nil {
 		return nil, err
 	}
+	return user, nil
+}
 
-	if err := s.sendEventNewUser(ctx, user); err != nil {
+// newUser checks the password against the policy and builds the user, the caller sets the status.
+func (s *UserService) newUser(req *model.RegisterRequest) (*model.User, error) {
+	user := &model.User{
+		PublicID:  uuid.New().String(),
+		Email:     req.Email,
+		FirstName: req.FirstName,
+		LastName:  req.LastName,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+	user.PasswordChangedAt = &user.CreatedAt
+
+	if err := s.policy.Validate(req.Password, user.Email, user.FirstName, user.LastName); err != nil {
+		return nil, err
+	}
+	hashed, err := s.hasher.Hash(req.Password)
+	if err != nil {
 		return nil, err
 	}
+	user.Password = hashed
 	return user, nil
 }
 
+func (s *UserService) insertUser(ctx context.Context, user *model.User) error {
+	if err := s.userStore.Insert(ctx, user); err != nil {
+		if dbx.IsDuplicateErr(err) {
+			return errz.ConflictErr.Wrap(err)
+		}
+		return err
+	}
+	return nil
+}
+
 func (s *UserService) sendEventNewUser(ctx context.Context, user *model.User) error {
 	userEvent := message.ToUserEvent(user)
 
@@ -89,23 +187,14 @@ func (s *UserService) Activate(ctx context.Context, activationCode string) error
 	if err != nil {
 		return err
 	}
-	if err := s.userStore.Activate(ctx, user.PublicID); err != nil {
-		return err
+	// the link only activates new users, it doesn't lift a suspension or a lock
+	if user.Status != model.UserStatusRegistered {
+		return errz.BadRequestErr.New("user is not waiting for activation")
 	}
-
-	user, err = s.GetByID(ctx, user.PublicID)
-	if err != nil {
-		return err
-	}
-	userEvent := message.ToUserEvent(user)
-	if err := s.outboxStore.Add(ctx, &model.OutBox{
-		Topic:     constants.TopicUserChanged,
-		Data:      userEvent,
-		Status:    model.CreatedStatus,
-		CreatedAt: time.Now(),
-	}); err != nil {
+	if err := s.changeStatus(ctx, user, model.UserStatusActivate, "", nil); err != nil {
 		return err
 	}
+	s.audit.Record(ctx, user, model.AuditUserActivated, nil)
 	return nil
 }
 
@@ -114,6 +203,9 @@ func (s *UserService) ResetPasswordRequest(ctx context.Context, email string) er
 	if err != nil {
 		return err
 	}
+	if user.Status != model.UserStatusActivate {
+		return fmt.Errorf("user not active")
+	}
 
 	resetCode := uuid.New().String()
 	if err := s.userStore.ResetPasswordRequest(ctx, user.PublicID, resetCode); err != nil {
@@ -143,25 +235,100 @@ func (s *UserService) GetByResetPassword(ctx context.Context, resetCode string)
 		}
 		return nil, err
 	}
+	if user.Status != model.UserStatusActivate {
+		return nil, errz.NotFoundErr.New("user not active")
+	}
 	return user, nil
 }
 
 func (s *UserService) ResetPassword(ctx context.Context, resetCode, password string) error {
 	user, err := s.userStore.GetByResetPassword(ctx, resetCode)
 	if err != nil {
+		if dbx.IsErrNoRows(err) {
+			return errz.NotFoundErr.Wrap(err)
+		}
 		return err
 	}
-	if err := s.userStore.ChangePassword(ctx, user.PublicID, password); err != nil {
+	if user.Status != model.UserStatusActivate {
+		return fmt.Errorf("user not active")
+	}
+	// the code goes with the new password, a password rejected by the policy leaves the link working
+	err = s.inTx(ctx, func(ctx context.Context) error {
+		isFirstUse, err := s.userStore.UseResetPasswordCode(ctx, user.PublicID, resetCode)
+		if err != nil {
+			return err
+		}
+		if !isFirstUse {
+			return errz.NotFoundErr.New("reset code has already been used")
+		}
+		return s.setPassword(ctx, user, password)
+	})
+	if err != nil {
 		return err
 	}
-	return nil
+	s.audit.Record(ctx, user, model.AuditPasswordReset, nil)
+	return s.revokeAllSessions(ctx, user)
+}
+
+// ChangePassword sets a new password, the user has to prove it is them with a recent login or the proof.
+func (s *UserService) ChangePassword(ctx context.Context, claim *auth.Claim, password string, proof *model.ReauthProof) error {
+	user, err := s.userStore.Get(ctx, claim.PublicID)
+	if err != nil {
+		return err
+	}
+	if err := s.verifyReauth(ctx, claim, user, proof); err != nil {
+		return err
+	}
+	if err := s.setPassword(ctx, user, password); err != nil {
+		return err
+	}
+	s.audit.Record(ctx, user, model.AuditPasswordChanged, nil)
+	return s.revokeAllSessions(ctx, user)
 }
 
-func (s *UserService) ChangePassword(ctx context.Context, userID, password string) error {
-	err := s.userStore.ChangePassword(ctx, userID, password)
+// setPassword checks the new password against the policy and the recent passwords before it is stored.
+func (s *UserService) setPassword(ctx context.Context, user *model.User, password string) error {
+	if err := s.policy.Validate(password, user.Email, user.FirstName, user.LastName); err != nil {
+		return err
+	}
+	if err := s.checkPasswordReuse(ctx, user, password); err != nil {
+		return err
+	}
+	hashed, err := s.hasher.Hash(password)
 	if err != nil {
 		return err
 	}
+	return s.userStore.ChangePassword(ctx, user.PublicID, hashed)
+}
+
+// checkPasswordReuse rejects the current password and the previous ones kept by the policy.
+func (s *UserService) checkPasswordReuse(ctx context.Context, user *model.User, password string) error {
+	historySize := s.authOpt.PasswordPolicy.History
+	if historySize <= 0 {
+		return nil
+	}
+	hashes := []string{user.Password}
+	if historySize > 1 {
+		history, err := s.userStore.ListPasswordHistory(ctx, user.ID, uint64(historySize-1))
+		if err != nil {
+			return err
+		}
+		hashes = append(hashes, history...)
+	}
+
+	for _, hash := range hashes {
+		ok, _, err := s.hasher.Verify(password, hash)
+		if err != nil {
+			// hashes of formats that are no longer supported can't match
+			continue
+		}
+		if ok {
+			return &passwordpolicy.ViolationError{Violations: []passwordpolicy.Violation{{
+				Code:    passwordpolicy.CodeReused,
+				Message: fmt.Sprintf("password must differ from the last %d passwords", historySize),
+			}}}
+		}
+	}
 	return nil
 }
 
@@ -0,0 +1,325 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/theruziev/oson_auth/internal/model"
+	"github.com/theruziev/oson_auth/internal/pkg/auth"
+	"github.com/theruziev/oson_auth/internal/pkg/dbx"
+	"github.com/theruziev/oson_auth/internal/pkg/errz"
+	"github.com/theruziev/oson_auth/internal/pkg/jsonx"
+)
+
+func (s *UserService) BeginWebAuthnRegistration(ctx context.Context, publicID string) (*protocol.CredentialCreation, error) {
+	if s.webAuthn == nil {
+		return nil, fmt.Errorf("passkeys are disabled")
+	}
+	user, err := s.userStore.Get(ctx, publicID)
+	if err != nil {
+		return nil, err
+	}
+	webAuthnUser, _, err := s.webAuthnUser(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+
+	options, sessionData, err := s.webAuthn.BeginRegistration(webAuthnUser)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.saveWebAuthnSession(ctx, model.WebAuthnCeremonyRegistration, user.ID, sessionData); err != nil {
+		return nil, err
+	}
+	return options, nil
+}
+
+func (s *UserService) FinishWebAuthnRegistration(ctx context.Context, publicID, name string, response []byte) (*model.WebAuthnCredential, error) {
+	if s.webAuthn == nil {
+		return nil, fmt.Errorf("passkeys are disabled")
+	}
+	parsed, err := auth.ParseWebAuthnCreation(response)
+	if err != nil {
+		return nil, errz.BadRequestErr.Wrap(err)
+	}
+	user, err := s.userStore.Get(ctx, publicID)
+	if err != nil {
+		return nil, err
+	}
+	sessionData, err := s.takeWebAuthnSession(ctx, parsed.Response.CollectedClientData.Challenge, model.WebAuthnCeremonyRegistration, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	webAuthnUser, _, err := s.webAuthnUser(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+
+	credential, err := s.webAuthn.FinishRegistration(webAuthnUser, sessionData, parsed)
+	if err != nil {
+		return nil, errz.BadRequestErr.Wrap(err)
+	}
+
+	transports := make([]string, 0, len(credential.Transport))
+	for _, transport := range credential.Transport {
+		transports = append(transports, string(transport))
+	}
+	webAuthnCredential := &model.WebAuthnCredential{
+		UserID:          user.ID,
+		CredentialID:    credential.ID,
+		PublicKey:       credential.PublicKey,
+		AttestationType: credential.AttestationType,
+		Transports:      transports,
+		AAGUID:          credential.Authenticator.AAGUID,
+		SignCount:       credential.Authenticator.SignCount,
+		BackupEligible:  credential.Flags.BackupEligible,
+		BackupState:     credential.Flags.BackupState,
+		Name:            name,
+		CreatedAt:       time.Now(),
+	}
+	if err := s.webAuthnStore.InsertCredential(ctx, webAuthnCredential); err != nil {
+		if dbx.IsDuplicateErr(err) {
+			return nil, errz.ConflictErr.Wrap(err)
+		}
+		return nil, err
+	}
+	return webAuthnCredential, nil
+}
+
+func (s *UserService) ListWebAuthnCredentials(ctx context.Context, publicID string) ([]*model.WebAuthnCredential, error) {
+	user, err := s.userStore.Get(ctx, publicID)
+	if err != nil {
+		return nil, err
+	}
+	return s.webAuthnStore.ListCredentials(ctx, user.ID)
+}
+
+func (s *UserService) DeleteWebAuthnCredential(ctx context.Context, publicID string, id uint64) error {
+	user, err := s.userStore.Get(ctx, publicID)
+	if err != nil {
+		return err
+	}
+	if err := s.webAuthnStore.DeleteCredential(ctx, user.ID, id); err != nil {
+		return errz.NotFoundErr.Wrap(err)
+	}
+	return nil
+}
+
+// BeginAuthTwoFAWebAuthn starts a passkey ceremony for the user who already passed the password check.
+func (s *UserService) BeginAuthTwoFAWebAuthn(ctx context.Context, claim *auth.Claim) (*protocol.CredentialAssertion, error) {
+	if s.webAuthn == nil {
+		return nil, fmt.Errorf("passkeys are disabled")
+	}
+	user, err := s.GetByUsername(ctx, claim.Email)
+	if err != nil {
+		return nil, err
+	}
+	if user.Status != model.UserStatusActivate {
+		return nil, fmt.Errorf("user not active")
+	}
+	webAuthnUser, _, err := s.webAuthnUser(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+
+	options, sessionData, err := s.webAuthn.BeginLogin(webAuthnUser)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.saveWebAuthnSession(ctx, model.WebAuthnCeremonyTwoFA, user.ID, sessionData); err != nil {
+		return nil, err
+	}
+	return options, nil
+}
+
+func (s *UserService) AuthTwoFAWebAuthn(ctx context.Context, claim *auth.Claim, response []byte) (*model.AuthToken, error) {
+	if s.webAuthn == nil {
+		return nil, fmt.Errorf("passkeys are disabled")
+	}
+	parsed, err := auth.ParseWebAuthnAssertion(response)
+	if err != nil {
+		return nil, err
+	}
+	user, err := s.GetByUsername(ctx, claim.Email)
+	if err != nil {
+		return nil, err
+	}
+	if user.Status != model.UserStatusActivate {
+		return nil, fmt.Errorf("user not active")
+	}
+	sessionData, err := s.takeWebAuthnSession(ctx, parsed.Response.CollectedClientData.Challenge, model.WebAuthnCeremonyTwoFA, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	webAuthnUser, credentials, err := s.webAuthnUser(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+
+	credential, err := s.webAuthn.FinishLogin(webAuthnUser, sessionData, parsed)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.touchWebAuthnCredential(ctx, credentials, credential); err != nil {
+		return nil, err
+	}
+	s.audit.Record(ctx, user, model.AuditTwoFASucceeded, auditMethod("webauthn"))
+
+	return s.startSession(ctx, user)
+}
+
+// BeginPasskeyLogin starts a passwordless login, the user is picked on the authenticator.
+func (s *UserService) BeginPasskeyLogin(ctx context.Context) (*protocol.CredentialAssertion, error) {
+	if s.webAuthn == nil {
+		return nil, fmt.Errorf("passkeys are disabled")
+	}
+	if err := s.webAuthnStore.DeleteExpiredSessions(ctx, time.Now()); err != nil {
+		return nil, err
+	}
+
+	options, sessionData, err := s.webAuthn.BeginPasswordlessLogin()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.saveWebAuthnSession(ctx, model.WebAuthnCeremonyPasswordless, 0, sessionData); err != nil {
+		return nil, err
+	}
+	return options, nil
+}
+
+// AuthPasskey signs the user in with a passkey alone. The authenticator has verified the user,
+// so the passkey counts as both factors and no 2FA step follows.
+func (s *UserService) AuthPasskey(ctx context.Context, response []byte) (*model.AuthToken, error) {
+	if s.webAuthn == nil {
+		return nil, fmt.Errorf("passkeys are disabled")
+	}
+	parsed, err := auth.ParseWebAuthnAssertion(response)
+	if err != nil {
+		return nil, err
+	}
+	sessionData, err := s.takeWebAuthnSession(ctx, parsed.Response.CollectedClientData.Challenge, model.WebAuthnCeremonyPasswordless, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		user        *model.User
+		credentials []*model.WebAuthnCredential
+	)
+	findUser := func(userHandle []byte) (*auth.WebAuthnUser, error) {
+		var webAuthnUser *auth.WebAuthnUser
+		user, err = s.userStore.Get(ctx, string(userHandle))
+		if err != nil {
+			return nil, err
+		}
+		webAuthnUser, credentials, err = s.webAuthnUser(ctx, user)
+		return webAuthnUser, err
+	}
+	credential, err := s.webAuthn.FinishPasswordlessLogin(findUser, sessionData, parsed)
+	if err != nil {
+		return nil, err
+	}
+	if user.Status != model.UserStatusActivate {
+		return nil, fmt.Errorf("user not active")
+	}
+	if err := s.touchWebAuthnCredential(ctx, credentials, credential); err != nil {
+		return nil, err
+	}
+	s.audit.Record(ctx, user, model.AuditLoginSucceeded, auditMethod("passkey"))
+
+	return s.startSession(ctx, user)
+}
+
+// webAuthnUser maps the user and the stored passkeys to the account the ceremonies work with.
+// The public id is the user handle, so no personal data ends up on the authenticator.
+func (s *UserService) webAuthnUser(ctx context.Context, user *model.User) (*auth.WebAuthnUser, []*model.WebAuthnCredential, error) {
+	credentials, err := s.webAuthnStore.ListCredentials(ctx, user.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	webAuthnCredentials := make([]webauthn.Credential, 0, len(credentials))
+	for _, credential := range credentials {
+		transports := make([]protocol.AuthenticatorTransport, 0, len(credential.Transports))
+		for _, transport := range credential.Transports {
+			transports = append(transports, protocol.AuthenticatorTransport(transport))
+		}
+		webAuthnCredentials = append(webAuthnCredentials, webauthn.Credential{
+			ID:              credential.CredentialID,
+			PublicKey:       credential.PublicKey,
+			AttestationType: credential.AttestationType,
+			Transport:       transports,
+			Flags: webauthn.CredentialFlags{
+				BackupEligible: credential.BackupEligible,
+				BackupState:    credential.BackupState,
+			},
+			Authenticator: webauthn.Authenticator{
+				AAGUID:    credential.AAGUID,
+				SignCount: credential.SignCount,
+			},
+		})
+	}
+
+	return &auth.WebAuthnUser{
+		ID:          []byte(user.PublicID),
+		Name:        user.Email,
+		DisplayName: strings.TrimSpace(user.FirstName + " " + user.LastName),
+		Credentials: webAuthnCredentials,
+	}, credentials, nil
+}
+
+func (s *UserService) saveWebAuthnSession(ctx context.Context, ceremony model.WebAuthnCeremony, userID uint64, sessionData *webauthn.SessionData) error {
+	data, err := jsonx.Marshal(sessionData)
+	if err != nil {
+		return err
+	}
+	return s.webAuthnStore.InsertSession(ctx, &model.WebAuthnSession{
+		Challenge: sessionData.Challenge,
+		Ceremony:  ceremony,
+		UserID:    userID,
+		Data:      data,
+		ExpiresAt: sessionData.Expires,
+		CreatedAt: time.Now(),
+	})
+}
+
+// takeWebAuthnSession loads and removes the ceremony started for the challenge.
+func (s *UserService) takeWebAuthnSession(ctx context.Context, challenge string, ceremony model.WebAuthnCeremony, userID uint64) (*webauthn.SessionData, error) {
+	session, err := s.webAuthnStore.TakeSession(ctx, challenge, ceremony)
+	if err != nil {
+		if dbx.IsErrNoRows(err) {
+			return nil, errz.BadRequestErr.New("unknown webauthn challenge")
+		}
+		return nil, err
+	}
+	if session.UserID != userID {
+		return nil, errz.BadRequestErr.New("webauthn challenge was issued to another user")
+	}
+	if time.Now().After(session.ExpiresAt) {
+		return nil, errz.BadRequestErr.New("webauthn challenge expired")
+	}
+
+	var sessionData webauthn.SessionData
+	if err := jsonx.Unmarshal(session.Data, &sessionData); err != nil {
+		return nil, err
+	}
+	return &sessionData, nil
+}
+
+func (s *UserService) touchWebAuthnCredential(ctx context.Context, credentials []*model.WebAuthnCredential, credential *webauthn.Credential) error {
+	now := time.Now()
+	for _, stored := range credentials {
+		if string(stored.CredentialID) != string(credential.ID) {
+			continue
+		}
+		stored.SignCount = credential.Authenticator.SignCount
+		stored.BackupState = credential.Flags.BackupState
+		stored.LastUsedAt = &now
+		return s.webAuthnStore.UpdateCredentialUsage(ctx, stored)
+	}
+	return fmt.Errorf("unknown webauthn credential")
+}
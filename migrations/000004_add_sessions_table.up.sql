@@ -0,0 +1,31 @@
+create table sessions
+(
+	id         bigserial,
+	public_id  uuid,
+	user_id    bigint,
+	created_at timestamp,
+	updated_at timestamp,
+	expires_at timestamp,
+	revoked_at timestamp
+);
+
+create unique index sessions_public_id_uidx
+	on sessions (public_id);
+
+create index sessions_user_id_idx
+	on sessions (user_id);
+
+create table refresh_tokens
+(
+	id         bigserial,
+	session_id bigint,
+	token_hash text,
+	created_at timestamp,
+	used_at    timestamp
+);
+
+create unique index refresh_tokens_token_hash_uidx
+	on refresh_tokens (token_hash);
+
+create index refresh_tokens_session_id_idx
+	on refresh_tokens (session_id);
@@ -0,0 +1,4 @@
+drop table revoked_tokens;
+
+alter table users
+	drop column tokens_valid_after;
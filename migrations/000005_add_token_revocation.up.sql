@@ -0,0 +1,12 @@
+alter table users
+	add column tokens_valid_after timestamp;
+
+create table revoked_tokens
+(
+	jti        text,
+	expires_at timestamp,
+	created_at timestamp
+);
+
+create unique index revoked_tokens_jti_uidx
+	on revoked_tokens (jti);
@@ -0,0 +1,6 @@
+alter table sessions
+	drop column client_id,
+	drop column auth_time;
+
+drop table authorization_codes;
+drop table clients;
@@ -0,0 +1,40 @@
+create table clients
+(
+	id            bigserial,
+	client_id     text,
+	secret_hash   text,
+	name          text,
+	redirect_uris text[],
+	is_public     bool default false,
+	created_at    timestamp,
+	updated_at    timestamp
+);
+
+create unique index clients_client_id_uidx
+	on clients (client_id);
+
+create table authorization_codes
+(
+	id                    bigserial,
+	code_hash             text,
+	client_id             text,
+	user_id               bigint,
+	redirect_uri          text,
+	scope                 text,
+	nonce                 text,
+	code_challenge        text,
+	code_challenge_method text,
+	auth_time             timestamp,
+	session_id            bigint,
+	expires_at            timestamp,
+	used_at               timestamp,
+	created_at            timestamp
+);
+
+create unique index authorization_codes_code_hash_uidx
+	on authorization_codes (code_hash);
+
+-- sessions opened before the column read their created_at as auth_time
+alter table sessions
+	add column client_id text,
+	add column auth_time timestamp;
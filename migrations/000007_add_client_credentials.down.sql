@@ -0,0 +1,4 @@
+alter table clients
+	drop column grant_types,
+	drop column scopes,
+	drop column secret_rotated_at;
@@ -0,0 +1,4 @@
+alter table clients
+	add column grant_types text[] default '{authorization_code,refresh_token}',
+	add column scopes text[] default '{}',
+	add column secret_rotated_at timestamp;
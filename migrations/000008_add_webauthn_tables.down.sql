@@ -0,0 +1,2 @@
+drop table webauthn_sessions;
+drop table webauthn_credentials;
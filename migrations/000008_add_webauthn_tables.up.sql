@@ -0,0 +1,36 @@
+create table webauthn_credentials
+(
+	id               bigserial,
+	user_id          bigint,
+	credential_id    bytea,
+	public_key       bytea,
+	attestation_type text,
+	transports       text[],
+	aaguid           bytea,
+	sign_count       bigint default 0,
+	backup_eligible  bool default false,
+	backup_state     bool default false,
+	name             text,
+	created_at       timestamp,
+	last_used_at     timestamp
+);
+
+create unique index webauthn_credentials_credential_id_uidx
+	on webauthn_credentials (credential_id);
+
+create index webauthn_credentials_user_id_idx
+	on webauthn_credentials (user_id);
+
+create table webauthn_sessions
+(
+	id         bigserial,
+	challenge  text,
+	ceremony   text,
+	user_id    bigint,
+	data       jsonb,
+	expires_at timestamp,
+	created_at timestamp
+);
+
+create unique index webauthn_sessions_challenge_uidx
+	on webauthn_sessions (challenge);
@@ -0,0 +1 @@
+drop table magic_links;
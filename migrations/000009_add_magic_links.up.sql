@@ -0,0 +1,12 @@
+create table magic_links
+(
+	id         bigserial,
+	token_hash text,
+	user_id    bigint,
+	expires_at timestamp,
+	used_at    timestamp,
+	created_at timestamp
+);
+
+create unique index magic_links_token_hash_uidx
+	on magic_links (token_hash);
@@ -0,0 +1,23 @@
+create table api_keys
+(
+	id           bigserial,
+	public_id    uuid,
+	user_id      bigint,
+	name         text,
+	token_hash   text,
+	prefix       text,
+	scopes       text[] default '{}',
+	expires_at   timestamp,
+	last_used_at timestamp,
+	revoked_at   timestamp,
+	created_at   timestamp
+);
+
+create unique index api_keys_public_id_uidx
+	on api_keys (public_id);
+
+create unique index api_keys_token_hash_uidx
+	on api_keys (token_hash);
+
+create index api_keys_user_id_idx
+	on api_keys (user_id);
@@ -0,0 +1,11 @@
+create table login_attempts
+(
+	id              bigserial,
+	subject         text,
+	failures        int not null default 0,
+	last_failure_at timestamp,
+	locked_until    timestamp
+);
+
+create unique index login_attempts_subject_uidx
+	on login_attempts (subject);
@@ -0,0 +1,4 @@
+drop table password_history;
+
+alter table users
+	drop column password_changed_at;
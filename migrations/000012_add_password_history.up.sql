@@ -0,0 +1,16 @@
+alter table users
+	add column password_changed_at timestamp;
+
+update users
+set password_changed_at = created_at;
+
+create table password_history
+(
+	id         bigserial,
+	user_id    bigint,
+	password   text,
+	created_at timestamp
+);
+
+create index password_history_user_id_idx
+	on password_history (user_id);
@@ -0,0 +1 @@
+drop table email_changes;
@@ -0,0 +1,16 @@
+create table email_changes
+(
+	id         bigserial,
+	token_hash text,
+	user_id    bigint,
+	new_email  text,
+	expires_at timestamp,
+	used_at    timestamp,
+	created_at timestamp
+);
+
+create unique index email_changes_token_hash_uidx
+	on email_changes (token_hash);
+
+create index email_changes_user_id_idx
+	on email_changes (user_id);
@@ -0,0 +1,5 @@
+alter table users
+	add column deleted_at timestamp;
+
+create index users_deleted_at_idx
+	on users (deleted_at);
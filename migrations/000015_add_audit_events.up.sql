@@ -0,0 +1,17 @@
+create table audit_events
+(
+	id         bigserial,
+	user_id    bigint,
+	type       text,
+	ip         text,
+	user_agent text,
+	request_id text,
+	metadata   jsonb,
+	created_at timestamp
+);
+
+create index audit_events_user_id_idx
+	on audit_events (user_id);
+
+create index audit_events_created_at_type_idx
+	on audit_events (created_at, type);
@@ -0,0 +1,2 @@
+alter table users
+	add column is_admin bool default false;
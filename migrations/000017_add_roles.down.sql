@@ -0,0 +1,14 @@
+alter table users
+	add column is_admin bool default false;
+
+update users
+set is_admin = true
+where id in (select ur.user_id
+             from user_roles ur
+                      join roles r on r.id = ur.role_id
+             where r.name = 'admin');
+
+drop table user_roles;
+drop table role_permissions;
+drop table permissions;
+drop table roles;
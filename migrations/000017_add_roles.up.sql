@@ -0,0 +1,70 @@
+create table roles
+(
+	id          bigserial,
+	name        text,
+	description text,
+	created_at  timestamp
+);
+
+create unique index roles_name_uidx
+	on roles (name);
+
+create table permissions
+(
+	name        text,
+	description text
+);
+
+create unique index permissions_name_uidx
+	on permissions (name);
+
+create table role_permissions
+(
+	role_id    bigint,
+	permission text
+);
+
+create unique index role_permissions_role_id_permission_uidx
+	on role_permissions (role_id, permission);
+
+create table user_roles
+(
+	user_id    bigint,
+	role_id    bigint,
+	created_at timestamp
+);
+
+create unique index user_roles_user_id_role_id_uidx
+	on user_roles (user_id, role_id);
+
+create index user_roles_role_id_idx
+	on user_roles (role_id);
+
+insert into permissions (name, description)
+values ('users:manage', 'View and manage the accounts of users in the admin api'),
+       ('roles:manage', 'Grant and revoke roles'),
+       ('audit:read', 'Read the audit log of every user'),
+       ('content:moderate', 'Moderate the content of every user');
+
+insert into roles (name, description, created_at)
+values ('admin', 'Full access to the admin api', now()),
+       ('support', 'Helps users with their accounts', now()),
+       ('moderator', 'Moderates content', now());
+
+insert into role_permissions (role_id, permission)
+select r.id, p.name
+from roles r,
+     permissions p
+where r.name = 'admin'
+   or (r.name = 'support' and p.name in ('users:manage', 'audit:read'))
+   or (r.name = 'moderator' and p.name = 'content:moderate');
+
+insert into user_roles (user_id, role_id, created_at)
+select u.id, r.id, now()
+from users u,
+     roles r
+where u.is_admin
+  and r.name = 'admin';
+
+alter table users
+	drop column is_admin;
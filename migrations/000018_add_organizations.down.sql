@@ -0,0 +1,6 @@
+alter table sessions
+	drop column organization_id;
+
+drop table organization_invites;
+drop table memberships;
+drop table organizations;
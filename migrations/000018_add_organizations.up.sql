@@ -0,0 +1,54 @@
+create table organizations
+(
+	id         bigserial,
+	public_id  uuid,
+	name       text,
+	created_at timestamp,
+	updated_at timestamp
+);
+
+create unique index organizations_public_id_uidx
+	on organizations (public_id);
+
+create table memberships
+(
+	id              bigserial,
+	organization_id bigint,
+	user_id         bigint,
+	role            text,
+	created_at      timestamp,
+	updated_at      timestamp
+);
+
+create unique index memberships_organization_id_user_id_uidx
+	on memberships (organization_id, user_id);
+
+create index memberships_user_id_idx
+	on memberships (user_id);
+
+create table organization_invites
+(
+	id              bigserial,
+	public_id       uuid,
+	organization_id bigint,
+	email           text,
+	role            text,
+	token_hash      text,
+	invited_by      bigint,
+	expires_at      timestamp,
+	accepted_at     timestamp,
+	revoked_at      timestamp,
+	created_at      timestamp
+);
+
+create unique index organization_invites_public_id_uidx
+	on organization_invites (public_id);
+
+create unique index organization_invites_token_hash_uidx
+	on organization_invites (token_hash);
+
+create index organization_invites_organization_id_idx
+	on organization_invites (organization_id);
+
+alter table sessions
+	add column organization_id bigint;
@@ -0,0 +1,3 @@
+alter table users
+	drop column status_reason,
+	drop column status_changed_at;
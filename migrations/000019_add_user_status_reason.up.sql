@@ -0,0 +1,7 @@
+alter table users
+	add column status_reason     text,
+	add column status_changed_at timestamp;
+
+update users
+set status_changed_at = deleted_at
+where deleted_at is not null;
@@ -0,0 +1 @@
+drop table trusted_devices;
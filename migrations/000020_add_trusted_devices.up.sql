@@ -0,0 +1,22 @@
+create table trusted_devices
+(
+	id           bigserial,
+	public_id    uuid,
+	user_id      bigint,
+	token_hash   text,
+	ip           text,
+	user_agent   text,
+	expires_at   timestamp,
+	last_used_at timestamp,
+	revoked_at   timestamp,
+	created_at   timestamp
+);
+
+create unique index trusted_devices_public_id_uidx
+	on trusted_devices (public_id);
+
+create unique index trusted_devices_token_hash_uidx
+	on trusted_devices (token_hash);
+
+create index trusted_devices_user_id_idx
+	on trusted_devices (user_id);
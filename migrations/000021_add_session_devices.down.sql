@@ -0,0 +1,4 @@
+alter table sessions
+	drop column ip,
+	drop column user_agent,
+	drop column last_seen_at;
@@ -0,0 +1,7 @@
+alter table sessions
+	add column ip           text,
+	add column user_agent   text,
+	add column last_seen_at timestamp;
+
+update sessions
+set last_seen_at = updated_at;
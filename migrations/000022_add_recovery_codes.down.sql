@@ -0,0 +1,5 @@
+-- the codes can't be recovered from the hashes, users have to enroll otp again to get new ones
+alter table users
+	add column otp_recovery_codes int[];
+
+drop table recovery_codes;
@@ -0,0 +1,20 @@
+create table recovery_codes
+(
+	id         bigserial,
+	user_id    bigint,
+	code_hash  text,
+	used_at    timestamp,
+	created_at timestamp
+);
+
+create index recovery_codes_user_id_idx
+	on recovery_codes (user_id);
+
+-- the codes kept in plain text are hashed the same way as the new ones, they keep working
+insert into recovery_codes (user_id, code_hash, created_at)
+select u.id, encode(sha256(convert_to(code::text, 'UTF8')), 'hex'), now()
+from users u,
+	unnest(u.otp_recovery_codes) code;
+
+alter table users
+	drop column otp_recovery_codes;
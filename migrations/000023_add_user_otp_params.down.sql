@@ -0,0 +1,5 @@
+alter table users
+	drop column otp_algorithm,
+	drop column otp_digits,
+	drop column otp_period,
+	drop column otp_last_step;
@@ -0,0 +1,12 @@
+alter table users
+	add column otp_algorithm text,
+	add column otp_digits    integer,
+	add column otp_period    integer,
+	add column otp_last_step bigint;
+
+-- the secrets enrolled so far were generated with the parameters that used to be hardcoded
+update users
+set otp_algorithm = 'SHA512',
+	otp_digits    = 6,
+	otp_period    = 30
+where otp_secret <> '';
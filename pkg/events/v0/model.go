@@ -9,6 +9,9 @@ type UserStatus string
 const (
 	UserStatusActivate   UserStatus = "activated"
 	UserStatusRegistered UserStatus = "registered"
+	UserStatusDeleted    UserStatus = "deleted"
+	UserStatusSuspended  UserStatus = "suspended"
+	UserStatusLocked     UserStatus = "locked"
 )
 
 type UserRegisteredEvent struct {
@@ -23,8 +26,11 @@ type UserEvent struct {
 	FirstName string     `json:"first_name"`
 	LastName  string     `json:"last_name"`
 	Status    UserStatus `json:"status"`
-	CreatedAt time.Time  `json:"created_at"`
-	UpdatedAt time.Time  `json:"updated_at"`
+	// StatusReason tells why the user was suspended or locked, it is empty for the other statuses.
+	StatusReason    string     `json:"status_reason,omitempty"`
+	StatusChangedAt *time.Time `json:"status_changed_at,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
 }
 
 type UserResetPasswordEvent struct {
@@ -32,3 +38,86 @@ type UserResetPasswordEvent struct {
 	Email             string `json:"email"`
 	ResetPasswordCode string `json:"reset_password_code"`
 }
+
+type UserMagicLinkEvent struct {
+	PublicID  string    `json:"public_id"`
+	Email     string    `json:"email"`
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// UserEmailChangeEvent asks the new address of the user to confirm the change of the email.
+type UserEmailChangeEvent struct {
+	PublicID  string    `json:"public_id"`
+	Email     string    `json:"email"`
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// UserEmailChangingEvent notifies the current address of the user that a change of the email was requested.
+type UserEmailChangingEvent struct {
+	PublicID string `json:"public_id"`
+	Email    string `json:"email"`
+	NewEmail string `json:"new_email"`
+}
+
+// UserDeletedEvent is sent when the user deletes the account. Consumers have to erase
+// their copies of the user data by PurgeAt, when it is erased here.
+type UserDeletedEvent struct {
+	PublicID  string    `json:"public_id"`
+	DeletedAt time.Time `json:"deleted_at"`
+	PurgeAt   time.Time `json:"purge_at"`
+}
+
+type AdminAction string
+
+const (
+	AdminActionActivate       AdminAction = "activate"
+	AdminActionResetPassword  AdminAction = "reset_password"
+	AdminActionDisable        AdminAction = "disable"
+	AdminActionEnable         AdminAction = "enable"
+	AdminActionLock           AdminAction = "lock"
+	AdminActionResetTwoFA     AdminAction = "reset_2fa"
+	AdminActionRevokeSessions AdminAction = "revoke_sessions"
+	AdminActionGrantRole      AdminAction = "grant_role"
+	AdminActionRevokeRole     AdminAction = "revoke_role"
+)
+
+// UserAdminActionEvent is sent when support staff changes the account of the user.
+type UserAdminActionEvent struct {
+	PublicID      string      `json:"public_id"`
+	Action        AdminAction `json:"action"`
+	ActorPublicID string      `json:"actor_public_id"`
+	// Role is set for the role actions.
+	Role string `json:"role,omitempty"`
+	// Reason is set for the actions that suspend or lock the user.
+	Reason    string    `json:"reason,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type OrganizationEvent struct {
+	PublicID  string    `json:"public_id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// MembershipEvent is sent when a user joins or leaves an organization or gets another role in it.
+type MembershipEvent struct {
+	OrganizationID string    `json:"organization_id"`
+	UserPublicID   string    `json:"user_public_id"`
+	Role           string    `json:"role"`
+	Removed        bool      `json:"removed"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// OrganizationInviteEvent asks the invited email to join the organization, there may be no account for it yet.
+type OrganizationInviteEvent struct {
+	OrganizationID   string    `json:"organization_id"`
+	OrganizationName string    `json:"organization_name"`
+	Email            string    `json:"email"`
+	Role             string    `json:"role"`
+	InviterName      string    `json:"inviter_name"`
+	Token            string    `json:"token"`
+	ExpiresAt        time.Time `json:"expires_at"`
+}